@@ -0,0 +1,252 @@
+// Package bsondiff computes structural differences between BSON documents,
+// renders them for humans and turns them into update documents.
+//
+//	diff, _ := bsondiff.Compare(before, after, bsondiff.WithIgnoreOrder())
+//	fmt.Print(diff)
+//	// ~ limit: {"$numberInt":"1"} -> {"$numberLong":"1"}
+//	// + comment: "hi"
+//
+//	update, _ := diff.Update() // {$set: {limit: 1, comment: "hi"}}
+package bsondiff
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Kind is the kind of a change.
+type Kind int
+
+const (
+	Added     Kind = iota + 1 // The field only exists in the new document
+	Removed                   // The field only exists in the old document
+	Changed                   // The field has a different type or value
+	Reordered                 // The document has the same fields in a different order
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	case Reordered:
+		return "reordered"
+	}
+
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Change is a single difference between two documents.
+type Change struct {
+	Kind Kind
+	Path []string      // Field names from the root, array indexes as strings
+	Old  bson.RawValue // Zero for Added
+	New  bson.RawValue // Zero for Removed
+}
+
+// Diff is the list of changes between two documents, in the order of the
+// fields of the old document followed by fields only in the new one.
+type Diff []Change
+
+// Equal reports whether the documents had no differences.
+func (d Diff) Equal() bool {
+	return len(d) == 0
+}
+
+// Compare will return the changes that turn a into b.
+func Compare(a, b bson.Raw, opts ...ConfigOpt) (Diff, error) {
+	if err := a.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid old document: %w", err)
+	}
+
+	if err := b.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid new document: %w", err)
+	}
+
+	d := differ{cfg: newConfig(opts...)}
+	d.documents(nil, a, b)
+
+	return d.diff, nil
+}
+
+type differ struct {
+	cfg  Config
+	diff Diff
+}
+
+func (d *differ) add(kind Kind, path []string, oldVal, newVal bson.RawValue) {
+	d.diff = append(d.diff, Change{
+		Kind: kind,
+		Path: append([]string(nil), path...),
+		Old:  oldVal,
+		New:  newVal,
+	})
+}
+
+func (d *differ) documents(path []string, a, b bson.Raw) {
+	aElems, _ := a.Elements()
+	bElems, _ := b.Elements()
+
+	bByKey := make(map[string]bson.RawValue, len(bElems))
+	for _, elem := range bElems {
+		bByKey[elem.Key()] = elem.Value()
+	}
+
+	aKeys := make(map[string]bool, len(aElems))
+
+	var aCommon []string
+
+	for _, elem := range aElems {
+		key := elem.Key()
+		aKeys[key] = true
+
+		bVal, ok := bByKey[key]
+		if !ok {
+			d.add(Removed, append(path, key), elem.Value(), bson.RawValue{})
+
+			continue
+		}
+
+		aCommon = append(aCommon, key)
+		d.values(append(path, key), elem.Value(), bVal)
+	}
+
+	var bCommon []string
+
+	for _, elem := range bElems {
+		if !aKeys[elem.Key()] {
+			d.add(Added, append(path, elem.Key()), bson.RawValue{}, elem.Value())
+
+			continue
+		}
+
+		bCommon = append(bCommon, elem.Key())
+	}
+
+	if !d.cfg.ignoreOrder && !slices.Equal(aCommon, bCommon) {
+		d.add(Reordered, path, documentValue(a), documentValue(b))
+	}
+}
+
+// arrays will compare arrays element by element when they have the same
+// length. Arrays of different lengths are reported as a single change, which
+// is also what an update document has to do to turn one into the other.
+func (d *differ) arrays(path []string, a, b bson.RawValue) {
+	aVals, _ := a.Array().Values()
+	bVals, _ := b.Array().Values()
+
+	if len(aVals) != len(bVals) {
+		d.add(Changed, path, a, b)
+
+		return
+	}
+
+	for i := range aVals {
+		d.values(append(path, strconv.Itoa(i)), aVals[i], bVals[i])
+	}
+}
+
+func (d *differ) values(path []string, a, b bson.RawValue) {
+	if d.cfg.ignoreNumericType {
+		if x, ok := number(a); ok {
+			if y, ok := number(b); ok {
+				if x != y {
+					d.add(Changed, path, a, b)
+				}
+
+				return
+			}
+		}
+	}
+
+	if a.Type != b.Type {
+		d.add(Changed, path, a, b)
+
+		return
+	}
+
+	switch a.Type {
+	case bson.TypeEmbeddedDocument:
+		d.documents(path, a.Document(), b.Document())
+	case bson.TypeArray:
+		d.arrays(path, a, b)
+	default:
+		if !a.Equal(b) {
+			d.add(Changed, path, a, b)
+		}
+	}
+}
+
+// number will return the value of an int32, int64 or double. Integers beyond
+// 2^53 lose precision, which is acceptable for a type-insensitive comparison.
+func number(rv bson.RawValue) (float64, bool) {
+	switch rv.Type {
+	case bson.TypeInt32:
+		return float64(rv.Int32()), true
+	case bson.TypeInt64:
+		return float64(rv.Int64()), true
+	case bson.TypeDouble:
+		if f := rv.Double(); !math.IsNaN(f) {
+			return f, true
+		}
+	}
+
+	return 0, false
+}
+
+func documentValue(doc bson.Raw) bson.RawValue {
+	return bson.RawValue{Type: bson.TypeEmbeddedDocument, Value: doc}
+}
+
+// String will render the diff one change per line. Added and removed fields
+// are prefixed with "+" and "-" and followed by their value, changed fields
+// with "~" and followed by "old -> new", and reordered documents with "~" and
+// followed by their field names before and after, e.g. "~ filter: order [x y]
+// -> [y x]".
+func (d Diff) String() string {
+	var sb strings.Builder
+
+	for _, c := range d {
+		sb.WriteString(c.String())
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+func (c Change) String() string {
+	path := strings.Join(c.Path, ".")
+	if path == "" {
+		path = "(root)"
+	}
+
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s: %v", path, c.New)
+	case Removed:
+		return fmt.Sprintf("- %s: %v", path, c.Old)
+	case Reordered:
+		return fmt.Sprintf("~ %s: order %v -> %v", path, keys(c.Old), keys(c.New))
+	}
+
+	return fmt.Sprintf("~ %s: %v -> %v", path, c.Old, c.New)
+}
+
+func keys(rv bson.RawValue) []string {
+	elems, _ := rv.Document().Elements()
+
+	names := make([]string, len(elems))
+	for i, elem := range elems {
+		names[i] = elem.Key()
+	}
+
+	return names
+}
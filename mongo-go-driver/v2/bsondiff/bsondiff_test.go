@@ -0,0 +1,144 @@
+package bsondiff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func raw(t *testing.T, doc bson.D) bson.Raw {
+	t.Helper()
+
+	b, err := bson.Marshal(doc)
+	require.NoError(t, err)
+
+	return b
+}
+
+func TestCompare(t *testing.T) {
+	a := raw(t, bson.D{
+		{Key: "find", Value: "coll"},
+		{Key: "limit", Value: int32(1)},
+		{Key: "filter", Value: bson.D{{Key: "x", Value: 1}, {Key: "y", Value: 2}}},
+		{Key: "tags", Value: bson.A{"a", "b"}},
+		{Key: "gone", Value: true},
+	})
+	b := raw(t, bson.D{
+		{Key: "find", Value: "coll"},
+		{Key: "limit", Value: int64(1)},
+		{Key: "filter", Value: bson.D{{Key: "y", Value: 2}, {Key: "x", Value: 1}}},
+		{Key: "tags", Value: bson.A{"a", "c"}},
+		{Key: "comment", Value: "hi"},
+	})
+
+	tests := []struct {
+		name string
+		opts []ConfigOpt
+		want string
+	}{
+		{
+			name: "strict",
+			want: `~ limit: {"$numberInt":"1"} -> {"$numberLong":"1"}
+~ filter: order [x y] -> [y x]
+~ tags.1: "b" -> "c"
+- gone: true
++ comment: "hi"
+`,
+		},
+		{
+			name: "ignore order and numeric type",
+			opts: []ConfigOpt{WithIgnoreOrder(), WithIgnoreNumericType()},
+			want: `~ tags.1: "b" -> "c"
+- gone: true
++ comment: "hi"
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff, err := Compare(a, b, test.opts...)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.want, diff.String())
+		})
+	}
+}
+
+func TestCompare_Equal(t *testing.T) {
+	a := raw(t, bson.D{{Key: "x", Value: 1.0}, {Key: "y", Value: bson.D{{Key: "z", Value: int32(2)}}}})
+	b := raw(t, bson.D{{Key: "y", Value: bson.D{{Key: "z", Value: int64(2)}}}, {Key: "x", Value: int32(1)}})
+
+	diff, err := Compare(a, b, WithIgnoreOrder(), WithIgnoreNumericType())
+	require.NoError(t, err)
+	assert.True(t, diff.Equal(), diff.String())
+
+	diff, err = Compare(a, b)
+	require.NoError(t, err)
+	assert.Len(t, diff, 3)
+}
+
+func TestCompare_ArrayLength(t *testing.T) {
+	a := raw(t, bson.D{{Key: "a", Value: bson.A{1}}})
+	b := raw(t, bson.D{{Key: "a", Value: bson.A{1, 2}}})
+
+	diff, err := Compare(a, b)
+	require.NoError(t, err)
+
+	require.Len(t, diff, 1)
+	assert.Equal(t, Changed, diff[0].Kind)
+	assert.Equal(t, []string{"a"}, diff[0].Path)
+}
+
+func TestCompare_Invalid(t *testing.T) {
+	_, err := Compare(bson.Raw{1, 2}, raw(t, bson.D{}))
+	assert.ErrorContains(t, err, "invalid old document")
+}
+
+func TestDiff_Update(t *testing.T) {
+	a := raw(t, bson.D{
+		{Key: "_id", Value: 1},
+		{Key: "name", Value: "a"},
+		{Key: "sub", Value: bson.D{{Key: "x", Value: 1}, {Key: "y", Value: 2}}},
+		{Key: "old", Value: true},
+	})
+	b := raw(t, bson.D{
+		{Key: "_id", Value: 1},
+		{Key: "name", Value: "b"},
+		{Key: "sub", Value: bson.D{{Key: "y", Value: 3}, {Key: "x", Value: 1}}},
+		{Key: "new", Value: bson.A{1}},
+	})
+
+	diff, err := Compare(a, b)
+	require.NoError(t, err)
+
+	update, err := diff.Update()
+	require.NoError(t, err)
+
+	got, err := bson.MarshalExtJSON(update, false, false)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+		"$set": {"name": "b", "new": [1], "sub": {"y": 3, "x": 1}},
+		"$unset": {"old": ""}
+	}`, string(got), "the reordered sub-document is set as a whole, not sub.y as well")
+}
+
+func TestDiff_Update_ID(t *testing.T) {
+	diff, err := Compare(raw(t, bson.D{{Key: "_id", Value: 1}}), raw(t, bson.D{{Key: "_id", Value: 2}}))
+	require.NoError(t, err)
+
+	_, err = diff.Update()
+	assert.ErrorContains(t, err, "_id is immutable")
+}
+
+func TestDiff_Update_Empty(t *testing.T) {
+	diff, err := Compare(raw(t, bson.D{{Key: "a", Value: 1}}), raw(t, bson.D{{Key: "a", Value: 1}}))
+	require.NoError(t, err)
+
+	update, err := diff.Update()
+	require.NoError(t, err)
+	assert.Empty(t, update)
+}
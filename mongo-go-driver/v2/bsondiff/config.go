@@ -0,0 +1,35 @@
+package bsondiff
+
+// Config is the configuration for a diff.
+type Config struct {
+	ignoreOrder       bool // Field order in documents doesn't matter
+	ignoreNumericType bool // int32(1), int64(1) and 1.0 are equal
+}
+
+type ConfigOpt func(*Config)
+
+// WithIgnoreOrder makes documents that only differ in the order of their
+// fields equal. Arrays are always compared by position.
+func WithIgnoreOrder() ConfigOpt {
+	return func(cfg *Config) {
+		cfg.ignoreOrder = true
+	}
+}
+
+// WithIgnoreNumericType makes numbers equal when they have the same value,
+// whether they are stored as an int32, int64 or double.
+func WithIgnoreNumericType() ConfigOpt {
+	return func(cfg *Config) {
+		cfg.ignoreNumericType = true
+	}
+}
+
+func newConfig(opts ...ConfigOpt) Config {
+	cfg := Config{}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return cfg
+}
@@ -0,0 +1,88 @@
+package bsondiff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Update will return an update document, {$set: {...}, $unset: {...}}, that
+// turns the old document into the new one when applied with UpdateOne.
+// Nested documents whose fields were reordered are replaced as a whole;
+// reordering top-level fields can't be expressed with update operators and is
+// ignored. The update is empty when the diff is.
+func (d Diff) Update() (bson.D, error) {
+	var (
+		set, unset bson.D
+		replaced   []string // Paths already set as a whole
+	)
+
+	// A reordered document is reported after the changes to its fields, so
+	// find every replaced document first.
+	for _, c := range d {
+		if c.Kind == Reordered && len(c.Path) > 0 {
+			replaced = append(replaced, strings.Join(c.Path, "."))
+		}
+	}
+
+	for _, c := range d {
+		if err := checkPath(c.Path); err != nil {
+			return nil, err
+		}
+
+		path := strings.Join(c.Path, ".")
+
+		if c.Kind != Reordered && within(path, replaced) {
+			continue
+		}
+
+		switch c.Kind {
+		case Added, Changed, Reordered:
+			if len(c.Path) == 0 {
+				continue
+			}
+
+			set = append(set, bson.E{Key: path, Value: c.New})
+		case Removed:
+			unset = append(unset, bson.E{Key: path, Value: ""})
+		}
+	}
+
+	update := bson.D{}
+	if len(set) > 0 {
+		update = append(update, bson.E{Key: "$set", Value: set})
+	}
+
+	if len(unset) > 0 {
+		update = append(update, bson.E{Key: "$unset", Value: unset})
+	}
+
+	return update, nil
+}
+
+// within reports whether path is inside one of the documents in parents.
+func within(path string, parents []string) bool {
+	for _, parent := range parents {
+		if strings.HasPrefix(path, parent+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func checkPath(path []string) error {
+	if len(path) > 0 && path[0] == "_id" {
+		return errors.New("_id is immutable and can't be changed with an update")
+	}
+
+	for _, field := range path {
+		if strings.Contains(field, ".") || strings.HasPrefix(field, "$") {
+			return fmt.Errorf("field %q can't be addressed in an update path", field)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,258 @@
+// Package changefeed consumes a change stream with at-least-once delivery
+// across restarts of the stream and of the process.
+//
+// After each event is handled, and after each empty batch that advances the
+// stream, the resume token is saved to a TokenStore. When the stream fails
+// with an error the driver doesn't resume from by itself, the Consumer
+// re-opens it from the saved token, so events are only handled again if the
+// process dies between handling one and saving its token.
+//
+// A timed-out getMore leaves a driver change stream unusable, even though the
+// server still holds the events. A stream that times out after handling
+// events is therefore re-opened from the token right away. Otherwise it backs
+// off as after any other error, so that a timeout shorter than maxAwaitTime,
+// which times out every getMore, doesn't re-open the stream in a tight loop.
+package changefeed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Watcher is implemented by *mongo.Collection, *mongo.Database and
+// *mongo.Client.
+type Watcher interface {
+	Watch(ctx context.Context, pipeline any, opts ...options.Lister[options.ChangeStreamOptions]) (*mongo.ChangeStream, error)
+}
+
+// Stats are the progress metrics of a consumer.
+type Stats struct {
+	Events      int64     // Events handled
+	Restarts    int64     // Times the change stream was re-opened
+	ClusterTime time.Time // clusterTime of the last event handled
+
+	// Lag is how far behind the cluster the last event handled was, or zero
+	// once an empty batch shows the consumer has caught up.
+	Lag time.Duration
+}
+
+// Consumer handles the events of a change stream.
+type Consumer struct {
+	target Watcher
+	store  TokenStore
+	cfg    Config
+
+	token bson.Raw // Last token saved, only used by Run
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// New will return a consumer of the change stream of target that keeps its
+// resume token in store.
+func New(target Watcher, store TokenStore, opts ...ConfigOpt) *Consumer {
+	return &Consumer{target: target, store: store, cfg: newConfig(opts...)}
+}
+
+// Stats will return a snapshot of the consumer's metrics.
+func (c *Consumer) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+// Run will call fn with each change event, starting after the token in the
+// store or with new events if there is none, until ctx is done, fn returns an
+// error, saving the token fails or the token can no longer be resumed from.
+// Errors from fn are returned as they are.
+func (c *Consumer) Run(ctx context.Context, fn func(ctx context.Context, event bson.Raw) error) error {
+	token, err := c.store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load resume token: %w", err)
+	}
+
+	c.token = token
+
+	backoff := c.cfg.minBackoff
+
+	for {
+		progressed, err := c.consume(ctx, fn)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var stop stopError
+		if errors.As(err, &stop) {
+			return stop.err
+		}
+
+		if unresumable(err) {
+			return fmt.Errorf("change stream can't be resumed from the saved token: %w", err)
+		}
+
+		c.mu.Lock()
+		c.stats.Restarts++
+		c.mu.Unlock()
+
+		if c.cfg.onRestart != nil {
+			c.cfg.onRestart(err)
+		}
+
+		if progressed {
+			backoff = c.cfg.minBackoff
+
+			if mongo.IsTimeout(err) {
+				continue
+			}
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		backoff = min(2*backoff, c.cfg.maxBackoff)
+	}
+}
+
+// stopError marks errors that end Run instead of re-opening the stream.
+type stopError struct {
+	err error
+}
+
+func (e stopError) Error() string { return e.err.Error() }
+
+// errClosed is returned by consume when the server closed the change stream,
+// e.g. after an invalidate event.
+var errClosed = errors.New("change stream closed by the server")
+
+// consume will handle events from a single change stream until it fails and
+// report whether any event was handled.
+func (c *Consumer) consume(ctx context.Context, fn func(context.Context, bson.Raw) error) (bool, error) {
+	opts := options.ChangeStream().SetMaxAwaitTime(c.cfg.maxAwaitTime)
+
+	if c.cfg.batchSize > 0 {
+		opts.SetBatchSize(c.cfg.batchSize)
+	}
+
+	if c.cfg.fullDocument != "" {
+		opts.SetFullDocument(c.cfg.fullDocument)
+	}
+
+	// startAfter, unlike resumeAfter, also accepts the token of an invalidate
+	// event.
+	if c.token != nil {
+		opts.SetStartAfter(c.token)
+	}
+
+	pipeline := c.cfg.pipeline
+	if pipeline == nil {
+		pipeline = mongo.Pipeline{}
+	}
+
+	stream, err := c.target.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return false, fmt.Errorf("failed to open change stream: %w", err)
+	}
+
+	defer stream.Close(context.WithoutCancel(ctx))
+
+	progressed := false
+
+	for {
+		// TryNext returns after each getMore, so the token and lag are kept
+		// current on a quiet stream.
+		if !stream.TryNext(ctx) {
+			if err := stream.Err(); err != nil {
+				return progressed, fmt.Errorf("change stream failed: %w", err)
+			}
+
+			if stream.ID() == 0 {
+				return progressed, errClosed
+			}
+
+			c.mu.Lock()
+			c.stats.Lag = 0
+			c.mu.Unlock()
+
+			if err := c.save(ctx, stream.ResumeToken()); err != nil {
+				return progressed, stopError{err: err}
+			}
+
+			continue
+		}
+
+		event := append(bson.Raw(nil), stream.Current...)
+
+		if err := fn(ctx, event); err != nil {
+			return progressed, stopError{err: err}
+		}
+
+		progressed = true
+		c.record(event)
+
+		if err := c.save(ctx, stream.ResumeToken()); err != nil {
+			return progressed, stopError{err: err}
+		}
+	}
+}
+
+// save will store the token if it changed since it was last saved.
+func (c *Consumer) save(ctx context.Context, token bson.Raw) error {
+	if token == nil || bytes.Equal(token, c.token) {
+		return nil
+	}
+
+	if err := c.store.Save(ctx, token); err != nil {
+		return fmt.Errorf("failed to save resume token: %w", err)
+	}
+
+	c.token = append(bson.Raw(nil), token...)
+
+	return nil
+}
+
+func (c *Consumer) record(event bson.Raw) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Events++
+
+	if t, _, ok := event.Lookup("clusterTime").TimestampOK(); ok {
+		c.stats.ClusterTime = time.Unix(int64(t), 0)
+		c.stats.Lag = max(time.Since(c.stats.ClusterTime), 0)
+	}
+}
+
+// unresumableCodes are the server errors after which re-opening the change
+// stream from the same token can't succeed.
+var unresumableCodes = []int{
+	260, // InvalidResumeToken
+	280, // ChangeStreamFatalError
+	286, // ChangeStreamHistoryLost
+}
+
+func unresumable(err error) bool {
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+
+	for _, code := range unresumableCodes {
+		if serverErr.HasErrorCode(code) {
+			return true
+		}
+	}
+
+	return false
+}
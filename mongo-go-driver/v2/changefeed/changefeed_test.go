@@ -0,0 +1,319 @@
+package changefeed
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/mockdeploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var errStop = errors.New("stop")
+
+// recordingStore remembers every token saved.
+type recordingStore struct {
+	MemoryStore
+	saved []string
+}
+
+func (s *recordingStore) Save(ctx context.Context, token bson.Raw) error {
+	s.saved = append(s.saved, token.Lookup("_data").StringValue())
+
+	return s.MemoryStore.Save(ctx, token)
+}
+
+func newCollection(t *testing.T) (*mockdeploy.Deployment, *mongo.Collection) {
+	t.Helper()
+
+	d := mockdeploy.New(t)
+	d.On("killCursors").Reply(mockdeploy.OK()).Repeat()
+
+	client, err := d.NewClient()
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+
+	return d, client.Database("db").Collection("coll")
+}
+
+func token(data string) bson.D {
+	return bson.D{{Key: "_data", Value: data}}
+}
+
+func changeEvent(data string, clusterTime time.Time) bson.D {
+	return bson.D{
+		{Key: "_id", Value: token(data)},
+		{Key: "operationType", Value: "insert"},
+		{Key: "clusterTime", Value: bson.Timestamp{T: uint32(clusterTime.Unix()), I: 1}},
+		{Key: "documentKey", Value: bson.D{{Key: "_id", Value: data}}},
+	}
+}
+
+// stopAt will return a handler that records the token of each event and
+// stops at the event with the given token.
+func stopAt(data string) (func(context.Context, bson.Raw) error, *[]string) {
+	var seen []string
+
+	return func(_ context.Context, event bson.Raw) error {
+		id := event.Lookup("_id", "_data").StringValue()
+		seen = append(seen, id)
+
+		if id == data {
+			return errStop
+		}
+
+		return nil
+	}, &seen
+}
+
+func changeStream() mockdeploy.Predicate {
+	return mockdeploy.Exists("pipeline.0.$changeStream")
+}
+
+func startAfter(data string) mockdeploy.Predicate {
+	return mockdeploy.Field("pipeline.0.$changeStream.startAfter._data", data)
+}
+
+func TestRun_SavesTokenAfterEachEvent(t *testing.T) {
+	d, coll := newCollection(t)
+
+	now := time.Now()
+
+	d.On("aggregate").Where(changeStream()).
+		Reply(mockdeploy.Cursor("db.coll", 7, changeEvent("a", now), changeEvent("b", now)))
+	d.On("getMore").Reply(mockdeploy.NextBatch("db.coll", 7, changeEvent("c", now)))
+
+	store := &recordingStore{}
+	consumer := New(coll, store)
+
+	handler, seen := stopAt("c")
+
+	require.ErrorIs(t, consumer.Run(context.Background(), handler), errStop)
+
+	assert.Equal(t, []string{"a", "b", "c"}, *seen)
+	assert.Equal(t, []string{"a", "b"}, store.saved, "the token of an event that failed must not be saved")
+	assert.Equal(t, int64(2), consumer.Stats().Events)
+
+	d.Verify()
+}
+
+func TestRun_ResumesFromStoredToken(t *testing.T) {
+	d, coll := newCollection(t)
+
+	d.On("aggregate").Where(startAfter("x")).Reply(mockdeploy.Cursor("db.coll", 7, changeEvent("y", time.Now())))
+
+	store := &MemoryStore{}
+	require.NoError(t, store.Save(context.Background(), mustMarshal(t, token("x"))))
+
+	handler, seen := stopAt("y")
+
+	require.ErrorIs(t, New(coll, store).Run(context.Background(), handler), errStop)
+	assert.Equal(t, []string{"y"}, *seen)
+}
+
+func TestRun_RestartsFromTokenAfterError(t *testing.T) {
+	d, coll := newCollection(t)
+
+	now := time.Now()
+
+	d.On("aggregate").Where(changeStream()).Reply(mockdeploy.Cursor("db.coll", 7, changeEvent("a", now)))
+	d.On("getMore").Reply(mockdeploy.Error(13, "Unauthorized", "not authorized"))
+	d.On("aggregate").Where(startAfter("a")).Reply(mockdeploy.Cursor("db.coll", 8, changeEvent("b", now)))
+
+	var restarts []error
+
+	consumer := New(coll, &MemoryStore{},
+		WithBackoff(time.Millisecond, time.Millisecond),
+		WithRestartHook(func(err error) { restarts = append(restarts, err) }))
+
+	handler, seen := stopAt("b")
+
+	require.ErrorIs(t, consumer.Run(context.Background(), handler), errStop)
+
+	assert.Equal(t, []string{"a", "b"}, *seen)
+	assert.Equal(t, int64(1), consumer.Stats().Restarts)
+
+	require.Len(t, restarts, 1)
+
+	var cmdErr mongo.CommandError
+	require.ErrorAs(t, restarts[0], &cmdErr)
+	assert.Equal(t, int32(13), cmdErr.Code)
+
+	d.Verify()
+}
+
+func TestRun_TimeoutRestartsWithoutBackoff(t *testing.T) {
+	d, coll := newCollection(t)
+
+	now := time.Now()
+
+	d.On("aggregate").Where(changeStream()).Reply(mockdeploy.Cursor("db.coll", 7, changeEvent("a", now)))
+	d.On("getMore").Reply(mockdeploy.Error(50, "MaxTimeMSExpired", "operation exceeded time limit"))
+	d.On("aggregate").Where(startAfter("a")).Reply(mockdeploy.Cursor("db.coll", 8, changeEvent("b", now)))
+
+	consumer := New(coll, &MemoryStore{}, WithBackoff(time.Hour, time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	handler, _ := stopAt("b")
+
+	require.ErrorIs(t, consumer.Run(ctx, handler), errStop)
+	assert.Equal(t, int64(1), consumer.Stats().Restarts)
+}
+
+func TestRun_TimeoutWithoutProgressBacksOff(t *testing.T) {
+	d, coll := newCollection(t)
+
+	// Every getMore of a quiet stream times out, as when the timeout is
+	// shorter than maxAwaitTime.
+	d.On("aggregate").Where(changeStream()).Reply(mockdeploy.Cursor("db.coll", 7)).Repeat()
+	d.On("getMore").Reply(mockdeploy.Error(50, "MaxTimeMSExpired", "operation exceeded time limit")).Repeat()
+
+	const (
+		backoff = 20 * time.Millisecond
+		run     = 300 * time.Millisecond
+	)
+
+	consumer := New(coll, &MemoryStore{}, WithBackoff(backoff, backoff), WithMaxAwaitTime(10*time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), run)
+	defer cancel()
+
+	err := consumer.Run(ctx, func(context.Context, bson.Raw) error { return nil })
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	restarts := consumer.Stats().Restarts
+	assert.Positive(t, restarts)
+	assert.LessOrEqual(t, restarts, int64(run/backoff)+1, "each restart without progress must wait for the backoff")
+}
+
+func TestRun_UnresumableToken(t *testing.T) {
+	d, coll := newCollection(t)
+
+	d.On("aggregate").Where(changeStream()).Reply(mockdeploy.Cursor("db.coll", 7))
+	d.On("getMore").Reply(mockdeploy.Error(286, "ChangeStreamHistoryLost", "resume point may no longer be in the oplog"))
+
+	err := New(coll, &MemoryStore{}).Run(context.Background(), func(context.Context, bson.Raw) error { return nil })
+	require.ErrorContains(t, err, "can't be resumed")
+
+	var cmdErr mongo.CommandError
+	require.ErrorAs(t, err, &cmdErr)
+	assert.Equal(t, int32(286), cmdErr.Code)
+}
+
+func TestRun_StatsAndPostBatchResumeToken(t *testing.T) {
+	d, coll := newCollection(t)
+
+	store := &recordingStore{}
+	consumer := New(coll, store)
+
+	var lagAfterEvent time.Duration
+
+	d.On("aggregate").Where(changeStream()).
+		Reply(mockdeploy.Cursor("db.coll", 7, changeEvent("a", time.Now().Add(-time.Minute))))
+	d.On("getMore").ReplyFunc(func(mockdeploy.Command) bson.D {
+		lagAfterEvent = consumer.Stats().Lag
+
+		return mockdeploy.OK(bson.E{Key: "cursor", Value: bson.D{
+			{Key: "id", Value: int64(7)},
+			{Key: "ns", Value: "db.coll"},
+			{Key: "nextBatch", Value: bson.A{}},
+			{Key: "postBatchResumeToken", Value: token("p")},
+		}})
+	})
+	d.On("getMore").Reply(mockdeploy.NextBatch("db.coll", 7, changeEvent("b", time.Now())))
+
+	var lagAfterEmptyBatch time.Duration
+
+	err := consumer.Run(context.Background(), func(_ context.Context, event bson.Raw) error {
+		if event.Lookup("_id", "_data").StringValue() == "b" {
+			lagAfterEmptyBatch = consumer.Stats().Lag
+
+			return errStop
+		}
+
+		return nil
+	})
+	require.ErrorIs(t, err, errStop)
+
+	assert.GreaterOrEqual(t, lagAfterEvent, time.Minute)
+	assert.Zero(t, lagAfterEmptyBatch, "an empty batch means the consumer caught up")
+	assert.Equal(t, []string{"a", "p"}, store.saved)
+	assert.WithinDuration(t, time.Now().Add(-time.Minute), consumer.Stats().ClusterTime, 2*time.Second)
+}
+
+func TestRun_Cancel(t *testing.T) {
+	d, coll := newCollection(t)
+
+	d.On("aggregate").Where(changeStream()).Reply(mockdeploy.Cursor("db.coll", 7))
+	d.On("getMore").Reply(mockdeploy.NextBatch("db.coll", 7)).Repeat()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := New(coll, &MemoryStore{}).Run(ctx, func(context.Context, bson.Raw) error { return nil })
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestFileStore(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "token.json"))
+
+	got, err := store.Load(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, got, "a missing file means there is no token")
+
+	want := mustMarshal(t, token("8263A1"))
+	require.NoError(t, store.Save(context.Background(), want))
+
+	got, err = store.Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(store.path), "*"))
+	require.NoError(t, err)
+	assert.Len(t, matches, 1, "the temporary file must be renamed over the token file")
+}
+
+func TestCollectionStore(t *testing.T) {
+	d, coll := newCollection(t)
+
+	store := NewCollectionStore(coll, "orders-consumer")
+
+	d.On("find").Where(mockdeploy.Filter("_id", "orders-consumer")).Reply(
+		mockdeploy.Cursor("db.coll", 0),
+		mockdeploy.Cursor("db.coll", 0, bson.D{{Key: "_id", Value: "orders-consumer"}, {Key: "token", Value: token("t")}}),
+	)
+	d.On("update").Where(
+		mockdeploy.Field("updates.0.q._id", "orders-consumer"),
+		mockdeploy.Field("updates.0.upsert", true),
+		mockdeploy.Field("updates.0.u.$set.token._data", "t"),
+	).Reply(mockdeploy.Write(mockdeploy.WriteResult{N: 1}))
+
+	got, err := store.Load(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	require.NoError(t, store.Save(context.Background(), mustMarshal(t, token("t"))))
+
+	got, err = store.Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "t", got.Lookup("_data").StringValue())
+
+	d.Verify()
+}
+
+func mustMarshal(t *testing.T, v any) bson.Raw {
+	t.Helper()
+
+	b, err := bson.Marshal(v)
+	require.NoError(t, err)
+
+	return b
+}
@@ -0,0 +1,85 @@
+package changefeed
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Config is the configuration for a Consumer.
+type Config struct {
+	pipeline     any                  // Pipeline appended to the $changeStream stage
+	fullDocument options.FullDocument // fullDocument option of the change stream
+	batchSize    int32                // Batch size of the change stream, 0 for the server default
+	maxAwaitTime time.Duration        // How long a getMore waits for events
+	minBackoff   time.Duration        // First wait before re-opening after an error
+	maxBackoff   time.Duration        // Longest wait before re-opening after an error
+	onRestart    func(error)          // Called each time the change stream is re-opened
+}
+
+type ConfigOpt func(*Config)
+
+// WithPipeline sets the aggregation stages applied to change events, e.g. a
+// $match on operationType.
+func WithPipeline(pipeline any) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.pipeline = pipeline
+	}
+}
+
+// WithFullDocument sets the fullDocument option, e.g. options.UpdateLookup to
+// include the current document in update events.
+func WithFullDocument(fullDocument options.FullDocument) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.fullDocument = fullDocument
+	}
+}
+
+// WithBatchSize sets the batch size of the change stream.
+func WithBatchSize(n int32) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.batchSize = n
+	}
+}
+
+// WithMaxAwaitTime sets how long the server waits for events before replying
+// with an empty batch. The resume token is saved and the lag updated after
+// each empty batch, so this bounds how stale they get on a quiet stream. It
+// must be less than the client's timeout, if any. The default is 1s.
+func WithMaxAwaitTime(d time.Duration) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.maxAwaitTime = d
+	}
+}
+
+// WithBackoff sets the waits before re-opening the change stream after an
+// error. The wait starts at minimum, doubles on each consecutive error and is
+// capped at maximum. The defaults are 100ms and 10s.
+func WithBackoff(minimum, maximum time.Duration) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.minBackoff = minimum
+		cfg.maxBackoff = maximum
+	}
+}
+
+// WithRestartHook sets a function called with the error that closed the
+// change stream before it is re-opened.
+func WithRestartHook(fn func(err error)) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.onRestart = fn
+	}
+}
+
+func newConfig(opts ...ConfigOpt) Config {
+	cfg := Config{
+		maxAwaitTime: time.Second,
+		minBackoff:   100 * time.Millisecond,
+		maxBackoff:   10 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return cfg
+}
@@ -0,0 +1,163 @@
+package changefeed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// TokenStore persists the resume token of a consumer between runs.
+type TokenStore interface {
+	// Load will return the saved token, or nil if there is none.
+	Load(ctx context.Context) (bson.Raw, error)
+
+	// Save will replace the saved token.
+	Save(ctx context.Context, token bson.Raw) error
+}
+
+// MemoryStore keeps the token in memory. It survives restarts of the change
+// stream but not of the process.
+type MemoryStore struct {
+	mu    sync.Mutex
+	token bson.Raw
+}
+
+var _ TokenStore = &MemoryStore{}
+
+// Load implements TokenStore.
+func (s *MemoryStore) Load(context.Context) (bson.Raw, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.token, nil
+}
+
+// Save implements TokenStore.
+func (s *MemoryStore) Save(_ context.Context, token bson.Raw) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.token = append(bson.Raw(nil), token...)
+
+	return nil
+}
+
+// FileStore keeps the token in a file as canonical Extended JSON. The file is
+// replaced atomically, so a crash while saving leaves the previous token.
+type FileStore struct {
+	path string
+}
+
+var _ TokenStore = &FileStore{}
+
+// NewFileStore will return a store that keeps the token at path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load implements TokenStore.
+func (s *FileStore) Load(context.Context) (bson.Raw, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resume token: %w", err)
+	}
+
+	var token bson.Raw
+	if err := bson.UnmarshalExtJSON(data, true, &token); err != nil {
+		return nil, fmt.Errorf("failed to parse resume token in %s: %w", s.path, err)
+	}
+
+	return token, nil
+}
+
+// Save implements TokenStore.
+func (s *FileStore) Save(_ context.Context, token bson.Raw) error {
+	data, err := bson.MarshalExtJSON(token, true, false)
+	if err != nil {
+		return fmt.Errorf("failed to encode resume token: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create resume token file: %w", err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("failed to write resume token: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write resume token: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace resume token file: %w", err)
+	}
+
+	return nil
+}
+
+// CollectionStore keeps the token in a document of a collection, so that
+// consumers on different hosts can take over from each other.
+type CollectionStore struct {
+	coll *mongo.Collection
+	id   string
+}
+
+var _ TokenStore = &CollectionStore{}
+
+// NewCollectionStore will return a store that keeps the token in the document
+// of coll whose _id is id, e.g. the name of the consumer.
+func NewCollectionStore(coll *mongo.Collection, id string) *CollectionStore {
+	return &CollectionStore{coll: coll, id: id}
+}
+
+// Load implements TokenStore.
+func (s *CollectionStore) Load(ctx context.Context) (bson.Raw, error) {
+	var doc struct {
+		Token bson.Raw `bson:"token"`
+	}
+
+	err := s.coll.FindOne(ctx, bson.D{{Key: "_id", Value: s.id}}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load resume token: %w", err)
+	}
+
+	return doc.Token, nil
+}
+
+// Save implements TokenStore.
+func (s *CollectionStore) Save(ctx context.Context, token bson.Raw) error {
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "token", Value: token}}},
+		{Key: "$currentDate", Value: bson.D{{Key: "updatedAt", Value: true}}},
+	}
+
+	opts := options.UpdateOne().SetUpsert(true)
+
+	if _, err := s.coll.UpdateOne(ctx, bson.D{{Key: "_id", Value: s.id}}, update, opts); err != nil {
+		return fmt.Errorf("failed to save resume token: %w", err)
+	}
+
+	return nil
+}
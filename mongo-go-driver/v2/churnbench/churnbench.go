@@ -0,0 +1,300 @@
+// Package churnbench measures how connection churn under client-side
+// operation timeouts affects throughput, the standalone form of
+// TestConnectionChurn in tickets/drivers/csot.
+//
+// A run loads an unindexed collection, samples the latency of a find that
+// scans it, and then, for each RTT percentile, runs the find with that
+// percentile as its timeout on a fresh client, counting successes, timeouts
+// and the connections the pool closed. Running the same configuration with
+// two driver builds, e.g. before and after a fix, and plotting the CSV
+// results shows the effect of the fix across timeouts:
+//
+//	churnbench run -label baseline -out baseline.csv
+//	churnbench run -label fix -out fix.csv
+//	churnbench plot -out throughput.svg baseline.csv fix.csv
+package churnbench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/event"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// batchSize is the number of documents per insert when loading.
+const batchSize = 500
+
+// Case is a workload.
+type Case struct {
+	Description string
+	Volume      int    // Documents loaded and finds run per percentile
+	GoRoutines  int    // Goroutines the finds are split across
+	MaxPoolSize uint64 // maxPoolSize of the clients running the finds
+}
+
+// Result is the outcome of a case for one percentile.
+type Result struct {
+	Label             string
+	Description       string
+	Percentile        float64       // RTT percentile used as the timeout
+	Timeout           time.Duration // Timeout of each find
+	Operations        int           // Finds run
+	Succeeded         int           // Finds that returned
+	TimedOut          int           // Finds that failed with a timeout
+	Failed            int           // Finds that failed with any other error
+	ConnectionsClosed int           // Connections closed, except on disconnect
+	Elapsed           time.Duration // Time to run the finds
+}
+
+// Throughput will return the successful finds per second.
+func (r Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(r.Succeeded) / r.Elapsed.Seconds()
+}
+
+// SuccessRate will return the fraction of finds that succeeded.
+func (r Result) SuccessRate() float64 {
+	if r.Operations == 0 {
+		return 0
+	}
+
+	return float64(r.Succeeded) / float64(r.Operations)
+}
+
+// query matches no document, so the find scans the whole collection.
+var query = bson.D{{Key: "field1", Value: "doesntexist"}}
+
+// Run will run the case against the deployment at uri and return one result
+// per percentile.
+func Run(ctx context.Context, uri string, c Case, opts ...ConfigOpt) ([]Result, error) {
+	cfg := newConfig(opts...)
+
+	if c.GoRoutines <= 0 || c.Volume < c.GoRoutines {
+		return nil, fmt.Errorf("invalid case %q: volume must be at least the number of goroutines", c.Description)
+	}
+
+	for _, p := range cfg.percentiles {
+		if p < 0 || p > 1 {
+			return nil, fmt.Errorf("percentile %v is not in [0,1]", p)
+		}
+	}
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	defer func() { _ = client.Disconnect(context.Background()) }()
+
+	coll := client.Database(cfg.database).Collection(fmt.Sprintf("churn%d", time.Now().UnixNano()))
+
+	defer func() { _ = coll.Drop(context.Background()) }()
+
+	if err := load(ctx, coll, c, cfg.seed); err != nil {
+		return nil, fmt.Errorf("failed to load collection: %w", err)
+	}
+
+	latencies, err := sampleLatencies(ctx, coll, c.GoRoutines, cfg.samples)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample latencies: %w", err)
+	}
+
+	results := make([]Result, 0, len(cfg.percentiles))
+
+	for _, p := range cfg.percentiles {
+		if cfg.warmup > 0 {
+			time.Sleep(cfg.warmup)
+		}
+
+		res, err := runPercentile(ctx, uri, coll.Database().Name(), coll.Name(), c, quantile(latencies, p))
+		if err != nil {
+			return nil, fmt.Errorf("failed to run percentile %v: %w", p, err)
+		}
+
+		res.Label = cfg.label
+		res.Percentile = p
+
+		results = append(results, res)
+	}
+
+	return results, nil
+}
+
+// load will insert Volume documents generated from seed.
+func load(ctx context.Context, coll *mongo.Collection, c Case, seed int64) error {
+	rng := rand.New(rand.NewSource(seed))
+
+	var batches [][]bson.D
+
+	for remaining := c.Volume; remaining > 0; remaining -= batchSize {
+		batch := make([]bson.D, min(remaining, batchSize))
+		for i := range batch {
+			batch[i] = bson.D{
+				{Key: "field1", Value: rng.Int63()},
+				{Key: "field2", Value: rng.Int31()},
+			}
+		}
+
+		batches = append(batches, batch)
+	}
+
+	return parallel(c.GoRoutines, len(batches), func(i int) error {
+		_, err := coll.InsertMany(ctx, batches[i])
+
+		return err
+	})
+}
+
+// sampleLatencies will return the sorted latencies of the query, run samples
+// times by each goroutine.
+func sampleLatencies(ctx context.Context, coll *mongo.Collection, goroutines, samples int) ([]time.Duration, error) {
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+	)
+
+	err := parallel(goroutines, goroutines*samples, func(int) error {
+		start := time.Now()
+
+		err := coll.FindOne(ctx, query).Err()
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+
+		mu.Lock()
+		latencies = append(latencies, time.Since(start))
+		mu.Unlock()
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	return latencies, nil
+}
+
+// quantile will return the p-quantile of sorted latencies using the nearest
+// rank, the minimum for 0 and the maximum for 1.
+func quantile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+func runPercentile(ctx context.Context, uri, db, coll string, c Case, timeout time.Duration) (Result, error) {
+	var closed atomic.Int64
+
+	monitor := &event.PoolMonitor{
+		Event: func(evt *event.PoolEvent) {
+			if evt.Type == event.ConnectionClosed && evt.Reason != event.ReasonPoolClosed {
+				closed.Add(1)
+			}
+		},
+	}
+
+	opts := options.Client().ApplyURI(uri).SetPoolMonitor(monitor)
+	if c.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(c.MaxPoolSize)
+	}
+
+	client, err := mongo.Connect(opts)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	defer func() { _ = client.Disconnect(context.Background()) }()
+
+	collection := client.Database(db).Collection(coll)
+
+	var succeeded, timedOut, failed atomic.Int64
+
+	start := time.Now()
+
+	err = parallel(c.GoRoutines, c.Volume, func(int) error {
+		opCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		err := collection.FindOne(opCtx, query).Err()
+
+		switch {
+		case err == nil, errors.Is(err, mongo.ErrNoDocuments):
+			succeeded.Add(1)
+		case mongo.IsTimeout(err):
+			timedOut.Add(1)
+		default:
+			failed.Add(1)
+		}
+
+		return ctx.Err()
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Description:       c.Description,
+		Timeout:           timeout,
+		Operations:        c.Volume,
+		Succeeded:         int(succeeded.Load()),
+		TimedOut:          int(timedOut.Load()),
+		Failed:            int(failed.Load()),
+		ConnectionsClosed: int(closed.Load()),
+		Elapsed:           time.Since(start),
+	}, nil
+}
+
+// parallel will call fn for every index in [0,n) from the given number of
+// goroutines and return the first error.
+func parallel(goroutines, n int, fn func(i int) error) error {
+	var (
+		next     atomic.Int64
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= n {
+					return
+				}
+
+				if err := fn(i); err != nil {
+					errOnce.Do(func() { firstErr = err })
+
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return firstErr
+}
@@ -0,0 +1,175 @@
+package churnbench
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleResults() []Result {
+	var results []Result
+
+	for _, label := range []string{"baseline", "fix"} {
+		for _, p := range []float64{1, 0, 0.5} {
+			succeeded := int(p * 80)
+			if label == "fix" {
+				succeeded += 20
+			}
+
+			results = append(results, Result{
+				Label:             label,
+				Description:       "low volume",
+				Percentile:        p,
+				Timeout:           time.Duration(1+p*10) * time.Millisecond,
+				Operations:        100,
+				Succeeded:         succeeded,
+				TimedOut:          100 - succeeded,
+				ConnectionsClosed: 100 - succeeded,
+				Elapsed:           500 * time.Millisecond,
+			})
+		}
+	}
+
+	return results
+}
+
+func TestQuantile(t *testing.T) {
+	sorted := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	assert.Equal(t, time.Duration(1), quantile(sorted, 0))
+	assert.Equal(t, time.Duration(5), quantile(sorted, 0.5))
+	assert.Equal(t, time.Duration(10), quantile(sorted, 0.95))
+	assert.Equal(t, time.Duration(10), quantile(sorted, 1))
+	assert.Zero(t, quantile(nil, 0.5))
+}
+
+func TestPercentiles(t *testing.T) {
+	ps, err := Percentiles(25)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0, 0.25, 0.5, 0.75, 1}, ps)
+
+	ps, err = Percentiles(1)
+	require.NoError(t, err)
+	assert.Len(t, ps, 101)
+
+	for _, step := range []int{0, -5, 101} {
+		_, err := Percentiles(step)
+		assert.ErrorContains(t, err, "not in [1,100]", "step %d", step)
+	}
+}
+
+func TestResult(t *testing.T) {
+	r := Result{Operations: 100, Succeeded: 50, Elapsed: 2 * time.Second}
+
+	assert.Equal(t, 25.0, r.Throughput())
+	assert.Equal(t, 0.5, r.SuccessRate())
+	assert.Zero(t, Result{}.Throughput())
+	assert.Zero(t, Result{}.SuccessRate())
+}
+
+func TestCSV(t *testing.T) {
+	results := sampleResults()
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, results))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, len(results)+1)
+
+	assert.Equal(t, strings.Join(csvHeader, ","), lines[0])
+	assert.Equal(t, "baseline,low volume,1,11,100,80,20,0,20,500,160.000,0.8000", lines[1])
+
+	got, err := ReadCSV(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, results, got)
+}
+
+func TestReadCSV_Invalid(t *testing.T) {
+	in := strings.Join(csvHeader, ",") + "\nbaseline,x,abc,1,1,1,0,0,0,1,1,1\n"
+
+	_, err := ReadCSV(strings.NewReader(in))
+	assert.ErrorContains(t, err, `line 2: invalid percentile "abc"`)
+}
+
+func TestNewChart(t *testing.T) {
+	chart := NewChart(sampleResults(), Metrics["throughput"])
+
+	assert.Equal(t, "throughput (ops/s) vs. timeout percentile", chart.Title)
+	require.Len(t, chart.Series, 2)
+
+	assert.Equal(t, "baseline", chart.Series[0].Label)
+	assert.Equal(t, []Point{{X: 0, Y: 0}, {X: 50, Y: 80}, {X: 100, Y: 160}}, chart.Series[0].Points)
+	assert.Equal(t, "fix", chart.Series[1].Label)
+	assert.Equal(t, Point{X: 0, Y: 40}, chart.Series[1].Points[0])
+}
+
+func TestChart_WriteSVG(t *testing.T) {
+	chart := NewChart(sampleResults(), Metrics["success_rate"])
+	chart.Series[1].Label = "fix <pr>"
+
+	var buf bytes.Buffer
+	require.NoError(t, chart.WriteSVG(&buf))
+
+	out := buf.String()
+
+	assert.True(t, strings.HasPrefix(out, "<svg"))
+	assert.Equal(t, 2, strings.Count(out, "<polyline"))
+	assert.Equal(t, 6, strings.Count(out, "<circle"))
+	assert.Contains(t, out, "fix &lt;pr&gt;")
+	assert.Contains(t, out, ">success rate vs. timeout percentile</text>")
+}
+
+func TestChart_WritePNG(t *testing.T) {
+	chart := NewChart(sampleResults(), Metrics["throughput"])
+
+	var buf bytes.Buffer
+	require.NoError(t, chart.WritePNG(&buf))
+
+	img, err := png.Decode(&buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, chartWidth, img.Bounds().Dx())
+	assert.Equal(t, chartHeight, img.Bounds().Dy())
+
+	// The marker of the last baseline point is drawn in its color.
+	f := chart.frame()
+	r, g, b, _ := img.At(int(f.px(100)), int(f.py(160))).RGBA()
+	assert.Equal(t, []uint32{0x1f, 0x77, 0xb4}, []uint32{r >> 8, g >> 8, b >> 8})
+}
+
+func TestNiceCeil(t *testing.T) {
+	assert.Equal(t, 1.0, niceCeil(0))
+	assert.Equal(t, 200.0, niceCeil(160))
+	assert.Equal(t, 250.0, niceCeil(201))
+	assert.Equal(t, 1.0, niceCeil(0.8000001))
+	assert.Equal(t, 0.5, niceCeil(0.42))
+}
+
+func TestParallel(t *testing.T) {
+	var calls atomic.Int64
+
+	require.NoError(t, parallel(4, 100, func(int) error {
+		calls.Add(1)
+
+		return nil
+	}))
+	assert.Equal(t, int64(100), calls.Load())
+
+	errBoom := errors.New("boom")
+
+	err := parallel(4, 100, func(i int) error {
+		if i == 10 {
+			return errBoom
+		}
+
+		return nil
+	})
+	assert.ErrorIs(t, err, errBoom)
+}
@@ -0,0 +1,189 @@
+// Command churnbench runs the connection churn benchmark and plots its
+// results.
+//
+//	churnbench run -label baseline -out baseline.csv
+//	churnbench run -label fix -out fix.csv
+//	churnbench plot -metric throughput -out throughput.svg baseline.csv fix.csv
+//	churnbench plot -metric success_rate -out success_rate.png baseline.csv fix.csv
+//
+// The deployment is read from -uri, or MONGODB_URI. The defaults of run are
+// the "low volume" case of TestConnectionChurn in tickets/drivers/csot. plot
+// writes SVG or PNG depending on the extension of -out; PNG charts have no
+// text.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/churnbench"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+
+	switch os.Args[1] {
+	case "run":
+		err = run(os.Args[2:])
+	case "plot":
+		err = plot(os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: churnbench run [flags] | churnbench plot [flags] results.csv...")
+	os.Exit(2)
+}
+
+func run(args []string) error {
+	uri := os.Getenv("MONGODB_URI")
+	if uri == "" {
+		uri = "mongodb://localhost:27017"
+	}
+
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+
+	var (
+		uriFlag     = fs.String("uri", uri, "connection string")
+		label       = fs.String("label", "baseline", "label of the driver build under test")
+		description = fs.String("description", "low volume", "description of the case")
+		volume      = fs.Int("volume", 50, "documents loaded and finds run per percentile")
+		goroutines  = fs.Int("goroutines", 10, "goroutines the finds are split across")
+		maxPoolSize = fs.Uint64("max-pool", 1, "maxPoolSize of the clients running the finds")
+		step        = fs.Int("step", 1, "step between percentiles, in percent")
+		samples     = fs.Int("samples", 10, "latency samples per goroutine")
+		seed        = fs.Int64("seed", 1, "seed of the generated documents")
+		out         = fs.String("out", "-", "CSV file to write, - for stdout")
+	)
+
+	_ = fs.Parse(args)
+
+	percentiles, err := churnbench.Percentiles(*step)
+	if err != nil {
+		return fmt.Errorf("invalid -step: %w", err)
+	}
+
+	results, err := churnbench.Run(context.Background(), *uriFlag, churnbench.Case{
+		Description: *description,
+		Volume:      *volume,
+		GoRoutines:  *goroutines,
+		MaxPoolSize: *maxPoolSize,
+	},
+		churnbench.WithLabel(*label),
+		churnbench.WithPercentiles(percentiles...),
+		churnbench.WithSamples(*samples),
+		churnbench.WithSeed(*seed),
+	)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(*out, func(w io.Writer) error {
+		return churnbench.WriteCSV(w, results)
+	})
+}
+
+func plot(args []string) error {
+	fs := flag.NewFlagSet("plot", flag.ExitOnError)
+
+	var (
+		metric = fs.String("metric", "throughput", "metric to plot: "+strings.Join(metricNames(), ", "))
+		out    = fs.String("out", "churn.svg", "SVG or PNG file to write")
+	)
+
+	_ = fs.Parse(args)
+
+	m, ok := churnbench.Metrics[*metric]
+	if !ok {
+		return fmt.Errorf("unknown metric %q", *metric)
+	}
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no results to plot")
+	}
+
+	var results []churnbench.Result
+
+	for _, path := range fs.Args() {
+		rs, err := readFile(path)
+		if err != nil {
+			return err
+		}
+
+		results = append(results, rs...)
+	}
+
+	chart := churnbench.NewChart(results, m)
+
+	switch ext := strings.ToLower(filepath.Ext(*out)); ext {
+	case ".svg":
+		return writeFile(*out, chart.WriteSVG)
+	case ".png":
+		return writeFile(*out, chart.WritePNG)
+	default:
+		return fmt.Errorf("unsupported output format %q", ext)
+	}
+}
+
+func metricNames() []string {
+	names := make([]string, 0, len(churnbench.Metrics))
+	for name := range churnbench.Metrics {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func readFile(path string) ([]churnbench.Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open results: %w", err)
+	}
+
+	defer f.Close()
+
+	results, err := churnbench.ReadCSV(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return results, nil
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	if err := write(f); err != nil {
+		_ = f.Close()
+
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return f.Close()
+}
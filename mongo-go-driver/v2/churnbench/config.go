@@ -0,0 +1,99 @@
+package churnbench
+
+import (
+	"fmt"
+	"time"
+)
+
+// Config is the configuration of a benchmark run.
+type Config struct {
+	label       string        // Name of the driver build, e.g. "baseline" or "fix"
+	percentiles []float64     // RTT percentiles used as timeouts, in [0,1]
+	samples     int           // Latency samples per goroutine for the RTT distribution
+	seed        int64         // Seed of the generated documents
+	database    string        // Database of the generated collection
+	warmup      time.Duration // Pause before each percentile, letting the server settle
+}
+
+type ConfigOpt func(*Config)
+
+// WithLabel sets the label of the results, naming the driver build under
+// test. The default is "baseline".
+func WithLabel(label string) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.label = label
+	}
+}
+
+// WithPercentiles sets the RTT percentiles used as operation timeouts, each
+// in [0,1]. The default is every percentile from 0 to 100 in steps of 5.
+func WithPercentiles(percentiles ...float64) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.percentiles = percentiles
+	}
+}
+
+// WithSamples sets the number of latency samples each goroutine takes to
+// estimate the RTT distribution. The default is 10.
+func WithSamples(n int) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.samples = n
+	}
+}
+
+// WithSeed sets the seed of the generated documents. The default is 1.
+func WithSeed(seed int64) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.seed = seed
+	}
+}
+
+// WithDatabase sets the database of the generated collection. The default is
+// "testdb".
+func WithDatabase(name string) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.database = name
+	}
+}
+
+// WithWarmup sets a pause before running each percentile. The default is 0.
+func WithWarmup(d time.Duration) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.warmup = d
+	}
+}
+
+// Percentiles will return the percentiles from 0 to 1 in steps of step
+// percent, e.g. Percentiles(5) for 0, 0.05, ..., 1. step must be in [1,100].
+func Percentiles(step int) ([]float64, error) {
+	if step <= 0 || step > 100 {
+		return nil, fmt.Errorf("step %d is not in [1,100]", step)
+	}
+
+	return percentiles(step), nil
+}
+
+func percentiles(step int) []float64 {
+	var ps []float64
+	for p := 0; p <= 100; p += step {
+		ps = append(ps, float64(p)/100)
+	}
+
+	return ps
+}
+
+func newConfig(opts ...ConfigOpt) Config {
+	cfg := Config{
+		label:       "baseline",
+		percentiles: percentiles(5),
+		samples:     10,
+		seed:        1,
+		database:    "testdb",
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return cfg
+}
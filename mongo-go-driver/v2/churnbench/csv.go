@@ -0,0 +1,139 @@
+package churnbench
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvHeader are the columns of the CSV files. Throughput and success rate are
+// derived and ignored when reading.
+var csvHeader = []string{
+	"label",
+	"description",
+	"percentile",
+	"timeout_ms",
+	"operations",
+	"succeeded",
+	"timed_out",
+	"failed",
+	"connections_closed",
+	"elapsed_ms",
+	"throughput",
+	"success_rate",
+}
+
+// WriteCSV will write the results as CSV with a header.
+func WriteCSV(w io.Writer, results []Result) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(csvHeader); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	for _, r := range results {
+		record := []string{
+			r.Label,
+			r.Description,
+			strconv.FormatFloat(r.Percentile, 'f', -1, 64),
+			formatMillis(r.Timeout),
+			strconv.Itoa(r.Operations),
+			strconv.Itoa(r.Succeeded),
+			strconv.Itoa(r.TimedOut),
+			strconv.Itoa(r.Failed),
+			strconv.Itoa(r.ConnectionsClosed),
+			formatMillis(r.Elapsed),
+			strconv.FormatFloat(r.Throughput(), 'f', 3, 64),
+			strconv.FormatFloat(r.SuccessRate(), 'f', 4, 64),
+		}
+
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("failed to write result: %w", err)
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// ReadCSV will read results written by WriteCSV.
+func ReadCSV(r io.Reader) ([]Result, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvHeader)
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV: %w", err)
+	}
+
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	results := make([]Result, 0, len(records)-1)
+
+	for i, record := range records[1:] {
+		res, err := parseRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse line %d: %w", i+2, err)
+		}
+
+		results = append(results, res)
+	}
+
+	return results, nil
+}
+
+func parseRecord(record []string) (Result, error) {
+	p := &fieldParser{record: record}
+
+	res := Result{
+		Label:             record[0],
+		Description:       record[1],
+		Percentile:        p.float(2),
+		Timeout:           p.millis(3),
+		Operations:        p.int(4),
+		Succeeded:         p.int(5),
+		TimedOut:          p.int(6),
+		Failed:            p.int(7),
+		ConnectionsClosed: p.int(8),
+		Elapsed:           p.millis(9),
+	}
+
+	return res, p.err
+}
+
+// fieldParser parses fields of a record, keeping the first error.
+type fieldParser struct {
+	record []string
+	err    error
+}
+
+func (p *fieldParser) float(i int) float64 {
+	v, err := strconv.ParseFloat(p.record[i], 64)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("invalid %s %q: %w", csvHeader[i], p.record[i], err)
+	}
+
+	return v
+}
+
+func (p *fieldParser) int(i int) int {
+	v, err := strconv.Atoi(p.record[i])
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("invalid %s %q: %w", csvHeader[i], p.record[i], err)
+	}
+
+	return v
+}
+
+func (p *fieldParser) millis(i int) time.Duration {
+	return time.Duration(p.float(i) * float64(time.Millisecond))
+}
+
+func formatMillis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64)
+}
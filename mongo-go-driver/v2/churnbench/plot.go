@@ -0,0 +1,345 @@
+package churnbench
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metric is a value of a result that can be plotted.
+type Metric struct {
+	Name  string // Axis label
+	Value func(Result) float64
+}
+
+// Metrics are the plottable metrics by CSV column name.
+var Metrics = map[string]Metric{
+	"throughput": {
+		Name:  "throughput (ops/s)",
+		Value: Result.Throughput,
+	},
+	"success_rate": {
+		Name:  "success rate",
+		Value: Result.SuccessRate,
+	},
+	"connections_closed": {
+		Name:  "connections closed",
+		Value: func(r Result) float64 { return float64(r.ConnectionsClosed) },
+	},
+	"timed_out": {
+		Name:  "timeouts",
+		Value: func(r Result) float64 { return float64(r.TimedOut) },
+	},
+}
+
+// Point is a point of a series.
+type Point struct {
+	X, Y float64
+}
+
+// Series is a line of a chart.
+type Series struct {
+	Label  string
+	Points []Point
+}
+
+// Chart is a line chart with one series per label.
+type Chart struct {
+	Title  string
+	XLabel string
+	YLabel string
+	Series []Series
+}
+
+// NewChart will return a chart of metric against the timeout percentile, with
+// one series per label in the order the labels first appear.
+func NewChart(results []Result, metric Metric) Chart {
+	chart := Chart{
+		Title:  metric.Name + " vs. timeout percentile",
+		XLabel: "timeout percentile",
+		YLabel: metric.Name,
+	}
+
+	index := map[string]int{}
+
+	for _, r := range results {
+		i, ok := index[r.Label]
+		if !ok {
+			i = len(chart.Series)
+			index[r.Label] = i
+			chart.Series = append(chart.Series, Series{Label: r.Label})
+		}
+
+		chart.Series[i].Points = append(chart.Series[i].Points, Point{X: r.Percentile * 100, Y: metric.Value(r)})
+	}
+
+	for _, s := range chart.Series {
+		sort.Slice(s.Points, func(i, j int) bool { return s.Points[i].X < s.Points[j].X })
+	}
+
+	return chart
+}
+
+// Layout of rendered charts, in pixels.
+const (
+	chartWidth   = 800
+	chartHeight  = 500
+	marginLeft   = 80
+	marginRight  = 30
+	marginTop    = 50
+	marginBottom = 60
+	tickCount    = 5
+)
+
+// palette are the colors of the series, reused past the fifth.
+var palette = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd"}
+
+// frame maps data coordinates to pixels.
+type frame struct {
+	xMin, xMax float64
+	yMin, yMax float64
+}
+
+func (c Chart) frame() frame {
+	f := frame{xMin: math.Inf(1), xMax: math.Inf(-1), yMax: math.Inf(-1)}
+
+	for _, s := range c.Series {
+		for _, p := range s.Points {
+			f.xMin = math.Min(f.xMin, p.X)
+			f.xMax = math.Max(f.xMax, p.X)
+			f.yMax = math.Max(f.yMax, p.Y)
+		}
+	}
+
+	if math.IsInf(f.xMin, 1) {
+		f.xMin, f.xMax, f.yMax = 0, 100, 1
+	}
+
+	if f.xMax == f.xMin {
+		f.xMax = f.xMin + 1
+	}
+
+	f.yMax = niceCeil(f.yMax)
+
+	return f
+}
+
+func (f frame) px(x float64) float64 {
+	return marginLeft + (x-f.xMin)/(f.xMax-f.xMin)*(chartWidth-marginLeft-marginRight)
+}
+
+func (f frame) py(y float64) float64 {
+	return chartHeight - marginBottom - (y-f.yMin)/(f.yMax-f.yMin)*(chartHeight-marginTop-marginBottom)
+}
+
+func (f frame) xTicks() []float64 { return ticks(f.xMin, f.xMax) }
+
+func (f frame) yTicks() []float64 { return ticks(f.yMin, f.yMax) }
+
+func ticks(lo, hi float64) []float64 {
+	ts := make([]float64, tickCount+1)
+	for i := range ts {
+		ts[i] = lo + float64(i)*(hi-lo)/tickCount
+	}
+
+	return ts
+}
+
+// niceCeil will return the smallest of 1, 2, 2.5 and 5 times a power of ten
+// that is at least v, or 1 if v isn't positive.
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+
+	mag := math.Pow(10, math.Floor(math.Log10(v)))
+
+	for _, m := range []float64{1, 2, 2.5, 5, 10} {
+		if m*mag >= v {
+			return m * mag
+		}
+	}
+
+	return 10 * mag
+}
+
+func formatTick(v float64) string {
+	if math.Abs(v) >= 100 {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+
+	return strconv.FormatFloat(v, 'g', 3, 64)
+}
+
+// WriteSVG will render the chart as SVG.
+func (c Chart) WriteSVG(w io.Writer) error {
+	f := c.frame()
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(&sb, `<rect width="%d" height="%d" fill="white"/>`+"\n", chartWidth, chartHeight)
+	fmt.Fprintf(&sb, `<text x="%d" y="%d" text-anchor="middle" font-size="16">%s</text>`+"\n",
+		chartWidth/2, marginTop/2, html.EscapeString(c.Title))
+
+	for _, x := range f.xTicks() {
+		fmt.Fprintf(&sb, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="#ddd"/>`+"\n",
+			f.px(x), marginTop, f.px(x), chartHeight-marginBottom)
+		fmt.Fprintf(&sb, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`+"\n",
+			f.px(x), chartHeight-marginBottom+18, formatTick(x))
+	}
+
+	for _, y := range f.yTicks() {
+		fmt.Fprintf(&sb, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#ddd"/>`+"\n",
+			marginLeft, f.py(y), chartWidth-marginRight, f.py(y))
+		fmt.Fprintf(&sb, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">%s</text>`+"\n",
+			marginLeft-8, f.py(y), formatTick(y))
+	}
+
+	fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="black"/>`+"\n",
+		marginLeft, marginTop, chartWidth-marginLeft-marginRight, chartHeight-marginTop-marginBottom)
+	fmt.Fprintf(&sb, `<text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n",
+		(chartWidth+marginLeft-marginRight)/2, chartHeight-15, html.EscapeString(c.XLabel))
+	fmt.Fprintf(&sb, `<text transform="translate(20 %d) rotate(-90)" text-anchor="middle">%s</text>`+"\n",
+		(chartHeight+marginTop-marginBottom)/2, html.EscapeString(c.YLabel))
+
+	for i, s := range c.Series {
+		hex := palette[i%len(palette)]
+
+		points := make([]string, len(s.Points))
+		for j, p := range s.Points {
+			points[j] = fmt.Sprintf("%.1f,%.1f", f.px(p.X), f.py(p.Y))
+		}
+
+		fmt.Fprintf(&sb, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`+"\n", hex, strings.Join(points, " "))
+
+		for _, p := range s.Points {
+			fmt.Fprintf(&sb, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"/>`+"\n", f.px(p.X), f.py(p.Y), hex)
+		}
+
+		lx, ly := chartWidth-marginRight-150, marginTop+15+i*18
+		fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="12" height="12" fill="%s"/>`+"\n", lx, ly-10, hex)
+		fmt.Fprintf(&sb, `<text x="%d" y="%d">%s</text>`+"\n", lx+18, ly, html.EscapeString(s.Label))
+	}
+
+	sb.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, sb.String())
+
+	return err
+}
+
+// WritePNG will render the chart as PNG. It has no text: the title, ticks and
+// labels are only in the SVG, and the legend is the swatches in the order of
+// the series.
+func (c Chart) WritePNG(w io.Writer) error {
+	f := c.frame()
+
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	fillRect(img, 0, 0, chartWidth, chartHeight, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+
+	grid := color.RGBA{R: 221, G: 221, B: 221, A: 255}
+	black := color.RGBA{A: 255}
+
+	left, right := marginLeft, chartWidth-marginRight
+	top, bottom := marginTop, chartHeight-marginBottom
+
+	for _, x := range f.xTicks() {
+		drawLine(img, int(f.px(x)), top, int(f.px(x)), bottom, 1, grid)
+	}
+
+	for _, y := range f.yTicks() {
+		drawLine(img, left, int(f.py(y)), right, int(f.py(y)), 1, grid)
+	}
+
+	drawLine(img, left, top, right, top, 1, black)
+	drawLine(img, left, bottom, right, bottom, 1, black)
+	drawLine(img, left, top, left, bottom, 1, black)
+	drawLine(img, right, top, right, bottom, 1, black)
+
+	for i, s := range c.Series {
+		col := rgba(palette[i%len(palette)])
+
+		for j, p := range s.Points {
+			x, y := int(f.px(p.X)), int(f.py(p.Y))
+
+			if j > 0 {
+				prev := s.Points[j-1]
+				drawLine(img, int(f.px(prev.X)), int(f.py(prev.Y)), x, y, 2, col)
+			}
+
+			fillRect(img, x-2, y-2, x+3, y+3, col)
+		}
+
+		lx, ly := right-150, top+5+i*18
+		fillRect(img, lx, ly, lx+12, ly+12, col)
+	}
+
+	return png.Encode(w, img)
+}
+
+// rgba will return the color of a palette entry.
+func rgba(hex string) color.RGBA {
+	v, _ := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}
+}
+
+func fillRect(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	draw.Draw(img, image.Rect(x0, y0, x1, y1), image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// drawLine will draw a line of the given width with Bresenham's algorithm.
+func drawLine(img *image.RGBA, x0, y0, x1, y1, width int, c color.RGBA) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := sign(x1-x0), sign(y1-y0)
+	e := dx + dy
+
+	for {
+		fillRect(img, x0, y0, x0+width, y0+width, c)
+
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+
+		e2 := 2 * e
+
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
+
+func sign(v int) int {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	}
+
+	return 0
+}
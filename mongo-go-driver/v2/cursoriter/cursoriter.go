@@ -0,0 +1,110 @@
+// Package cursoriter adapts mongo cursors and change streams to range-over-func
+// iterators, so that decoding, Err and Close can't be forgotten.
+//
+//	cursor, err := coll.Find(ctx, filter)
+//	if err != nil {
+//		return err
+//	}
+//
+//	for doc, err := range cursoriter.All[Order](ctx, cursor) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+package cursoriter
+
+import (
+	"context"
+	"fmt"
+	"iter"
+)
+
+// Source is implemented by *mongo.Cursor and *mongo.ChangeStream.
+type Source interface {
+	Next(ctx context.Context) bool
+	Decode(val any) error
+	Err() error
+	Close(ctx context.Context) error
+	RemainingBatchLength() int
+}
+
+// All will return an iterator over the documents of src decoded into T. A
+// decoding error, or the error of src once it is exhausted, is yielded with a
+// zero T, after which iteration stops. src is closed when the loop ends,
+// including on break, so the iterator can only be ranged over once.
+//
+// For a change stream the loop only ends on an error, a break or when ctx is
+// done, since Next blocks until the next event.
+func All[T any](ctx context.Context, src Source) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		defer src.Close(context.WithoutCancel(ctx))
+
+		for src.Next(ctx) {
+			doc, err := decode[T](src)
+			if err != nil {
+				yield(doc, err)
+
+				return
+			}
+
+			if !yield(doc, nil) {
+				return
+			}
+		}
+
+		if err := src.Err(); err != nil {
+			var zero T
+			yield(zero, fmt.Errorf("failed to iterate cursor: %w", err))
+		}
+	}
+}
+
+// Batches will return an iterator over the documents of src a batch at a
+// time, where a batch is what the server returned in a single reply. Batches
+// are never empty. Errors and closing behave as for All; a decoding error
+// discards the rest of its batch.
+func Batches[T any](ctx context.Context, src Source) iter.Seq2[[]T, error] {
+	return func(yield func([]T, error) bool) {
+		defer src.Close(context.WithoutCancel(ctx))
+
+		for src.Next(ctx) {
+			batch := make([]T, 0, src.RemainingBatchLength()+1)
+
+			for {
+				doc, err := decode[T](src)
+				if err != nil {
+					yield(nil, err)
+
+					return
+				}
+
+				batch = append(batch, doc)
+
+				// Next only talks to the server once the batch is used up.
+				if src.RemainingBatchLength() == 0 || !src.Next(ctx) {
+					break
+				}
+			}
+
+			if !yield(batch, nil) {
+				return
+			}
+		}
+
+		if err := src.Err(); err != nil {
+			yield(nil, fmt.Errorf("failed to iterate cursor: %w", err))
+		}
+	}
+}
+
+func decode[T any](src Source) (T, error) {
+	var doc T
+	if err := src.Decode(&doc); err != nil {
+		var zero T
+
+		return zero, fmt.Errorf("failed to decode document: %w", err)
+	}
+
+	return doc, nil
+}
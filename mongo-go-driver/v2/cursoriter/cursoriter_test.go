@@ -0,0 +1,202 @@
+package cursoriter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/mockdeploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+type item struct {
+	ID int32 `bson:"_id"`
+}
+
+func newCollection(t *testing.T) (*mockdeploy.Deployment, *mongo.Collection) {
+	t.Helper()
+
+	d := mockdeploy.New(t)
+
+	client, err := d.NewClient()
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+
+	return d, client.Database("db").Collection("coll")
+}
+
+func doc(id int32) bson.D {
+	return bson.D{{Key: "_id", Value: id}}
+}
+
+func find(t *testing.T, coll *mongo.Collection) *mongo.Cursor {
+	t.Helper()
+
+	cursor, err := coll.Find(context.Background(), bson.D{})
+	require.NoError(t, err)
+
+	return cursor
+}
+
+func TestAll(t *testing.T) {
+	d, coll := newCollection(t)
+
+	d.On("find").Reply(mockdeploy.Cursor("db.coll", 7, doc(1), doc(2)))
+	d.On("getMore").Reply(mockdeploy.NextBatch("db.coll", 0, doc(3)))
+
+	var got []int32
+
+	for it, err := range All[item](context.Background(), find(t, coll)) {
+		require.NoError(t, err)
+
+		got = append(got, it.ID)
+	}
+
+	assert.Equal(t, []int32{1, 2, 3}, got)
+
+	d.Verify()
+}
+
+func TestAll_BreakClosesCursor(t *testing.T) {
+	d, coll := newCollection(t)
+
+	d.On("find").Reply(mockdeploy.Cursor("db.coll", 7, doc(1), doc(2)))
+	d.On("killCursors").Reply(mockdeploy.OK())
+
+	cursor := find(t, coll)
+
+	for range All[item](context.Background(), cursor) {
+		break
+	}
+
+	assert.Len(t, d.CommandsNamed("killCursors"), 1)
+	assert.Equal(t, int64(0), cursor.ID())
+}
+
+func TestAll_DecodeError(t *testing.T) {
+	d, coll := newCollection(t)
+
+	d.On("find").Reply(mockdeploy.Cursor("db.coll", 0, doc(1), bson.D{{Key: "_id", Value: "x"}}, doc(3)))
+
+	var (
+		got  []int32
+		errs []error
+	)
+
+	for it, err := range All[item](context.Background(), find(t, coll)) {
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		got = append(got, it.ID)
+	}
+
+	assert.Equal(t, []int32{1}, got)
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "failed to decode document")
+}
+
+func TestAll_CursorError(t *testing.T) {
+	d, coll := newCollection(t)
+
+	d.On("find").Reply(mockdeploy.Cursor("db.coll", 7, doc(1)))
+	d.On("getMore").Reply(mockdeploy.Error(43, "CursorNotFound", "cursor id 7 not found"))
+	d.On("killCursors").Reply(mockdeploy.OK())
+
+	var errs []error
+
+	for _, err := range All[item](context.Background(), find(t, coll)) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	require.Len(t, errs, 1)
+
+	var cmdErr mongo.CommandError
+	require.ErrorAs(t, errs[0], &cmdErr)
+	assert.Equal(t, int32(43), cmdErr.Code)
+}
+
+func TestBatches(t *testing.T) {
+	d, coll := newCollection(t)
+
+	d.On("find").Reply(mockdeploy.Cursor("db.coll", 7, doc(1), doc(2)))
+	d.On("getMore").Reply(mockdeploy.NextBatch("db.coll", 7, doc(3)))
+	d.On("getMore").Reply(mockdeploy.NextBatch("db.coll", 7))
+	d.On("getMore").Reply(mockdeploy.NextBatch("db.coll", 0, doc(4), doc(5)))
+
+	var got [][]item
+
+	for batch, err := range Batches[item](context.Background(), find(t, coll)) {
+		require.NoError(t, err)
+
+		got = append(got, batch)
+	}
+
+	assert.Equal(t, [][]item{{{1}, {2}}, {{3}}, {{4}, {5}}}, got)
+
+	d.Verify()
+}
+
+func TestBatches_BreakClosesCursor(t *testing.T) {
+	d, coll := newCollection(t)
+
+	d.On("find").Reply(mockdeploy.Cursor("db.coll", 7, doc(1), doc(2)))
+	d.On("killCursors").Reply(mockdeploy.OK())
+
+	for batch := range Batches[item](context.Background(), find(t, coll)) {
+		assert.Len(t, batch, 2)
+
+		break
+	}
+
+	assert.Len(t, d.CommandsNamed("getMore"), 0, "breaking after the first batch must not fetch the next")
+	assert.Len(t, d.CommandsNamed("killCursors"), 1)
+}
+
+type event struct {
+	OperationType string `bson:"operationType"`
+	DocumentKey   item   `bson:"documentKey"`
+}
+
+func changeEvent(token string, id int32) bson.D {
+	return bson.D{
+		{Key: "_id", Value: bson.D{{Key: "_data", Value: token}}},
+		{Key: "operationType", Value: "insert"},
+		{Key: "documentKey", Value: doc(id)},
+	}
+}
+
+func TestAll_ChangeStream(t *testing.T) {
+	d, coll := newCollection(t)
+
+	d.On("aggregate").Where(mockdeploy.Exists("pipeline.0.$changeStream")).
+		Reply(mockdeploy.Cursor("db.coll", 7, changeEvent("a", 1)))
+	d.On("getMore").Reply(mockdeploy.NextBatch("db.coll", 7, changeEvent("b", 2), changeEvent("c", 3)))
+	d.On("killCursors").Reply(mockdeploy.OK())
+
+	stream, err := coll.Watch(context.Background(), mongo.Pipeline{})
+	require.NoError(t, err)
+
+	var got []int32
+
+	for ev, err := range All[event](context.Background(), stream) {
+		require.NoError(t, err)
+		require.Equal(t, "insert", ev.OperationType)
+
+		got = append(got, ev.DocumentKey.ID)
+		if len(got) == 3 {
+			break
+		}
+	}
+
+	assert.Equal(t, []int32{1, 2, 3}, got)
+	assert.Len(t, d.CommandsNamed("killCursors"), 1)
+	assert.Equal(t, "c", stream.ResumeToken().Lookup("_data").StringValue())
+}
@@ -0,0 +1,253 @@
+package docload
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/mockdeploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/schema"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func TestText_Load(t *testing.T) {
+	docs, err := NewText(strings.NewReader("hello world"), "hello.txt").Load(context.Background())
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+
+	assert.Equal(t, "hello world", docs[0].PageContent)
+	assert.Equal(t, "hello.txt", docs[0].Metadata[MetadataSource])
+}
+
+func TestMarkdown_Load(t *testing.T) {
+	const md = `Preamble text.
+
+# Install
+
+Intro.
+
+## Linux
+
+Run the script.
+
+` + "```sh" + `
+# not a heading
+./install.sh
+` + "```" + `
+
+## C# ##
+
+Use the package.
+
+# Usage
+
+Call it.
+`
+
+	docs, err := NewMarkdown(strings.NewReader(md), "README.md").Load(context.Background())
+	require.NoError(t, err)
+	require.Len(t, docs, 5)
+
+	headings := make([]any, len(docs))
+	for i, doc := range docs {
+		headings[i] = doc.Metadata[MetadataHeading]
+		assert.Equal(t, "README.md", doc.Metadata[MetadataSource])
+	}
+
+	assert.Equal(t, []any{nil, "Install", "Install > Linux", "Install > C#", "Usage"}, headings)
+	assert.Contains(t, docs[2].PageContent, "# not a heading", "fenced code must stay in its section")
+}
+
+func TestParseHeading(t *testing.T) {
+	testCases := []struct {
+		line  string
+		level int
+		title string
+		ok    bool
+	}{
+		{line: "# Title", level: 1, title: "Title", ok: true},
+		{line: "### Title ###", level: 3, title: "Title", ok: true},
+		{line: "## C#", level: 2, title: "C#", ok: true},
+		{line: "#hashtag", ok: false},
+		{line: "    # indented code", ok: false},
+		{line: "####### too deep", ok: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.line, func(t *testing.T) {
+			level, title, ok := parseHeading(tc.line)
+
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.level, level)
+			assert.Equal(t, tc.title, title)
+		})
+	}
+}
+
+func TestJSONLines_Load(t *testing.T) {
+	const jsonl = `{"text": "foo", "baz": "bar"}
+
+{"text": "thud", "n": 2}
+`
+
+	docs, err := NewJSONLines(strings.NewReader(jsonl), "docs.jsonl").Load(context.Background())
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+
+	assert.Equal(t, "foo", docs[0].PageContent)
+	assert.Equal(t, map[string]any{"baz": "bar", MetadataSource: "docs.jsonl", MetadataLine: 1}, docs[0].Metadata)
+	assert.Equal(t, 3, docs[1].Metadata[MetadataLine])
+
+	_, err = NewJSONLines(strings.NewReader(`{"body": "x"}`), "bad.jsonl").Load(context.Background())
+	assert.ErrorContains(t, err, `bad.jsonl:1 has no string field "text"`)
+}
+
+// gridFSCollections will script d to store the documents inserted into each
+// collection and return them to every find on it, which is enough for a
+// bucket holding a single file.
+func gridFSCollections(d *mockdeploy.Deployment) map[string][]any {
+	colls := map[string][]any{}
+
+	d.On("insert").ReplyFunc(func(cmd mockdeploy.Command) bson.D {
+		name := cmd.Document.Lookup("insert").StringValue()
+
+		docs, _ := cmd.Document.Lookup("documents").Array().Values()
+		for _, doc := range docs {
+			colls[name] = append(colls[name], doc.Document())
+		}
+
+		return mockdeploy.Inserted(int32(len(docs)))
+	}).Repeat()
+
+	d.On("find").ReplyFunc(func(cmd mockdeploy.Command) bson.D {
+		name := cmd.Document.Lookup("find").StringValue()
+
+		return mockdeploy.Cursor("db."+name, 0, colls[name]...)
+	}).Repeat()
+
+	d.On("listIndexes").Reply(mockdeploy.Error(26, "NamespaceNotFound", "ns does not exist")).Repeat()
+	d.On("createIndexes").Reply(mockdeploy.OK()).Repeat()
+
+	return colls
+}
+
+func TestGridFS_Load(t *testing.T) {
+	d := mockdeploy.New(t)
+	colls := gridFSCollections(d)
+
+	client, err := d.NewClient()
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+
+	const md = "# Install\n\nRun the install script.\n\n## Linux\n\nUse the package manager.\n"
+
+	bucket := client.Database("db").GridFSBucket(options.GridFSBucket().SetChunkSizeBytes(16))
+
+	id, err := bucket.UploadFromStream(context.Background(), "guide.md", strings.NewReader(md))
+	require.NoError(t, err)
+
+	require.Len(t, colls["fs.chunks"], (len(md)+15)/16, "the file must be uploaded in several chunks")
+	require.Len(t, colls["fs.files"], 1)
+
+	docs, err := NewGridFS(bucket, "guide.md").Load(context.Background())
+	require.NoError(t, err)
+
+	want, err := NewMarkdown(strings.NewReader(md), "gridfs:guide.md").Load(context.Background())
+	require.NoError(t, err)
+
+	for _, doc := range want {
+		doc.Metadata[MetadataFileID] = id
+	}
+
+	assert.Equal(t, want, docs, "the chunks must be reassembled into the uploaded Markdown")
+}
+
+func TestRecursiveCharacter_SplitText(t *testing.T) {
+	t.Run("fits", func(t *testing.T) {
+		chunks, err := NewRecursiveCharacter(100, 10).SplitText("short text")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"short text"}, chunks)
+	})
+
+	t.Run("paragraphs before words", func(t *testing.T) {
+		text := "aaaa bbbb\n\ncccc dddd"
+
+		chunks, err := NewRecursiveCharacter(10, 0).SplitText(text)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"aaaa bbbb", "cccc dddd"}, chunks)
+	})
+
+	t.Run("overlap", func(t *testing.T) {
+		chunks, err := NewRecursiveCharacter(11, 5).SplitText("one two three four five")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"one two", "two three", "three four", "four five"}, chunks)
+	})
+
+	t.Run("runes", func(t *testing.T) {
+		chunks, err := NewRecursiveCharacter(3, 0).SplitText("ééééé")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"ééé", "éé"}, chunks)
+	})
+
+	t.Run("bounded", func(t *testing.T) {
+		text := strings.Repeat("lorem ipsum dolor sit amet.\n", 50)
+
+		chunks, err := NewRecursiveCharacter(64, 16).SplitText(text)
+		require.NoError(t, err)
+		require.NotEmpty(t, chunks)
+
+		for _, chunk := range chunks {
+			assert.LessOrEqual(t, utf8.RuneCountInString(chunk), 64)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewRecursiveCharacter(10, 10).SplitText("x")
+		assert.Error(t, err)
+
+		_, err = NewRecursiveCharacter(0, 0).SplitText("x")
+		assert.Error(t, err)
+	})
+}
+
+func TestTokenSplitter(t *testing.T) {
+	assert.Equal(t, 5, ApproxTokenCount("Hello, world! ok"))
+
+	text := strings.Repeat("alpha beta gamma delta. ", 20)
+
+	chunks, err := NewTokenSplitter(10, 2, nil).SplitText(text)
+	require.NoError(t, err)
+	require.Greater(t, len(chunks), 1)
+
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, ApproxTokenCount(chunk), 10)
+	}
+}
+
+func TestSplitDocuments(t *testing.T) {
+	docs := []schema.Document{
+		{PageContent: "aaaa bbbb cccc", Metadata: map[string]any{MetadataSource: "a.txt"}},
+		{PageContent: "dddd"},
+	}
+
+	chunks, err := SplitDocuments(NewRecursiveCharacter(9, 0), docs)
+	require.NoError(t, err)
+	require.Len(t, chunks, 3)
+
+	assert.Equal(t, "aaaa bbbb", chunks[0].PageContent)
+	assert.Equal(t, map[string]any{MetadataSource: "a.txt", MetadataChunk: 0}, chunks[0].Metadata)
+	assert.Equal(t, map[string]any{MetadataSource: "a.txt", MetadataChunk: 1}, chunks[1].Metadata)
+	assert.Equal(t, map[string]any{MetadataChunk: 0}, chunks[2].Metadata)
+
+	_, hasChunk := docs[0].Metadata[MetadataChunk]
+	assert.False(t, hasChunk, "the original metadata must not be modified")
+}
@@ -0,0 +1,72 @@
+package docload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/tmc/langchaingo/schema"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// GridFS loads a file stored in a GridFS bucket. The file is parsed according
+// to its extension: ".md" and ".markdown" as Markdown, ".jsonl" and ".ndjson"
+// as JSON-lines and anything else as plain text.
+type GridFS struct {
+	bucket   *mongo.GridFSBucket
+	filename string
+
+	// ContentKey is passed through to the JSON-lines loader.
+	ContentKey string
+}
+
+var _ Loader = &GridFS{}
+
+// NewGridFS will return a loader for the latest revision of filename in bucket.
+func NewGridFS(bucket *mongo.GridFSBucket, filename string) *GridFS {
+	return &GridFS{bucket: bucket, filename: filename, ContentKey: "text"}
+}
+
+func (l *GridFS) Load(ctx context.Context) ([]schema.Document, error) {
+	stream, err := l.bucket.OpenDownloadStreamByName(ctx, l.filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %w", l.filename, err)
+	}
+
+	defer stream.Close()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(stream); err != nil {
+		return nil, fmt.Errorf("failed to download %q: %w", l.filename, err)
+	}
+
+	source := "gridfs:" + l.filename
+
+	var loader Loader
+	switch strings.ToLower(path.Ext(l.filename)) {
+	case ".md", ".markdown":
+		loader = NewMarkdown(&buf, source)
+	case ".jsonl", ".ndjson":
+		jl := NewJSONLines(&buf, source)
+		jl.ContentKey = l.ContentKey
+
+		loader = jl
+	default:
+		loader = NewText(&buf, source)
+	}
+
+	docs, err := loader.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if file := stream.GetFile(); file != nil {
+		for _, doc := range docs {
+			doc.Metadata[MetadataFileID] = file.ID
+		}
+	}
+
+	return docs, nil
+}
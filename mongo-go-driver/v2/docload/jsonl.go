@@ -0,0 +1,69 @@
+package docload
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// JSONLines loads one document per line of a JSON-lines file. The value of
+// ContentKey becomes the page content and every other key is copied into the
+// metadata.
+type JSONLines struct {
+	r      io.Reader
+	source string
+
+	// ContentKey is the key holding the text of each line. The default is
+	// "text".
+	ContentKey string
+}
+
+var _ Loader = &JSONLines{}
+
+// NewJSONLines will return a loader that reads the text of each line from the
+// "text" key.
+func NewJSONLines(r io.Reader, source string) *JSONLines {
+	return &JSONLines{r: r, source: source, ContentKey: "text"}
+}
+
+func (l *JSONLines) Load(context.Context) ([]schema.Document, error) {
+	var docs []schema.Document
+
+	scanner := bufio.NewScanner(l.r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := map[string]any{}
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			return nil, fmt.Errorf("failed to parse %s:%d: %w", l.source, lineNum, err)
+		}
+
+		content, ok := fields[l.ContentKey].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d has no string field %q", l.source, lineNum, l.ContentKey)
+		}
+
+		delete(fields, l.ContentKey)
+
+		fields[MetadataSource] = l.source
+		fields[MetadataLine] = lineNum
+
+		docs = append(docs, schema.Document{PageContent: content, Metadata: fields})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", l.source, err)
+	}
+
+	return docs, nil
+}
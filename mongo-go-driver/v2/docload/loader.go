@@ -0,0 +1,55 @@
+// Package docload loads documents from plain text, Markdown, JSON-lines and
+// GridFS files and splits them into chunks that are small enough to embed.
+// Every document carries a "source" metadata field so that chunks in the
+// vector store can be traced back to the file they came from.
+package docload
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// Metadata keys set by the loaders and splitters in this package.
+const (
+	MetadataSource  = "source"  // Name of the file or stream the document was loaded from
+	MetadataHeading = "heading" // Markdown heading path, e.g. "Install > Linux"
+	MetadataLine    = "line"    // 1-based line number in a JSON-lines file
+	MetadataChunk   = "chunk"   // 0-based index of a chunk within its document
+	MetadataFileID  = "fileID"  // _id of the GridFS file
+)
+
+// Loader loads documents from a single source.
+type Loader interface {
+	Load(ctx context.Context) ([]schema.Document, error)
+}
+
+// Text loads the entire contents of a reader as a single document.
+type Text struct {
+	r      io.Reader
+	source string
+}
+
+var _ Loader = &Text{}
+
+// NewText will return a loader that reads r into a single document whose
+// source metadata is set to source.
+func NewText(r io.Reader, source string) *Text {
+	return &Text{r: r, source: source}
+}
+
+func (l *Text) Load(context.Context) ([]schema.Document, error) {
+	b, err := io.ReadAll(l.r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", l.source, err)
+	}
+
+	doc := schema.Document{
+		PageContent: string(b),
+		Metadata:    map[string]any{MetadataSource: l.source},
+	}
+
+	return []schema.Document{doc}, nil
+}
@@ -0,0 +1,132 @@
+package docload
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// Markdown loads a Markdown file as one document per section, where a section
+// starts at an ATX heading ("# Title") and runs until the next heading of the
+// same or a higher level. Headings inside fenced code blocks are ignored.
+type Markdown struct {
+	r      io.Reader
+	source string
+}
+
+var _ Loader = &Markdown{}
+
+// NewMarkdown will return a loader that splits r into sections.
+func NewMarkdown(r io.Reader, source string) *Markdown {
+	return &Markdown{r: r, source: source}
+}
+
+func (l *Markdown) Load(context.Context) ([]schema.Document, error) {
+	var (
+		docs     []schema.Document
+		headings []string // Heading text by level, headings[0] is "#"
+		section  strings.Builder
+		fenced   bool
+	)
+
+	flush := func() {
+		content := strings.TrimSpace(section.String())
+		section.Reset()
+
+		if content == "" {
+			return
+		}
+
+		meta := map[string]any{MetadataSource: l.source}
+
+		var path []string
+		for _, h := range headings {
+			if h != "" {
+				path = append(path, h)
+			}
+		}
+
+		if len(path) > 0 {
+			meta[MetadataHeading] = strings.Join(path, " > ")
+		}
+
+		docs = append(docs, schema.Document{PageContent: content, Metadata: meta})
+	}
+
+	scanner := bufio.NewScanner(l.r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+		}
+
+		if level, title, ok := parseHeading(line); ok && !fenced {
+			flush()
+
+			// Drop headings at this level and below, then record this one.
+			if len(headings) >= level {
+				headings = headings[:level-1]
+			}
+
+			for len(headings) < level-1 {
+				headings = append(headings, "")
+			}
+
+			headings = append(headings, title)
+		}
+
+		section.WriteString(line)
+		section.WriteByte('\n')
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", l.source, err)
+	}
+
+	flush()
+
+	return docs, nil
+}
+
+// parseHeading will return the level and title of an ATX heading line.
+func parseHeading(line string) (int, string, bool) {
+	// Up to three spaces of indentation are allowed.
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return 0, "", false
+	}
+
+	level := 0
+	for level < len(trimmed) && trimmed[level] == '#' {
+		level++
+	}
+
+	if level == 0 || level > 6 {
+		return 0, "", false
+	}
+
+	rest := trimmed[level:]
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return 0, "", false
+	}
+
+	// Strip the optional closing sequence, e.g. "## Title ##".
+	// The closing sequence must be preceded by a space so that titles like
+	// "C#" are left alone.
+	title := strings.TrimSpace(rest)
+	if i := strings.LastIndex(title, " #"); i >= 0 && strings.Trim(title[i+1:], "#") == "" {
+		title = strings.TrimSpace(title[:i])
+	} else if strings.Trim(title, "#") == "" {
+		title = ""
+	}
+
+	return level, title, true
+}
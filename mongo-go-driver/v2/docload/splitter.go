@@ -0,0 +1,213 @@
+package docload
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// Splitter splits text into chunks.
+type Splitter interface {
+	SplitText(text string) ([]string, error)
+}
+
+// RecursiveCharacter splits text on the first separator that occurs in it,
+// recursing into pieces that are still longer than ChunkSize with the
+// remaining separators, and then merges adjacent pieces back together into
+// chunks of at most ChunkSize with ChunkOverlap of shared context.
+type RecursiveCharacter struct {
+	Separators   []string         // Separators in order of preference, "" splits into runes
+	ChunkSize    int              // Maximum length of a chunk
+	ChunkOverlap int              // Length shared by consecutive chunks
+	Len          func(string) int // Measures length, the default counts runes
+}
+
+var _ Splitter = &RecursiveCharacter{}
+
+// NewRecursiveCharacter will return a splitter that prefers to split on
+// paragraphs, then lines, then words, then runes, measuring length in runes.
+func NewRecursiveCharacter(chunkSize, chunkOverlap int) *RecursiveCharacter {
+	return &RecursiveCharacter{
+		Separators:   []string{"\n\n", "\n", " ", ""},
+		ChunkSize:    chunkSize,
+		ChunkOverlap: chunkOverlap,
+		Len:          utf8.RuneCountInString,
+	}
+}
+
+// NewTokenSplitter will return a recursive splitter that measures length with
+// countTokens, so that ChunkSize and ChunkOverlap are expressed in tokens. If
+// countTokens is nil, ApproxTokenCount is used.
+func NewTokenSplitter(chunkSize, chunkOverlap int, countTokens func(string) int) *RecursiveCharacter {
+	if countTokens == nil {
+		countTokens = ApproxTokenCount
+	}
+
+	splitter := NewRecursiveCharacter(chunkSize, chunkOverlap)
+	splitter.Len = countTokens
+
+	return splitter
+}
+
+var tokenPattern = regexp.MustCompile(`[\p{L}\p{N}_]+|[^\s\p{L}\p{N}_]`)
+
+// ApproxTokenCount will approximate the number of tokens in text by counting
+// words and punctuation marks. It is a stand-in for a model tokenizer such as
+// tiktoken, which usually reports a slightly higher count.
+func ApproxTokenCount(text string) int {
+	return len(tokenPattern.FindAllStringIndex(text, -1))
+}
+
+func (s *RecursiveCharacter) SplitText(text string) ([]string, error) {
+	if s.ChunkSize <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive, got %d", s.ChunkSize)
+	}
+
+	if s.ChunkOverlap < 0 || s.ChunkOverlap >= s.ChunkSize {
+		return nil, fmt.Errorf("chunk overlap %d must be in [0,%d)", s.ChunkOverlap, s.ChunkSize)
+	}
+
+	separators := s.Separators
+	if len(separators) == 0 {
+		separators = []string{""}
+	}
+
+	return s.split(text, separators), nil
+}
+
+func (s *RecursiveCharacter) length(text string) int {
+	if s.Len == nil {
+		return utf8.RuneCountInString(text)
+	}
+
+	return s.Len(text)
+}
+
+// split will split text on the first applicable separator, recursing into
+// pieces that are still too long.
+func (s *RecursiveCharacter) split(text string, separators []string) []string {
+	sep, rest := separators[len(separators)-1], []string(nil)
+	for i, candidate := range separators {
+		if candidate == "" || strings.Contains(text, candidate) {
+			sep, rest = candidate, separators[i+1:]
+
+			break
+		}
+	}
+
+	var pieces []string
+	for _, piece := range strings.Split(text, sep) {
+		if piece != "" {
+			pieces = append(pieces, piece)
+		}
+	}
+
+	var chunks, short []string
+	for _, piece := range pieces {
+		if s.length(piece) <= s.ChunkSize {
+			short = append(short, piece)
+
+			continue
+		}
+
+		if len(short) > 0 {
+			chunks = append(chunks, s.merge(short, sep)...)
+			short = nil
+		}
+
+		if len(rest) == 0 {
+			chunks = append(chunks, piece) // Nothing left to split on
+
+			continue
+		}
+
+		chunks = append(chunks, s.split(piece, rest)...)
+	}
+
+	if len(short) > 0 {
+		chunks = append(chunks, s.merge(short, sep)...)
+	}
+
+	return chunks
+}
+
+// merge will join adjacent pieces with sep into chunks no longer than
+// ChunkSize, carrying up to ChunkOverlap of trailing pieces into the next
+// chunk.
+func (s *RecursiveCharacter) merge(pieces []string, sep string) []string {
+	sepLen := s.length(sep)
+
+	var (
+		chunks  []string
+		current []string
+		total   int
+	)
+
+	joinedLen := func(n int) int {
+		if len(current) == 0 {
+			return n
+		}
+
+		return total + sepLen + n
+	}
+
+	for _, piece := range pieces {
+		n := s.length(piece)
+
+		if joinedLen(n) > s.ChunkSize && len(current) > 0 {
+			if chunk := strings.TrimSpace(strings.Join(current, sep)); chunk != "" {
+				chunks = append(chunks, chunk)
+			}
+
+			// Drop pieces from the front until what remains fits in the overlap
+			// and leaves room for the next piece.
+			for len(current) > 0 && (total > s.ChunkOverlap || joinedLen(n) > s.ChunkSize) {
+				total -= s.length(current[0])
+				if len(current) > 1 {
+					total -= sepLen
+				}
+
+				current = current[1:]
+			}
+		}
+
+		total = joinedLen(n)
+		current = append(current, piece)
+	}
+
+	if chunk := strings.TrimSpace(strings.Join(current, sep)); chunk != "" {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+// SplitDocuments will split every document into chunks, copying the metadata
+// of the original document into each chunk and recording the chunk index.
+func SplitDocuments(splitter Splitter, docs []schema.Document) ([]schema.Document, error) {
+	var chunks []schema.Document
+
+	for _, doc := range docs {
+		texts, err := splitter.SplitText(doc.PageContent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split document from %v: %w", doc.Metadata[MetadataSource], err)
+		}
+
+		for i, text := range texts {
+			meta := maps.Clone(doc.Metadata)
+			if meta == nil {
+				meta = map[string]any{}
+			}
+
+			meta[MetadataChunk] = i
+
+			chunks = append(chunks, schema.Document{PageContent: text, Metadata: meta})
+		}
+	}
+
+	return chunks, nil
+}
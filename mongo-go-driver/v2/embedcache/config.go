@@ -0,0 +1,54 @@
+package embedcache
+
+import "time"
+
+// Config is the configuration for a caching embedder.
+type Config struct {
+	ttl             time.Duration // How long a cached vector lives
+	dimensions      int           // Expected vector dimensions, 0 to accept any
+	lookupBatchSize int           // Maximum number of keys in a single $in
+}
+
+type ConfigOpt func(*Config)
+
+// WithTTL sets how long cached vectors live before the TTL index removes them.
+// It only takes effect when EnsureIndexes is called. The default is 30 days.
+func WithTTL(ttl time.Duration) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.ttl = ttl
+	}
+}
+
+// WithDimensions sets the expected number of dimensions. Cached vectors with a
+// different number of dimensions are treated as misses, and the embedder is
+// rejected if it returns a vector of the wrong size.
+func WithDimensions(dimensions int) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.dimensions = dimensions
+	}
+}
+
+// WithLookupBatchSize sets the maximum number of keys looked up with a single
+// $in query. The default is 1000.
+func WithLookupBatchSize(size int) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.lookupBatchSize = size
+	}
+}
+
+func newConfig(opts ...ConfigOpt) Config {
+	cfg := Config{
+		ttl:             30 * 24 * time.Hour,
+		lookupBatchSize: 1000,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.lookupBatchSize < 1 {
+		cfg.lookupBatchSize = 1
+	}
+
+	return cfg
+}
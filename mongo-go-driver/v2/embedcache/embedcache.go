@@ -0,0 +1,238 @@
+// Package embedcache caches vector embeddings in a MongoDB collection. The mock
+// embedders keep what they have seen in a map, which is lost when the process
+// exits; real embedding calls are slow and billed per token, so this package
+// wraps an embeddings.Embedder and only calls it for texts that are not
+// already cached.
+package embedcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/tmc/langchaingo/embeddings"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// entry is the document stored for every cached text.
+type entry struct {
+	Key        string    `bson:"_id"`
+	Model      string    `bson:"model"`
+	Dimensions int       `bson:"dimensions"`
+	Vector     []float32 `bson:"vector"`
+	CreatedAt  time.Time `bson:"createdAt"`
+}
+
+// Stats counts cache hits and misses.
+type Stats struct {
+	Hits   int64
+	Misses int64
+}
+
+// Embedder is an embeddings.Embedder that caches vectors in a collection.
+type Embedder struct {
+	coll     *mongo.Collection
+	embedder embeddings.Embedder
+	model    string
+	cfg      Config
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+var _ embeddings.Embedder = &Embedder{}
+
+// New will return an embedder that caches the vectors created by embedder in
+// coll. The model name is part of the cache key, so vectors from different
+// models never collide.
+func New(coll *mongo.Collection, embedder embeddings.Embedder, model string, opts ...ConfigOpt) *Embedder {
+	return &Embedder{
+		coll:     coll,
+		embedder: embedder,
+		model:    model,
+		cfg:      newConfig(opts...),
+	}
+}
+
+// EnsureIndexes will create the TTL index that expires cached vectors.
+func (e *Embedder) EnsureIndexes(ctx context.Context) error {
+	model := mongo.IndexModel{
+		Keys: bson.D{{Key: "createdAt", Value: 1}},
+		Options: options.Index().
+			SetName("createdAt_ttl").
+			SetExpireAfterSeconds(int32(e.cfg.ttl / time.Second)),
+	}
+
+	if _, err := e.coll.Indexes().CreateOne(ctx, model); err != nil {
+		return fmt.Errorf("failed to create TTL index: %w", err)
+	}
+
+	return nil
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (e *Embedder) Stats() Stats {
+	return Stats{Hits: e.hits.Load(), Misses: e.misses.Load()}
+}
+
+// Key will return the cache key for text embedded by model.
+func Key(model, text string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + text))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// EmbedDocuments will return a vector for each text, looking them up in the
+// cache first and embedding and caching the misses.
+func (e *Embedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	keys := make([]string, len(texts))
+	for i, text := range texts {
+		keys[i] = Key(e.model, text)
+	}
+
+	cached, err := e.lookup(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	vectors := make([][]float32, len(texts))
+
+	// Embed each missing text once, even if it is repeated in the input.
+	var (
+		missTexts []string
+		missKeys  []string
+	)
+
+	missing := map[string]bool{}
+	for i, key := range keys {
+		if vector, ok := cached[key]; ok {
+			vectors[i] = vector
+			e.hits.Add(1)
+
+			continue
+		}
+
+		e.misses.Add(1)
+
+		if !missing[key] {
+			missing[key] = true
+			missTexts = append(missTexts, texts[i])
+			missKeys = append(missKeys, key)
+		}
+	}
+
+	if len(missTexts) == 0 {
+		return vectors, nil
+	}
+
+	embedded, err := e.embedder.EmbedDocuments(ctx, missTexts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed %d uncached texts: %w", len(missTexts), err)
+	}
+
+	if len(embedded) != len(missTexts) {
+		return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(embedded), len(missTexts))
+	}
+
+	if err := e.store(ctx, missKeys, embedded); err != nil {
+		return nil, err
+	}
+
+	fresh := make(map[string][]float32, len(missKeys))
+	for i, key := range missKeys {
+		fresh[key] = embedded[i]
+	}
+
+	for i, key := range keys {
+		if vectors[i] == nil {
+			vectors[i] = fresh[key]
+		}
+	}
+
+	return vectors, nil
+}
+
+// EmbedQuery will return the vector for a single text, using the cache.
+func (e *Embedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	vectors, err := e.EmbedDocuments(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+
+	return vectors[0], nil
+}
+
+// lookup will find the cached vectors for keys with $in queries of at most
+// lookupBatchSize keys each.
+func (e *Embedder) lookup(ctx context.Context, keys []string) (map[string][]float32, error) {
+	cached := map[string][]float32{}
+
+	for start := 0; start < len(keys); start += e.cfg.lookupBatchSize {
+		end := start + e.cfg.lookupBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		filter := bson.D{
+			{Key: "_id", Value: bson.D{{Key: "$in", Value: keys[start:end]}}},
+			{Key: "model", Value: e.model},
+		}
+
+		if e.cfg.dimensions > 0 {
+			filter = append(filter, bson.E{Key: "dimensions", Value: e.cfg.dimensions})
+		}
+
+		cursor, err := e.coll.Find(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up cached vectors: %w", err)
+		}
+
+		var entries []entry
+		if err := cursor.All(ctx, &entries); err != nil {
+			return nil, fmt.Errorf("failed to decode cached vectors: %w", err)
+		}
+
+		for _, ent := range entries {
+			cached[ent.Key] = ent.Vector
+		}
+	}
+
+	return cached, nil
+}
+
+// store will upsert the vectors into the cache.
+func (e *Embedder) store(ctx context.Context, keys []string, vectors [][]float32) error {
+	now := time.Now()
+
+	models := make([]mongo.WriteModel, len(keys))
+	for i, key := range keys {
+		if e.cfg.dimensions > 0 && len(vectors[i]) != e.cfg.dimensions {
+			return fmt.Errorf("embedder returned %d dimensions, want %d", len(vectors[i]), e.cfg.dimensions)
+		}
+
+		ent := entry{
+			Key:        key,
+			Model:      e.model,
+			Dimensions: len(vectors[i]),
+			Vector:     vectors[i],
+			CreatedAt:  now,
+		}
+
+		models[i] = mongo.NewReplaceOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: key}}).
+			SetReplacement(ent).
+			SetUpsert(true)
+	}
+
+	_, err := e.coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return fmt.Errorf("failed to cache vectors: %w", err)
+	}
+
+	return nil
+}
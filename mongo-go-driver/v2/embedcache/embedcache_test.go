@@ -0,0 +1,146 @@
+package embedcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/embeddings"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/drivertest"
+)
+
+const testModel = "text-embedding-3-small"
+
+// mockLLM creates a two-dimensional embedding from the length of the text and
+// records every text it is asked to embed.
+type mockLLM struct {
+	embedded []string
+}
+
+var _ embeddings.EmbedderClient = &mockLLM{}
+
+func (llm *mockLLM) CreateEmbedding(_ context.Context, texts []string) ([][]float32, error) {
+	llm.embedded = append(llm.embedded, texts...)
+
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float32{float32(len(text)), 1}
+	}
+
+	return vectors, nil
+}
+
+func newMockEmbedder(t *testing.T) (*mockLLM, embeddings.Embedder) {
+	t.Helper()
+
+	llm := &mockLLM{}
+
+	embedder, err := embeddings.NewEmbedder(llm)
+	require.NoError(t, err)
+
+	return llm, embedder
+}
+
+func newMockCollection(t *testing.T, responses ...bson.D) *mongo.Collection {
+	t.Helper()
+
+	opts := options.Client()
+	opts.Deployment = drivertest.NewMockDeployment(responses...)
+
+	client, err := mongo.Connect(opts)
+	require.NoError(t, err, "failed to connect to mock deployment")
+
+	return client.Database("db").Collection("embeddings")
+}
+
+func findReply(entries ...entry) bson.D {
+	batch := bson.A{}
+	for _, ent := range entries {
+		batch = append(batch, ent)
+	}
+
+	return bson.D{
+		{Key: "ok", Value: 1},
+		{Key: "cursor", Value: bson.D{
+			{Key: "id", Value: int64(0)},
+			{Key: "ns", Value: "db.embeddings"},
+			{Key: "firstBatch", Value: batch},
+		}},
+	}
+}
+
+func TestKey(t *testing.T) {
+	assert.Equal(t, Key(testModel, "foo"), Key(testModel, "foo"))
+	assert.NotEqual(t, Key(testModel, "foo"), Key("other-model", "foo"))
+	assert.Len(t, Key(testModel, "foo"), 64)
+}
+
+func TestEmbedder_EmbedDocuments(t *testing.T) {
+	cachedFoo := entry{
+		Key:        Key(testModel, "foo"),
+		Model:      testModel,
+		Dimensions: 2,
+		Vector:     []float32{42, 42},
+		CreatedAt:  time.Now(),
+	}
+
+	coll := newMockCollection(t,
+		findReply(cachedFoo),
+		bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}})
+
+	llm, embedder := newMockEmbedder(t)
+	cache := New(coll, embedder, testModel, WithDimensions(2))
+
+	vectors, err := cache.EmbedDocuments(context.Background(), []string{"foo", "thud", "thud"})
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]float32{{42, 42}, {4, 1}, {4, 1}}, vectors)
+	assert.Equal(t, []string{"thud"}, llm.embedded, "only misses are embedded, once each")
+	assert.Equal(t, Stats{Hits: 1, Misses: 2}, cache.Stats())
+}
+
+func TestEmbedder_EmbedQuery_AllCached(t *testing.T) {
+	cached := entry{Key: Key(testModel, "thud"), Model: testModel, Dimensions: 2, Vector: []float32{7, 7}}
+
+	// No write response is scripted, so a cache write would fail the test.
+	coll := newMockCollection(t, findReply(cached))
+
+	llm, embedder := newMockEmbedder(t)
+	cache := New(coll, embedder, testModel)
+
+	vector, err := cache.EmbedQuery(context.Background(), "thud")
+	require.NoError(t, err)
+
+	assert.Equal(t, []float32{7, 7}, vector)
+	assert.Empty(t, llm.embedded)
+}
+
+func TestEmbedder_EmbedDocuments_LookupBatches(t *testing.T) {
+	coll := newMockCollection(t,
+		findReply(),
+		findReply(),
+		bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 3}})
+
+	llm, embedder := newMockEmbedder(t)
+	cache := New(coll, embedder, testModel, WithLookupBatchSize(2))
+
+	_, err := cache.EmbedDocuments(context.Background(), []string{"a", "bb", "ccc"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"a", "bb", "ccc"}, llm.embedded)
+}
+
+func TestEmbedder_EmbedDocuments_WrongDimensions(t *testing.T) {
+	coll := newMockCollection(t, findReply())
+
+	_, embedder := newMockEmbedder(t)
+	cache := New(coll, embedder, testModel, WithDimensions(1536))
+
+	_, err := cache.EmbedDocuments(context.Background(), []string{"foo"})
+	assert.ErrorContains(t, err, "embedder returned 2 dimensions, want 1536")
+}
@@ -0,0 +1,310 @@
+// Package extjsoncheck checks that Extended JSON documents round-trip without
+// loss through the bson package.
+//
+// Each case in a corpus is decoded with bson.UnmarshalExtJSON into every
+// target (bson.D, bson.M, bson.Raw and any user structs for documents, bson.A
+// for top-level arrays), encoded back to BSON and to Extended JSON, and
+// compared with the expected encoding from the corpus. Every type or
+// value that changes along the way is reported as a Mismatch, so that a driver
+// upgrade that breaks, say, timestamps in arrays shows up as a failing check
+// instead of a production incident.
+package extjsoncheck
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Target is a Go type documents are decoded into.
+type Target struct {
+	Name string
+	New  func() any // Pointer to decode into, e.g. func() any { return &bson.D{} }
+
+	// Ordered targets must preserve the order of fields. Maps don't.
+	Ordered bool
+
+	// Partial targets, typically structs, only hold some fields of a
+	// document. Only fields present both in the document and in what the
+	// target encodes are compared.
+	Partial bool
+
+	// Array targets decode top-level arrays and are only checked against
+	// cases whose JSON is an array; the others only against documents.
+	Array bool
+}
+
+// DefaultTargets will return the bson.D, bson.M, bson.Raw and bson.A targets.
+func DefaultTargets() []Target {
+	return []Target{
+		{Name: "bson.D", New: func() any { return &bson.D{} }, Ordered: true},
+		{Name: "bson.M", New: func() any { return &bson.M{} }},
+		{Name: "bson.Raw", New: func() any { return &bson.Raw{} }, Ordered: true},
+		{Name: "bson.A", New: func() any { return &bson.A{} }, Ordered: true, Array: true},
+	}
+}
+
+// StructTarget will return a partial target for the struct type of T, e.g.
+// StructTarget[timestamps]("timestamps").
+func StructTarget[T any](name string) Target {
+	return Target{Name: name, New: func() any { return new(T) }, Ordered: true, Partial: true}
+}
+
+// Stage is the step of the round trip at which a mismatch was found.
+type Stage string
+
+const (
+	StageExpected Stage = "expected" // The case has no expected BSON
+	StageDecode   Stage = "decode"   // bson.UnmarshalExtJSON into the target
+	StageBSON     Stage = "bson"     // bson.Marshal of the target
+	StageExtJSON  Stage = "extjson"  // bson.MarshalExtJSON of the target
+)
+
+// Mismatch is a difference found while round-tripping a case.
+type Mismatch struct {
+	Case   string
+	Target string
+	Stage  Stage
+	Path   string // Dotted path of the field, empty for document-level errors
+	Want   string
+	Got    string
+}
+
+func (m Mismatch) String() string {
+	where := m.Case + " [" + m.Target + "] " + string(m.Stage)
+	if m.Path != "" {
+		where += " " + m.Path
+	}
+
+	return fmt.Sprintf("%s: want %s, got %s", where, m.Want, m.Got)
+}
+
+// Check will round-trip every case through every target and return all
+// mismatches found.
+func Check(cases []Case, targets []Target) []Mismatch {
+	var mismatches []Mismatch
+
+	for _, c := range cases {
+		mismatches = append(mismatches, checkCase(c, targets)...)
+	}
+
+	return mismatches
+}
+
+func checkCase(c Case, targets []Target) []Mismatch {
+	if len(c.BSON) == 0 {
+		return []Mismatch{{Case: c.Name, Stage: StageExpected, Want: "expected BSON", Got: "none"}}
+	}
+
+	array := isArray(c.JSON)
+
+	var mismatches []Mismatch
+
+	for _, target := range targets {
+		if target.Array == array {
+			mismatches = append(mismatches, checkTarget(c, target, c.BSON)...)
+		}
+	}
+
+	return mismatches
+}
+
+func checkTarget(c Case, target Target, want bson.Raw) []Mismatch {
+	mismatch := func(stage Stage, want, got string) []Mismatch {
+		return []Mismatch{{Case: c.Name, Target: target.Name, Stage: stage, Want: want, Got: got}}
+	}
+
+	dst := target.New()
+	if err := bson.UnmarshalExtJSON([]byte(c.JSON), false, dst); err != nil {
+		return mismatch(StageDecode, "no error", err.Error())
+	}
+
+	val := reflect.ValueOf(dst).Elem().Interface()
+
+	got, err := marshal(val, target.Array)
+	if err != nil {
+		return mismatch(StageBSON, "no error", err.Error())
+	}
+
+	mismatches := compare(want, got, target.Ordered, target.Partial)
+	for i := range mismatches {
+		mismatches[i].Case, mismatches[i].Target, mismatches[i].Stage = c.Name, target.Name, StageBSON
+	}
+
+	extJSON, err := marshalExtJSON(val, target.Array, c.Canonical)
+	if err != nil {
+		return append(mismatches, mismatch(StageExtJSON, "no error", err.Error())...)
+	}
+
+	// Text is only comparable when the field order is kept and no field is
+	// dropped; otherwise compare what the Extended JSON decodes to.
+	if target.Ordered && !target.Partial {
+		if wantText, gotText := canonicalJSON(c.JSON), canonicalJSON(string(extJSON)); wantText != gotText {
+			mismatches = append(mismatches, mismatch(StageExtJSON, wantText, gotText)...)
+		}
+
+		return mismatches
+	}
+
+	reparsed, err := parseExtJSON(extJSON, target.Array, c.Canonical)
+	if err != nil {
+		return append(mismatches, mismatch(StageExtJSON, "valid Extended JSON", err.Error())...)
+	}
+
+	for _, m := range compare(want, reparsed, target.Ordered, target.Partial) {
+		m.Case, m.Target, m.Stage = c.Name, target.Name, StageExtJSON
+		mismatches = append(mismatches, m)
+	}
+
+	return mismatches
+}
+
+// canonicalJSON will re-encode JSON with the field order kept, without
+// insignificant whitespace and with every string escaped the same way, so
+// that e.g. "\u00e9" and "é" compare equal. Numbers keep their text, since
+// Extended JSON distinguishes 1 from 1.0. Invalid JSON is left as it is.
+func canonicalJSON(s string) string {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+
+	var buf bytes.Buffer
+	if err := writeCanonical(dec, &buf); err != nil {
+		return s
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return s
+	}
+
+	return buf.String()
+}
+
+func writeCanonical(dec *json.Decoder, buf *bytes.Buffer) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		buf.WriteRune(rune(tok))
+
+		for i := 0; dec.More(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			if tok == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+
+				writeString(buf, key.(string))
+				buf.WriteByte(':')
+			}
+
+			if err := writeCanonical(dec, buf); err != nil {
+				return err
+			}
+		}
+
+		end, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		buf.WriteRune(rune(end.(json.Delim)))
+	case string:
+		writeString(buf, tok)
+	case json.Number:
+		buf.WriteString(tok.String())
+	case bool:
+		buf.WriteString(strconv.FormatBool(tok))
+	case nil:
+		buf.WriteString("null")
+	}
+
+	return nil
+}
+
+// writeString will write s as a JSON string, escaping only what JSON requires.
+func writeString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+
+	_ = enc.Encode(s)
+
+	buf.Truncate(buf.Len() - 1) // Encode ends with a newline
+}
+
+// isArray reports whether the JSON of a case is an array.
+func isArray(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), "[")
+}
+
+// marshal will return the BSON of val, which for an array is the array
+// document.
+func marshal(val any, array bool) (bson.Raw, error) {
+	if !array {
+		return bson.Marshal(val)
+	}
+
+	typ, data, err := bson.MarshalValue(val)
+	if err != nil {
+		return nil, err
+	}
+
+	if typ != bson.TypeArray {
+		return nil, fmt.Errorf("marshaled to %s, not an array", typ)
+	}
+
+	return data, nil
+}
+
+// marshalExtJSON will return the Extended JSON of val. bson.MarshalExtJSON
+// only writes documents, so an array is written as the field of one.
+func marshalExtJSON(val any, array, canonical bool) ([]byte, error) {
+	if !array {
+		return bson.MarshalExtJSON(val, canonical, false)
+	}
+
+	doc, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: val}}, canonical, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var wrapper struct {
+		V json.RawMessage `json:"v"`
+	}
+
+	if err := json.Unmarshal(doc, &wrapper); err != nil {
+		return nil, fmt.Errorf("failed to unwrap array: %w", err)
+	}
+
+	return wrapper.V, nil
+}
+
+// parseExtJSON will return the BSON of Extended JSON written by
+// marshalExtJSON.
+func parseExtJSON(data []byte, array, canonical bool) (bson.Raw, error) {
+	if !array {
+		var raw bson.Raw
+		err := bson.UnmarshalExtJSON(data, canonical, &raw)
+
+		return raw, err
+	}
+
+	var arr bson.A
+	if err := bson.UnmarshalExtJSON(data, canonical, &arr); err != nil {
+		return nil, err
+	}
+
+	return marshal(arr, true)
+}
@@ -0,0 +1,58 @@
+// Command extjsoncheck round-trips a corpus of Extended JSON documents through
+// the bson package and reports every type or value that changes. With no
+// arguments the built-in corpus is used; otherwise each argument is a
+// directory of files in the BSON corpus specification format, e.g. a checkout
+// of mongodb/specifications/source/bson-corpus/tests.
+//
+//	go run ./extjsoncheck/cmd/extjsoncheck [-builtin] [dir ...]
+//
+// The exit status is 1 when there are mismatches, so it can gate a driver
+// upgrade in CI.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/extjsoncheck"
+)
+
+func main() {
+	builtin := flag.Bool("builtin", false, "also check the built-in corpus when directories are given")
+	flag.Parse()
+
+	var cases []extjsoncheck.Case
+
+	if *builtin || flag.NArg() == 0 {
+		builtinCases, err := extjsoncheck.DefaultCorpus()
+		if err != nil {
+			log.Fatalf("failed to load built-in corpus: %v", err)
+		}
+
+		cases = append(cases, builtinCases...)
+	}
+
+	for _, dir := range flag.Args() {
+		dirCases, err := extjsoncheck.LoadCorpus(os.DirFS(dir), ".")
+		if err != nil {
+			log.Fatalf("failed to load corpus %q: %v", dir, err)
+		}
+
+		cases = append(cases, dirCases...)
+	}
+
+	targets := extjsoncheck.DefaultTargets()
+	mismatches := extjsoncheck.Check(cases, targets)
+
+	for _, m := range mismatches {
+		fmt.Println(m)
+	}
+
+	fmt.Printf("%d cases, %d targets, %d mismatches\n", len(cases), len(targets), len(mismatches))
+
+	if len(mismatches) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,110 @@
+package extjsoncheck
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// compare will return a mismatch, without case, target or stage, for every
+// field whose type or value differs between want and got. Unordered
+// comparisons match fields by key, ordered ones also require the same
+// position. Partial comparisons only look at fields present in both.
+func compare(want, got bson.Raw, ordered, partial bool) []Mismatch {
+	return compareDocuments("", want, got, ordered, partial, false)
+}
+
+func compareDocuments(prefix string, want, got bson.Raw, ordered, partial, array bool) []Mismatch {
+	wantElems, err := want.Elements()
+	if err != nil {
+		return []Mismatch{{Path: prefix, Want: "valid BSON", Got: err.Error()}}
+	}
+
+	gotElems, err := got.Elements()
+	if err != nil {
+		return []Mismatch{{Path: prefix, Want: "valid BSON", Got: err.Error()}}
+	}
+
+	gotByKey := make(map[string]int, len(gotElems))
+	for i, elem := range gotElems {
+		gotByKey[elem.Key()] = i
+	}
+
+	var mismatches []Mismatch
+
+	for i, wantElem := range wantElems {
+		key := wantElem.Key()
+		fieldPath := join(prefix, key)
+
+		j, ok := gotByKey[key]
+		if !ok {
+			if !partial {
+				mismatches = append(mismatches, Mismatch{Path: fieldPath, Want: describe(wantElem.Value()), Got: "missing"})
+			}
+
+			continue
+		}
+
+		// Arrays always keep their order, even inside a map.
+		if (ordered || array) && !partial && i != j {
+			mismatches = append(mismatches, Mismatch{
+				Path: fieldPath,
+				Want: "position " + strconv.Itoa(i),
+				Got:  "position " + strconv.Itoa(j),
+			})
+		}
+
+		mismatches = append(mismatches, compareValues(fieldPath, wantElem.Value(), gotElems[j].Value(), ordered, partial)...)
+	}
+
+	if partial {
+		return mismatches
+	}
+
+	wantKeys := make(map[string]bool, len(wantElems))
+	for _, elem := range wantElems {
+		wantKeys[elem.Key()] = true
+	}
+
+	for _, gotElem := range gotElems {
+		if !wantKeys[gotElem.Key()] {
+			mismatches = append(mismatches, Mismatch{Path: join(prefix, gotElem.Key()), Want: "missing", Got: describe(gotElem.Value())})
+		}
+	}
+
+	return mismatches
+}
+
+func compareValues(fieldPath string, want, got bson.RawValue, ordered, partial bool) []Mismatch {
+	if want.Type != got.Type {
+		return []Mismatch{{Path: fieldPath, Want: describe(want), Got: describe(got)}}
+	}
+
+	switch want.Type {
+	case bson.TypeEmbeddedDocument:
+		return compareDocuments(fieldPath, want.Document(), got.Document(), ordered, partial, false)
+	case bson.TypeArray:
+		return compareDocuments(fieldPath, bson.Raw(want.Array()), bson.Raw(got.Array()), ordered, partial, true)
+	}
+
+	if !bytes.Equal(want.Value, got.Value) {
+		return []Mismatch{{Path: fieldPath, Want: describe(want), Got: describe(got)}}
+	}
+
+	return nil
+}
+
+// describe will return the type and value of rv, e.g. "timestamp {1 2}".
+func describe(rv bson.RawValue) string {
+	return fmt.Sprintf("%v %v", rv.Type, rv)
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + "." + key
+}
@@ -0,0 +1,135 @@
+package extjsoncheck
+
+import (
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed corpus/*.json
+var defaultCorpus embed.FS
+
+// bsonTypeInt64 is the bson_type of the int64 corpus file.
+const bsonTypeInt64 = "0x12"
+
+// Case is a single Extended JSON document to round-trip.
+type Case struct {
+	Name      string // File and description, e.g. "timestamp.json: in array"
+	Canonical bool   // Whether JSON is canonical (true) or relaxed (false) Extended JSON
+	JSON      string // A document, or an array for array targets
+
+	// BSON is the expected encoding; for an array, that of the array
+	// document, with keys "0", "1", etc. It is required: taking it from
+	// bson.UnmarshalExtJSON would compare the decoder under test with itself.
+	BSON []byte
+}
+
+// corpusFile is a file in the format of the BSON corpus specification tests,
+// https://github.com/mongodb/specifications/tree/master/source/bson-corpus.
+// Only the valid cases are used.
+type corpusFile struct {
+	Description string `json:"description"`
+	BSONType    string `json:"bson_type"`
+	TestKey     string `json:"test_key"`
+	Valid       []struct {
+		Description      string `json:"description"`
+		CanonicalBSON    string `json:"canonical_bson"`
+		CanonicalExtJSON string `json:"canonical_extjson"`
+		RelaxedExtJSON   string `json:"relaxed_extjson"`
+		Lossy            bool   `json:"lossy"`
+	} `json:"valid"`
+}
+
+// DefaultCorpus will return the built-in corpus, which covers the corner cases
+// that have regressed before: timestamps in arrays, including top-level ones,
+// decimal128, dates before 1970, binary subtypes and escaped strings.
+func DefaultCorpus() ([]Case, error) {
+	return LoadCorpus(defaultCorpus, "corpus")
+}
+
+// LoadCorpus will load every .json file in dir of fsys. Each file is in the
+// BSON corpus specification format; every valid, lossless entry yields a
+// canonical case and, when present, a relaxed case expected to encode to the
+// same canonical BSON. Use os.DirFS to load the
+// specification's own corpus from disk.
+func LoadCorpus(fsys fs.FS, dir string) ([]Case, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read corpus directory: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			files = append(files, entry.Name())
+		}
+	}
+
+	sort.Strings(files)
+
+	var cases []Case
+
+	for _, name := range files {
+		data, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		fileCases, err := parseCorpusFile(name, data)
+		if err != nil {
+			return nil, err
+		}
+
+		cases = append(cases, fileCases...)
+	}
+
+	return cases, nil
+}
+
+func parseCorpusFile(name string, data []byte) ([]Case, error) {
+	var file corpusFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+
+	var cases []Case
+
+	for _, valid := range file.Valid {
+		// Lossy cases don't round-trip by definition.
+		if valid.Lossy || valid.CanonicalExtJSON == "" {
+			continue
+		}
+
+		canonicalBSON, err := hex.DecodeString(valid.CanonicalBSON)
+		if err != nil {
+			return nil, fmt.Errorf("invalid canonical_bson in %s: %q: %w", name, valid.Description, err)
+		}
+
+		caseName := name + ": " + valid.Description
+
+		cases = append(cases, Case{
+			Name:      caseName,
+			Canonical: true,
+			JSON:      valid.CanonicalExtJSON,
+			BSON:      canonicalBSON,
+		})
+
+		// Relaxed Extended JSON loses the int64 type, an int64 that fits in
+		// an int32 reads back as an int32, so its relaxed form doesn't encode
+		// to the canonical BSON.
+		if valid.RelaxedExtJSON != "" && file.BSONType != bsonTypeInt64 {
+			cases = append(cases, Case{
+				Name: caseName + " (relaxed)",
+				JSON: valid.RelaxedExtJSON,
+				BSON: canonicalBSON,
+			})
+		}
+	}
+
+	return cases, nil
+}
@@ -0,0 +1,200 @@
+package extjsoncheck
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type timestamps struct {
+	A []bson.Timestamp `bson:"a"`
+}
+
+func mustMarshal(t *testing.T, doc bson.D) []byte {
+	t.Helper()
+
+	data, err := bson.Marshal(doc)
+	require.NoError(t, err)
+
+	return data
+}
+
+func TestDefaultCorpus(t *testing.T) {
+	cases, err := DefaultCorpus()
+	require.NoError(t, err)
+	require.NotEmpty(t, cases)
+
+	for _, m := range Check(cases, DefaultTargets()) {
+		t.Error(m)
+	}
+
+	var tsArray []Case
+	for _, c := range cases {
+		if strings.HasPrefix(c.Name, "timestamp.json: Timestamps in an array") {
+			tsArray = append(tsArray, c)
+		}
+	}
+
+	require.Len(t, tsArray, 1)
+
+	for _, m := range Check(tsArray, []Target{StructTarget[timestamps]("timestamps")}) {
+		t.Error(m)
+	}
+}
+
+func TestCheck_ReportsTypeChange(t *testing.T) {
+	type narrow struct {
+		N int32 `bson:"n"`
+	}
+
+	cases := []Case{{Name: "int64", Canonical: true, JSON: `{"n": {"$numberLong": "1"}}`, BSON: mustMarshal(t, bson.D{{Key: "n", Value: int64(1)}})}}
+
+	mismatches := Check(cases, []Target{StructTarget[narrow]("narrow")})
+	require.NotEmpty(t, mismatches)
+
+	assert.Equal(t, StageBSON, mismatches[0].Stage)
+	assert.Equal(t, "n", mismatches[0].Path)
+	assert.Contains(t, mismatches[0].Want, "64-bit integer")
+	assert.Contains(t, mismatches[0].Got, "32-bit integer")
+}
+
+func TestCheck_ReportsDecodeError(t *testing.T) {
+	type wrong struct {
+		A []string `bson:"a"`
+	}
+
+	cases := []Case{{
+		Name:      "ts",
+		Canonical: true,
+		JSON:      `{"a": [{"$timestamp": {"t": 1, "i": 2}}]}`,
+		BSON:      mustMarshal(t, bson.D{{Key: "a", Value: bson.A{bson.Timestamp{T: 1, I: 2}}}}),
+	}}
+
+	mismatches := Check(cases, []Target{StructTarget[wrong]("wrong")})
+	require.Len(t, mismatches, 1)
+
+	assert.Equal(t, StageDecode, mismatches[0].Stage)
+}
+
+func TestDefaultCorpus_TopLevelArrays(t *testing.T) {
+	cases, err := DefaultCorpus()
+	require.NoError(t, err)
+
+	var arrays []Case
+	for _, c := range cases {
+		if isArray(c.JSON) {
+			arrays = append(arrays, c)
+		}
+	}
+
+	require.Len(t, arrays, 3, "timestamps, and dates in canonical and relaxed form")
+
+	// Corrupting the expected BSON must be reported by the bson.A target.
+	corrupt := arrays[0]
+	corrupt.BSON = append([]byte(nil), corrupt.BSON...)
+	corrupt.BSON[len(corrupt.BSON)-2] ^= 0xFF
+
+	mismatches := Check([]Case{corrupt}, DefaultTargets())
+	require.NotEmpty(t, mismatches)
+
+	for _, m := range mismatches {
+		assert.Equal(t, "bson.A", m.Target)
+	}
+}
+
+func TestCheck_ReportsMissingBSON(t *testing.T) {
+	cases := []Case{{Name: "no bson", Canonical: true, JSON: `{"a": 1}`}}
+
+	mismatches := Check(cases, DefaultTargets())
+	require.Len(t, mismatches, 1)
+
+	assert.Equal(t, StageExpected, mismatches[0].Stage)
+}
+
+func TestCheck_ComparesWithExpectedBSON(t *testing.T) {
+	// A decoder that reads the date wrong must not agree with itself.
+	cases := []Case{{
+		Name:      "date",
+		Canonical: true,
+		JSON:      `{"a": {"$date": {"$numberLong": "0"}}}`,
+		BSON:      mustMarshal(t, bson.D{{Key: "a", Value: bson.DateTime(-1)}}),
+	}}
+
+	mismatches := Check(cases, DefaultTargets())
+	require.NotEmpty(t, mismatches)
+
+	assert.Equal(t, StageBSON, mismatches[0].Stage)
+	assert.Equal(t, "a", mismatches[0].Path)
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	assert.Equal(t, canonicalJSON(`{"a" : "\u00e9\u2606"}`), canonicalJSON(`{"a":"é☆"}`))
+	assert.Equal(t, `{"a":"a\u0000b","b":[1.0,true,null]}`, canonicalJSON(`{ "a" : "a\u0000b", "b" : [ 1.0, true, null ] }`))
+	assert.NotEqual(t, canonicalJSON(`{"a":1,"b":2}`), canonicalJSON(`{"b":2,"a":1}`), "the field order must be kept")
+	assert.NotEqual(t, canonicalJSON(`{"a":1}`), canonicalJSON(`{"a":1.0}`))
+	assert.Equal(t, `{"a":`, canonicalJSON(`{"a":`))
+	assert.Equal(t, `{} {}`, canonicalJSON(`{} {}`))
+}
+
+func TestDefaultCorpus_EscapedStrings(t *testing.T) {
+	cases, err := DefaultCorpus()
+	require.NoError(t, err)
+
+	var escaped []Case
+	for _, c := range cases {
+		if strings.HasPrefix(c.Name, "string.json:") && strings.Contains(c.JSON, `\u`) {
+			escaped = append(escaped, c)
+		}
+	}
+
+	require.Len(t, escaped, 3)
+	assert.Empty(t, Check(escaped, DefaultTargets()))
+}
+
+func TestCompare_Unordered(t *testing.T) {
+	want, err := bson.Marshal(bson.D{{Key: "a", Value: 1}, {Key: "b", Value: bson.A{1, 2}}})
+	require.NoError(t, err)
+
+	got, err := bson.Marshal(bson.D{{Key: "b", Value: bson.A{1, 2}}, {Key: "a", Value: 1}})
+	require.NoError(t, err)
+
+	assert.Empty(t, compare(want, got, false, false))
+	assert.NotEmpty(t, compare(want, got, true, false))
+
+	swapped, err := bson.Marshal(bson.D{{Key: "a", Value: 1}, {Key: "b", Value: bson.A{2, 1}}})
+	require.NoError(t, err)
+
+	assert.Len(t, compare(want, swapped, false, false), 2, "array values still compare by position")
+}
+
+func TestParseCorpusFile_SkipsLossy(t *testing.T) {
+	data := []byte(`{"valid": [
+		{"description": "ok", "canonical_bson": "0500000000", "canonical_extjson": "{}", "relaxed_extjson": "{}"},
+		{"description": "lossy", "canonical_bson": "0500000000", "canonical_extjson": "{}", "lossy": true}
+	]}`)
+
+	cases, err := parseCorpusFile("f.json", data)
+	require.NoError(t, err)
+	require.Len(t, cases, 2)
+
+	assert.Equal(t, "f.json: ok", cases[0].Name)
+	assert.True(t, cases[0].Canonical)
+	assert.Equal(t, []byte{5, 0, 0, 0, 0}, cases[0].BSON)
+	assert.Equal(t, "f.json: ok (relaxed)", cases[1].Name)
+	assert.Equal(t, cases[0].BSON, cases[1].BSON, "relaxed cases expect the canonical BSON")
+}
+
+func TestParseCorpusFile_SkipsRelaxedInt64(t *testing.T) {
+	data := []byte(`{"bson_type": "0x12", "valid": [
+		{"description": "1", "canonical_bson": "10000000126100010000000000000000", "canonical_extjson": "{\"a\": {\"$numberLong\": \"1\"}}", "relaxed_extjson": "{\"a\": 1}"}
+	]}`)
+
+	cases, err := parseCorpusFile("int64.json", data)
+	require.NoError(t, err)
+	require.Len(t, cases, 1)
+
+	assert.Empty(t, Check(cases, DefaultTargets()))
+}
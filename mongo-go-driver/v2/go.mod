@@ -1,8 +1,8 @@
 module github.com/prestonvasquez/mongo-go-driver/v2
 
-go 1.22.0
+go 1.23.0
 
-toolchain go1.22.6
+toolchain go1.23.4
 
 require (
 	github.com/aws/aws-sdk-go-v2 v1.26.1
@@ -0,0 +1,239 @@
+// Package golden compares the commands a driver operation sends to checked-in
+// Extended JSON golden files.
+//
+// An operation is run against a mockdeploy.Deployment, the outgoing commands
+// are captured, fields that change from run to run (lsid, $clusterTime,
+// txnNumber, and optionally driver-generated ObjectIDs) are replaced with
+// placeholders and the result is compared to testdata/<name>.json, field
+// order included, since the server reads the command name from the first
+// field. After an intended change in the commands the driver sends, run the
+// tests with -update, a flag the test package defines and passes to
+// WithUpdate, or with GOLDEN_UPDATE=1 to rewrite the golden files.
+package golden
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/mockdeploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// UpdateEnv is the environment variable that, when set to true, makes the
+// tests rewrite the golden files instead of comparing against them, whatever
+// is passed to WithUpdate.
+const UpdateEnv = "GOLDEN_UPDATE"
+
+// VolatileFields are the top-level command fields that differ between runs
+// and are always normalized.
+var VolatileFields = []string{"lsid", "$clusterTime", "txnNumber"}
+
+// Config is the configuration for a golden comparison.
+type Config struct {
+	dir      string   // Directory holding the golden files
+	volatile []string // Extra top-level fields to normalize
+	skip     []string // Names of commands to leave out
+	objectID bool     // Replace every ObjectID with a placeholder
+	update   bool     // Rewrite the golden files instead of comparing
+}
+
+type ConfigOpt func(*Config)
+
+// WithDir sets the directory holding the golden files. The default is
+// "testdata".
+func WithDir(dir string) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.dir = dir
+	}
+}
+
+// WithVolatileFields adds top-level fields to normalize on top of
+// VolatileFields, e.g. "maxTimeMS" for operations run with a timeout.
+func WithVolatileFields(fields ...string) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.volatile = append(cfg.volatile, fields...)
+	}
+}
+
+// WithSkipCommands leaves out commands with the given names. "endSessions" is
+// always left out since it depends on when the client is disconnected.
+func WithSkipCommands(names ...string) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.skip = append(cfg.skip, names...)
+	}
+}
+
+// WithObjectIDs replaces every ObjectID in the commands with the placeholder
+// "<ObjectID>", for operations where the driver generates the _id of inserted
+// documents.
+func WithObjectIDs() ConfigOpt {
+	return func(cfg *Config) {
+		cfg.objectID = true
+	}
+}
+
+// WithUpdate rewrites the golden files with the captured commands instead of
+// comparing them when update is true, e.g. from an -update test flag of the
+// importing package. Setting GOLDEN_UPDATE also rewrites them.
+func WithUpdate(update bool) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.update = cfg.update || update
+	}
+}
+
+func newConfig(opts ...ConfigOpt) Config {
+	update, _ := strconv.ParseBool(os.Getenv(UpdateEnv))
+
+	cfg := Config{
+		dir:      "testdata",
+		volatile: append([]string(nil), VolatileFields...),
+		skip:     []string{"endSessions"},
+		update:   update,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return cfg
+}
+
+// Run will run op with a client connected to d and compare the commands it
+// sends to the golden file for name. The error returned by op is returned so
+// that the test can assert on it; a failed operation still has its commands
+// compared.
+func Run(t *testing.T, d *mockdeploy.Deployment, name string, op func(ctx context.Context, client *mongo.Client) error, opts ...ConfigOpt) error {
+	t.Helper()
+
+	client, err := d.NewClient()
+	require.NoError(t, err, "failed to connect to mock deployment")
+
+	defer func() { _ = client.Disconnect(context.Background()) }()
+
+	d.Reset()
+
+	opErr := op(context.Background(), client)
+
+	Assert(t, name, d.Commands(), opts...)
+
+	return opErr
+}
+
+// Assert will compare the commands to the golden file for name, or rewrite
+// the golden file when updating. Fields must be in the same order: both sides
+// are decoded into bson.D and compared as canonical Extended JSON.
+func Assert(t testing.TB, name string, cmds []mockdeploy.Command, opts ...ConfigOpt) {
+	t.Helper()
+
+	cfg := newConfig(opts...)
+
+	got, err := marshal(cmds, cfg)
+	require.NoError(t, err, "failed to marshal commands")
+
+	path := filepath.Join(cfg.dir, name+".json")
+
+	if cfg.update {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, got, 0o644))
+
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err, "failed to read golden file, run with -update or %s=1 to create it", UpdateEnv)
+
+	want, err := reformat(data)
+	require.NoError(t, err, "failed to parse golden file %s", path)
+
+	assert.Equal(t, string(want), string(got), "commands differ from %s", path)
+}
+
+// reformat will return golden Extended JSON as marshal writes it, so that
+// only whitespace differences are ignored.
+func reformat(data []byte) ([]byte, error) {
+	var doc bson.D
+	if err := bson.UnmarshalExtJSON(data, true, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Extended JSON: %w", err)
+	}
+
+	return marshalIndent(doc)
+}
+
+// Normalize will return the command with each of the given top-level fields
+// replaced by the placeholder "<field>", so that golden files record that the
+// field was sent without depending on its value.
+func Normalize(cmd bson.Raw, fields ...string) (bson.D, error) {
+	var doc bson.D
+	if err := bson.Unmarshal(cmd, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal command: %w", err)
+	}
+
+	for i, elem := range doc {
+		if slices.Contains(fields, elem.Key) {
+			doc[i].Value = "<" + elem.Key + ">"
+		}
+	}
+
+	return doc, nil
+}
+
+// marshal will encode the normalized commands as indented canonical Extended
+// JSON, which keeps the distinction between int32, int64 and double.
+func marshal(cmds []mockdeploy.Command, cfg Config) ([]byte, error) {
+	docs := bson.A{}
+
+	for _, cmd := range cmds {
+		if slices.Contains(cfg.skip, cmd.Name) {
+			continue
+		}
+
+		doc, err := Normalize(cmd.Document, cfg.volatile...)
+		if err != nil {
+			return nil, err
+		}
+
+		if cfg.objectID {
+			doc = replaceObjectIDs(doc).(bson.D)
+		}
+
+		docs = append(docs, doc)
+	}
+
+	return marshalIndent(bson.D{{Key: "commands", Value: docs}})
+}
+
+func marshalIndent(doc bson.D) ([]byte, error) {
+	b, err := bson.MarshalExtJSONIndent(doc, true, false, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal Extended JSON: %w", err)
+	}
+
+	return append(b, '\n'), nil
+}
+
+// replaceObjectIDs will return v with every ObjectID, at any depth, replaced
+// by a placeholder.
+func replaceObjectIDs(v any) any {
+	switch v := v.(type) {
+	case bson.ObjectID:
+		return "<ObjectID>"
+	case bson.D:
+		for i := range v {
+			v[i].Value = replaceObjectIDs(v[i].Value)
+		}
+	case bson.A:
+		for i := range v {
+			v[i] = replaceObjectIDs(v[i])
+		}
+	}
+
+	return v
+}
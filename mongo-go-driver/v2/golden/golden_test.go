@@ -0,0 +1,272 @@
+package golden
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/mockdeploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata instead of comparing against them")
+
+// recordingT captures failures instead of failing the test.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (rt *recordingT) Helper() {}
+
+func (rt *recordingT) Errorf(format string, args ...any) {
+	rt.errors = append(rt.errors, fmt.Sprintf(format, args...))
+}
+
+// bulkWriteReply will reply to a client bulkWrite with a successful result for
+// every operation in the batch.
+func bulkWriteReply(cmd mockdeploy.Command) bson.D {
+	ops, _ := cmd.Document.Lookup("ops").Array().Values()
+
+	var (
+		results              = bson.A{}
+		nInserted, nModified int32
+	)
+
+	for i, op := range ops {
+		result := bson.D{{Key: "ok", Value: 1.0}, {Key: "idx", Value: int32(i)}, {Key: "n", Value: int32(1)}}
+
+		if _, err := op.Document().LookupErr("insert"); err == nil {
+			nInserted++
+		} else {
+			result = append(result, bson.E{Key: "nModified", Value: int32(1)})
+			nModified++
+		}
+
+		results = append(results, result)
+	}
+
+	return mockdeploy.OK(
+		bson.E{Key: "cursor", Value: bson.D{
+			{Key: "id", Value: int64(0)},
+			{Key: "ns", Value: "admin.$cmd.bulkWrite"},
+			{Key: "firstBatch", Value: results},
+		}},
+		bson.E{Key: "nErrors", Value: int32(0)},
+		bson.E{Key: "nInserted", Value: nInserted},
+		bson.E{Key: "nMatched", Value: nModified},
+		bson.E{Key: "nModified", Value: nModified},
+		bson.E{Key: "nUpserted", Value: int32(0)},
+		bson.E{Key: "nDeleted", Value: int32(0)},
+	)
+}
+
+func insertOne(db, coll string, doc any) mongo.ClientBulkWrite {
+	return mongo.ClientBulkWrite{
+		Database:   db,
+		Collection: coll,
+		Model:      mongo.NewClientInsertOneModel().SetDocument(doc),
+	}
+}
+
+func newDeployment(t *testing.T) *mockdeploy.Deployment {
+	t.Helper()
+
+	d := mockdeploy.New(t)
+	d.On("bulkWrite").ReplyFunc(bulkWriteReply).Repeat()
+
+	return d
+}
+
+func TestNormalize(t *testing.T) {
+	raw, err := bson.Marshal(bson.D{
+		{Key: "insert", Value: "coll"},
+		{Key: "lsid", Value: bson.D{{Key: "id", Value: "abc"}}},
+		{Key: "txnNumber", Value: int64(7)},
+	})
+	require.NoError(t, err)
+
+	doc, err := Normalize(raw, VolatileFields...)
+	require.NoError(t, err)
+
+	assert.Equal(t, bson.D{
+		{Key: "insert", Value: "coll"},
+		{Key: "lsid", Value: "<lsid>"},
+		{Key: "txnNumber", Value: "<txnNumber>"},
+	}, doc)
+}
+
+func TestBulkWrite_Batching(t *testing.T) {
+	d := newDeployment(t)
+	d.SetMaxBatchCount(2)
+
+	err := Run(t, d, "batching", func(ctx context.Context, client *mongo.Client) error {
+		var writes []mongo.ClientBulkWrite
+		for i := 0; i < 5; i++ {
+			writes = append(writes, insertOne("db", "x", bson.D{{Key: "_id", Value: i}}))
+		}
+
+		res, err := client.BulkWrite(ctx, writes)
+		if err == nil {
+			assert.Equal(t, int64(5), res.InsertedCount)
+		}
+
+		return err
+	}, WithUpdate(*update))
+	require.NoError(t, err)
+
+	assert.Len(t, d.CommandsNamed("bulkWrite"), 3, "5 inserts with maxWriteBatchSize 2")
+}
+
+func TestBulkWrite_UpdateStartsWithDollar(t *testing.T) {
+	d := newDeployment(t)
+
+	err := Run(t, d, "update_starts_with_dollar", func(ctx context.Context, client *mongo.Client) error {
+		writes := []mongo.ClientBulkWrite{insertOne("db", "k", bson.D{{Key: "x", Value: 1}})}
+
+		if _, err := client.BulkWrite(ctx, writes); err != nil {
+			return err
+		}
+
+		writes = []mongo.ClientBulkWrite{{
+			Database:   "db",
+			Collection: "k",
+			Model: mongo.NewClientUpdateOneModel().
+				SetFilter(bson.D{}).
+				SetUpdate(bson.D{{Key: "set", Value: bson.D{{Key: "status", Value: "D"}}}}),
+		}}
+
+		_, err := client.BulkWrite(ctx, writes)
+
+		return err
+	}, WithObjectIDs(), WithUpdate(*update))
+	assert.Error(t, err, "an update document without $ operators must be rejected")
+}
+
+func TestBulkWrite_ReplaceOneDoesNotHaveDollar(t *testing.T) {
+	d := newDeployment(t)
+
+	err := Run(t, d, "replace_one_does_not_have_dollar", func(ctx context.Context, client *mongo.Client) error {
+		writes := []mongo.ClientBulkWrite{insertOne("db", "k", bson.D{{Key: "x", Value: 1}})}
+
+		if _, err := client.BulkWrite(ctx, writes); err != nil {
+			return err
+		}
+
+		writes = []mongo.ClientBulkWrite{{
+			Database:   "db",
+			Collection: "k",
+			Model: mongo.NewClientReplaceOneModel().
+				SetFilter(bson.D{}).
+				SetReplacement(bson.D{{Key: "$x", Value: 1}}),
+		}}
+
+		_, err := client.BulkWrite(ctx, writes)
+
+		return err
+	}, WithObjectIDs(), WithUpdate(*update))
+	assert.Error(t, err, "a replacement document with $ operators must be rejected")
+}
+
+func TestBulkWrite_VerboseResults(t *testing.T) {
+	d := newDeployment(t)
+
+	err := Run(t, d, "verbose_results", func(ctx context.Context, client *mongo.Client) error {
+		writes := []mongo.ClientBulkWrite{
+			insertOne("db", "coll", bson.D{{Key: "x", Value: 1}}),
+			insertOne("db", "coll2", bson.D{{Key: "x", Value: 2}}),
+			{
+				Database:   "db",
+				Collection: "coll",
+				Model: mongo.NewClientUpdateOneModel().
+					SetFilter(bson.D{{Key: "x", Value: 1}}).
+					SetUpdate(bson.D{{Key: "$set", Value: bson.D{{Key: "x", Value: 3}}}}),
+			},
+		}
+
+		res, err := client.BulkWrite(ctx, writes, options.ClientBulkWrite().SetVerboseResults(true))
+		if err != nil {
+			return err
+		}
+
+		assert.Len(t, res.InsertResults, 2)
+		assert.Len(t, res.UpdateResults, 1)
+
+		return nil
+	}, WithObjectIDs(), WithUpdate(*update))
+	require.NoError(t, err)
+}
+
+func TestBulkWrite_NoNamespace(t *testing.T) {
+	d := newDeployment(t)
+
+	// Whether or not the driver rejects the empty collection name, it must not
+	// panic; the golden file records what, if anything, is sent.
+	_ = Run(t, d, "no_namespace", func(ctx context.Context, client *mongo.Client) error {
+		writes := []mongo.ClientBulkWrite{insertOne("db", "", bson.D{{Key: "x", Value: 1}})}
+
+		_, err := client.BulkWrite(ctx, writes)
+
+		return err
+	}, WithObjectIDs(), WithUpdate(*update))
+}
+
+func command(t *testing.T, doc bson.D) mockdeploy.Command {
+	t.Helper()
+
+	raw, err := bson.Marshal(doc)
+	require.NoError(t, err)
+
+	return mockdeploy.Command{Name: doc[0].Key, Document: raw}
+}
+
+func TestAssert_FieldOrder(t *testing.T) {
+	t.Setenv(UpdateEnv, "false")
+
+	dir := t.TempDir()
+
+	find := command(t, bson.D{{Key: "find", Value: "coll"}, {Key: "filter", Value: bson.D{}}, {Key: "limit", Value: int64(1)}})
+	Assert(t, "find", []mockdeploy.Command{find}, WithDir(dir), WithUpdate(true))
+
+	t.Run("same order", func(t *testing.T) {
+		rt := &recordingT{TB: t}
+		Assert(rt, "find", []mockdeploy.Command{find}, WithDir(dir))
+
+		assert.Empty(t, rt.errors)
+	})
+
+	t.Run("whitespace", func(t *testing.T) {
+		compact := `{"commands":[{"find":"coll","filter":{},"limit":{"$numberLong":"1"}}]}`
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "compact.json"), []byte(compact), 0o644))
+
+		rt := &recordingT{TB: t}
+		Assert(rt, "compact", []mockdeploy.Command{find}, WithDir(dir))
+
+		assert.Empty(t, rt.errors)
+	})
+
+	t.Run("reordered", func(t *testing.T) {
+		reordered := command(t, bson.D{{Key: "filter", Value: bson.D{}}, {Key: "find", Value: "coll"}, {Key: "limit", Value: int64(1)}})
+
+		rt := &recordingT{TB: t}
+		Assert(rt, "find", []mockdeploy.Command{reordered}, WithDir(dir))
+
+		assert.NotEmpty(t, rt.errors, "a command with its fields reordered must not match")
+	})
+
+	t.Run("type", func(t *testing.T) {
+		int32Limit := command(t, bson.D{{Key: "find", Value: "coll"}, {Key: "filter", Value: bson.D{}}, {Key: "limit", Value: int32(1)}})
+
+		rt := &recordingT{TB: t}
+		Assert(rt, "find", []mockdeploy.Command{int32Limit}, WithDir(dir))
+
+		assert.NotEmpty(t, rt.errors, "an int32 must not match an int64")
+	})
+}
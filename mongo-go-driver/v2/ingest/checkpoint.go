@@ -0,0 +1,145 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Checkpoint records how far a pipeline got. Every document up to and
+// including Offset has been embedded and written.
+type Checkpoint struct {
+	Offset    int64     `bson:"offset"`    // Number of source documents that have been written
+	LastID    any       `bson:"lastID"`    // _id of the last written document, if it had one
+	UpdatedAt time.Time `bson:"updatedAt"` // When the checkpoint was saved
+}
+
+// CheckpointStore persists checkpoints between runs of a pipeline.
+type CheckpointStore interface {
+	// Load returns the last saved checkpoint, or nil if there is none.
+	Load(ctx context.Context) (*Checkpoint, error)
+
+	// Save persists the checkpoint, replacing any previous one.
+	Save(ctx context.Context, cp Checkpoint) error
+}
+
+// MemoryCheckpointStore keeps the checkpoint in memory. It is useful for tests
+// and for resuming within a single process.
+type MemoryCheckpointStore struct {
+	mu sync.Mutex
+	cp *Checkpoint
+}
+
+var _ CheckpointStore = &MemoryCheckpointStore{}
+
+func (store *MemoryCheckpointStore) Load(context.Context) (*Checkpoint, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.cp == nil {
+		return nil, nil
+	}
+
+	cp := *store.cp
+
+	return &cp, nil
+}
+
+func (store *MemoryCheckpointStore) Save(_ context.Context, cp Checkpoint) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.cp = &cp
+
+	return nil
+}
+
+// CollectionCheckpointStore keeps the checkpoint as a single document, keyed by
+// the pipeline name, in a MongoDB collection.
+type CollectionCheckpointStore struct {
+	coll *mongo.Collection
+	name string
+}
+
+var _ CheckpointStore = &CollectionCheckpointStore{}
+
+// NewCollectionCheckpointStore will return a checkpoint store that saves the
+// checkpoint for the named pipeline in coll.
+func NewCollectionCheckpointStore(coll *mongo.Collection, name string) *CollectionCheckpointStore {
+	return &CollectionCheckpointStore{coll: coll, name: name}
+}
+
+func (store *CollectionCheckpointStore) Load(ctx context.Context) (*Checkpoint, error) {
+	cp := &Checkpoint{}
+
+	err := store.coll.FindOne(ctx, bson.D{{Key: "_id", Value: store.name}}).Decode(cp)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint %q: %w", store.name, err)
+	}
+
+	return cp, nil
+}
+
+func (store *CollectionCheckpointStore) Save(ctx context.Context, cp Checkpoint) error {
+	update := bson.D{{Key: "$set", Value: cp}}
+	opts := options.UpdateOne().SetUpsert(true)
+
+	_, err := store.coll.UpdateOne(ctx, bson.D{{Key: "_id", Value: store.name}}, update, opts)
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint %q: %w", store.name, err)
+	}
+
+	return nil
+}
+
+// watermark tracks batches that complete out of order and reports the
+// highest batch below which every batch has completed.
+type watermark struct {
+	next int64 // Sequence number of the first incomplete batch
+	done map[int64]batchEnd
+}
+
+// batchEnd is what a checkpoint needs to know about a completed batch.
+type batchEnd struct {
+	offset int64
+	lastID any
+}
+
+func newWatermark(start int64) *watermark {
+	return &watermark{next: start, done: map[int64]batchEnd{}}
+}
+
+// complete marks the batch as done. If this advances the watermark, the end of
+// the newest contiguous batch is returned.
+func (wm *watermark) complete(seq int64, end batchEnd) (batchEnd, bool) {
+	wm.done[seq] = end
+
+	var (
+		last     batchEnd
+		advanced bool
+	)
+
+	for {
+		end, ok := wm.done[wm.next]
+		if !ok {
+			break
+		}
+
+		delete(wm.done, wm.next)
+		wm.next++
+
+		last, advanced = end, true
+	}
+
+	return last, advanced
+}
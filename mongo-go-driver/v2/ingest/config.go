@@ -0,0 +1,132 @@
+package ingest
+
+import "time"
+
+// Mode determines how embedded documents are written to the collection.
+type Mode int
+
+const (
+	// ModeUpsert replaces (or inserts) the whole document, keyed by _id. Documents
+	// without an _id are given a new ObjectID.
+	ModeUpsert Mode = iota
+
+	// ModeReembed only sets the embedding field on existing documents, leaving
+	// the rest of the document untouched.
+	ModeReembed
+)
+
+// Config is the configuration for an ingestion pipeline.
+type Config struct {
+	batchSize      int             // Number of documents embedded and written together
+	concurrency    int             // Number of batches in flight at once
+	maxRetries     int             // Number of retries for a failed embed or write
+	initialBackoff time.Duration   // Backoff before the first retry
+	maxBackoff     time.Duration   // Upper bound on the backoff between retries
+	textField      string          // Field holding the text to embed
+	embeddingField string          // Field holding the vector embedding
+	mode           Mode            // How documents are written
+	checkpoints    CheckpointStore // Where to persist progress, nil to disable
+	progress       func(Progress)  // Called after each batch is written
+}
+
+type ConfigOpt func(*Config)
+
+// WithBatchSize sets the number of documents that are embedded in a single
+// EmbedDocuments call and written in a single BulkWrite. The default is 100.
+func WithBatchSize(size int) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.batchSize = size
+	}
+}
+
+// WithConcurrency sets the maximum number of batches that are embedded and
+// written at the same time. The default is 4.
+func WithConcurrency(n int) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.concurrency = n
+	}
+}
+
+// WithMaxRetries sets how many times an embed or write is retried before the
+// pipeline gives up. The default is 3.
+func WithMaxRetries(n int) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.maxRetries = n
+	}
+}
+
+// WithBackoff sets the initial and maximum backoff between retries. The
+// backoff doubles after every attempt. The default is 500ms up to 30s.
+func WithBackoff(initial, max time.Duration) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.initialBackoff = initial
+		cfg.maxBackoff = max
+	}
+}
+
+// WithTextField sets the name of the field holding the text. The default is
+// "page_content".
+func WithTextField(name string) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.textField = name
+	}
+}
+
+// WithEmbeddingField sets the name of the field the vector is written to. The
+// default is "embedding".
+func WithEmbeddingField(name string) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.embeddingField = name
+	}
+}
+
+// WithMode sets how documents are written. The default is ModeUpsert.
+func WithMode(mode Mode) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.mode = mode
+	}
+}
+
+// WithCheckpointStore enables resuming: progress is saved to the store after
+// every contiguous run of written batches, and loaded when the pipeline
+// starts.
+func WithCheckpointStore(store CheckpointStore) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.checkpoints = store
+	}
+}
+
+// WithProgress sets a callback that is called after each batch is written.
+// Calls are serialized.
+func WithProgress(fn func(Progress)) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.progress = fn
+	}
+}
+
+func newConfig(opts ...ConfigOpt) Config {
+	cfg := Config{
+		batchSize:      100,
+		concurrency:    4,
+		maxRetries:     3,
+		initialBackoff: 500 * time.Millisecond,
+		maxBackoff:     30 * time.Second,
+		textField:      "page_content",
+		embeddingField: "embedding",
+		mode:           ModeUpsert,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.batchSize < 1 {
+		cfg.batchSize = 1
+	}
+
+	if cfg.concurrency < 1 {
+		cfg.concurrency = 1
+	}
+
+	return cfg
+}
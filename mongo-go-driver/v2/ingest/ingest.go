@@ -0,0 +1,430 @@
+// Package ingest embeds large corpora and writes them to a collection in
+// batches. Unlike the vector store example, which embeds every text in one
+// EmbedDocuments call and writes them with one InsertMany, a pipeline embeds
+// batches with bounded concurrency and retries, writes them with unordered
+// BulkWrites and checkpoints its progress so that a backfill of millions of
+// documents can be stopped and resumed.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/tmc/langchaingo/embeddings"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Progress is a snapshot of a pipeline run.
+type Progress struct {
+	Batches  int64         // Batches written during this run
+	Written  int64         // Documents written during this run
+	Offset   int64         // Source documents written, including those from previous runs
+	Inserted int64         // Documents inserted, as reported by the server
+	Upserted int64         // Documents upserted, as reported by the server
+	Modified int64         // Documents modified, as reported by the server
+	Retries  int64         // Embed and write attempts that were retried
+	Elapsed  time.Duration // Time since the run started
+}
+
+// Rate returns the number of documents written per second during this run.
+func (p Progress) Rate() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(p.Written) / p.Elapsed.Seconds()
+}
+
+// Pipeline embeds documents from a source and writes them to a collection.
+type Pipeline struct {
+	coll     *mongo.Collection
+	embedder embeddings.Embedder
+	cfg      Config
+}
+
+// NewPipeline will return a pipeline that embeds with embedder and writes to
+// coll.
+func NewPipeline(coll *mongo.Collection, embedder embeddings.Embedder, opts ...ConfigOpt) *Pipeline {
+	return &Pipeline{
+		coll:     coll,
+		embedder: embedder,
+		cfg:      newConfig(opts...),
+	}
+}
+
+type batch struct {
+	seq  int64
+	docs []Document
+	end  batchEnd
+}
+
+type batchResult struct {
+	batch   batch
+	res     *mongo.BulkWriteResult
+	retries int64
+	err     error
+}
+
+// Run will ingest every document in src, returning once the source is
+// exhausted or the first batch fails after exhausting its retries. If a
+// checkpoint store is configured, documents written by a previous run are
+// skipped.
+func (p *Pipeline) Run(ctx context.Context, src Source) (Progress, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+
+	startOffset, err := p.resume(ctx, src)
+	if err != nil {
+		return Progress{Offset: startOffset}, err
+	}
+
+	progress := Progress{Offset: startOffset}
+
+	batches := make(chan batch)
+	results := make(chan batchResult)
+
+	// Read the source into batches. The error is only read after batches is
+	// closed.
+	var produceErr error
+	go func() {
+		defer close(batches)
+
+		produceErr = p.produce(ctx, src, startOffset, batches)
+	}()
+
+	// Embed and write batches with bounded concurrency.
+	done := make(chan struct{}, p.cfg.concurrency)
+	for i := 0; i < p.cfg.concurrency; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+
+			for b := range batches {
+				results <- p.process(ctx, b)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(results)
+
+		for i := 0; i < p.cfg.concurrency; i++ {
+			<-done
+		}
+	}()
+
+	// Collect results, advancing the checkpoint only when every batch before it
+	// has been written.
+	wm := newWatermark(0)
+
+	var firstErr error
+	for res := range results {
+		progress.Retries += res.retries
+
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to ingest batch %d: %w", res.batch.seq, res.err)
+			}
+
+			cancel()
+
+			continue
+		}
+
+		progress.Batches++
+		progress.Written += int64(len(res.batch.docs))
+
+		if res.res != nil {
+			progress.Inserted += res.res.InsertedCount
+			progress.Upserted += res.res.UpsertedCount
+			progress.Modified += res.res.ModifiedCount
+		}
+
+		if end, ok := wm.complete(res.batch.seq, res.batch.end); ok {
+			progress.Offset = end.offset
+
+			if p.cfg.checkpoints != nil && firstErr == nil {
+				cp := Checkpoint{Offset: end.offset, LastID: end.lastID, UpdatedAt: time.Now()}
+				if err := p.cfg.checkpoints.Save(ctx, cp); err != nil {
+					firstErr = err
+
+					cancel()
+				}
+			}
+		}
+
+		progress.Elapsed = time.Since(start)
+
+		if p.cfg.progress != nil {
+			p.cfg.progress(progress)
+		}
+	}
+
+	progress.Elapsed = time.Since(start)
+
+	if firstErr != nil {
+		return progress, firstErr
+	}
+
+	if produceErr != nil {
+		return progress, produceErr
+	}
+
+	return progress, nil
+}
+
+// resume will load the checkpoint, if any, and move the source past the
+// documents that have already been written. It returns the offset to resume
+// from.
+func (p *Pipeline) resume(ctx context.Context, src Source) (int64, error) {
+	if p.cfg.checkpoints == nil {
+		return 0, nil
+	}
+
+	cp, err := p.cfg.checkpoints.Load(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if cp == nil || cp.Offset == 0 {
+		return 0, nil
+	}
+
+	if resumer, ok := src.(Resumer); ok && cp.LastID != nil {
+		if err := resumer.ResumeAfter(ctx, cp.LastID); err != nil {
+			return 0, fmt.Errorf("failed to resume source after %v: %w", cp.LastID, err)
+		}
+
+		return cp.Offset, nil
+	}
+
+	for i := int64(0); i < cp.Offset; i++ {
+		if _, err := src.Next(ctx); err != nil {
+			return i, fmt.Errorf("failed to skip to checkpoint offset %d: %w", cp.Offset, err)
+		}
+	}
+
+	return cp.Offset, nil
+}
+
+// produce will read the source into batches until it is exhausted.
+func (p *Pipeline) produce(ctx context.Context, src Source, offset int64, batches chan<- batch) error {
+	var seq int64
+
+	send := func(docs []Document) bool {
+		offset += int64(len(docs))
+
+		b := batch{
+			seq:  seq,
+			docs: docs,
+			end:  batchEnd{offset: offset, lastID: docs[len(docs)-1].ID},
+		}
+
+		seq++
+
+		select {
+		case batches <- b:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	docs := make([]Document, 0, p.cfg.batchSize)
+	for {
+		doc, err := src.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read source: %w", err)
+		}
+
+		docs = append(docs, doc)
+		if len(docs) < p.cfg.batchSize {
+			continue
+		}
+
+		if !send(docs) {
+			return ctx.Err()
+		}
+
+		docs = make([]Document, 0, p.cfg.batchSize)
+	}
+
+	if len(docs) > 0 && !send(docs) {
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+// process will embed and write a single batch.
+func (p *Pipeline) process(ctx context.Context, b batch) batchResult {
+	result := batchResult{batch: b}
+
+	texts := make([]string, len(b.docs))
+	for i, doc := range b.docs {
+		texts[i] = doc.Text
+	}
+
+	var vectors [][]float32
+
+	retries, err := p.retry(ctx, func(ctx context.Context) error {
+		var err error
+
+		vectors, err = p.embedder.EmbedDocuments(ctx, texts)
+		if err != nil {
+			return err
+		}
+
+		if len(vectors) != len(texts) {
+			return fmt.Errorf("embedder returned %d vectors for %d texts", len(vectors), len(texts))
+		}
+
+		return nil
+	})
+
+	result.retries += retries
+
+	if err != nil {
+		result.err = fmt.Errorf("failed to embed documents: %w", err)
+
+		return result
+	}
+
+	models, err := p.writeModels(b.docs, vectors)
+	if err != nil {
+		result.err = err
+
+		return result
+	}
+
+	opts := options.BulkWrite().SetOrdered(false)
+
+	retries, err = p.retry(ctx, func(ctx context.Context) error {
+		var err error
+
+		result.res, err = p.coll.BulkWrite(ctx, models, opts)
+
+		return err
+	})
+
+	result.retries += retries
+
+	if err != nil {
+		result.err = fmt.Errorf("failed to write documents: %w", err)
+	}
+
+	return result
+}
+
+// writeModels will return the bulk write models for the documents and their
+// vectors according to the pipeline mode.
+func (p *Pipeline) writeModels(docs []Document, vectors [][]float32) ([]mongo.WriteModel, error) {
+	models := make([]mongo.WriteModel, len(docs))
+
+	for i, doc := range docs {
+		switch p.cfg.mode {
+		case ModeReembed:
+			if doc.ID == nil {
+				return nil, fmt.Errorf("cannot re-embed a document without an _id")
+			}
+
+			models[i] = mongo.NewUpdateOneModel().
+				SetFilter(bson.D{{Key: "_id", Value: doc.ID}}).
+				SetUpdate(bson.D{{Key: "$set", Value: bson.D{{Key: p.cfg.embeddingField, Value: vectors[i]}}}})
+		default:
+			// Generate missing _ids here rather than let the driver generate
+			// them on each attempt, so that retrying a batch that was partly
+			// written replaces the documents instead of inserting them again.
+			id := doc.ID
+			if id == nil {
+				id = bson.NewObjectID()
+			}
+
+			bdoc := make(bson.D, 0, len(doc.Metadata)+3)
+			bdoc = append(bdoc,
+				bson.E{Key: "_id", Value: id},
+				bson.E{Key: p.cfg.textField, Value: doc.Text},
+				bson.E{Key: p.cfg.embeddingField, Value: vectors[i]})
+
+			keys := make([]string, 0, len(doc.Metadata))
+			for k := range doc.Metadata {
+				keys = append(keys, k)
+			}
+
+			sort.Strings(keys) // Keep the field order deterministic
+
+			for _, k := range keys {
+				bdoc = append(bdoc, bson.E{Key: k, Value: doc.Metadata[k]})
+			}
+
+			models[i] = mongo.NewReplaceOneModel().
+				SetFilter(bson.D{{Key: "_id", Value: id}}).
+				SetReplacement(bdoc).
+				SetUpsert(true)
+		}
+	}
+
+	return models, nil
+}
+
+// retry will call fn until it succeeds, the retries are exhausted or the
+// error is not worth retrying, backing off exponentially between attempts. It
+// returns the number of retries.
+func (p *Pipeline) retry(ctx context.Context, fn func(context.Context) error) (int64, error) {
+	backoff := p.cfg.initialBackoff
+
+	var retries int64
+	for {
+		err := fn(ctx)
+		if err == nil {
+			return retries, nil
+		}
+
+		if retries >= int64(p.cfg.maxRetries) || !retryable(err) || ctx.Err() != nil {
+			return retries, err
+		}
+
+		timer := time.NewTimer(backoff)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return retries, ctx.Err()
+		case <-timer.C:
+		}
+
+		retries++
+
+		backoff *= 2
+		if backoff > p.cfg.maxBackoff {
+			backoff = p.cfg.maxBackoff
+		}
+	}
+}
+
+// retryable will return "false" for errors that will fail the same way if
+// retried, such as a write error on a specific document.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var bwe mongo.BulkWriteException
+	if errors.As(err, &bwe) && len(bwe.WriteErrors) > 0 {
+		return false
+	}
+
+	return true
+}
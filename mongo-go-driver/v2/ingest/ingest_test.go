@@ -0,0 +1,286 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/mockdeploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/drivertest"
+)
+
+// countingEmbedder returns a one-dimensional vector holding the length of each
+// text and fails the first failFirst calls.
+type countingEmbedder struct {
+	mu        sync.Mutex
+	calls     int
+	texts     []string
+	failFirst int
+}
+
+func (emb *countingEmbedder) EmbedDocuments(_ context.Context, texts []string) ([][]float32, error) {
+	emb.mu.Lock()
+	defer emb.mu.Unlock()
+
+	emb.calls++
+	if emb.calls <= emb.failFirst {
+		return nil, fmt.Errorf("transient embedding failure %d", emb.calls)
+	}
+
+	emb.texts = append(emb.texts, texts...)
+
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float32{float32(len(text))}
+	}
+
+	return vectors, nil
+}
+
+func (emb *countingEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	vectors, err := emb.EmbedDocuments(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+
+	return vectors[0], nil
+}
+
+func newMockCollection(t *testing.T, responses ...bson.D) *mongo.Collection {
+	t.Helper()
+
+	md := drivertest.NewMockDeployment(responses...)
+
+	opts := options.Client()
+	opts.Deployment = md
+
+	client, err := mongo.Connect(opts)
+	require.NoError(t, err, "failed to connect to mock deployment")
+
+	return client.Database("db").Collection("coll")
+}
+
+func newTestDocs(n int) []Document {
+	docs := make([]Document, n)
+	for i := range docs {
+		docs[i] = Document{ID: i, Text: fmt.Sprintf("doc %d", i)}
+	}
+
+	return docs
+}
+
+func okReply(n int) bson.D {
+	return bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: n}}
+}
+
+func TestWatermark(t *testing.T) {
+	wm := newWatermark(0)
+
+	_, ok := wm.complete(1, batchEnd{offset: 20, lastID: 19})
+	assert.False(t, ok, "batch 1 must not advance the watermark before batch 0")
+
+	_, ok = wm.complete(2, batchEnd{offset: 30, lastID: 29})
+	assert.False(t, ok)
+
+	end, ok := wm.complete(0, batchEnd{offset: 10, lastID: 9})
+	require.True(t, ok)
+	assert.Equal(t, batchEnd{offset: 30, lastID: 29}, end)
+
+	end, ok = wm.complete(3, batchEnd{offset: 40, lastID: 39})
+	require.True(t, ok)
+	assert.Equal(t, int64(40), end.offset)
+}
+
+func TestPipeline_Run(t *testing.T) {
+	coll := newMockCollection(t, okReply(2), okReply(2), okReply(1))
+	embedder := &countingEmbedder{}
+	store := &MemoryCheckpointStore{}
+
+	var updates []Progress
+
+	pipeline := NewPipeline(coll, embedder,
+		WithBatchSize(2),
+		WithConcurrency(1),
+		WithCheckpointStore(store),
+		WithProgress(func(p Progress) { updates = append(updates, p) }))
+
+	progress, err := pipeline.Run(context.Background(), NewSliceSource(newTestDocs(5)))
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(3), progress.Batches)
+	assert.Equal(t, int64(5), progress.Written)
+	assert.Equal(t, int64(5), progress.Offset)
+	assert.Equal(t, 3, embedder.calls)
+	assert.Len(t, updates, 3)
+
+	cp, err := store.Load(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, cp)
+
+	assert.Equal(t, int64(5), cp.Offset)
+	assert.Equal(t, 4, cp.LastID)
+}
+
+func TestPipeline_Run_Resume(t *testing.T) {
+	coll := newMockCollection(t, okReply(1))
+	embedder := &countingEmbedder{}
+
+	store := &MemoryCheckpointStore{}
+	require.NoError(t, store.Save(context.Background(), Checkpoint{Offset: 4, LastID: 3}))
+
+	pipeline := NewPipeline(coll, embedder, WithBatchSize(2), WithCheckpointStore(store))
+
+	progress, err := pipeline.Run(context.Background(), NewSliceSource(newTestDocs(5)))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"doc 4"}, embedder.texts, "only documents after the checkpoint are embedded")
+	assert.Equal(t, int64(1), progress.Written)
+	assert.Equal(t, int64(5), progress.Offset)
+}
+
+func TestPipeline_Run_Retry(t *testing.T) {
+	coll := newMockCollection(t, okReply(3))
+	embedder := &countingEmbedder{failFirst: 2}
+
+	pipeline := NewPipeline(coll, embedder,
+		WithBatchSize(10),
+		WithBackoff(time.Millisecond, time.Millisecond))
+
+	progress, err := pipeline.Run(context.Background(), NewSliceSource(newTestDocs(3)))
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(2), progress.Retries)
+	assert.Equal(t, int64(3), progress.Written)
+}
+
+func TestPipeline_Run_RetriesExhausted(t *testing.T) {
+	coll := newMockCollection(t)
+	embedder := &countingEmbedder{failFirst: 10}
+	store := &MemoryCheckpointStore{}
+
+	pipeline := NewPipeline(coll, embedder,
+		WithMaxRetries(1),
+		WithBackoff(time.Millisecond, time.Millisecond),
+		WithCheckpointStore(store))
+
+	_, err := pipeline.Run(context.Background(), NewSliceSource(newTestDocs(3)))
+	require.Error(t, err)
+
+	assert.Equal(t, 2, embedder.calls, "expected the first attempt and one retry")
+
+	cp, err := store.Load(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, cp, "a failed batch must not be checkpointed")
+}
+
+func TestPipeline_Run_RetryPartialWrite(t *testing.T) {
+	d := mockdeploy.New(t)
+	d.SetMaxBatchCount(2) // Split the batch into two update commands
+
+	d.On("update").Reply(mockdeploy.Write(mockdeploy.WriteResult{N: 2}))
+	d.On("update").Reply(mockdeploy.Error(50, "MaxTimeMSExpired", "operation exceeded time limit"))
+	d.On("update").Reply(mockdeploy.Write(mockdeploy.WriteResult{N: 2})).Repeat()
+
+	client, err := d.NewClient()
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+
+	pipeline := NewPipeline(client.Database("db").Collection("coll"), &countingEmbedder{},
+		WithBatchSize(4),
+		WithBackoff(time.Millisecond, time.Millisecond))
+
+	src := NewTextSource([]string{"a", "b", "c", "d"})
+
+	progress, err := pipeline.Run(context.Background(), src)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), progress.Retries)
+
+	// The retry resends the whole batch, including the two documents the
+	// first attempt wrote, and must not write them under new _ids.
+	updates := d.CommandsNamed("update")
+	require.Len(t, updates, 4)
+
+	ids := map[bson.ObjectID]int{}
+
+	for _, cmd := range updates {
+		stmts, err := cmd.Document.Lookup("updates").Array().Values()
+		require.NoError(t, err)
+
+		for _, stmt := range stmts {
+			assert.True(t, stmt.Document().Lookup("upsert").Boolean())
+			ids[stmt.Document().Lookup("q", "_id").ObjectID()]++
+		}
+	}
+
+	assert.Len(t, ids, 4, "each document must keep its _id across attempts")
+}
+
+func TestPipeline_WriteModels(t *testing.T) {
+	vectors := [][]float32{{1}, {2}}
+
+	t.Run("upsert", func(t *testing.T) {
+		pipeline := NewPipeline(nil, nil)
+
+		docs := []Document{
+			{ID: "a", Text: "x", Metadata: map[string]any{"z": 1, "y": 2}},
+			{Text: "w"},
+		}
+
+		models, err := pipeline.writeModels(docs, vectors)
+		require.NoError(t, err)
+
+		replace, ok := models[0].(*mongo.ReplaceOneModel)
+		require.True(t, ok, "documents with an _id must be upserted")
+
+		want := bson.D{
+			{Key: "_id", Value: "a"},
+			{Key: "page_content", Value: "x"},
+			{Key: "embedding", Value: []float32{1}},
+			{Key: "y", Value: 2},
+			{Key: "z", Value: 1},
+		}
+
+		assert.Equal(t, want, replace.Replacement)
+		assert.True(t, *replace.Upsert)
+
+		replace, ok = models[1].(*mongo.ReplaceOneModel)
+		require.True(t, ok, "documents without an _id must be upserted")
+
+		id, ok := replace.Filter.(bson.D)[0].Value.(bson.ObjectID)
+		require.True(t, ok, "documents without an _id must be given an ObjectID")
+		assert.Equal(t, id, replace.Replacement.(bson.D)[0].Value)
+	})
+
+	t.Run("reembed", func(t *testing.T) {
+		pipeline := NewPipeline(nil, nil, WithMode(ModeReembed), WithEmbeddingField("embeddings"))
+
+		models, err := pipeline.writeModels([]Document{{ID: 1, Text: "x"}}, vectors)
+		require.NoError(t, err)
+
+		update, ok := models[0].(*mongo.UpdateOneModel)
+		require.True(t, ok)
+
+		want := bson.D{{Key: "$set", Value: bson.D{{Key: "embeddings", Value: []float32{1}}}}}
+		assert.Equal(t, want, update.Update)
+
+		_, err = pipeline.writeModels([]Document{{Text: "x"}}, vectors)
+		assert.Error(t, err, "re-embedding requires an _id")
+	})
+}
+
+func TestRetryable(t *testing.T) {
+	assert.True(t, retryable(errors.New("network error")))
+	assert.False(t, retryable(context.Canceled))
+
+	bwe := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{}}}
+	assert.False(t, retryable(fmt.Errorf("wrapped: %w", bwe)))
+}
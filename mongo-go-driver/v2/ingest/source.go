@@ -0,0 +1,153 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Document is a single piece of text to embed and write.
+type Document struct {
+	ID       any            // _id of the document, nil to have the pipeline generate one
+	Text     string         // Text to embed
+	Metadata map[string]any // Additional fields written alongside the text in ModeUpsert
+}
+
+// Source yields the documents to ingest. Next returns io.EOF once the source is
+// exhausted.
+type Source interface {
+	Next(ctx context.Context) (Document, error)
+}
+
+// Resumer is implemented by sources that can efficiently skip to the document
+// after the given _id, rather than having the pipeline discard documents one
+// at a time.
+type Resumer interface {
+	ResumeAfter(ctx context.Context, id any) error
+}
+
+type sliceSource struct {
+	docs []Document
+	pos  int
+}
+
+var _ Source = &sliceSource{}
+
+// NewSliceSource will return a source that yields the given documents in order.
+func NewSliceSource(docs []Document) Source {
+	return &sliceSource{docs: docs}
+}
+
+// NewTextSource will return a source that yields a document without an _id
+// for every text, like the toInsert argument of the vector store example.
+func NewTextSource(texts []string) Source {
+	docs := make([]Document, len(texts))
+	for i, text := range texts {
+		docs[i] = Document{Text: text}
+	}
+
+	return &sliceSource{docs: docs}
+}
+
+func (src *sliceSource) Next(context.Context) (Document, error) {
+	if src.pos >= len(src.docs) {
+		return Document{}, io.EOF
+	}
+
+	doc := src.docs[src.pos]
+	src.pos++
+
+	return doc, nil
+}
+
+// CollectionSource reads existing documents from a collection in _id order. It
+// is used to (re-)embed a collection in place with ModeReembed.
+type CollectionSource struct {
+	coll      *mongo.Collection
+	filter    bson.D
+	textField string
+	after     any
+
+	cursor *mongo.Cursor
+}
+
+var (
+	_ Source  = &CollectionSource{}
+	_ Resumer = &CollectionSource{}
+)
+
+// NewCollectionSource will return a source over the documents in coll matching
+// filter, reading the text from textField. A nil filter matches every
+// document.
+func NewCollectionSource(coll *mongo.Collection, filter bson.D, textField string) *CollectionSource {
+	return &CollectionSource{coll: coll, filter: filter, textField: textField}
+}
+
+// ResumeAfter restricts the source to documents with an _id greater than id.
+// It must be called before the first call to Next.
+func (src *CollectionSource) ResumeAfter(_ context.Context, id any) error {
+	if src.cursor != nil {
+		return fmt.Errorf("cannot resume a collection source that has already started")
+	}
+
+	src.after = id
+
+	return nil
+}
+
+// Next returns the next document in _id order.
+func (src *CollectionSource) Next(ctx context.Context) (Document, error) {
+	if src.cursor == nil {
+		filter := bson.D{}
+		if len(src.filter) > 0 {
+			filter = append(filter, src.filter...)
+		}
+
+		if src.after != nil {
+			filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$gt", Value: src.after}}})
+		}
+
+		opts := options.Find().
+			SetSort(bson.D{{Key: "_id", Value: 1}}).
+			SetProjection(bson.D{{Key: "_id", Value: 1}, {Key: src.textField, Value: 1}})
+
+		cursor, err := src.coll.Find(ctx, filter, opts)
+		if err != nil {
+			return Document{}, fmt.Errorf("failed to open cursor: %w", err)
+		}
+
+		src.cursor = cursor
+	}
+
+	if !src.cursor.Next(ctx) {
+		if err := src.cursor.Err(); err != nil {
+			return Document{}, fmt.Errorf("failed to iterate cursor: %w", err)
+		}
+
+		return Document{}, io.EOF
+	}
+
+	doc := Document{ID: src.cursor.Current.Lookup("_id")}
+
+	text, ok := src.cursor.Current.Lookup(src.textField).StringValueOK()
+	if !ok {
+		return Document{}, fmt.Errorf("document %v has no string field %q", doc.ID, src.textField)
+	}
+
+	doc.Text = text
+
+	return doc, nil
+}
+
+// Close closes the underlying cursor, if any.
+func (src *CollectionSource) Close(ctx context.Context) error {
+	if src.cursor == nil {
+		return nil
+	}
+
+	return src.cursor.Close(ctx)
+}
@@ -0,0 +1,191 @@
+// Package knn is an in-memory, brute-force k-nearest-neighbor index used as a
+// reference for Atlas Vector Search. Because every vector is compared against
+// the query, its results are exact, and comparing them with the approximate
+// results of $vectorSearch measures the recall of a given numCandidates.
+package knn
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Result is a single search result.
+type Result struct {
+	ID    any
+	Score float64
+}
+
+// Index holds vectors in memory and searches them exhaustively.
+type Index struct {
+	sim        Similarity
+	dimensions int
+	ids        []any
+	vectors    [][]float32
+}
+
+// NewIndex will return an empty index of vectors with the given number of
+// dimensions, compared with the given similarity function.
+func NewIndex(sim Similarity, dimensions int) (*Index, error) {
+	switch sim {
+	case Cosine, DotProduct, Euclidean:
+	default:
+		return nil, fmt.Errorf("unsupported similarity %q", sim)
+	}
+
+	return &Index{sim: sim, dimensions: dimensions}, nil
+}
+
+// Len returns the number of vectors in the index.
+func (idx *Index) Len() int {
+	return len(idx.vectors)
+}
+
+// Add will add a vector to the index.
+func (idx *Index) Add(id any, vector []float32) error {
+	if len(vector) != idx.dimensions {
+		return fmt.Errorf("vector %v has %d dimensions, want %d", id, len(vector), idx.dimensions)
+	}
+
+	idx.ids = append(idx.ids, id)
+	idx.vectors = append(idx.vectors, vector)
+
+	return nil
+}
+
+// Search will return the k vectors most similar to query, ordered by
+// descending score. Ties are broken by insertion order.
+func (idx *Index) Search(query []float32, k int) ([]Result, error) {
+	if len(query) != idx.dimensions {
+		return nil, fmt.Errorf("query has %d dimensions, want %d", len(query), idx.dimensions)
+	}
+
+	if k <= 0 {
+		return nil, nil
+	}
+
+	// Keep the best k in a min-heap so the worst of them is cheap to evict.
+	h := &resultHeap{}
+	for i, vector := range idx.vectors {
+		score, err := Score(idx.sim, query, vector)
+		if err != nil {
+			return nil, fmt.Errorf("failed to score %v: %w", idx.ids[i], err)
+		}
+
+		if h.Len() < k {
+			heap.Push(h, scored{pos: i, score: score})
+		} else if score > (*h)[0].score {
+			(*h)[0] = scored{pos: i, score: score}
+			heap.Fix(h, 0)
+		}
+	}
+
+	best := make([]scored, h.Len())
+	copy(best, *h)
+
+	sort.Slice(best, func(i, j int) bool {
+		if best[i].score != best[j].score {
+			return best[i].score > best[j].score
+		}
+
+		return best[i].pos < best[j].pos
+	})
+
+	results := make([]Result, len(best))
+	for i, s := range best {
+		results[i] = Result{ID: idx.ids[s.pos], Score: s.score}
+	}
+
+	return results, nil
+}
+
+// LoadIndex will build an index from the vectors stored at path in every
+// document of coll matching filter.
+func LoadIndex(
+	ctx context.Context,
+	coll *mongo.Collection,
+	filter bson.D,
+	path string,
+	sim Similarity,
+	dimensions int,
+) (*Index, error) {
+	idx, err := NewIndex(sim, dimensions)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter == nil {
+		filter = bson.D{}
+	}
+
+	opts := options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}, {Key: path, Value: 1}})
+
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find vectors: %w", err)
+	}
+
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var (
+			id     any
+			vector []float32
+		)
+
+		if err := cursor.Current.Lookup("_id").Unmarshal(&id); err != nil {
+			return nil, fmt.Errorf("failed to decode _id: %w", err)
+		}
+
+		if err := cursor.Current.Lookup(strings.Split(path, ".")...).Unmarshal(&vector); err != nil {
+			return nil, fmt.Errorf("failed to decode %q of %v: %w", path, id, err)
+		}
+
+		if err := idx.Add(id, vector); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate vectors: %w", err)
+	}
+
+	return idx, nil
+}
+
+type scored struct {
+	pos   int
+	score float64
+}
+
+// resultHeap is a min-heap of scores, worst result first. Among equal scores
+// the latest insertion is considered worst.
+type resultHeap []scored
+
+func (h resultHeap) Len() int { return len(h) }
+
+func (h resultHeap) Less(i, j int) bool {
+	if h[i].score != h[j].score {
+		return h[i].score < h[j].score
+	}
+
+	return h[i].pos > h[j].pos
+}
+
+func (h resultHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *resultHeap) Push(x any) { *h = append(*h, x.(scored)) }
+
+func (h *resultHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return x
+}
@@ -0,0 +1,177 @@
+package knn
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestScore(t *testing.T) {
+	testCases := []struct {
+		name string
+		sim  Similarity
+		a, b []float32
+		want float64
+	}{
+		{name: "cosine identical", sim: Cosine, a: []float32{1, 2}, b: []float32{2, 4}, want: 1},
+		{name: "cosine orthogonal", sim: Cosine, a: []float32{1, 0}, b: []float32{0, 3}, want: 0.5},
+		{name: "cosine opposite", sim: Cosine, a: []float32{1, 0}, b: []float32{-1, 0}, want: 0},
+		{name: "dotProduct unit", sim: DotProduct, a: []float32{1, 0}, b: []float32{0.6, 0.8}, want: 0.8},
+		{name: "euclidean same", sim: Euclidean, a: []float32{1, 1}, b: []float32{1, 1}, want: 1},
+		{name: "euclidean 3-4-5", sim: Euclidean, a: []float32{0, 0}, b: []float32{3, 4}, want: 1.0 / 26},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Score(tc.sim, tc.a, tc.b)
+			require.NoError(t, err)
+
+			assert.InDelta(t, tc.want, got, 1e-6)
+		})
+	}
+
+	_, err := Score(Cosine, []float32{1}, []float32{1, 2})
+	assert.Error(t, err, "dimension mismatch")
+
+	_, err = Score(Cosine, []float32{0, 0}, []float32{1, 2})
+	assert.Error(t, err, "zero vector")
+
+	_, err = Score("manhattan", []float32{1}, []float32{1})
+	assert.Error(t, err)
+}
+
+func TestIndex_Search(t *testing.T) {
+	idx, err := NewIndex(Euclidean, 2)
+	require.NoError(t, err)
+
+	require.NoError(t, idx.Add("far", []float32{10, 10}))
+	require.NoError(t, idx.Add("near", []float32{1, 1}))
+	require.NoError(t, idx.Add("exact", []float32{0, 0}))
+	require.NoError(t, idx.Add("tie", []float32{1, 1}))
+	assert.Error(t, idx.Add("bad", []float32{1}))
+
+	results, err := idx.Search([]float32{0, 0}, 3)
+	require.NoError(t, err)
+
+	ids := []any{results[0].ID, results[1].ID, results[2].ID}
+	assert.Equal(t, []any{"exact", "near", "tie"}, ids, "ties must keep insertion order")
+	assert.InDelta(t, 1.0, results[0].Score, 1e-9)
+	assert.InDelta(t, 1.0/3, results[1].Score, 1e-9)
+
+	all, err := idx.Search([]float32{0, 0}, 10)
+	require.NoError(t, err)
+	assert.Len(t, all, 4)
+}
+
+// TestIndex_Search_BruteForce checks the heap selection against sorting every
+// score.
+func TestIndex_Search_BruteForce(t *testing.T) {
+	const dims, n, k = 8, 500, 10
+
+	rng := rand.New(rand.NewSource(1))
+	randVec := func() []float32 {
+		v := make([]float32, dims)
+		for i := range v {
+			v[i] = rng.Float32()*2 - 1
+		}
+
+		return v
+	}
+
+	idx, err := NewIndex(Cosine, dims)
+	require.NoError(t, err)
+
+	for i := 0; i < n; i++ {
+		require.NoError(t, idx.Add(i, randVec()))
+	}
+
+	query := randVec()
+
+	results, err := idx.Search(query, k)
+	require.NoError(t, err)
+	require.Len(t, results, k)
+
+	best := math.Inf(1)
+	for _, res := range results {
+		assert.LessOrEqual(t, res.Score, best, "results must be ordered by descending score")
+		best = res.Score
+	}
+
+	// No vector outside of the results may beat the worst result.
+	returned := map[any]bool{}
+	for _, res := range results {
+		returned[res.ID] = true
+	}
+
+	for i, vec := range idx.vectors {
+		if returned[i] {
+			continue
+		}
+
+		score, err := Score(Cosine, query, vec)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, score, results[k-1].Score)
+	}
+}
+
+func TestRecallAtK(t *testing.T) {
+	exact := []Result{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}}
+
+	assert.Equal(t, 1.0, RecallAtK(exact, []Result{{ID: 2}, {ID: 1}}, 2))
+	assert.Equal(t, 0.5, RecallAtK(exact, []Result{{ID: 1}, {ID: 9}}, 2))
+	assert.Equal(t, 0.75, RecallAtK(exact, []Result{{ID: int64(1)}, {ID: 2}, {ID: 4}, {ID: 8}}, 4))
+	assert.Equal(t, 0.0, RecallAtK(exact, []Result{{ID: "1"}, {ID: "2"}}, 2))
+	assert.Equal(t, 0.0, RecallAtK(exact, nil, 2))
+	assert.Equal(t, 1.0, RecallAtK(nil, nil, 2))
+}
+
+func TestIDKey(t *testing.T) {
+	oid := bson.NewObjectID()
+
+	_, data, err := bson.MarshalValue(oid)
+	require.NoError(t, err)
+
+	raw := bson.RawValue{Type: bson.TypeObjectID, Value: data}
+
+	assert.Equal(t, idKey(oid), idKey(raw))
+	assert.Equal(t, idKey(int32(7)), idKey(int64(7)))
+	assert.Equal(t, idKey(7), idKey(7.0))
+	assert.NotEqual(t, idKey("1"), idKey(1), "a string and a number with the same text must not collide")
+	assert.NotEqual(t, idKey(1.5), idKey(1))
+	assert.NotEqual(t, idKey(oid), idKey(oid.Hex()))
+	assert.NotEqual(t, idKey(bson.D{{Key: "a", Value: 1}}), idKey(bson.D{{Key: "a", Value: "1"}}))
+}
+
+func TestEvaluator_Evaluate(t *testing.T) {
+	idx, err := NewIndex(DotProduct, 2)
+	require.NoError(t, err)
+
+	require.NoError(t, idx.Add("a", []float32{1, 0}))
+	require.NoError(t, idx.Add("b", []float32{0.6, 0.8}))
+	require.NoError(t, idx.Add("c", []float32{0, 1}))
+
+	// The approximate search misses the second-best result for every query.
+	search := func(_ context.Context, query []float32, numCandidates, limit int) ([]Result, error) {
+		assert.Equal(t, 50, numCandidates)
+
+		exact, err := idx.Search(query, len(idx.vectors))
+		if err != nil {
+			return nil, err
+		}
+
+		return []Result{exact[0], exact[2]}, nil
+	}
+
+	report, err := NewEvaluator(idx, search).Evaluate(context.Background(), [][]float32{{1, 0}, {0, 1}}, 2, 50)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0.5, report.MeanRecall)
+	assert.Equal(t, 0.5, report.MinRecall)
+	assert.Equal(t, 0.0, report.MaxScoreDelta)
+	assert.Len(t, report.Queries, 2)
+}
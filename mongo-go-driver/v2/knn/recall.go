@@ -0,0 +1,191 @@
+package knn
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// SearchFunc runs an approximate nearest neighbor search, returning at most
+// limit results for the query while considering numCandidates.
+type SearchFunc func(ctx context.Context, query []float32, numCandidates, limit int) ([]Result, error)
+
+// VectorSearch will return a SearchFunc that runs $vectorSearch against the
+// named Atlas Vector Search index of coll, the way runVectorSearchExample
+// does, and reads the vectorSearchScore of each result.
+func VectorSearch(coll *mongo.Collection, index, path string) SearchFunc {
+	return func(ctx context.Context, query []float32, numCandidates, limit int) ([]Result, error) {
+		pipeline := mongo.Pipeline{
+			{{Key: "$vectorSearch", Value: bson.D{
+				{Key: "index", Value: index},
+				{Key: "path", Value: path},
+				{Key: "queryVector", Value: query},
+				{Key: "numCandidates", Value: numCandidates},
+				{Key: "limit", Value: limit},
+			}}},
+			{{Key: "$project", Value: bson.D{
+				{Key: "_id", Value: 1},
+				{Key: "score", Value: bson.D{{Key: "$meta", Value: "vectorSearchScore"}}},
+			}}},
+		}
+
+		cursor, err := coll.Aggregate(ctx, pipeline)
+		if err != nil {
+			return nil, fmt.Errorf("failed to aggregate: %w", err)
+		}
+
+		var docs []struct {
+			ID    any     `bson:"_id"`
+			Score float64 `bson:"score"`
+		}
+
+		if err := cursor.All(ctx, &docs); err != nil {
+			return nil, fmt.Errorf("failed to decode vector search results: %w", err)
+		}
+
+		results := make([]Result, len(docs))
+		for i, doc := range docs {
+			results[i] = Result{ID: doc.ID, Score: doc.Score}
+		}
+
+		return results, nil
+	}
+}
+
+// RecallAtK will return the fraction of the first k exact results that also
+// appear in the first k approximate results.
+func RecallAtK(exact, approx []Result, k int) float64 {
+	if k > len(exact) {
+		k = len(exact)
+	}
+
+	if k == 0 {
+		return 1
+	}
+
+	found := map[string]bool{}
+	for i := 0; i < k && i < len(approx); i++ {
+		found[idKey(approx[i].ID)] = true
+	}
+
+	hits := 0
+	for _, res := range exact[:k] {
+		if found[idKey(res.ID)] {
+			hits++
+		}
+	}
+
+	return float64(hits) / float64(k)
+}
+
+// QueryReport describes how the approximate search did for a single query.
+type QueryReport struct {
+	Recall float64
+
+	// MaxScoreDelta is the largest absolute difference between the approximate
+	// and exact score of a document returned by both searches. Anything beyond
+	// float32 rounding indicates the index similarity doesn't match.
+	MaxScoreDelta float64
+}
+
+// Report summarizes the recall over a set of queries.
+type Report struct {
+	K             int
+	NumCandidates int
+	MeanRecall    float64
+	MinRecall     float64
+	MaxScoreDelta float64
+	Queries       []QueryReport
+}
+
+// Evaluator compares approximate search results against an exact index.
+type Evaluator struct {
+	exact  *Index
+	search SearchFunc
+}
+
+// NewEvaluator will return an evaluator of search against the exact results
+// of idx. The index must hold the same vectors as the searched collection.
+func NewEvaluator(idx *Index, search SearchFunc) *Evaluator {
+	return &Evaluator{exact: idx, search: search}
+}
+
+// Evaluate will run every query through both searches and report recall@k
+// for the given numCandidates.
+func (e *Evaluator) Evaluate(ctx context.Context, queries [][]float32, k, numCandidates int) (Report, error) {
+	report := Report{K: k, NumCandidates: numCandidates, MinRecall: 1}
+
+	if len(queries) == 0 {
+		return report, fmt.Errorf("at least one query is required")
+	}
+
+	for i, query := range queries {
+		exact, err := e.exact.Search(query, k)
+		if err != nil {
+			return report, fmt.Errorf("failed to run exact search for query %d: %w", i, err)
+		}
+
+		approx, err := e.search(ctx, query, numCandidates, k)
+		if err != nil {
+			return report, fmt.Errorf("failed to run approximate search for query %d: %w", i, err)
+		}
+
+		qr := QueryReport{Recall: RecallAtK(exact, approx, k)}
+
+		exactScores := make(map[string]float64, len(exact))
+		for _, res := range exact {
+			exactScores[idKey(res.ID)] = res.Score
+		}
+
+		for _, res := range approx {
+			if score, ok := exactScores[idKey(res.ID)]; ok {
+				qr.MaxScoreDelta = math.Max(qr.MaxScoreDelta, math.Abs(score-res.Score))
+			}
+		}
+
+		report.Queries = append(report.Queries, qr)
+		report.MeanRecall += qr.Recall
+		report.MinRecall = math.Min(report.MinRecall, qr.Recall)
+		report.MaxScoreDelta = math.Max(report.MaxScoreDelta, qr.MaxScoreDelta)
+	}
+
+	report.MeanRecall /= float64(len(queries))
+
+	return report, nil
+}
+
+// idKey will return a comparable key for a document _id made of its BSON type
+// and value, so that e.g. "1" and 1 don't collide. Numbers are keyed by value,
+// as the server compares them, so that int32(1), int64(1) and 1.0 map to the
+// same key.
+func idKey(id any) string {
+	rv, ok := id.(bson.RawValue)
+	if !ok {
+		t, data, err := bson.MarshalValue(id)
+		if err != nil {
+			return fmt.Sprintf("%T:%v", id, id)
+		}
+
+		rv = bson.RawValue{Type: t, Value: data}
+	}
+
+	switch rv.Type {
+	case bson.TypeInt32, bson.TypeInt64:
+		n, _ := rv.AsInt64OK()
+
+		return "number:" + strconv.FormatInt(n, 10)
+	case bson.TypeDouble:
+		f := rv.Double()
+		if f == math.Trunc(f) && math.Abs(f) < math.MaxInt64 {
+			return "number:" + strconv.FormatInt(int64(f), 10)
+		}
+
+		return "number:" + strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	return rv.Type.String() + ":" + string(rv.Value)
+}
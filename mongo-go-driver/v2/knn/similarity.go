@@ -0,0 +1,69 @@
+package knn
+
+import (
+	"fmt"
+	"math"
+)
+
+// Similarity is the similarity function of a vector search index field, as
+// given by the "similarity" key of the index definition.
+type Similarity string
+
+const (
+	Cosine     Similarity = "cosine"
+	DotProduct Similarity = "dotProduct"
+	Euclidean  Similarity = "euclidean"
+)
+
+// Score will return the similarity between a and b normalized to [0,1] the
+// same way Atlas normalizes the vectorSearchScore:
+//
+//	cosine:     (1 + cos(a,b)) / 2
+//	dotProduct: (1 + a·b) / 2
+//	euclidean:  1 / (1 + |a-b|²)
+//
+// These are the Lucene similarity functions that back Atlas Vector Search.
+// Note that dotProduct assumes unit-length vectors, so the score of arbitrary
+// vectors can fall outside of [0,1].
+func Score(sim Similarity, a, b []float32) (float64, error) {
+	if len(a) != len(b) {
+		return 0, fmt.Errorf("vectors have different dimensions: %d != %d", len(a), len(b))
+	}
+
+	switch sim {
+	case Cosine:
+		na, nb := norm(a), norm(b)
+		if na == 0 || nb == 0 {
+			return 0, fmt.Errorf("cosine similarity is undefined for zero vectors")
+		}
+
+		return (1 + dotProduct(a, b)/(na*nb)) / 2, nil
+	case DotProduct:
+		return (1 + dotProduct(a, b)) / 2, nil
+	case Euclidean:
+		return 1 / (1 + squaredDistance(a, b)), nil
+	}
+
+	return 0, fmt.Errorf("unsupported similarity %q", sim)
+}
+
+func dotProduct(v1, v2 []float32) (sum float64) {
+	for i := range v1 {
+		sum += float64(v1[i]) * float64(v2[i])
+	}
+
+	return
+}
+
+func norm(v []float32) float64 {
+	return math.Sqrt(dotProduct(v, v))
+}
+
+func squaredDistance(v1, v2 []float32) (sum float64) {
+	for i := range v1 {
+		d := float64(v1[i]) - float64(v2[i])
+		sum += d * d
+	}
+
+	return
+}
@@ -5,6 +5,9 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"time"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/timeoutsel"
 )
 
 func main() {
@@ -19,12 +22,9 @@ func main() {
 		log.Fatalf("could not convert timeout argument to integer: %v", err)
 	}
 
-	blockTime := (3.0 / 20.0) * float64(timeout)
-	maxAwaitTime := float64(timeout) / 2.0
-	buffer := (maxAwaitTime - blockTime) / 70.0
-	getMoreBound := maxAwaitTime - blockTime + buffer
+	maxAwaitTime, blockTime, getMoreBound := timeoutsel.CursorTimes(time.Duration(timeout) * time.Millisecond)
 
-	fmt.Printf("blockTime: %dms\n", int(blockTime))
-	fmt.Printf("maxAwaitTime: %dms\n", int(maxAwaitTime))
-	fmt.Printf("getMoreBound: %dms\n", int(getMoreBound))
+	fmt.Printf("blockTime: %dms\n", blockTime.Milliseconds())
+	fmt.Printf("maxAwaitTime: %dms\n", maxAwaitTime.Milliseconds())
+	fmt.Printf("getMoreBound: %dms\n", getMoreBound.Milliseconds())
 }
@@ -0,0 +1,206 @@
+package main
+
+// The benchmarks cover Marshal, Unmarshal, UnmarshalExtJSON and registry
+// lookups for each document shape in fixtures.go and report allocations. The
+// output is in the standard format, so two runs can be compared with
+// benchstat:
+//
+//	go test -run='^$' -bench=. -count=10 > old.txt
+//	# change the driver version or code
+//	go test -run='^$' -bench=. -count=10 > new.txt
+//	benchstat old.txt new.txt
+//
+// Pass -profile=<dir> to write a CPU profile per benchmark case, e.g.
+// <dir>/Marshal_nested.cpu.pprof, covering every b.N round of the case. With
+// -count only the first run of a case is profiled. Don't combine it with
+// -cpuprofile, only one CPU profile can be active at a time.
+//
+// Heap profiles cover the whole process, so take one per case by running the
+// case alone with -memprofile, as make bench-memprofile CASE=Marshal/nested
+// does:
+//
+//	go test -run='^$' -bench='^BenchmarkMarshal$/^nested$' -memprofile=Marshal_nested.heap.pprof
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var profileDir = flag.String("profile", "", "directory to write a CPU profile per benchmark case to")
+
+// profiled are the cases whose CPU profile has been written.
+var profiled = map[string]bool{}
+
+type benchCase struct {
+	name  string
+	value any
+	dst   func() any // New pointer to decode into
+}
+
+var benchCases = []benchCase{
+	{name: "flat", value: encodetestInstance, dst: func() any { return &encodetest{} }},
+	{name: "nested", value: nestedInstance, dst: func() any { return &nestedtest1{} }},
+	{name: "slice", value: sliceInstance, dst: func() any { return &slicetest{} }},
+	{name: "map", value: mapInstance, dst: func() any { return &maptest{} }},
+	{name: "D", value: dInstance, dst: func() any { return &bson.D{} }},
+	{name: "Raw", value: mustMarshal(dInstance), dst: func() any { return &bson.Raw{} }},
+}
+
+func mustMarshal(val any) bson.Raw {
+	b, err := bson.Marshal(val)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+// runCase will run the benchmark case f as a sub-benchmark of b and, if
+// -profile is set, write a CPU profile of all its b.N rounds.
+func runCase(b *testing.B, name string, f func(b *testing.B)) {
+	b.Helper()
+
+	base := strings.ReplaceAll(strings.TrimPrefix(b.Name()+"/"+name, "Benchmark"), "/", "_")
+
+	if *profileDir == "" || profiled[base] {
+		b.Run(name, f)
+
+		return
+	}
+
+	profiled[base] = true
+
+	stop := startCPUProfile(b, filepath.Join(*profileDir, base+".cpu.pprof"))
+	defer stop()
+
+	b.Run(name, f)
+}
+
+// run will run fn b.N times with allocation reporting.
+func run(b *testing.B, bytes int, fn func() error) {
+	b.Helper()
+
+	b.SetBytes(int64(bytes))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := fn(); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.StopTimer()
+}
+
+// startCPUProfile will start a CPU profile written to path and return a
+// function that stops it.
+func startCPUProfile(b *testing.B, path string) func() {
+	b.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		b.Fatalf("failed to create profile directory: %v", err)
+	}
+
+	cpu, err := os.Create(path)
+	if err != nil {
+		b.Fatalf("failed to create CPU profile: %v", err)
+	}
+
+	if err := pprof.StartCPUProfile(cpu); err != nil {
+		_ = cpu.Close()
+		b.Fatalf("failed to start CPU profile: %v", err)
+	}
+
+	return func() {
+		pprof.StopCPUProfile()
+		_ = cpu.Close()
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	for _, bc := range benchCases {
+		runCase(b, bc.name, func(b *testing.B) {
+			run(b, len(mustMarshal(bc.value)), func() error {
+				_, err := bson.Marshal(bc.value)
+
+				return err
+			})
+		})
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	for _, bc := range benchCases {
+		runCase(b, bc.name, func(b *testing.B) {
+			data := mustMarshal(bc.value)
+
+			run(b, len(data), func() error {
+				return bson.Unmarshal(data, bc.dst())
+			})
+		})
+	}
+}
+
+func BenchmarkUnmarshalExtJSON(b *testing.B) {
+	for _, bc := range benchCases {
+		runCase(b, bc.name, func(b *testing.B) {
+			data, err := bson.MarshalExtJSON(bc.value, true, false)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			run(b, len(data), func() error {
+				return bson.UnmarshalExtJSON(data, false, bc.dst())
+			})
+		})
+	}
+}
+
+func BenchmarkRegistryLookup(b *testing.B) {
+	reg := bson.NewRegistry()
+
+	for _, bc := range benchCases {
+		typ := reflect.TypeOf(bc.value)
+
+		runCase(b, "Encoder/"+bc.name, func(b *testing.B) {
+			run(b, 0, func() error {
+				_, err := reg.LookupEncoder(typ)
+
+				return err
+			})
+		})
+
+		runCase(b, "Decoder/"+bc.name, func(b *testing.B) {
+			run(b, 0, func() error {
+				_, err := reg.LookupDecoder(typ)
+
+				return err
+			})
+		})
+	}
+}
+
+// TestBenchCasesRoundTrip guards against benchmarking a case that fails or
+// decodes to something else.
+func TestBenchCasesRoundTrip(t *testing.T) {
+	for _, bc := range benchCases {
+		t.Run(bc.name, func(t *testing.T) {
+			dst := bc.dst()
+			if err := bson.Unmarshal(mustMarshal(bc.value), dst); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := reflect.ValueOf(dst).Elem().Interface(); !reflect.DeepEqual(got, bc.value) {
+				t.Errorf("round trip mismatch:\ngot  %v\nwant %v", got, bc.value)
+			}
+		})
+	}
+}
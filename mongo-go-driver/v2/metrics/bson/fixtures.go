@@ -0,0 +1,169 @@
+package main
+
+import (
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type encodetest struct {
+	Field1String  string
+	Field1Int64   int64
+	Field1Float64 float64
+	Field2String  string
+	Field2Int64   int64
+	Field2Float64 float64
+	Field3String  string
+	Field3Int64   int64
+	Field3Float64 float64
+	Field4String  string
+	Field4Int64   int64
+	Field4Float64 float64
+}
+
+type nestedtest1 struct {
+	Nested nestedtest2
+}
+
+type nestedtest2 struct {
+	Nested nestedtest3
+}
+
+type nestedtest3 struct {
+	Nested nestedtest4
+}
+
+type nestedtest4 struct {
+	Nested nestedtest5
+}
+
+type nestedtest5 struct {
+	Nested nestedtest6
+}
+
+type nestedtest6 struct {
+	Nested nestedtest7
+}
+
+type nestedtest7 struct {
+	Nested nestedtest8
+}
+
+type nestedtest8 struct {
+	Nested nestedtest9
+}
+
+type nestedtest9 struct {
+	Nested nestedtest10
+}
+
+type nestedtest10 struct {
+	Nested nestedtest11
+}
+
+type nestedtest11 struct {
+	Nested encodetest
+}
+
+var encodetestInstance = encodetest{
+	Field1String:  "foo",
+	Field1Int64:   1,
+	Field1Float64: 3.0,
+	Field2String:  "bar",
+	Field2Int64:   2,
+	Field2Float64: 3.1,
+	Field3String:  "baz",
+	Field3Int64:   3,
+	Field3Float64: 3.14,
+	Field4String:  "qux",
+	Field4Int64:   4,
+	Field4Float64: 3.141,
+}
+
+var nestedInstance = nestedtest1{
+	Nested: nestedtest2{
+		Nested: nestedtest3{
+			Nested: nestedtest4{
+				Nested: nestedtest5{
+					Nested: nestedtest6{
+						Nested: nestedtest7{
+							Nested: nestedtest8{
+								Nested: nestedtest9{
+									Nested: nestedtest10{
+										Nested: nestedtest11{
+											Nested: encodetestInstance,
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+type slicetest struct {
+	Strings []string
+	Int64s  []int64
+	Docs    []encodetest
+}
+
+type maptest struct {
+	Strings map[string]string
+	Int64s  map[string]int64
+	Docs    map[string]encodetest
+}
+
+const collectionSize = 100
+
+var sliceInstance = newSliceInstance()
+
+func newSliceInstance() slicetest {
+	st := slicetest{}
+	for i := 0; i < collectionSize; i++ {
+		st.Strings = append(st.Strings, "value"+strconv.Itoa(i))
+		st.Int64s = append(st.Int64s, int64(i))
+		st.Docs = append(st.Docs, encodetestInstance)
+	}
+
+	return st
+}
+
+var mapInstance = newMapInstance()
+
+func newMapInstance() maptest {
+	mt := maptest{
+		Strings: map[string]string{},
+		Int64s:  map[string]int64{},
+		Docs:    map[string]encodetest{},
+	}
+
+	for i := 0; i < collectionSize; i++ {
+		key := "key" + strconv.Itoa(i)
+
+		mt.Strings[key] = "value" + strconv.Itoa(i)
+		mt.Int64s[key] = int64(i)
+		mt.Docs[key] = encodetestInstance
+	}
+
+	return mt
+}
+
+// dInstance is the flat document as a bson.D, the representation used when
+// there is no struct for the data.
+var dInstance = bson.D{
+	{Key: "field1String", Value: "foo"},
+	{Key: "field1Int64", Value: int64(1)},
+	{Key: "field1Float64", Value: 3.0},
+	{Key: "field2String", Value: "bar"},
+	{Key: "field2Int64", Value: int64(2)},
+	{Key: "field2Float64", Value: 3.1},
+	{Key: "field3String", Value: "baz"},
+	{Key: "field3Int64", Value: int64(3)},
+	{Key: "field3Float64", Value: 3.14},
+	{Key: "field4String", Value: "qux"},
+	{Key: "field4Int64", Value: int64(4)},
+	{Key: "field4Float64", Value: 3.141},
+}
@@ -0,0 +1,481 @@
+// Package mockdeploy is a scripted mock deployment for driver tests.
+//
+// drivertest.NewMockDeployment replies to commands from a FIFO of documents
+// and never looks at what was sent, so a test has to know the exact order of
+// every command the driver will send and cannot assert on their contents.
+// The deployment in this package decodes every outgoing OP_MSG, matches it
+// against rules registered by command name and predicates, replies with the
+// first matching rule, records the command for later assertions and fails the
+// test when a command doesn't match any rule.
+package mockdeploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/address"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/description"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/mnet"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/wiremessage"
+)
+
+const (
+	serverAddress         = address.Address("127.0.0.1:27017")
+	maxWireVersion        = 25
+	defaultMaxBatchCount  = uint32(100000)
+	sessionTimeoutMinutes = int64(30)
+)
+
+// Command is a command sent by the driver.
+type Command struct {
+	Name     string   // First key of the command document, e.g. "find"
+	Database string   // Value of "$db"
+	Document bson.Raw // Command document with OP_MSG document sequences folded in as arrays
+}
+
+// Deployment is a driver.Deployment that replies to commands according to
+// scripted rules.
+type Deployment struct {
+	t testing.TB
+
+	mu            sync.Mutex
+	rules         []*Rule
+	commands      []Command
+	nextID        int64
+	kind          description.ServerKind
+	maxBatchCount uint32
+	updates       chan description.Topology
+}
+
+var (
+	_ driver.Deployment   = &Deployment{}
+	_ driver.Server       = &Deployment{}
+	_ driver.Connector    = &Deployment{}
+	_ driver.Disconnector = &Deployment{}
+	_ driver.Subscriber   = &Deployment{}
+)
+
+// New will return a deployment that reports unexpected commands to t. The
+// "endSessions" command sent on disconnect is answered with {ok: 1} unless a
+// rule for it is added.
+func New(t testing.TB) *Deployment {
+	return &Deployment{t: t, kind: description.ServerKindRSPrimary, maxBatchCount: defaultMaxBatchCount}
+}
+
+// SetServerKind changes the kind of server the deployment reports, e.g. to
+// description.ServerKindMongos. The default is a replica set primary.
+func (d *Deployment) SetServerKind(kind description.ServerKind) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.kind = kind
+}
+
+// SetMaxBatchCount changes the maxWriteBatchSize the deployment reports, which
+// makes the driver split writes into smaller batches. The default is 100,000.
+func (d *Deployment) SetMaxBatchCount(n uint32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.maxBatchCount = n
+}
+
+// NewClient will return a client that sends every operation to the
+// deployment. The deployment option overrides any deployment set in opts.
+func (d *Deployment) NewClient(opts ...*options.ClientOptions) (*mongo.Client, error) {
+	deploymentOpts := options.Client()
+	deploymentOpts.Deployment = d
+
+	return mongo.Connect(append(opts, deploymentOpts)...)
+}
+
+// On will register a rule for commands with the given name. Rules are
+// consulted in the order they were registered.
+func (d *Deployment) On(name string) *Rule {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	rule := &Rule{name: name}
+	d.rules = append(d.rules, rule)
+
+	return rule
+}
+
+// Commands returns every command sent so far, in order.
+func (d *Deployment) Commands() []Command {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]Command(nil), d.commands...)
+}
+
+// CommandsNamed returns the commands with the given name sent so far, in
+// order.
+func (d *Deployment) CommandsNamed(name string) []Command {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var cmds []Command
+	for _, cmd := range d.commands {
+		if cmd.Name == name {
+			cmds = append(cmds, cmd)
+		}
+	}
+
+	return cmds
+}
+
+// Reset forgets the captured commands. Rules are kept.
+func (d *Deployment) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.commands = nil
+}
+
+// Verify will fail the test for every rule that still has replies left, i.e.
+// commands the test expected the driver to send but it never did.
+func (d *Deployment) Verify() {
+	d.t.Helper()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, rule := range d.rules {
+		if remaining := rule.remaining(); remaining > 0 {
+			d.t.Errorf("rule for %q has %d unused replies", rule.name, remaining)
+		}
+	}
+}
+
+// handle will record the command and return the reply for it.
+func (d *Deployment) handle(cmd Command) bson.D {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.commands = append(d.commands, cmd)
+
+	for _, rule := range d.rules {
+		if reply, ok := rule.reply(cmd); ok {
+			return reply
+		}
+	}
+
+	if cmd.Name == "endSessions" {
+		return OK()
+	}
+
+	d.t.Errorf("unexpected command %q: %v", cmd.Name, cmd.Document)
+
+	return Error(59, "CommandNotFound", fmt.Sprintf("no scripted reply for command %q", cmd.Name))
+}
+
+// SelectServer implements the driver.Deployment interface by returning the
+// deployment itself.
+func (d *Deployment) SelectServer(context.Context, description.ServerSelector) (driver.Server, error) {
+	return d, nil
+}
+
+// GetServerSelectionTimeout returns zero as server selection never blocks.
+func (*Deployment) GetServerSelectionTimeout() time.Duration {
+	return 0
+}
+
+// Kind implements the driver.Deployment interface.
+func (d *Deployment) Kind() description.TopologyKind {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.kind == description.ServerKindMongos {
+		return description.TopologyKindSharded
+	}
+
+	return description.TopologyKindReplicaSetWithPrimary
+}
+
+// Connection implements the driver.Server interface. Every call returns a new
+// connection so that concurrent operations get the replies to their own
+// commands.
+func (d *Deployment) Connection(context.Context) (*mnet.Connection, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.nextID++
+
+	conn := &connection{
+		deployment:    d,
+		id:            d.nextID,
+		kind:          d.kind,
+		maxBatchCount: d.maxBatchCount,
+	}
+
+	return mnet.NewConnection(conn), nil
+}
+
+// RTTMonitor implements the driver.Server interface.
+func (*Deployment) RTTMonitor() driver.RTTMonitor {
+	return zeroRTTMonitor{}
+}
+
+// Connect is a no-op that implements the driver.Connector interface.
+func (*Deployment) Connect() error {
+	return nil
+}
+
+// Disconnect implements the driver.Disconnector interface.
+func (d *Deployment) Disconnect(context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.updates != nil {
+		close(d.updates)
+		d.updates = nil
+	}
+
+	return nil
+}
+
+// Subscribe implements the driver.Subscriber interface. The only topology
+// description published carries the session timeout, which the client needs
+// to support sessions.
+func (d *Deployment) Subscribe() (*driver.Subscription, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.updates == nil {
+		timeout := sessionTimeoutMinutes
+
+		d.updates = make(chan description.Topology, 1)
+		d.updates <- description.Topology{SessionTimeoutMinutes: &timeout}
+	}
+
+	return &driver.Subscription{Updates: d.updates}, nil
+}
+
+// Unsubscribe is a no-op that implements the driver.Subscriber interface.
+func (*Deployment) Unsubscribe(*driver.Subscription) error {
+	return nil
+}
+
+type zeroRTTMonitor struct{}
+
+func (zeroRTTMonitor) EWMA() time.Duration { return 0 }
+func (zeroRTTMonitor) Min() time.Duration  { return 0 }
+func (zeroRTTMonitor) Stats() string       { return "" }
+
+// connection replies to each wire message written to it with the reply
+// chosen by the deployment.
+type connection struct {
+	deployment    *Deployment
+	id            int64
+	kind          description.ServerKind
+	maxBatchCount uint32
+
+	mu      sync.Mutex
+	replies [][]byte
+}
+
+var (
+	_ mnet.ReadWriteCloser = &connection{}
+	_ mnet.Describer       = &connection{}
+)
+
+func (c *connection) Write(_ context.Context, wm []byte) error {
+	requestID, cmd, moreToCome, err := decodeMsg(wm)
+	if err != nil {
+		c.deployment.t.Errorf("failed to decode wire message: %v", err)
+
+		return err
+	}
+
+	reply := c.deployment.handle(cmd)
+
+	// Unacknowledged writes don't get a reply.
+	if moreToCome {
+		return nil
+	}
+
+	b, err := encodeReply(requestID, reply)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.replies = append(c.replies, b)
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *connection) Read(ctx context.Context) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.replies) == 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		return nil, errors.New("no reply pending")
+	}
+
+	reply := c.replies[0]
+	c.replies = c.replies[1:]
+
+	return reply, nil
+}
+
+func (*connection) Close() error { return nil }
+
+func (c *connection) Description() description.Server {
+	timeout := sessionTimeoutMinutes
+
+	return description.Server{
+		Addr:                  serverAddress,
+		CanonicalAddr:         serverAddress,
+		Kind:                  c.kind,
+		MaxDocumentSize:       16 * 1024 * 1024,
+		MaxMessageSize:        48000000,
+		MaxBatchCount:         c.maxBatchCount,
+		SessionTimeoutMinutes: &timeout,
+		WireVersion:           &description.VersionRange{Max: maxWireVersion},
+	}
+}
+
+func (c *connection) ID() string { return "mockdeploy[" + strconv.FormatInt(c.id, 10) + "]" }
+
+func (c *connection) ServerConnectionID() *int64 {
+	id := c.id
+
+	return &id
+}
+
+func (c *connection) DriverConnectionID() int64 { return c.id }
+func (*connection) Address() address.Address    { return serverAddress }
+func (*connection) Stale() bool                 { return false }
+func (*connection) OIDCTokenGenID() uint64      { return 0 }
+func (*connection) SetOIDCTokenGenID(uint64)    {}
+
+// decodeMsg will decode an OP_MSG wire message, folding any document
+// sequences (e.g. the "documents" of an insert) into the command document.
+func decodeMsg(wm []byte) (int32, Command, bool, error) {
+	_, requestID, _, opcode, rem, ok := wiremessage.ReadHeader(wm)
+	if !ok {
+		return 0, Command{}, false, errors.New("could not read header")
+	}
+
+	if opcode != wiremessage.OpMsg {
+		return 0, Command{}, false, fmt.Errorf("unsupported opcode %v", opcode)
+	}
+
+	flags, rem, ok := wiremessage.ReadMsgFlags(rem)
+	if !ok {
+		return 0, Command{}, false, errors.New("could not read flags")
+	}
+
+	if flags&wiremessage.ChecksumPresent != 0 && len(rem) >= 4 {
+		rem = rem[:len(rem)-4]
+	}
+
+	var (
+		body      bsoncore.Document
+		sequences []bsoncore.Element
+	)
+
+	for len(rem) > 0 {
+		var stype wiremessage.SectionType
+
+		stype, rem, ok = wiremessage.ReadMsgSectionType(rem)
+		if !ok {
+			return 0, Command{}, false, errors.New("could not read section type")
+		}
+
+		switch stype {
+		case wiremessage.SingleDocument:
+			body, rem, ok = wiremessage.ReadMsgSectionSingleDocument(rem)
+			if !ok {
+				return 0, Command{}, false, errors.New("could not read command document")
+			}
+		case wiremessage.DocumentSequence:
+			var (
+				identifier string
+				docs       []bsoncore.Document
+			)
+
+			identifier, docs, rem, ok = wiremessage.ReadMsgSectionDocumentSequence(rem)
+			if !ok {
+				return 0, Command{}, false, errors.New("could not read document sequence")
+			}
+
+			aidx, arr := bsoncore.AppendArrayElementStart(nil, identifier)
+			for i, doc := range docs {
+				arr = bsoncore.AppendDocumentElement(arr, strconv.Itoa(i), doc)
+			}
+
+			arr, _ = bsoncore.AppendArrayEnd(arr, aidx)
+			sequences = append(sequences, arr)
+		default:
+			return 0, Command{}, false, fmt.Errorf("unsupported section type %v", stype)
+		}
+	}
+
+	if body == nil {
+		return 0, Command{}, false, errors.New("wire message has no command document")
+	}
+
+	doc := body
+	if len(sequences) > 0 {
+		elems, err := body.Elements()
+		if err != nil {
+			return 0, Command{}, false, fmt.Errorf("invalid command document: %w", err)
+		}
+
+		idx, dst := bsoncore.AppendDocumentStart(nil)
+		for _, elem := range elems {
+			dst = append(dst, elem...)
+		}
+
+		for _, seq := range sequences {
+			dst = append(dst, seq...)
+		}
+
+		doc, _ = bsoncore.AppendDocumentEnd(dst, idx)
+	}
+
+	cmd := Command{Document: bson.Raw(doc)}
+
+	if first, err := doc.IndexErr(0); err == nil {
+		cmd.Name = first.Key()
+	}
+
+	if db, ok := doc.Lookup("$db").StringValueOK(); ok {
+		cmd.Database = db
+	}
+
+	return requestID, cmd, flags&wiremessage.MoreToCome != 0, nil
+}
+
+// encodeReply will encode the reply as an OP_MSG responding to requestID.
+func encodeReply(requestID int32, reply bson.D) ([]byte, error) {
+	doc, err := bson.Marshal(reply)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal reply: %w", err)
+	}
+
+	idx, dst := wiremessage.AppendHeaderStart(nil, wiremessage.NextRequestID(), requestID, wiremessage.OpMsg)
+	dst = wiremessage.AppendMsgFlags(dst, 0)
+	dst = wiremessage.AppendMsgSectionType(dst, wiremessage.SingleDocument)
+	dst = append(dst, doc...)
+
+	return bsoncore.UpdateLength(dst, idx, int32(len(dst[idx:]))), nil
+}
@@ -0,0 +1,209 @@
+package mockdeploy
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
+)
+
+// recordingT captures failures instead of failing the test, so that tests can
+// assert that the deployment reports them.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (rt *recordingT) Helper() {}
+
+func (rt *recordingT) Errorf(format string, args ...any) {
+	rt.errors = append(rt.errors, fmt.Sprintf(format, args...))
+}
+
+func newCollection(t *testing.T, d *Deployment) *mongo.Collection {
+	t.Helper()
+
+	client, err := d.NewClient()
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+
+	return client.Database("db").Collection("coll")
+}
+
+func TestDeployment_FindByFilter(t *testing.T) {
+	d := New(t)
+	coll := newCollection(t, d)
+
+	d.On("find").Where(Filter("x", 1)).Reply(Cursor("db.coll", 0, bson.D{{Key: "x", Value: 1}}))
+	d.On("find").Where(Filter("x", 2)).Reply(Cursor("db.coll", 0, bson.D{{Key: "x", Value: 2}, {Key: "y", Value: true}}))
+
+	var doc bson.D
+
+	err := coll.FindOne(context.Background(), bson.D{{Key: "x", Value: 2}}).Decode(&doc)
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "x", Value: int32(2)}, {Key: "y", Value: true}}, doc)
+
+	err = coll.FindOne(context.Background(), bson.D{{Key: "x", Value: int64(1)}}).Decode(&doc)
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "x", Value: int32(1)}}, doc)
+
+	finds := d.CommandsNamed("find")
+	require.Len(t, finds, 2)
+
+	assert.Equal(t, "db", finds[0].Database)
+	assert.Equal(t, "coll", finds[0].Document.Lookup("find").StringValue())
+	assert.True(t, Field("limit", 1)(finds[0]))
+
+	d.Verify()
+}
+
+func TestDeployment_CursorGetMore(t *testing.T) {
+	d := New(t)
+	coll := newCollection(t, d)
+
+	d.On("find").Reply(Cursor("db.coll", 42, bson.D{{Key: "_id", Value: 1}}))
+	d.On("getMore").Where(Field("getMore", int64(42))).Reply(NextBatch("db.coll", 0, bson.D{{Key: "_id", Value: 2}}))
+
+	cursor, err := coll.Find(context.Background(), bson.D{})
+	require.NoError(t, err)
+
+	var docs []bson.D
+	require.NoError(t, cursor.All(context.Background(), &docs))
+
+	assert.Len(t, docs, 2)
+
+	d.Verify()
+}
+
+func TestDeployment_InsertCapturesDocuments(t *testing.T) {
+	d := New(t)
+	coll := newCollection(t, d)
+
+	d.On("insert").ReplyFunc(func(cmd Command) bson.D {
+		docs, _ := cmd.Document.Lookup("documents").Array().Values()
+
+		return Inserted(int32(len(docs)))
+	})
+
+	_, err := coll.InsertMany(context.Background(), []bson.D{
+		{{Key: "_id", Value: 1}},
+		{{Key: "_id", Value: 2}},
+	})
+	require.NoError(t, err)
+
+	inserts := d.CommandsNamed("insert")
+	require.Len(t, inserts, 1)
+
+	docs, err := inserts[0].Document.Lookup("documents").Array().Values()
+	require.NoError(t, err)
+	require.Len(t, docs, 2, "the document sequence must be folded into the command")
+
+	assert.Equal(t, int32(2), docs[1].Document().Lookup("_id").Int32())
+}
+
+func TestDeployment_UnacknowledgedWrite(t *testing.T) {
+	d := New(t)
+
+	client, err := d.NewClient(options.Client().SetWriteConcern(writeconcern.Unacknowledged()))
+	require.NoError(t, err)
+
+	defer func() { _ = client.Disconnect(context.Background()) }()
+
+	d.On("insert").Reply(OK())
+
+	_, err = client.Database("db").Collection("coll").InsertOne(context.Background(), bson.D{{Key: "x", Value: 1}})
+	require.NoError(t, err)
+
+	assert.Len(t, d.CommandsNamed("insert"), 1)
+}
+
+func TestDeployment_WriteErrors(t *testing.T) {
+	d := New(t)
+	coll := newCollection(t, d)
+
+	d.On("insert").Reply(Write(WriteResult{
+		N:           1,
+		WriteErrors: []WriteError{{Index: 1, Code: 11000, Message: "E11000 duplicate key error"}},
+	}))
+
+	_, err := coll.InsertMany(context.Background(), []bson.D{{{Key: "_id", Value: 1}}, {{Key: "_id", Value: 1}}})
+
+	var bwe mongo.BulkWriteException
+	require.ErrorAs(t, err, &bwe)
+
+	assert.True(t, mongo.IsDuplicateKeyError(err))
+	assert.Equal(t, 1, bwe.WriteErrors[0].Index)
+}
+
+func TestDeployment_ErrorLabels(t *testing.T) {
+	d := New(t)
+	coll := newCollection(t, d)
+
+	d.On("delete").Reply(Error(112, "WriteConflict", "write conflict", "TransientTransactionError"))
+
+	_, err := coll.DeleteOne(context.Background(), bson.D{})
+
+	var serverErr mongo.ServerError
+	require.ErrorAs(t, err, &serverErr)
+
+	assert.True(t, serverErr.HasErrorCode(112))
+	assert.True(t, serverErr.HasErrorLabel("TransientTransactionError"))
+}
+
+func TestDeployment_RepeatAndExhaust(t *testing.T) {
+	rt := &recordingT{TB: t}
+
+	d := New(rt)
+	coll := newCollection(t, d)
+
+	d.On("count").Reply(OK(bson.E{Key: "n", Value: 3}))
+	d.On("update").Reply(Write(WriteResult{N: 1, NModified: 1})).Repeat()
+
+	for i := 0; i < 3; i++ {
+		_, err := coll.UpdateOne(context.Background(), bson.D{}, bson.D{{Key: "$set", Value: bson.D{{Key: "x", Value: i}}}})
+		require.NoError(t, err)
+	}
+
+	// The count reply was never used.
+	d.Verify()
+	require.Len(t, rt.errors, 1)
+	assert.Contains(t, rt.errors[0], `rule for "count" has 1 unused replies`)
+}
+
+func TestDeployment_UnexpectedCommand(t *testing.T) {
+	rt := &recordingT{TB: t}
+
+	d := New(rt)
+	coll := newCollection(t, d)
+
+	err := coll.Drop(context.Background())
+	assert.Error(t, err)
+
+	require.Len(t, rt.errors, 1)
+	assert.Contains(t, rt.errors[0], `unexpected command "drop"`)
+}
+
+func TestField(t *testing.T) {
+	raw, err := bson.Marshal(bson.D{
+		{Key: "find", Value: "coll"},
+		{Key: "filter", Value: bson.D{{Key: "a", Value: bson.D{{Key: "b", Value: 1.0}}}}},
+		{Key: "comment", Value: "hi"},
+	})
+	require.NoError(t, err)
+
+	cmd := Command{Name: "find", Document: raw}
+
+	assert.True(t, Filter("a.b", 1)(cmd), "numbers compare by value")
+	assert.False(t, Filter("a.b", 2)(cmd))
+	assert.True(t, Field("comment", "hi")(cmd))
+	assert.False(t, Field("comment", 1)(cmd))
+	assert.True(t, Exists("filter.a")(cmd))
+	assert.False(t, Exists("sort")(cmd))
+}
@@ -0,0 +1,131 @@
+package mockdeploy
+
+import "go.mongodb.org/mongo-driver/v2/bson"
+
+// OK will return a successful reply, {ok: 1}, with any extra fields appended.
+func OK(fields ...bson.E) bson.D {
+	return append(bson.D{{Key: "ok", Value: 1.0}}, fields...)
+}
+
+// Error will return a command error reply. Error labels such as
+// "TransientTransactionError" are only included when given.
+func Error(code int32, codeName, msg string, labels ...string) bson.D {
+	reply := bson.D{
+		{Key: "ok", Value: 0.0},
+		{Key: "errmsg", Value: msg},
+		{Key: "code", Value: code},
+		{Key: "codeName", Value: codeName},
+	}
+
+	if len(labels) > 0 {
+		reply = append(reply, bson.E{Key: "errorLabels", Value: labels})
+	}
+
+	return reply
+}
+
+// Cursor will return the reply to a cursor-creating command such as find or
+// aggregate. A non-zero id tells the driver more batches are available via
+// getMore.
+func Cursor(ns string, id int64, docs ...any) bson.D {
+	return cursorReply("firstBatch", ns, id, docs)
+}
+
+// NextBatch will return the reply to a getMore.
+func NextBatch(ns string, id int64, docs ...any) bson.D {
+	return cursorReply("nextBatch", ns, id, docs)
+}
+
+func cursorReply(batchKey, ns string, id int64, docs []any) bson.D {
+	batch := bson.A{}
+	batch = append(batch, docs...)
+
+	return OK(bson.E{Key: "cursor", Value: bson.D{
+		{Key: "id", Value: id},
+		{Key: "ns", Value: ns},
+		{Key: batchKey, Value: batch},
+	}})
+}
+
+// Upserted describes a document upserted by an update.
+type Upserted struct {
+	Index int32
+	ID    any
+}
+
+// WriteError describes a write error on a single document of a batch.
+type WriteError struct {
+	Index   int32
+	Code    int32
+	Message string
+}
+
+// WriteResult describes the result of an insert, update or delete command.
+type WriteResult struct {
+	N           int32 // Number of documents matched or inserted
+	NModified   int32 // Number of documents modified by an update
+	Upserted    []Upserted
+	WriteErrors []WriteError
+
+	// WriteConcernError, if set, is reported as a writeConcernError with this
+	// code.
+	WriteConcernError int32
+}
+
+// Write will return the reply to a write command.
+func Write(res WriteResult) bson.D {
+	reply := OK(
+		bson.E{Key: "n", Value: res.N},
+		bson.E{Key: "nModified", Value: res.NModified},
+	)
+
+	if len(res.Upserted) > 0 {
+		upserted := bson.A{}
+		for _, u := range res.Upserted {
+			upserted = append(upserted, bson.D{{Key: "index", Value: u.Index}, {Key: "_id", Value: u.ID}})
+		}
+
+		reply = append(reply, bson.E{Key: "upserted", Value: upserted})
+	}
+
+	if len(res.WriteErrors) > 0 {
+		writeErrors := bson.A{}
+		for _, we := range res.WriteErrors {
+			writeErrors = append(writeErrors, bson.D{
+				{Key: "index", Value: we.Index},
+				{Key: "code", Value: we.Code},
+				{Key: "errmsg", Value: we.Message},
+			})
+		}
+
+		reply = append(reply, bson.E{Key: "writeErrors", Value: writeErrors})
+	}
+
+	if res.WriteConcernError != 0 {
+		reply = append(reply, bson.E{Key: "writeConcernError", Value: bson.D{
+			{Key: "code", Value: res.WriteConcernError},
+			{Key: "errmsg", Value: "write concern error"},
+		}})
+	}
+
+	return reply
+}
+
+// Inserted will return the reply to an insert of n documents.
+func Inserted(n int32) bson.D {
+	return Write(WriteResult{N: n})
+}
+
+// FindAndModify will return the reply to a findAndModify whose pre- or
+// post-image is value. A nil value means no document matched.
+func FindAndModify(value any) bson.D {
+	n := int32(1)
+	if value == nil {
+		n = 0
+	}
+
+	return OK(
+		bson.E{Key: "lastErrorObject", Value: bson.D{{Key: "n", Value: n}}},
+		bson.E{Key: "value", Value: value},
+	)
+}
@@ -0,0 +1,149 @@
+package mockdeploy
+
+import (
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Predicate reports whether a command matches.
+type Predicate func(cmd Command) bool
+
+// Field will return a predicate that matches commands whose value at the
+// dotted path equals value. Numbers compare by value, so Field("limit", 1)
+// matches {limit: 1} whether it was sent as an int32, int64 or double.
+func Field(path string, value any) Predicate {
+	return func(cmd Command) bool {
+		actual, err := cmd.Document.LookupErr(strings.Split(path, ".")...)
+		if err != nil {
+			return false
+		}
+
+		return equal(actual, value)
+	}
+}
+
+// Exists will return a predicate that matches commands that have a value at
+// the dotted path.
+func Exists(path string) Predicate {
+	return func(cmd Command) bool {
+		_, err := cmd.Document.LookupErr(strings.Split(path, ".")...)
+
+		return err == nil
+	}
+}
+
+// Filter will return a predicate that matches commands whose "filter"
+// document has the given value at the dotted path, e.g. Filter("x", 1) for
+// find({x: 1}).
+func Filter(path string, value any) Predicate {
+	return Field("filter."+path, value)
+}
+
+// Rule replies to matching commands.
+type Rule struct {
+	name       string
+	predicates []Predicate
+	replies    []func(Command) bson.D
+	next       int
+	repeat     bool
+}
+
+// Where will restrict the rule to commands that match every predicate.
+func (r *Rule) Where(preds ...Predicate) *Rule {
+	r.predicates = append(r.predicates, preds...)
+
+	return r
+}
+
+// Reply will queue replies. Each matching command consumes the next reply, and
+// the rule stops matching once they are used up unless Repeat is called.
+func (r *Rule) Reply(replies ...bson.D) *Rule {
+	for _, reply := range replies {
+		reply := reply
+		r.replies = append(r.replies, func(Command) bson.D { return reply })
+	}
+
+	return r
+}
+
+// ReplyFunc will queue a reply computed from the command, e.g. to echo back
+// the number of documents in an insert.
+func (r *Rule) ReplyFunc(fn func(cmd Command) bson.D) *Rule {
+	r.replies = append(r.replies, fn)
+
+	return r
+}
+
+// Repeat will keep replying with the last reply once the others are used up.
+func (r *Rule) Repeat() *Rule {
+	r.repeat = true
+
+	return r
+}
+
+// remaining returns the number of unused replies.
+func (r *Rule) remaining() int {
+	if r.repeat {
+		return 0
+	}
+
+	return len(r.replies) - r.next
+}
+
+// reply will return the next reply if the rule matches cmd.
+func (r *Rule) reply(cmd Command) (bson.D, bool) {
+	if cmd.Name != r.name || len(r.replies) == 0 {
+		return nil, false
+	}
+
+	if r.next >= len(r.replies) && !r.repeat {
+		return nil, false
+	}
+
+	for _, pred := range r.predicates {
+		if !pred(cmd) {
+			return nil, false
+		}
+	}
+
+	pos := r.next
+	if pos >= len(r.replies) {
+		pos = len(r.replies) - 1
+	} else {
+		r.next++
+	}
+
+	return r.replies[pos](cmd), true
+}
+
+// equal will compare a value in a command with an expected Go value.
+func equal(actual bson.RawValue, expected any) bool {
+	typ, data, err := bson.MarshalValue(expected)
+	if err != nil {
+		return false
+	}
+
+	want := bson.RawValue{Type: typ, Value: data}
+
+	if a, ok := number(actual); ok {
+		if w, ok := number(want); ok {
+			return a == w
+		}
+	}
+
+	return actual.Equal(want)
+}
+
+func number(rv bson.RawValue) (float64, bool) {
+	switch rv.Type {
+	case bson.TypeInt32:
+		return float64(rv.Int32()), true
+	case bson.TypeInt64:
+		return float64(rv.Int64()), true
+	case bson.TypeDouble:
+		return rv.Double(), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,253 @@
+// Package oneof provides tagged unions for BSON fields that may hold one of
+// several types, e.g. a field that is either a string or a boolean.
+//
+//	type Options struct {
+//		WriteBlocking oneof.OneOf2[string, bool] `bson:"writeBlocking"`
+//	}
+//
+// Decoding picks the first alternative whose natural BSON type, the type its
+// zero value marshals to, matches the stored value exactly. If none matches,
+// the alternatives are tried in order with the default decoders, so an int64
+// is still accepted by an int alternative. A decoded value that is not changed
+// is encoded back with its original BSON type and bytes. Both work through
+// bson.UnmarshalExtJSON and bson.MarshalExtJSON as well.
+package oneof
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// alternative decodes a BSON value into one Go type of a union.
+type alternative struct {
+	natural bson.Type
+	decode  func(rv bson.RawValue) (any, error)
+}
+
+func alternativeFor[T any]() alternative {
+	var zero T
+
+	natural, _, _ := bson.MarshalValue(zero)
+
+	return alternative{
+		natural: natural,
+		decode: func(rv bson.RawValue) (any, error) {
+			var val T
+			if err := rv.Unmarshal(&val); err != nil {
+				return nil, err
+			}
+
+			return val, nil
+		},
+	}
+}
+
+// union is the state shared by the OneOf types. index is 1-based so that the
+// zero value is an unset union, which encodes as null.
+type union struct {
+	index int
+	value any
+	raw   bson.RawValue // Value as decoded, until it is replaced
+}
+
+func (u *union) set(index int, value any) {
+	*u = union{index: index, value: value}
+}
+
+func (u union) marshal() (byte, []byte, error) {
+	if u.index == 0 {
+		return byte(bson.TypeNull), nil, nil
+	}
+
+	if u.raw.Type != 0 {
+		return byte(u.raw.Type), u.raw.Value, nil
+	}
+
+	typ, data, err := bson.MarshalValue(u.value)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to marshal alternative %d: %w", u.index, err)
+	}
+
+	return byte(typ), data, nil
+}
+
+func (u *union) unmarshal(typ byte, data []byte, alts ...alternative) error {
+	rv := bson.RawValue{Type: bson.Type(typ), Value: data}
+
+	if rv.Type == bson.TypeNull || rv.Type == bson.TypeUndefined {
+		*u = union{}
+
+		return nil
+	}
+
+	for i, alt := range alts {
+		if alt.natural != rv.Type {
+			continue
+		}
+
+		if val, err := alt.decode(rv); err == nil {
+			u.decoded(i+1, val, rv)
+
+			return nil
+		}
+	}
+
+	for i, alt := range alts {
+		if val, err := alt.decode(rv); err == nil {
+			u.decoded(i+1, val, rv)
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("cannot decode %v into any of %d alternatives", rv.Type, len(alts))
+}
+
+func (u *union) decoded(index int, value any, rv bson.RawValue) {
+	// Copy the bytes, the decoder may reuse its buffer.
+	raw := bson.RawValue{Type: rv.Type, Value: append([]byte(nil), rv.Value...)}
+
+	*u = union{index: index, value: value, raw: raw}
+}
+
+// OneOf2 holds a value of type A or B.
+type OneOf2[A, B any] struct {
+	u union
+}
+
+var (
+	_ bson.ValueMarshaler   = OneOf2[string, bool]{}
+	_ bson.ValueUnmarshaler = &OneOf2[string, bool]{}
+)
+
+// New2A will return a union holding a.
+func New2A[A, B any](a A) OneOf2[A, B] {
+	var o OneOf2[A, B]
+	o.SetA(a)
+
+	return o
+}
+
+// New2B will return a union holding b.
+func New2B[A, B any](b B) OneOf2[A, B] {
+	var o OneOf2[A, B]
+	o.SetB(b)
+
+	return o
+}
+
+// Index returns 1 when the union holds an A, 2 when it holds a B and 0 when it
+// is unset.
+func (o OneOf2[A, B]) Index() int { return o.u.index }
+
+// Value returns the value held, or nil when the union is unset.
+func (o OneOf2[A, B]) Value() any { return o.u.value }
+
+// A returns the value if the union holds an A.
+func (o OneOf2[A, B]) A() (A, bool) { return get[A](o.u, 1) }
+
+// B returns the value if the union holds a B.
+func (o OneOf2[A, B]) B() (B, bool) { return get[B](o.u, 2) }
+
+// SetA replaces the value with a.
+func (o *OneOf2[A, B]) SetA(a A) { o.u.set(1, a) }
+
+// SetB replaces the value with b.
+func (o *OneOf2[A, B]) SetB(b B) { o.u.set(2, b) }
+
+// MarshalBSONValue implements the bson.ValueMarshaler interface.
+func (o OneOf2[A, B]) MarshalBSONValue() (byte, []byte, error) {
+	return o.u.marshal()
+}
+
+// UnmarshalBSONValue implements the bson.ValueUnmarshaler interface.
+func (o *OneOf2[A, B]) UnmarshalBSONValue(typ byte, data []byte) error {
+	return o.u.unmarshal(typ, data, alternativeFor[A](), alternativeFor[B]())
+}
+
+func (o OneOf2[A, B]) String() string {
+	return fmt.Sprint(o.u.value)
+}
+
+// OneOf3 holds a value of type A, B or C.
+type OneOf3[A, B, C any] struct {
+	u union
+}
+
+var (
+	_ bson.ValueMarshaler   = OneOf3[string, bool, int]{}
+	_ bson.ValueUnmarshaler = &OneOf3[string, bool, int]{}
+)
+
+// New3A will return a union holding a.
+func New3A[A, B, C any](a A) OneOf3[A, B, C] {
+	var o OneOf3[A, B, C]
+	o.SetA(a)
+
+	return o
+}
+
+// New3B will return a union holding b.
+func New3B[A, B, C any](b B) OneOf3[A, B, C] {
+	var o OneOf3[A, B, C]
+	o.SetB(b)
+
+	return o
+}
+
+// New3C will return a union holding c.
+func New3C[A, B, C any](c C) OneOf3[A, B, C] {
+	var o OneOf3[A, B, C]
+	o.SetC(c)
+
+	return o
+}
+
+// Index returns 1, 2 or 3 for an A, B or C and 0 when the union is unset.
+func (o OneOf3[A, B, C]) Index() int { return o.u.index }
+
+// Value returns the value held, or nil when the union is unset.
+func (o OneOf3[A, B, C]) Value() any { return o.u.value }
+
+// A returns the value if the union holds an A.
+func (o OneOf3[A, B, C]) A() (A, bool) { return get[A](o.u, 1) }
+
+// B returns the value if the union holds a B.
+func (o OneOf3[A, B, C]) B() (B, bool) { return get[B](o.u, 2) }
+
+// C returns the value if the union holds a C.
+func (o OneOf3[A, B, C]) C() (C, bool) { return get[C](o.u, 3) }
+
+// SetA replaces the value with a.
+func (o *OneOf3[A, B, C]) SetA(a A) { o.u.set(1, a) }
+
+// SetB replaces the value with b.
+func (o *OneOf3[A, B, C]) SetB(b B) { o.u.set(2, b) }
+
+// SetC replaces the value with c.
+func (o *OneOf3[A, B, C]) SetC(c C) { o.u.set(3, c) }
+
+// MarshalBSONValue implements the bson.ValueMarshaler interface.
+func (o OneOf3[A, B, C]) MarshalBSONValue() (byte, []byte, error) {
+	return o.u.marshal()
+}
+
+// UnmarshalBSONValue implements the bson.ValueUnmarshaler interface.
+func (o *OneOf3[A, B, C]) UnmarshalBSONValue(typ byte, data []byte) error {
+	return o.u.unmarshal(typ, data, alternativeFor[A](), alternativeFor[B](), alternativeFor[C]())
+}
+
+func (o OneOf3[A, B, C]) String() string {
+	return fmt.Sprint(o.u.value)
+}
+
+func get[T any](u union, index int) (T, bool) {
+	if u.index != index {
+		var zero T
+
+		return zero, false
+	}
+
+	return u.value.(T), true
+}
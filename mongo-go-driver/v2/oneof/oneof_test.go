@@ -0,0 +1,122 @@
+package oneof
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type options struct {
+	WriteBlocking OneOf2[string, bool]          `bson:"writeBlocking"`
+	Limit         OneOf2[int, string]           `bson:"limit"`
+	Shape         OneOf2[bson.D, bson.A]        `bson:"shape"`
+	Any           OneOf3[bool, float64, string] `bson:"any,omitempty"`
+}
+
+func TestOneOf2_StringOrBool(t *testing.T) {
+	for _, value := range []any{true, "majority"} {
+		raw, err := bson.Marshal(bson.D{{Key: "writeBlocking", Value: value}})
+		require.NoError(t, err)
+
+		var opts options
+		require.NoError(t, bson.Unmarshal(raw, &opts))
+
+		assert.Equal(t, value, opts.WriteBlocking.Value())
+
+		if b, ok := opts.WriteBlocking.B(); ok {
+			assert.True(t, b)
+			assert.Equal(t, 2, opts.WriteBlocking.Index())
+		} else {
+			s, ok := opts.WriteBlocking.A()
+			require.True(t, ok)
+			assert.Equal(t, "majority", s)
+		}
+	}
+}
+
+func TestOneOf2_PreservesOriginalType(t *testing.T) {
+	raw, err := bson.Marshal(bson.D{{Key: "limit", Value: int64(5)}})
+	require.NoError(t, err)
+
+	var opts options
+	require.NoError(t, bson.Unmarshal(raw, &opts))
+
+	limit, ok := opts.Limit.A()
+	require.True(t, ok, "an int64 is accepted by the int alternative")
+	assert.Equal(t, 5, limit)
+
+	out, err := bson.Marshal(opts)
+	require.NoError(t, err)
+	assert.Equal(t, bson.TypeInt64, bson.Raw(out).Lookup("limit").Type, "encoded back as the original type")
+
+	opts.Limit.SetB("all")
+
+	out, err = bson.Marshal(opts)
+	require.NoError(t, err)
+	assert.Equal(t, "all", bson.Raw(out).Lookup("limit").StringValue())
+}
+
+func TestOneOf2_DocOrArray(t *testing.T) {
+	raw, err := bson.Marshal(bson.D{{Key: "shape", Value: bson.A{1, 2}}})
+	require.NoError(t, err)
+
+	var opts options
+	require.NoError(t, bson.Unmarshal(raw, &opts))
+
+	arr, ok := opts.Shape.B()
+	require.True(t, ok)
+	assert.Equal(t, bson.A{int32(1), int32(2)}, arr)
+
+	raw, err = bson.Marshal(bson.D{{Key: "shape", Value: bson.D{{Key: "x", Value: 1}}}})
+	require.NoError(t, err)
+
+	require.NoError(t, bson.Unmarshal(raw, &opts))
+
+	doc, ok := opts.Shape.A()
+	require.True(t, ok)
+	assert.Equal(t, bson.D{{Key: "x", Value: int32(1)}}, doc)
+}
+
+func TestOneOf3_ExtJSON(t *testing.T) {
+	tests := []struct {
+		json  string
+		index int
+		want  any
+	}{
+		{json: `{"any": true}`, index: 1, want: true},
+		{json: `{"any": {"$numberDouble": "1.5"}}`, index: 2, want: 1.5},
+		{json: `{"any": "x"}`, index: 3, want: "x"},
+		{json: `{"any": null}`, index: 0, want: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.json, func(t *testing.T) {
+			var opts options
+			require.NoError(t, bson.UnmarshalExtJSON([]byte(test.json), false, &opts))
+
+			assert.Equal(t, test.index, opts.Any.Index())
+			assert.Equal(t, test.want, opts.Any.Value())
+		})
+	}
+
+	out, err := bson.MarshalExtJSON(bson.D{{Key: "any", Value: New3B[bool, float64, string](2.5)}}, false, false)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"any": 2.5}`, string(out))
+}
+
+func TestOneOf_Unset(t *testing.T) {
+	out, err := bson.Marshal(bson.D{{Key: "v", Value: OneOf2[string, bool]{}}})
+	require.NoError(t, err)
+
+	assert.Equal(t, bson.TypeNull, bson.Raw(out).Lookup("v").Type)
+}
+
+func TestOneOf_NoAlternative(t *testing.T) {
+	raw, err := bson.Marshal(bson.D{{Key: "writeBlocking", Value: bson.A{}}})
+	require.NoError(t, err)
+
+	var opts options
+	assert.ErrorContains(t, bson.Unmarshal(raw, &opts), "cannot decode array into any of 2 alternatives")
+}
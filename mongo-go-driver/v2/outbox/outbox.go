@@ -0,0 +1,142 @@
+// Package outbox implements the transactional outbox pattern on MongoDB.
+//
+// Events are inserted into an outbox collection in the same transaction as
+// the business write they describe, so either both are committed or neither
+// is. A Relay then publishes committed events to a Sink and marks them
+// delivered:
+//
+//	err := box.WithTransaction(ctx, func(ctx context.Context) error {
+//		if _, err := orders.InsertOne(ctx, order); err != nil {
+//			return err
+//		}
+//
+//		_, err := box.Add(ctx, "orders.created", order.ID.Hex(), order)
+//
+//		return err
+//	})
+//
+// Call EnsureIndexes when setting up the outbox, so that relays find the
+// undelivered events through an index.
+//
+// Delivery is at least once: an event is published again if the relay stops
+// between publishing it and marking it delivered, so sinks and their
+// consumers should deduplicate on Event.ID.
+//
+// A relay polls the undelivered events in insertion order, by _id, and
+// publishes them one at a time. Nothing claims or leases an event, so relays
+// running side by side publish the same events. _ids are generated by the
+// clients that add the events and transactions commit in any order, so an
+// event can become visible after a later one was published; a sink that needs
+// a strict order, e.g. per key, must enforce it itself. An event that keeps
+// failing to publish is dead-lettered after WithMaxAttempts attempts, so that
+// it doesn't hold back the events after it.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Event is a document of the outbox collection.
+type Event struct {
+	ID          bson.ObjectID `bson:"_id"`
+	Topic       string        `bson:"topic"`
+	Key         string        `bson:"key,omitempty"` // E.g. a partition or aggregate key
+	Payload     bson.Raw      `bson:"payload"`
+	CreatedAt   time.Time     `bson:"createdAt"`
+	DeliveredAt *time.Time    `bson:"deliveredAt,omitempty"` // Unset until published
+	Attempts    int32         `bson:"attempts"`              // Failed publish attempts
+	LastError   string        `bson:"lastError,omitempty"`   // Error of the last failed attempt
+
+	// DeadLetteredAt is set when the relay gives up on publishing the event.
+	DeadLetteredAt *time.Time `bson:"deadLetteredAt,omitempty"`
+}
+
+// Outbox is an outbox collection.
+type Outbox struct {
+	coll *mongo.Collection
+}
+
+// New will return an outbox stored in coll.
+func New(coll *mongo.Collection) *Outbox {
+	return &Outbox{coll: coll}
+}
+
+// Collection will return the outbox collection.
+func (o *Outbox) Collection() *mongo.Collection {
+	return o.coll
+}
+
+// EnsureIndexes will create the index that relays poll the outbox with, on
+// deliveredAt and then _id, the order events are published in. Creating an
+// index that already exists does nothing, so it can be called on every start.
+func (o *Outbox) EnsureIndexes(ctx context.Context) error {
+	index := mongo.IndexModel{
+		Keys: bson.D{{Key: "deliveredAt", Value: 1}, {Key: "_id", Value: 1}},
+	}
+
+	if _, err := o.coll.Indexes().CreateOne(ctx, index); err != nil {
+		return fmt.Errorf("failed to create outbox index: %w", err)
+	}
+
+	return nil
+}
+
+// WithTransaction will run fn in a transaction on a new session of the
+// outbox's client, retrying it as mongo.Session.WithTransaction does. Writes
+// made with the context passed to fn, including Add, are committed together.
+func (o *Outbox) WithTransaction(
+	ctx context.Context,
+	fn func(ctx context.Context) error,
+	opts ...options.Lister[options.TransactionOptions],
+) error {
+	sess, err := o.coll.Database().Client().StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+
+	defer sess.EndSession(context.WithoutCancel(ctx))
+
+	_, err = sess.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		return nil, fn(ctx)
+	}, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to run transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Add will insert an event with payload, which must encode to a document, and
+// return its ID. It must be called with the context of a transaction, e.g.
+// the one passed to the function of WithTransaction, for the event to be
+// atomic with the other writes.
+func (o *Outbox) Add(ctx context.Context, topic, key string, payload any) (bson.ObjectID, error) {
+	if sess := mongo.SessionFromContext(ctx); sess == nil || !sess.ClientSession().TransactionRunning() {
+		return bson.ObjectID{}, fmt.Errorf("outbox event %q must be added in a transaction", topic)
+	}
+
+	raw, err := bson.Marshal(payload)
+	if err != nil {
+		return bson.ObjectID{}, fmt.Errorf("failed to encode payload of %q: %w", topic, err)
+	}
+
+	event := Event{
+		ID:        bson.NewObjectID(),
+		Topic:     topic,
+		Key:       key,
+		Payload:   raw,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if _, err := o.coll.InsertOne(ctx, event); err != nil {
+		return bson.ObjectID{}, fmt.Errorf("failed to insert outbox event: %w", err)
+	}
+
+	return event.ID, nil
+}
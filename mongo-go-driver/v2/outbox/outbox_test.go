@@ -0,0 +1,339 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/mockdeploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func newOutbox(t *testing.T) (*mockdeploy.Deployment, *mongo.Database, *Outbox) {
+	t.Helper()
+
+	d := mockdeploy.New(t)
+
+	client, err := d.NewClient()
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+
+	db := client.Database("shop")
+
+	return d, db, New(db.Collection("outbox"))
+}
+
+func newEvent(t *testing.T, topic string) Event {
+	t.Helper()
+
+	payload, err := bson.Marshal(bson.D{{Key: "topic", Value: topic}})
+	require.NoError(t, err)
+
+	return Event{
+		ID:        bson.NewObjectID(),
+		Topic:     topic,
+		Payload:   payload,
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+}
+
+func eventDocs(events ...Event) []any {
+	docs := make([]any, len(events))
+	for i, event := range events {
+		docs[i] = event
+	}
+
+	return docs
+}
+
+func TestWithTransaction(t *testing.T) {
+	d, db, box := newOutbox(t)
+
+	d.On("insert").Reply(mockdeploy.Inserted(1)).Repeat()
+	d.On("commitTransaction").Reply(mockdeploy.OK())
+
+	var id bson.ObjectID
+
+	err := box.WithTransaction(context.Background(), func(ctx context.Context) error {
+		if _, err := db.Collection("orders").InsertOne(ctx, bson.D{{Key: "_id", Value: 1}}); err != nil {
+			return err
+		}
+
+		var err error
+		id, err = box.Add(ctx, "orders.created", "1", bson.D{{Key: "order", Value: 1}})
+
+		return err
+	})
+	require.NoError(t, err)
+
+	inserts := d.CommandsNamed("insert")
+	require.Len(t, inserts, 2)
+
+	assert.Equal(t, "orders", inserts[0].Document.Lookup("insert").StringValue())
+	assert.True(t, inserts[0].Document.Lookup("startTransaction").Boolean())
+
+	outboxInsert := inserts[1].Document
+	assert.Equal(t, "outbox", outboxInsert.Lookup("insert").StringValue())
+	assert.False(t, outboxInsert.Lookup("autocommit").Boolean(), "the event must be written in the transaction")
+	assert.Equal(t, inserts[0].Document.Lookup("lsid"), outboxInsert.Lookup("lsid"))
+	assert.Equal(t, inserts[0].Document.Lookup("txnNumber"), outboxInsert.Lookup("txnNumber"))
+
+	event := outboxInsert.Lookup("documents", "0").Document()
+	assert.Equal(t, id, event.Lookup("_id").ObjectID())
+	assert.Equal(t, "orders.created", event.Lookup("topic").StringValue())
+	assert.Equal(t, int32(1), event.Lookup("payload", "order").Int32())
+
+	_, err = event.LookupErr("deliveredAt")
+	assert.Error(t, err, "a new event must be undelivered")
+
+	assert.Len(t, d.CommandsNamed("commitTransaction"), 1)
+}
+
+func TestWithTransaction_Abort(t *testing.T) {
+	d, _, box := newOutbox(t)
+
+	d.On("insert").Reply(mockdeploy.Inserted(1))
+	d.On("abortTransaction").Reply(mockdeploy.OK())
+
+	errOutOfStock := errors.New("out of stock")
+
+	err := box.WithTransaction(context.Background(), func(ctx context.Context) error {
+		if _, err := box.Add(ctx, "orders.created", "", bson.D{}); err != nil {
+			return err
+		}
+
+		return errOutOfStock
+	})
+	require.ErrorIs(t, err, errOutOfStock)
+
+	assert.Len(t, d.CommandsNamed("abortTransaction"), 1)
+	assert.Empty(t, d.CommandsNamed("commitTransaction"))
+}
+
+func TestAdd_OutsideTransaction(t *testing.T) {
+	_, _, box := newOutbox(t)
+
+	_, err := box.Add(context.Background(), "orders.created", "", bson.D{})
+	assert.ErrorContains(t, err, "must be added in a transaction")
+}
+
+func TestPoll(t *testing.T) {
+	d, _, box := newOutbox(t)
+
+	first, second := newEvent(t, "a"), newEvent(t, "b")
+
+	d.On("find").Where(mockdeploy.Filter("deliveredAt.$exists", false), mockdeploy.Field("limit", 10)).
+		Reply(mockdeploy.Cursor("shop.outbox", 0, eventDocs(first, second)...))
+	d.On("update").Reply(mockdeploy.Write(mockdeploy.WriteResult{N: 1, NModified: 1})).Repeat()
+
+	sink := &MemorySink{}
+
+	n, err := NewRelay(box, sink, WithBatchSize(10)).Poll(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	assert.Equal(t, []Event{first, second}, sink.Events())
+
+	updates := d.CommandsNamed("update")
+	require.Len(t, updates, 2)
+
+	for i, event := range []Event{first, second} {
+		update := updates[i].Document.Lookup("updates", "0").Document()
+
+		assert.Equal(t, event.ID, update.Lookup("q", "_id").ObjectID())
+		assert.False(t, update.Lookup("q", "deliveredAt", "$exists").Boolean(), "marking must be idempotent")
+		assert.True(t, update.Lookup("u", "$currentDate", "deliveredAt").Boolean())
+	}
+}
+
+func TestPoll_PublishFailure(t *testing.T) {
+	d, _, box := newOutbox(t)
+
+	first, second, third := newEvent(t, "a"), newEvent(t, "b"), newEvent(t, "c")
+
+	d.On("find").Reply(mockdeploy.Cursor("shop.outbox", 0, eventDocs(first, second, third)...))
+	d.On("update").Reply(mockdeploy.Write(mockdeploy.WriteResult{N: 1, NModified: 1})).Repeat()
+
+	var published []string
+
+	sink := SinkFunc(func(_ context.Context, event Event) error {
+		if event.Topic == "b" {
+			return errors.New("broker unavailable")
+		}
+
+		published = append(published, event.Topic)
+
+		return nil
+	})
+
+	n, err := NewRelay(box, sink).Poll(context.Background())
+	require.ErrorContains(t, err, "broker unavailable")
+
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"a"}, published, "events after a failed one must wait for it")
+
+	updates := d.CommandsNamed("update")
+	require.Len(t, updates, 2)
+
+	failure := updates[1].Document.Lookup("updates", "0").Document()
+	assert.Equal(t, second.ID, failure.Lookup("q", "_id").ObjectID())
+	assert.Equal(t, int32(1), failure.Lookup("u", "$inc", "attempts").Int32())
+	assert.Equal(t, "broker unavailable", failure.Lookup("u", "$set", "lastError").StringValue())
+}
+
+func TestPoll_DeadLetter(t *testing.T) {
+	d, _, box := newOutbox(t)
+
+	first, second, third := newEvent(t, "a"), newEvent(t, "b"), newEvent(t, "c")
+	second.Attempts = 2
+
+	d.On("find").Where(mockdeploy.Filter("deadLetteredAt.$exists", false)).
+		Reply(mockdeploy.Cursor("shop.outbox", 0, eventDocs(first, second, third)...))
+	d.On("update").Reply(mockdeploy.Write(mockdeploy.WriteResult{N: 1, NModified: 1})).Repeat()
+
+	var published []string
+
+	sink := SinkFunc(func(_ context.Context, event Event) error {
+		if event.Topic == "b" {
+			return errors.New("payload rejected")
+		}
+
+		published = append(published, event.Topic)
+
+		return nil
+	})
+
+	var reported []error
+
+	relay := NewRelay(box, sink, WithMaxAttempts(3), WithErrorHook(func(err error) { reported = append(reported, err) }))
+
+	n, err := relay.Poll(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"a", "c"}, published, "a dead-lettered event must not hold back later ones")
+
+	require.Len(t, reported, 1)
+	assert.ErrorIs(t, reported[0], ErrDeadLettered)
+	assert.ErrorContains(t, reported[0], "after 3 attempts")
+
+	updates := d.CommandsNamed("update")
+	require.Len(t, updates, 3)
+
+	deadLetter := updates[1].Document.Lookup("updates", "0").Document()
+	assert.Equal(t, second.ID, deadLetter.Lookup("q", "_id").ObjectID())
+	assert.Equal(t, int32(1), deadLetter.Lookup("u", "$inc", "attempts").Int32())
+	assert.Equal(t, "payload rejected", deadLetter.Lookup("u", "$set", "lastError").StringValue())
+	assert.True(t, deadLetter.Lookup("u", "$currentDate", "deadLetteredAt").Boolean())
+}
+
+func TestPoll_NoMaxAttempts(t *testing.T) {
+	d, _, box := newOutbox(t)
+
+	first, second := newEvent(t, "a"), newEvent(t, "b")
+	first.Attempts = 100
+
+	d.On("find").Reply(mockdeploy.Cursor("shop.outbox", 0, eventDocs(first, second)...))
+	d.On("update").Reply(mockdeploy.Write(mockdeploy.WriteResult{N: 1, NModified: 1})).Repeat()
+
+	sink := SinkFunc(func(context.Context, Event) error { return errors.New("broker unavailable") })
+
+	n, err := NewRelay(box, sink, WithMaxAttempts(0)).Poll(context.Background())
+	require.ErrorContains(t, err, "broker unavailable")
+	assert.Zero(t, n)
+
+	updates := d.CommandsNamed("update")
+	require.Len(t, updates, 1)
+	assert.True(t, updates[0].Document.Lookup("updates", "0", "u", "$currentDate").IsZero(), "an event must never be dead-lettered")
+}
+
+func TestEnsureIndexes(t *testing.T) {
+	d, _, box := newOutbox(t)
+
+	d.On("createIndexes").Reply(mockdeploy.OK())
+
+	require.NoError(t, box.EnsureIndexes(context.Background()))
+
+	cmds := d.CommandsNamed("createIndexes")
+	require.Len(t, cmds, 1)
+
+	var key bson.D
+	require.NoError(t, bson.Unmarshal(cmds[0].Document.Lookup("indexes", "0", "key").Document(), &key))
+	assert.Equal(t, bson.D{{Key: "deliveredAt", Value: int32(1)}, {Key: "_id", Value: int32(1)}}, key)
+}
+
+func TestMemorySink_IgnoresDuplicates(t *testing.T) {
+	sink := &MemorySink{}
+	event := newEvent(t, "a")
+
+	require.NoError(t, sink.Publish(context.Background(), event))
+	require.NoError(t, sink.Publish(context.Background(), event))
+
+	assert.Len(t, sink.Events(), 1)
+}
+
+func TestRun_ChangeStreamWakesRelay(t *testing.T) {
+	d, _, box := newOutbox(t)
+
+	event := newEvent(t, "a")
+
+	d.On("find").Reply(
+		mockdeploy.Cursor("shop.outbox", 0),
+		mockdeploy.Cursor("shop.outbox", 0, eventDocs(event)...),
+	)
+	d.On("update").Reply(mockdeploy.Write(mockdeploy.WriteResult{N: 1, NModified: 1}))
+	d.On("aggregate").Where(mockdeploy.Field("pipeline.1.$match.operationType", "insert")).
+		Reply(mockdeploy.Cursor("shop.outbox", 7))
+	d.On("getMore").Reply(mockdeploy.NextBatch("shop.outbox", 7, bson.D{
+		{Key: "_id", Value: bson.D{{Key: "_data", Value: "a"}}},
+		{Key: "operationType", Value: "insert"},
+	}))
+	d.On("getMore").Reply(mockdeploy.NextBatch("shop.outbox", 7)).Repeat()
+	d.On("killCursors").Reply(mockdeploy.OK()).Repeat()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var published []Event
+
+	sink := SinkFunc(func(_ context.Context, event Event) error {
+		published = append(published, event)
+		cancel()
+
+		return nil
+	})
+
+	// Without the change stream the second poll would wait an hour.
+	err := NewRelay(box, sink, WithChangeStream(), WithPollInterval(time.Hour)).Run(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+
+	assert.Equal(t, []Event{event}, published)
+}
+
+func TestRun_ReportsErrors(t *testing.T) {
+	d, _, box := newOutbox(t)
+
+	d.On("find").Reply(mockdeploy.Error(13, "Unauthorized", "not authorized")).Repeat()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var errs []error
+
+	relay := NewRelay(box, &MemorySink{}, WithPollInterval(time.Millisecond), WithErrorHook(func(err error) {
+		errs = append(errs, err)
+		if len(errs) == 2 {
+			cancel()
+		}
+	}))
+
+	require.ErrorIs(t, relay.Run(ctx), context.Canceled)
+
+	require.Len(t, errs, 2, "the relay must keep polling after an error")
+	assert.ErrorContains(t, errs[0], "failed to find undelivered events")
+}
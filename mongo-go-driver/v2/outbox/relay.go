@@ -0,0 +1,265 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// RelayConfig is the configuration for a Relay.
+type RelayConfig struct {
+	pollInterval time.Duration // Wait between polls of the outbox
+	batchSize    int32         // Events read per poll
+	changeStream bool          // Poll as soon as an event is inserted
+	maxAttempts  int32         // Failed publishes before an event is dead-lettered, 0 for never
+	onError      func(error)   // Called with errors that don't stop the relay
+}
+
+// ErrDeadLettered is reported to the error hook for an event the relay gave
+// up on publishing.
+var ErrDeadLettered = errors.New("outbox event dead-lettered")
+
+type RelayConfigOpt func(*RelayConfig)
+
+// WithPollInterval sets how long the relay waits between polls of the outbox
+// when there is nothing to publish. The default is 1s.
+func WithPollInterval(d time.Duration) RelayConfigOpt {
+	return func(cfg *RelayConfig) {
+		cfg.pollInterval = d
+	}
+}
+
+// WithBatchSize sets the maximum number of events published per poll. The
+// default is 100.
+func WithBatchSize(n int32) RelayConfigOpt {
+	return func(cfg *RelayConfig) {
+		cfg.batchSize = n
+	}
+}
+
+// WithChangeStream makes the relay watch the outbox for inserts and poll as
+// soon as one is committed, instead of waiting for the poll interval. Polling
+// continues as a fallback, so events are never missed if the change stream
+// fails or isn't supported by the deployment.
+func WithChangeStream() RelayConfigOpt {
+	return func(cfg *RelayConfig) {
+		cfg.changeStream = true
+	}
+}
+
+// WithMaxAttempts sets how many times publishing an event can fail before
+// the relay dead-letters it: it sets Event.DeadLetteredAt, reports
+// ErrDeadLettered and publishes the events after it. 0 never dead-letters, so
+// a failing event holds back every later event until it is published. The
+// default is 10.
+func WithMaxAttempts(n int32) RelayConfigOpt {
+	return func(cfg *RelayConfig) {
+		cfg.maxAttempts = n
+	}
+}
+
+// WithErrorHook sets a function called with errors the relay recovers from,
+// e.g. a failed publish, which is retried on the next poll, or a dead-lettered
+// event.
+func WithErrorHook(fn func(err error)) RelayConfigOpt {
+	return func(cfg *RelayConfig) {
+		cfg.onError = fn
+	}
+}
+
+func newRelayConfig(opts ...RelayConfigOpt) RelayConfig {
+	cfg := RelayConfig{
+		pollInterval: time.Second,
+		batchSize:    100,
+		maxAttempts:  10,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return cfg
+}
+
+// Relay publishes the undelivered events of an outbox to a sink, polling them
+// in insertion order, see the package documentation.
+type Relay struct {
+	outbox *Outbox
+	sink   Sink
+	cfg    RelayConfig
+}
+
+// NewRelay will return a relay from the outbox to sink.
+func NewRelay(outbox *Outbox, sink Sink, opts ...RelayConfigOpt) *Relay {
+	return &Relay{outbox: outbox, sink: sink, cfg: newRelayConfig(opts...)}
+}
+
+// undelivered matches events that haven't been published yet.
+var undelivered = bson.D{{Key: "deliveredAt", Value: bson.D{{Key: "$exists", Value: false}}}}
+
+// pending matches the undelivered events that haven't been dead-lettered.
+var pending = append(bson.D{{Key: "deadLetteredAt", Value: bson.D{{Key: "$exists", Value: false}}}}, undelivered...)
+
+// Poll will publish up to a batch of undelivered events, in _id order, and
+// return how many were published. A failure is recorded on the event. Poll
+// stops at the first event the sink fails to publish, so that later events
+// aren't published before it, unless the event has failed WithMaxAttempts
+// times; it is then dead-lettered and the later events are published.
+func (r *Relay) Poll(ctx context.Context) (int, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(int64(r.cfg.batchSize))
+
+	cursor, err := r.outbox.coll.Find(ctx, pending, opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find undelivered events: %w", err)
+	}
+
+	var events []Event
+	if err := cursor.All(ctx, &events); err != nil {
+		return 0, fmt.Errorf("failed to decode outbox events: %w", err)
+	}
+
+	published := 0
+
+	for _, event := range events {
+		if publishErr := r.sink.Publish(ctx, event); publishErr != nil {
+			err := fmt.Errorf("failed to publish event %s: %w", event.ID.Hex(), publishErr)
+
+			if r.cfg.maxAttempts == 0 || event.Attempts+1 < r.cfg.maxAttempts {
+				return published, errors.Join(err, r.markFailed(ctx, event, publishErr, false))
+			}
+
+			if err := r.markFailed(ctx, event, publishErr, true); err != nil {
+				return published, err
+			}
+
+			r.report(fmt.Errorf("%w after %d attempts: %w", ErrDeadLettered, event.Attempts+1, err))
+
+			continue
+		}
+
+		if err := r.markDelivered(ctx, event); err != nil {
+			return published, err
+		}
+
+		published++
+	}
+
+	return published, nil
+}
+
+// markDelivered will set deliveredAt unless it is already set, e.g. by
+// another relay that published the same event concurrently, so that the
+// first delivery time is kept.
+func (r *Relay) markDelivered(ctx context.Context, event Event) error {
+	filter := append(bson.D{{Key: "_id", Value: event.ID}}, undelivered...)
+	update := bson.D{
+		{Key: "$currentDate", Value: bson.D{{Key: "deliveredAt", Value: true}}},
+		{Key: "$unset", Value: bson.D{{Key: "lastError", Value: ""}}},
+	}
+
+	if _, err := r.outbox.coll.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to mark event %s delivered: %w", event.ID.Hex(), err)
+	}
+
+	return nil
+}
+
+// markFailed will record a failed publish of the event and, if deadLetter is
+// set, dead-letter it.
+func (r *Relay) markFailed(ctx context.Context, event Event, publishErr error, deadLetter bool) error {
+	update := bson.D{
+		{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+		{Key: "$set", Value: bson.D{{Key: "lastError", Value: publishErr.Error()}}},
+	}
+
+	if deadLetter {
+		update = append(update, bson.E{Key: "$currentDate", Value: bson.D{{Key: "deadLetteredAt", Value: true}}})
+	}
+
+	if _, err := r.outbox.coll.UpdateOne(ctx, bson.D{{Key: "_id", Value: event.ID}}, update); err != nil {
+		return fmt.Errorf("failed to record publish failure of event %s: %w", event.ID.Hex(), err)
+	}
+
+	return nil
+}
+
+// Run will publish events until ctx is done and return its error. A full
+// batch is followed by another poll right away; otherwise the relay waits for
+// the poll interval or, with WithChangeStream, for the next insert.
+func (r *Relay) Run(ctx context.Context) error {
+	wake := make(chan struct{}, 1)
+
+	if r.cfg.changeStream {
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		go r.watch(watchCtx, wake)
+	}
+
+	for {
+		n, err := r.Poll(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			r.report(err)
+		}
+
+		if err == nil && n == int(r.cfg.batchSize) {
+			continue
+		}
+
+		timer := time.NewTimer(r.cfg.pollInterval)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		case <-wake:
+		case <-timer.C:
+		}
+
+		timer.Stop()
+	}
+}
+
+// watch will signal wake for every insert into the outbox. Only the signal
+// matters, events are always read by Poll.
+func (r *Relay) watch(ctx context.Context, wake chan<- struct{}) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "operationType", Value: "insert"}}}}}
+
+	stream, err := r.outbox.coll.Watch(ctx, pipeline)
+	if err != nil {
+		r.report(fmt.Errorf("failed to watch outbox, falling back to polling: %w", err))
+
+		return
+	}
+
+	defer stream.Close(context.WithoutCancel(ctx))
+
+	for stream.Next(ctx) {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+
+	if err := stream.Err(); err != nil && ctx.Err() == nil {
+		r.report(fmt.Errorf("outbox change stream failed, falling back to polling: %w", err))
+	}
+}
+
+func (r *Relay) report(err error) {
+	if r.cfg.onError != nil {
+		r.cfg.onError(err)
+	}
+}
@@ -0,0 +1,60 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Sink is where a relay publishes events, e.g. a message broker.
+type Sink interface {
+	// Publish will deliver the event. It may be called more than once for the
+	// same event.
+	Publish(ctx context.Context, event Event) error
+}
+
+// SinkFunc adapts a function to a Sink.
+type SinkFunc func(ctx context.Context, event Event) error
+
+// Publish implements Sink.
+func (f SinkFunc) Publish(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+// MemorySink keeps published events in memory, ignoring events it already
+// has, as a consumer deduplicating on Event.ID would.
+type MemorySink struct {
+	mu     sync.Mutex
+	events []Event
+	seen   map[bson.ObjectID]bool
+}
+
+var _ Sink = &MemorySink{}
+
+// Publish implements Sink.
+func (s *MemorySink) Publish(_ context.Context, event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seen == nil {
+		s.seen = map[bson.ObjectID]bool{}
+	}
+
+	if s.seen[event.ID] {
+		return nil
+	}
+
+	s.seen[event.ID] = true
+	s.events = append(s.events, event)
+
+	return nil
+}
+
+// Events will return the events published so far, in order.
+func (s *MemorySink) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Event(nil), s.events...)
+}
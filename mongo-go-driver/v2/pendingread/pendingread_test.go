@@ -0,0 +1,227 @@
+package pendingread
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func TestMain(m *testing.M) {
+	RecordBackgroundReads()
+
+	os.Exit(m.Run())
+}
+
+// poolMessages are the messages that show how a connection is reused.
+var poolMessages = []string{ConnectionCheckedOut, ConnectionCheckedIn, ConnectionClosed}
+
+// pendingReadMessages are the messages of the pending read sequence.
+var pendingReadMessages = []string{PendingReadStarted, PendingReadSucceeded, PendingReadFailed}
+
+func newClient(t *testing.T, server *Server, rec *Recorder) *mongo.Collection {
+	t.Helper()
+
+	client, err := mongo.Connect(options.Client().
+		ApplyURI(server.URI()).
+		SetMaxPoolSize(1).
+		SetLoggerOptions(rec.LoggerOptions()))
+	require.NoError(t, err, "failed to connect to server")
+
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+
+	// Establish the connection so that operations don't time out during the
+	// handshake.
+	require.NoError(t, client.Ping(context.Background(), nil))
+
+	rec.Reset()
+
+	return client.Database("db").Collection("coll")
+}
+
+func insert(coll *mongo.Collection, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	_, err := coll.InsertOne(ctx, bson.D{})
+
+	return err
+}
+
+// requireSequence will wait for the messages of connection id to be want.
+// Background reads are recorded once they are over, which can be after the
+// operation that waited for them returns.
+func requireSequence(t *testing.T, rec *Recorder, id int64, want []string, messages ...string) {
+	t.Helper()
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, want, rec.Sequence(id, messages...))
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestServer(t *testing.T) {
+	server := NewServer(t)
+
+	rec := NewRecorder()
+	coll := newClient(t, server, rec)
+
+	require.NoError(t, insert(coll, time.Second))
+
+	assert.Equal(t, []string{"ping", "insert"}, server.Commands())
+
+	ids := rec.ConnectionIDs(ConnectionCheckedOut)
+	require.Len(t, ids, 1)
+
+	assert.Equal(t, []string{
+		ConnectionCheckedOut,
+		CommandStarted,
+		CommandSucceeded,
+		ConnectionCheckedIn,
+	}, rec.Sequence(ids[0], ConnectionCheckedOut, CommandStarted, CommandSucceeded, ConnectionCheckedIn))
+}
+
+// A connection whose operation timed out is reused once the rest of the reply
+// has been read, whether the timeout hit before the reply or in the middle of
+// it.
+func TestPendingRead_Reuse(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply Reply
+	}{
+		{name: "before the reply", reply: Reply{Delay: 150 * time.Millisecond}},
+		{name: "after the message length", reply: Reply{Partial: 4, Delay: 150 * time.Millisecond}},
+		{name: "in the body", reply: Reply{Partial: 24, Delay: 150 * time.Millisecond}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := NewServer(t)
+			server.Script("insert", test.reply)
+
+			rec := NewRecorder()
+			coll := newClient(t, server, rec)
+
+			assert.ErrorIs(t, insert(coll, 50*time.Millisecond), context.DeadlineExceeded)
+			require.NoError(t, insert(coll, time.Second))
+
+			assert.Equal(t, []string{"ping", "insert", "insert"}, server.Commands())
+
+			ids := rec.ConnectionIDs(ConnectionCheckedOut)
+			require.Len(t, ids, 1, "both operations must use the same connection")
+
+			assert.Equal(t, []string{
+				ConnectionCheckedOut,
+				ConnectionCheckedIn,
+				ConnectionCheckedOut,
+				ConnectionCheckedIn,
+			}, rec.Sequence(ids[0], poolMessages...))
+
+			requireSequence(t, rec, ids[0], []string{PendingReadStarted, PendingReadSucceeded}, pendingReadMessages...)
+		})
+	}
+}
+
+// A connection whose reply doesn't arrive in time is closed rather than
+// reused.
+func TestPendingRead_ReplyNeverArrives(t *testing.T) {
+	server := NewServer(t)
+	server.Script("insert", Reply{Delay: 10 * time.Second})
+
+	rec := NewRecorder()
+	coll := newClient(t, server, rec)
+
+	assert.ErrorIs(t, insert(coll, 50*time.Millisecond), context.DeadlineExceeded)
+
+	// Whether the pending read runs in the background or on the next checkout,
+	// it gives up long before the reply.
+	_ = insert(coll, 5*time.Second)
+
+	ids := rec.ConnectionIDs(ConnectionCheckedOut)
+	require.NotEmpty(t, ids)
+
+	first := rec.Sequence(ids[0], poolMessages...)
+	require.NotEmpty(t, first)
+
+	assert.Equal(t, ConnectionClosed, first[len(first)-1], "sequence: %v", first)
+	assert.Equal(t, 1, rec.Count(ConnectionClosed))
+
+	requireSequence(t, rec, ids[0], []string{
+		PendingReadStarted,
+		PendingReadFailed,
+		ConnectionClosed,
+	}, append(pendingReadMessages, ConnectionClosed)...)
+}
+
+// Pending reads are per connection: started, then succeeded or failed. The
+// connection is checked in with the reply in flight and read in the
+// background, and the next operation waits for the read to be over before it
+// can check the connection out.
+//
+// This is Test2884_CheckInState from tickets/drivers/csot without a mongod:
+//
+//   - The first insert times out waiting for the reply.
+//   - The second times out in checkout, awaiting the pending read.
+//   - The third checks the connection out once the rest of the reply has been
+//     read, and succeeds.
+func TestPendingRead_CheckInState(t *testing.T) {
+	server := NewServer(t)
+	server.Script("insert", Reply{Delay: 450 * time.Millisecond})
+
+	rec := NewRecorder()
+	coll := newClient(t, server, rec)
+
+	assert.ErrorIs(t, insert(coll, 200*time.Millisecond), context.DeadlineExceeded)
+	assert.ErrorIs(t, insert(coll, 200*time.Millisecond), context.DeadlineExceeded)
+	require.NoError(t, insert(coll, 200*time.Millisecond))
+
+	assert.Equal(t, []string{"ping", "insert", "insert"}, server.Commands(), "the second insert must not be sent")
+
+	ids := rec.ConnectionIDs(ConnectionCheckedOut)
+	require.Len(t, ids, 1, "every operation must use the same connection")
+
+	requireSequence(t, rec, ids[0], []string{
+		ConnectionCheckedOut,
+		ConnectionCheckedIn,
+		PendingReadStarted,
+		PendingReadSucceeded,
+		ConnectionCheckedOut,
+		ConnectionCheckedIn,
+	}, append(poolMessages, pendingReadMessages...)...)
+}
+
+// A connection is closed when the pending read can't complete in time, and
+// an operation that timed out waiting for it isn't sent.
+//
+// This is Test2884_CloseWhenNoRemainingTime from tickets/drivers/csot without
+// a mongod.
+func TestPendingRead_CloseWhenNoRemainingTime(t *testing.T) {
+	server := NewServer(t)
+	server.Script("insert", Reply{Delay: 750 * time.Millisecond})
+
+	rec := NewRecorder()
+	coll := newClient(t, server, rec)
+
+	assert.ErrorIs(t, insert(coll, 50*time.Millisecond), context.DeadlineExceeded)
+	assert.ErrorIs(t, insert(coll, 200*time.Millisecond), context.DeadlineExceeded)
+
+	assert.Zero(t, rec.Count(PendingReadStarted), "the second insert must time out while the pending read runs")
+
+	ids := rec.ConnectionIDs(ConnectionCheckedOut)
+	require.Len(t, ids, 1)
+
+	requireSequence(t, rec, ids[0], []string{
+		PendingReadStarted,
+		PendingReadFailed,
+		ConnectionClosed,
+	}, append(pendingReadMessages, ConnectionClosed)...)
+
+	assert.Equal(t, []string{"ping", "insert"}, server.Commands())
+	assert.Equal(t, 1, rec.Count(CommandStarted))
+	assert.Equal(t, 1, rec.Count(CommandFailed))
+}
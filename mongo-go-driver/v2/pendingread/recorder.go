@@ -0,0 +1,257 @@
+package pendingread
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/topology"
+)
+
+// Log messages recorded, as in tickets/drivers/csot/logger.go.
+const (
+	CommandStarted       = "Command started"
+	CommandSucceeded     = "Command succeeded"
+	CommandFailed        = "Command failed"
+	ConnectionCreated    = "Connection created"
+	ConnectionCheckedOut = "Connection checked out"
+	ConnectionCheckedIn  = "Connection checked in"
+	ConnectionClosed     = "Connection closed"
+	PendingReadStarted   = "Pending read started"
+	PendingReadSucceeded = "Pending read succeeded"
+	PendingReadFailed    = "Pending read failed"
+)
+
+// Log keys of the driver's connection ID and of the server address.
+const (
+	keyDriverConnectionID = "driverConnectionId"
+	keyServerHost         = "serverHost"
+	keyServerPort         = "serverPort"
+)
+
+var recorded = map[string]bool{
+	CommandStarted:       true,
+	CommandSucceeded:     true,
+	CommandFailed:        true,
+	ConnectionCreated:    true,
+	ConnectionCheckedOut: true,
+	ConnectionCheckedIn:  true,
+	ConnectionClosed:     true,
+	PendingReadStarted:   true,
+	PendingReadSucceeded: true,
+	PendingReadFailed:    true,
+}
+
+// Record is a log message of a connection.
+type Record struct {
+	Message      string
+	ConnectionID int64
+	At           time.Time // When the message was logged or the read started or ended
+}
+
+// Recorder is an options.LogSink recording the messages of each connection.
+type Recorder struct {
+	mu      sync.Mutex
+	records []Record // Ordered by At
+}
+
+type checkIn struct {
+	recorder     *Recorder
+	connectionID int64
+}
+
+var (
+	checkInsMu sync.Mutex
+
+	// lastCheckIns is the connection last checked in to each server address,
+	// the one a background read of that address is reading from.
+	lastCheckIns = map[string]checkIn{}
+)
+
+// RecordBackgroundReads will make recorders record the reads that drivers
+// like v2.2.0 run in the background on a connection checked in while its
+// reply is still in flight, which they report through topology.BGReadCallback
+// instead of logging them. A read is recorded as PendingReadStarted, then
+// PendingReadSucceeded or PendingReadFailed, for the connection last checked
+// in to its address. The driver reads the callback without synchronization,
+// so this must be called before any client connects, e.g. from TestMain.
+func RecordBackgroundReads() {
+	topology.BGReadCallback = backgroundRead
+}
+
+func backgroundRead(addr string, start, read time.Time, errs []error, _ bool) {
+	checkInsMu.Lock()
+	c, ok := lastCheckIns[addr]
+	checkInsMu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	end := PendingReadSucceeded
+	if len(errs) > 0 {
+		end = PendingReadFailed
+	}
+
+	c.recorder.add(Record{Message: PendingReadStarted, ConnectionID: c.connectionID, At: start})
+	c.recorder.add(Record{Message: end, ConnectionID: c.connectionID, At: read})
+}
+
+var _ options.LogSink = &Recorder{}
+
+// NewRecorder will return an empty recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// LoggerOptions will return logger options sending debug messages of the
+// command and connection components to the recorder.
+func (r *Recorder) LoggerOptions() *options.LoggerOptions {
+	return options.Logger().
+		SetSink(r).
+		SetComponentLevel(options.LogComponentCommand, options.LogLevelDebug).
+		SetComponentLevel(options.LogComponentConnection, options.LogLevelDebug)
+}
+
+// Info records msg if it is one of the messages of this package and has a
+// connection ID.
+func (r *Recorder) Info(_ int, msg string, keysAndValues ...any) {
+	if !recorded[msg] {
+		return
+	}
+
+	id, ok := connectionID(keysAndValues)
+	if !ok {
+		return
+	}
+
+	if msg == ConnectionCheckedIn {
+		checkInsMu.Lock()
+		lastCheckIns[serverAddress(keysAndValues)] = checkIn{recorder: r, connectionID: id}
+		checkInsMu.Unlock()
+	}
+
+	r.add(Record{Message: msg, ConnectionID: id, At: time.Now()})
+}
+
+// add will insert rec in time order. Background reads are reported once they
+// are over, after messages logged while they ran.
+func (r *Recorder) add(rec Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := len(r.records)
+	for i > 0 && r.records[i-1].At.After(rec.At) {
+		i--
+	}
+
+	r.records = slices.Insert(r.records, i, rec)
+}
+
+// Error ignores errors, which the driver only logs for failed log writes.
+func (r *Recorder) Error(error, string, ...any) {}
+
+// Records will return every record, in order.
+func (r *Recorder) Records() []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.records)
+}
+
+// Sequence will return the messages of connection id in order, restricted to
+// messages if any are given.
+func (r *Recorder) Sequence(id int64, messages ...string) []string {
+	var seq []string
+
+	for _, rec := range r.Records() {
+		if rec.ConnectionID != id {
+			continue
+		}
+
+		if len(messages) > 0 && !slices.Contains(messages, rec.Message) {
+			continue
+		}
+
+		seq = append(seq, rec.Message)
+	}
+
+	return seq
+}
+
+// ConnectionIDs will return the IDs of the connections that logged msg, in
+// the order they first did.
+func (r *Recorder) ConnectionIDs(msg string) []int64 {
+	var ids []int64
+
+	for _, rec := range r.Records() {
+		if rec.Message == msg && !slices.Contains(ids, rec.ConnectionID) {
+			ids = append(ids, rec.ConnectionID)
+		}
+	}
+
+	return ids
+}
+
+// Count will return the number of times msg was logged.
+func (r *Recorder) Count(msg string) int {
+	n := 0
+
+	for _, rec := range r.Records() {
+		if rec.Message == msg {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Reset will drop every record.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records = nil
+}
+
+// serverAddress will return the host:port of the server a message is about.
+func serverAddress(keysAndValues []any) string {
+	var host, port any
+
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		switch keysAndValues[i] {
+		case keyServerHost:
+			host = keysAndValues[i+1]
+		case keyServerPort:
+			port = keysAndValues[i+1]
+		}
+	}
+
+	return net.JoinHostPort(fmt.Sprint(host), fmt.Sprint(port))
+}
+
+func connectionID(keysAndValues []any) (int64, bool) {
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		if keysAndValues[i] != keyDriverConnectionID {
+			continue
+		}
+
+		switch v := keysAndValues[i+1].(type) {
+		case int64:
+			return v, true
+		case uint64:
+			return int64(v), true
+		case int32:
+			return int64(v), true
+		case uint32:
+			return int64(v), true
+		case int:
+			return int64(v), true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,402 @@
+// Package pendingread verifies how the driver reuses a connection after an
+// operation times out while the server reply is still in flight, without a
+// mongod.
+//
+// A Server is a TCP server that speaks just enough of the wire protocol to
+// complete handshakes and reply {ok: 1} to commands, and that can delay or
+// split the reply to a command so that the client's deadline expires before
+// or in the middle of the reply. A Recorder is a log sink that records the
+// pool, command and pending read log messages of each connection, along with
+// the background reads of drivers that don't log pending reads, see
+// RecordBackgroundReads, so that a test can assert their sequence:
+//
+//	server := pendingread.NewServer(t)
+//	server.Script("insert", pendingread.Reply{Delay: 150 * time.Millisecond})
+//
+//	rec := pendingread.NewRecorder()
+//	client, err := mongo.Connect(options.Client().
+//		ApplyURI(server.URI()).
+//		SetLoggerOptions(rec.LoggerOptions()))
+package pendingread
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/wiremessage"
+)
+
+const (
+	maxWireVersion  = 25
+	maxMessageSize  = 48_000_000
+	maxBSONSize     = 16 * 1024 * 1024
+	maxWriteBatch   = 100_000
+	sessionTimeout  = 30
+	headerLength    = 16
+	opReplyFlagsLen = 20 // Flags, cursor ID, starting from and number returned
+)
+
+// Reply describes how the server writes the reply to a command.
+type Reply struct {
+	// Partial is the number of bytes of the reply written before the delay,
+	// e.g. 4 to write the message length only. 0 delays the whole reply.
+	Partial int
+
+	// Delay is the wait before writing the reply, or its remaining bytes.
+	Delay time.Duration
+}
+
+// Server is a fake mongod on a loopback TCP port.
+type Server struct {
+	t  testing.TB
+	ln net.Listener
+
+	mu       sync.Mutex
+	scripts  map[string][]Reply
+	commands []string
+	conns    map[net.Conn]bool
+	nextID   int32
+	closed   bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewServer will start a server that is closed when the test ends.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	s := &Server{
+		t:       t,
+		ln:      ln,
+		scripts: map[string][]Reply{},
+		conns:   map[net.Conn]bool{},
+		done:    make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+
+	go s.accept()
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// URI will return a connection string for a direct connection to the server.
+func (s *Server) URI() string {
+	return fmt.Sprintf("mongodb://%s/?directConnection=true", s.ln.Addr())
+}
+
+// Script will queue replies for the next commands named command, in order.
+// Commands without a queued reply are answered immediately.
+func (s *Server) Script(command string, replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scripts[command] = append(s.scripts[command], replies...)
+}
+
+// Commands will return the names of the commands received, in order, except
+// handshakes and heartbeats.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.commands...)
+}
+
+// Close will close the listener and every connection and wait for their
+// goroutines.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+
+		return
+	}
+
+	s.closed = true
+	close(s.done)
+
+	_ = s.ln.Close()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+
+			return
+		}
+
+		s.nextID++
+		id := s.nextID
+		s.conns[conn] = true
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serve(conn, id)
+	}
+}
+
+func (s *Server) serve(conn net.Conn, id int32) {
+	defer s.wg.Done()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+
+		_ = conn.Close()
+	}()
+
+	for {
+		req, err := readMessage(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.t.Logf("pendingread: failed to read request on connection %d: %v", id, err)
+			}
+
+			return
+		}
+
+		reply, script, err := s.handle(req, id)
+		if err != nil {
+			s.t.Errorf("pendingread: %v", err)
+
+			return
+		}
+
+		if err := s.write(conn, reply, script); err != nil {
+			return
+		}
+	}
+}
+
+// handle will return the reply to the request and how to write it.
+func (s *Server) handle(req []byte, connID int32) ([]byte, Reply, error) {
+	_, requestID, _, opcode, body, ok := wiremessage.ReadHeader(req)
+	if !ok {
+		return nil, Reply{}, errors.New("malformed message header")
+	}
+
+	var cmd bsoncore.Document
+
+	switch opcode {
+	case wiremessage.OpQuery:
+		cmd, ok = readQuery(body)
+	case wiremessage.OpMsg:
+		cmd, ok = readMsg(body)
+	default:
+		return nil, Reply{}, fmt.Errorf("unsupported opcode %s", opcode)
+	}
+
+	if !ok {
+		return nil, Reply{}, fmt.Errorf("malformed %s message", opcode)
+	}
+
+	elem, err := cmd.IndexErr(0)
+	if err != nil {
+		return nil, Reply{}, fmt.Errorf("failed to read command name: %w", err)
+	}
+
+	name := elem.Key()
+
+	var doc bson.D
+
+	var script Reply
+
+	switch strings.ToLower(name) {
+	case "hello", "ismaster":
+		doc = bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "helloOk", Value: true},
+			{Key: "isWritablePrimary", Value: true},
+			{Key: "ismaster", Value: true},
+			{Key: "minWireVersion", Value: 0},
+			{Key: "maxWireVersion", Value: maxWireVersion},
+			{Key: "maxBsonObjectSize", Value: maxBSONSize},
+			{Key: "maxMessageSizeBytes", Value: maxMessageSize},
+			{Key: "maxWriteBatchSize", Value: maxWriteBatch},
+			{Key: "logicalSessionTimeoutMinutes", Value: sessionTimeout},
+			{Key: "connectionId", Value: connID},
+		}
+	default:
+		s.mu.Lock()
+		s.commands = append(s.commands, name)
+
+		if queued := s.scripts[name]; len(queued) > 0 {
+			script = queued[0]
+			s.scripts[name] = queued[1:]
+		}
+		s.mu.Unlock()
+
+		doc = bson.D{{Key: "ok", Value: 1}}
+		if name == "insert" {
+			doc = append(doc, bson.E{Key: "n", Value: 1})
+		}
+	}
+
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, Reply{}, fmt.Errorf("failed to marshal reply to %s: %w", name, err)
+	}
+
+	if opcode == wiremessage.OpQuery {
+		return opReply(requestID, raw), script, nil
+	}
+
+	return opMsg(requestID, raw), script, nil
+}
+
+// write will write reply to conn as script describes.
+func (s *Server) write(conn net.Conn, reply []byte, script Reply) error {
+	partial := min(script.Partial, len(reply))
+
+	if _, err := conn.Write(reply[:partial]); err != nil {
+		return err
+	}
+
+	if script.Delay > 0 {
+		select {
+		case <-time.After(script.Delay):
+		case <-s.done:
+			return net.ErrClosed
+		}
+	}
+
+	_, err := conn.Write(reply[partial:])
+
+	return err
+}
+
+func readMessage(r io.Reader) ([]byte, error) {
+	var sizeBuf [4]byte
+	if _, err := io.ReadFull(r, sizeBuf[:]); err != nil {
+		return nil, err
+	}
+
+	size := int32(binary.LittleEndian.Uint32(sizeBuf[:]))
+	if size < headerLength || size > maxMessageSize {
+		return nil, fmt.Errorf("invalid message length %d", size)
+	}
+
+	msg := make([]byte, size)
+	copy(msg, sizeBuf[:])
+
+	if _, err := io.ReadFull(r, msg[4:]); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func readQuery(body []byte) (bsoncore.Document, bool) {
+	_, body, ok := wiremessage.ReadQueryFlags(body)
+	if !ok {
+		return nil, false
+	}
+
+	_, body, ok = wiremessage.ReadQueryFullCollectionName(body)
+	if !ok {
+		return nil, false
+	}
+
+	_, body, ok = wiremessage.ReadQueryNumberToSkip(body)
+	if !ok {
+		return nil, false
+	}
+
+	_, body, ok = wiremessage.ReadQueryNumberToReturn(body)
+	if !ok {
+		return nil, false
+	}
+
+	query, _, ok := wiremessage.ReadQueryQuery(body)
+
+	return query, ok
+}
+
+// readMsg will return the body section of an OP_MSG. Document sequences,
+// e.g. the documents of an insert, are skipped.
+func readMsg(body []byte) (bsoncore.Document, bool) {
+	_, body, ok := wiremessage.ReadMsgFlags(body)
+	if !ok {
+		return nil, false
+	}
+
+	var cmd bsoncore.Document
+
+	for len(body) > 0 {
+		var stype wiremessage.SectionType
+
+		stype, body, ok = wiremessage.ReadMsgSectionType(body)
+		if !ok {
+			return nil, false
+		}
+
+		switch stype {
+		case wiremessage.SingleDocument:
+			cmd, body, ok = wiremessage.ReadMsgSectionSingleDocument(body)
+		case wiremessage.DocumentSequence:
+			_, _, body, ok = wiremessage.ReadMsgSectionRawDocumentSequence(body)
+		default:
+			return nil, false
+		}
+
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return cmd, cmd != nil
+}
+
+func opMsg(responseTo int32, doc []byte) []byte {
+	idx, msg := wiremessage.AppendHeaderStart(nil, wiremessage.NextRequestID(), responseTo, wiremessage.OpMsg)
+	msg = wiremessage.AppendMsgFlags(msg, 0)
+	msg = wiremessage.AppendMsgSectionType(msg, wiremessage.SingleDocument)
+	msg = append(msg, doc...)
+
+	return bsoncore.UpdateLength(msg, idx, int32(len(msg[idx:])))
+}
+
+func opReply(responseTo int32, doc []byte) []byte {
+	msg := wiremessage.AppendHeader(nil, int32(headerLength+opReplyFlagsLen+len(doc)), wiremessage.NextRequestID(), responseTo, wiremessage.OpReply)
+	msg = wiremessage.AppendReplyFlags(msg, 0)
+	msg = wiremessage.AppendReplyCursorID(msg, 0)
+	msg = wiremessage.AppendReplyStartingFrom(msg, 0)
+	msg = wiremessage.AppendReplyNumberReturned(msg, 1)
+
+	return append(msg, doc...)
+}
@@ -0,0 +1,97 @@
+// Command poolsim simulates the connection pool under Poisson traffic and
+// prints the checkout wait distribution for each maxConnecting value given.
+//
+//	poolsim -rate 2000 -duration 1m -handshake 50ms-200ms -max-connecting 2,4,8
+//
+// Durations of the handshake, the operations and pending reads are either
+// fixed, e.g. 10ms, or uniform ranges, e.g. 5ms-20ms.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/poolsim"
+)
+
+func main() {
+	var (
+		rate            = flag.Float64("rate", 100, "mean checkouts per second")
+		duration        = flag.Duration("duration", time.Minute, "simulated time of arrivals")
+		handshake       = flag.String("handshake", "50ms", "handshake time")
+		operation       = flag.String("op", "10ms", "time an operation holds its connection")
+		minPoolSize     = flag.Int("min-pool", 0, "minPoolSize")
+		maxPoolSize     = flag.Int("max-pool", 100, "maxPoolSize, 0 for no limit")
+		maxConnecting   = flag.String("max-connecting", "2", "comma separated maxConnecting values to compare")
+		waitTimeout     = flag.Duration("wait-timeout", 0, "checkout wait timeout, 0 for none")
+		maxIdleTime     = flag.Duration("max-idle", 0, "maxIdleTime, 0 for none")
+		pendingReadRate = flag.Float64("pending-reads", 0, "fraction of operations leaving a pending read")
+		pendingRead     = flag.String("pending-read-time", "100ms", "time until the reply of a pending read")
+		seed            = flag.Int64("seed", 1, "random seed")
+	)
+
+	flag.Parse()
+
+	opts := []poolsim.ConfigOpt{
+		poolsim.WithArrivals(poolsim.Poisson(*rate)),
+		poolsim.WithHandshake(mustParseDistribution(*handshake)),
+		poolsim.WithOperationTime(mustParseDistribution(*operation)),
+		poolsim.WithMinPoolSize(*minPoolSize),
+		poolsim.WithMaxPoolSize(*maxPoolSize),
+		poolsim.WithWaitQueueTimeout(*waitTimeout),
+		poolsim.WithMaxIdleTime(*maxIdleTime),
+		poolsim.WithSeed(*seed),
+	}
+
+	if *pendingReadRate > 0 {
+		opts = append(opts, poolsim.WithPendingReads(*pendingReadRate, mustParseDistribution(*pendingRead)))
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MAX CONNECTING\tCHECKOUTS\tTIMED OUT\tMEAN\tP50\tP90\tP99\tMAX\tCREATED\tPEAK CONNS\tPEAK WAITING")
+
+	for _, field := range strings.Split(*maxConnecting, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			log.Fatalf("invalid maxConnecting %q: %v", field, err)
+		}
+
+		res := poolsim.Run(*duration, append(opts, poolsim.WithMaxConnecting(n))...)
+
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\n",
+			n, res.Checkouts, res.TimedOut, res.Mean(), res.Quantile(0.5), res.Quantile(0.9),
+			res.Quantile(0.99), res.Quantile(1), res.ConnectionsCreated, res.PeakConnections, res.PeakWaiting)
+	}
+
+	if err := tw.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// mustParseDistribution will parse a fixed duration, e.g. 10ms, or a uniform
+// range, e.g. 5ms-20ms.
+func mustParseDistribution(s string) poolsim.Distribution {
+	lo, hi, isRange := strings.Cut(s, "-")
+
+	minimum, err := time.ParseDuration(lo)
+	if err != nil {
+		log.Fatalf("invalid duration %q: %v", s, err)
+	}
+
+	if !isRange {
+		return poolsim.Fixed(minimum)
+	}
+
+	maximum, err := time.ParseDuration(hi)
+	if err != nil {
+		log.Fatalf("invalid duration %q: %v", s, err)
+	}
+
+	return poolsim.Uniform(minimum, maximum)
+}
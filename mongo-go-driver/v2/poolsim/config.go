@@ -0,0 +1,147 @@
+package poolsim
+
+import (
+	"time"
+)
+
+// Config is the configuration of a simulated pool and its workload.
+type Config struct {
+	minPoolSize        int           // Connections kept open by the maintainer
+	maxPoolSize        int           // Limit of open connections, 0 for none
+	maxConnecting      int           // Limit of concurrent handshakes
+	waitQueueTimeout   time.Duration // Longest checkout wait, 0 for none
+	maxIdleTime        time.Duration // Idle time after which a connection is closed, 0 for none
+	maintainInterval   time.Duration // Period of the maintainer
+	handshake          Distribution  // Time to establish a connection
+	operation          Distribution  // Time a connection is checked out
+	arrivals           Arrivals      // Time between checkouts
+	pendingReadRate    float64       // Fraction of operations that time out with a reply in flight
+	pendingRead        Distribution  // Time until the reply of a timed out operation arrives
+	pendingReadTimeout time.Duration // Longest wait for the reply before closing the connection
+	seed               int64         // Seed of the random source
+}
+
+type ConfigOpt func(*Config)
+
+// WithMinPoolSize sets the number of connections the maintainer keeps open.
+// The default is 0.
+func WithMinPoolSize(n int) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.minPoolSize = n
+	}
+}
+
+// WithMaxPoolSize sets the limit of open connections, counting those being
+// established, in use and idle. 0 means no limit. The default is 100, as in
+// the driver.
+func WithMaxPoolSize(n int) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.maxPoolSize = n
+	}
+}
+
+// WithMaxConnecting sets the limit of connections being established at once.
+// The default is 2, as in the driver.
+func WithMaxConnecting(n int) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.maxConnecting = n
+	}
+}
+
+// WithWaitQueueTimeout sets how long a checkout waits for a connection before
+// failing, standing in for the operation's timeout. The default is 0, which
+// waits indefinitely.
+func WithWaitQueueTimeout(d time.Duration) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.waitQueueTimeout = d
+	}
+}
+
+// WithMaxIdleTime sets how long a connection may stay idle before it is
+// closed on checkout or by the maintainer. The default is 0, which keeps idle
+// connections open.
+func WithMaxIdleTime(d time.Duration) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.maxIdleTime = d
+	}
+}
+
+// WithMaintainInterval sets the period of the maintainer, which closes idle
+// connections past the max idle time and opens connections up to the min pool
+// size. The default is 10s, as in the driver.
+func WithMaintainInterval(d time.Duration) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.maintainInterval = d
+	}
+}
+
+// WithHandshake sets the time to establish a connection. The default is a
+// fixed 50ms.
+func WithHandshake(dist Distribution) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.handshake = dist
+	}
+}
+
+// WithOperationTime sets how long an operation keeps its connection checked
+// out. The default is a fixed 10ms.
+func WithOperationTime(dist Distribution) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.operation = dist
+	}
+}
+
+// WithArrivals sets the arrival process of checkouts. The default is a
+// Poisson process of 100 checkouts per second.
+func WithArrivals(arrivals Arrivals) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.arrivals = arrivals
+	}
+}
+
+// WithPendingReads makes the given fraction of operations time out while the
+// server reply is still in flight. The connection is checked in but stays
+// unusable until the reply, drawn from remaining, has been read, or is closed
+// once the pending read timeout has passed.
+func WithPendingReads(rate float64, remaining Distribution) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.pendingReadRate = rate
+		cfg.pendingRead = remaining
+	}
+}
+
+// WithPendingReadTimeout sets how long a connection with a pending read waits
+// for the reply before being closed. The default is 400ms, the driver's
+// background read timeout.
+func WithPendingReadTimeout(d time.Duration) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.pendingReadTimeout = d
+	}
+}
+
+// WithSeed sets the seed of the random source, so that runs with the same
+// configuration have the same result. The default is 1.
+func WithSeed(seed int64) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.seed = seed
+	}
+}
+
+func newConfig(opts ...ConfigOpt) Config {
+	cfg := Config{
+		maxPoolSize:        100,
+		maxConnecting:      2,
+		maintainInterval:   10 * time.Second,
+		handshake:          Fixed(50 * time.Millisecond),
+		operation:          Fixed(10 * time.Millisecond),
+		arrivals:           Poisson(100),
+		pendingReadTimeout: 400 * time.Millisecond,
+		seed:               1,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return cfg
+}
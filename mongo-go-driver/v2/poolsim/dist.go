@@ -0,0 +1,68 @@
+package poolsim
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Distribution draws a duration, e.g. the time a handshake or an operation
+// takes.
+type Distribution func(r *rand.Rand) time.Duration
+
+// Fixed will return a distribution that always draws d.
+func Fixed(d time.Duration) Distribution {
+	return func(*rand.Rand) time.Duration {
+		return d
+	}
+}
+
+// Uniform will return a distribution that draws uniformly from [minimum,
+// maximum).
+func Uniform(minimum, maximum time.Duration) Distribution {
+	return func(r *rand.Rand) time.Duration {
+		if maximum <= minimum {
+			return minimum
+		}
+
+		return minimum + time.Duration(r.Int63n(int64(maximum-minimum)))
+	}
+}
+
+// Exponential will return a distribution that draws from an exponential
+// distribution with the given mean.
+func Exponential(mean time.Duration) Distribution {
+	return func(r *rand.Rand) time.Duration {
+		return time.Duration(r.ExpFloat64() * float64(mean))
+	}
+}
+
+// Arrivals draws the time between two checkouts. The first checkout happens
+// one draw after the start of the simulation.
+type Arrivals func(r *rand.Rand) time.Duration
+
+// Poisson will return a Poisson arrival process of perSecond checkouts per
+// second on average.
+func Poisson(perSecond float64) Arrivals {
+	return Arrivals(Exponential(time.Duration(float64(time.Second) / perSecond)))
+}
+
+// Constant will return arrivals every interval.
+func Constant(interval time.Duration) Arrivals {
+	return Arrivals(Fixed(interval))
+}
+
+// Burst will return arrivals of n simultaneous checkouts every interval,
+// starting at the beginning of the simulation.
+func Burst(n int, interval time.Duration) Arrivals {
+	i := 0
+
+	return func(*rand.Rand) time.Duration {
+		defer func() { i++ }()
+
+		if i > 0 && i%n == 0 {
+			return interval
+		}
+
+		return 0
+	}
+}
@@ -0,0 +1,329 @@
+// Package poolsim is a discrete-event simulator of the driver's connection
+// pool (CMAP), for evaluating pool settings and design changes without a
+// server.
+//
+// Time is simulated, so a run over minutes of traffic takes milliseconds, and
+// runs are deterministic for a given seed. The model follows the pool of
+// x/mongo/driver/topology:
+//
+//   - A checkout takes the most recently used idle connection, closing those
+//     idle for longer than the max idle time. Without one it joins both the
+//     idle wait queue and the new connection queue.
+//   - Up to maxConnecting handshakes run at once, each for the checkout that
+//     requested it, as long as the pool is under maxPoolSize. A connection
+//     whose checkout was served by a check-in in the meantime becomes idle.
+//   - A check-in serves the oldest waiting checkout, if any.
+//   - A connection checked in with a pending read is unusable until the reply
+//     is read, and is closed if it takes longer than the pending read timeout.
+//   - The maintainer closes idle connections past the max idle time and opens
+//     connections up to minPoolSize.
+//
+// Arrivals are drawn from their own random source, so runs with the same seed
+// and arrival process see the same traffic whatever the pool settings:
+//
+//	res := poolsim.Run(time.Minute,
+//		poolsim.WithArrivals(poolsim.Poisson(500)),
+//		poolsim.WithHandshake(poolsim.Uniform(20*time.Millisecond, 80*time.Millisecond)),
+//		poolsim.WithMaxConnecting(4),
+//	)
+//	fmt.Println(res.Quantile(0.99))
+package poolsim
+
+import (
+	"container/heap"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+type conn struct {
+	idleSince time.Duration
+}
+
+type waiter struct {
+	arrived     time.Duration
+	done        bool // Served or timed out
+	maintenance bool // Requested by the maintainer, not a checkout
+}
+
+type event struct {
+	at  time.Duration
+	seq int // Orders events at the same time by scheduling
+	fn  func()
+}
+
+type eventQueue []event
+
+func (q eventQueue) Len() int { return len(q) }
+
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at == q[j].at {
+		return q[i].seq < q[j].seq
+	}
+
+	return q[i].at < q[j].at
+}
+
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *eventQueue) Push(x any) { *q = append(*q, x.(event)) }
+
+func (q *eventQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+
+	return e
+}
+
+type sim struct {
+	cfg     Config
+	horizon time.Duration
+	arrRNG  *rand.Rand // Draws arrivals
+	rng     *rand.Rand // Draws everything else
+	now     time.Duration
+	events  eventQueue
+	seq     int
+
+	idle        []*conn   // Idle connections, most recently checked in last
+	total       int       // Open connections, including those being established
+	connecting  int       // Handshakes in progress
+	waiting     int       // Checkouts waiting for a connection
+	idleWait    []*waiter // Checkouts waiting for a check-in
+	newConnWait []*waiter // Requests waiting for a handshake to start
+	maintQueued int       // Maintenance requests in newConnWait
+
+	res Result
+}
+
+// Run will simulate checkouts arriving until horizon and return the result
+// once every checkout has been served or timed out.
+func Run(horizon time.Duration, opts ...ConfigOpt) Result {
+	s := &sim{
+		cfg:     newConfig(opts...),
+		horizon: horizon,
+	}
+
+	s.arrRNG = rand.New(rand.NewSource(s.cfg.seed))
+	s.rng = rand.New(rand.NewSource(s.cfg.seed + 1))
+
+	s.scheduleArrival()
+
+	if s.cfg.maintainInterval > 0 {
+		s.at(0, s.maintain)
+	}
+
+	for s.events.Len() > 0 {
+		e := heap.Pop(&s.events).(event)
+		s.now = e.at
+
+		e.fn()
+
+		s.res.PeakConnections = max(s.res.PeakConnections, s.total)
+		s.res.PeakWaiting = max(s.res.PeakWaiting, s.waiting)
+	}
+
+	s.res.Elapsed = s.now
+
+	sort.Slice(s.res.Waits, func(i, j int) bool { return s.res.Waits[i] < s.res.Waits[j] })
+
+	return s.res
+}
+
+func (s *sim) at(t time.Duration, fn func()) {
+	s.seq++
+	heap.Push(&s.events, event{at: t, seq: s.seq, fn: fn})
+}
+
+func (s *sim) after(d time.Duration, fn func()) {
+	s.at(s.now+d, fn)
+}
+
+func (s *sim) scheduleArrival() {
+	next := s.now + s.cfg.arrivals(s.arrRNG)
+	if next >= s.horizon {
+		return
+	}
+
+	s.at(next, func() {
+		s.checkOut()
+		s.scheduleArrival()
+	})
+}
+
+func (s *sim) checkOut() {
+	s.res.Checkouts++
+
+	for len(s.idle) > 0 {
+		c := s.idle[len(s.idle)-1]
+		s.idle = s.idle[:len(s.idle)-1]
+
+		if s.perished(c) {
+			s.closeConn(&s.res.IdleClosed)
+
+			continue
+		}
+
+		s.use(c, 0)
+
+		return
+	}
+
+	w := &waiter{arrived: s.now}
+
+	s.waiting++
+	s.idleWait = append(s.idleWait, w)
+	s.newConnWait = append(s.newConnWait, w)
+
+	if s.cfg.waitQueueTimeout > 0 {
+		s.after(s.cfg.waitQueueTimeout, func() {
+			if !w.done {
+				w.done = true
+				s.waiting--
+				s.res.TimedOut++
+			}
+		})
+	}
+
+	s.createConnections()
+}
+
+// createConnections will start handshakes for the requests waiting for one,
+// within the maxConnecting and maxPoolSize limits.
+func (s *sim) createConnections() {
+	for s.connecting < s.cfg.maxConnecting && len(s.newConnWait) > 0 {
+		if s.cfg.maxPoolSize > 0 && s.total >= s.cfg.maxPoolSize {
+			return
+		}
+
+		w := s.newConnWait[0]
+		s.newConnWait = s.newConnWait[1:]
+
+		if w.maintenance {
+			s.maintQueued--
+
+			// Connections created for checkouts since the request may have
+			// brought the pool up to minPoolSize.
+			if s.total >= s.cfg.minPoolSize {
+				continue
+			}
+		}
+
+		if w.done {
+			continue
+		}
+
+		s.connecting++
+		s.total++
+
+		s.after(s.cfg.handshake(s.rng), func() {
+			s.connecting--
+			s.res.ConnectionsCreated++
+
+			c := &conn{}
+
+			if w.maintenance || w.done {
+				s.checkIn(c)
+			} else {
+				s.serve(w, c)
+			}
+
+			s.createConnections()
+		})
+	}
+}
+
+// serve will hand c to the waiting checkout w.
+func (s *sim) serve(w *waiter, c *conn) {
+	w.done = true
+	s.waiting--
+
+	s.use(c, s.now-w.arrived)
+}
+
+func (s *sim) use(c *conn, wait time.Duration) {
+	s.res.Waits = append(s.res.Waits, wait)
+
+	s.after(s.cfg.operation(s.rng), func() {
+		if s.cfg.pendingReadRate > 0 && s.rng.Float64() < s.cfg.pendingReadRate {
+			s.pendingRead(c)
+
+			return
+		}
+
+		s.checkIn(c)
+	})
+}
+
+func (s *sim) pendingRead(c *conn) {
+	s.res.PendingReads++
+
+	remaining := s.cfg.pendingRead(s.rng)
+	if remaining > s.cfg.pendingReadTimeout {
+		s.after(s.cfg.pendingReadTimeout, func() {
+			s.closeConn(&s.res.PendingReadsClosed)
+			s.createConnections()
+		})
+
+		return
+	}
+
+	s.after(remaining, func() {
+		s.checkIn(c)
+	})
+}
+
+func (s *sim) checkIn(c *conn) {
+	c.idleSince = s.now
+
+	for len(s.idleWait) > 0 {
+		w := s.idleWait[0]
+		s.idleWait = s.idleWait[1:]
+
+		if !w.done {
+			s.serve(w, c)
+
+			return
+		}
+	}
+
+	s.idle = append(s.idle, c)
+}
+
+func (s *sim) perished(c *conn) bool {
+	return s.cfg.maxIdleTime > 0 && s.now-c.idleSince > s.cfg.maxIdleTime
+}
+
+func (s *sim) closeConn(counter *int) {
+	s.total--
+	*counter++
+}
+
+func (s *sim) maintain() {
+	idle := s.idle[:0]
+
+	for _, c := range s.idle {
+		if s.perished(c) {
+			s.closeConn(&s.res.IdleClosed)
+
+			continue
+		}
+
+		idle = append(idle, c)
+	}
+
+	s.idle = idle
+
+	// Connections still being established count towards minPoolSize, and so
+	// do the requests of earlier runs that haven't started yet.
+	for i := s.total + s.maintQueued; i < s.cfg.minPoolSize; i++ {
+		s.newConnWait = append(s.newConnWait, &waiter{arrived: s.now, maintenance: true})
+		s.maintQueued++
+	}
+
+	s.createConnections()
+
+	if next := s.now + s.cfg.maintainInterval; next < s.horizon {
+		s.at(next, s.maintain)
+	}
+}
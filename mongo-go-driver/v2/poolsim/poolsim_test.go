@@ -0,0 +1,180 @@
+package poolsim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun_MaxConnecting(t *testing.T) {
+	// Five simultaneous checkouts on an empty pool with a 1s handshake, as in
+	// tickets/3419/experiments/semaphore.
+	res := Run(time.Second,
+		WithArrivals(Burst(5, time.Hour)),
+		WithHandshake(Fixed(time.Second)),
+		WithOperationTime(Fixed(10*time.Millisecond)),
+		WithMaxConnecting(2),
+	)
+
+	assert.Equal(t, 5, res.Checkouts)
+
+	// The first two get the first two connections, the others get them as
+	// they are checked in.
+	assert.Equal(t, []time.Duration{
+		time.Second,
+		time.Second,
+		1010 * time.Millisecond,
+		1010 * time.Millisecond,
+		1020 * time.Millisecond,
+	}, res.Waits)
+
+	// The handshakes started for the third and fourth checkouts complete after
+	// they were served, so those connections end up idle.
+	assert.Equal(t, 4, res.ConnectionsCreated)
+	assert.Equal(t, 4, res.PeakConnections)
+	assert.Equal(t, 5, res.PeakWaiting)
+}
+
+func TestRun_MaxPoolSize(t *testing.T) {
+	res := Run(time.Second,
+		WithArrivals(Burst(3, time.Hour)),
+		WithOperationTime(Fixed(time.Second)),
+		WithMaxPoolSize(1),
+	)
+
+	assert.Equal(t, 1, res.ConnectionsCreated)
+	assert.Equal(t, []time.Duration{
+		50 * time.Millisecond,
+		1050 * time.Millisecond,
+		2050 * time.Millisecond,
+	}, res.Waits)
+}
+
+func TestRun_WaitQueueTimeout(t *testing.T) {
+	res := Run(time.Second,
+		WithArrivals(Burst(2, time.Hour)),
+		WithOperationTime(Fixed(time.Second)),
+		WithMaxPoolSize(1),
+		WithWaitQueueTimeout(100*time.Millisecond),
+	)
+
+	assert.Equal(t, 2, res.Checkouts)
+	assert.Equal(t, 1, res.TimedOut)
+	assert.Equal(t, []time.Duration{50 * time.Millisecond}, res.Waits)
+}
+
+func TestRun_MaxIdleTime(t *testing.T) {
+	// Checkouts at 2s, 4s, 6s and 8s each find the previous connection idle
+	// for too long.
+	res := Run(10*time.Second,
+		WithArrivals(Constant(2*time.Second)),
+		WithMaxIdleTime(time.Second),
+	)
+
+	assert.Equal(t, 4, res.Checkouts)
+	assert.Equal(t, 4, res.ConnectionsCreated)
+	assert.Equal(t, 3, res.IdleClosed)
+}
+
+func TestRun_MinPoolSize(t *testing.T) {
+	res := Run(time.Second,
+		WithArrivals(Constant(time.Hour)),
+		WithMinPoolSize(5),
+	)
+
+	assert.Zero(t, res.Checkouts)
+	assert.Equal(t, 5, res.ConnectionsCreated)
+	assert.Equal(t, 5, res.PeakConnections)
+	assert.Equal(t, 150*time.Millisecond, res.Elapsed, "two handshakes at a time")
+}
+
+func TestRun_MinPoolSize_SlowHandshake(t *testing.T) {
+	// Each maintenance run finds the pool still short of minPoolSize, since a
+	// single 2s handshake runs at a time, but must not request the missing
+	// connections again.
+	res := Run(time.Minute,
+		WithArrivals(Constant(time.Hour)),
+		WithMinPoolSize(10),
+		WithMaxConnecting(1),
+		WithHandshake(Fixed(2*time.Second)),
+		WithMaintainInterval(time.Second),
+	)
+
+	assert.Zero(t, res.Checkouts)
+	assert.Equal(t, 10, res.ConnectionsCreated)
+	assert.Equal(t, 10, res.PeakConnections)
+}
+
+func TestRun_PendingReads(t *testing.T) {
+	tests := []struct {
+		name       string
+		remaining  time.Duration
+		wantClosed int
+		wantWaits  []time.Duration
+	}{
+		{
+			name:       "read in time",
+			remaining:  20 * time.Millisecond,
+			wantClosed: 0,
+			wantWaits:  []time.Duration{0, 50 * time.Millisecond},
+		},
+		{
+			name:       "read timeout",
+			remaining:  time.Second,
+			wantClosed: 2,
+			wantWaits:  []time.Duration{50 * time.Millisecond, 50 * time.Millisecond},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The first connection is checked in at 160ms and the second
+			// checkout arrives at 200ms.
+			res := Run(250*time.Millisecond,
+				WithArrivals(Constant(100*time.Millisecond)),
+				WithPendingReads(1, Fixed(test.remaining)),
+			)
+
+			assert.Equal(t, 2, res.PendingReads)
+			assert.Equal(t, test.wantClosed, res.PendingReadsClosed)
+			assert.Equal(t, test.wantWaits, res.Waits)
+		})
+	}
+}
+
+func TestRun_Deterministic(t *testing.T) {
+	opts := []ConfigOpt{
+		WithArrivals(Poisson(1000)),
+		WithHandshake(Uniform(20*time.Millisecond, 80*time.Millisecond)),
+		WithOperationTime(Exponential(5 * time.Millisecond)),
+		WithPendingReads(0.01, Exponential(200*time.Millisecond)),
+		WithMaxIdleTime(100 * time.Millisecond),
+		WithMaintainInterval(time.Second),
+	}
+
+	a := Run(10*time.Second, opts...)
+	b := Run(10*time.Second, opts...)
+
+	assert.Equal(t, a, b)
+	assert.Greater(t, a.Checkouts, 9000)
+	assert.Len(t, a.Waits, a.Checkouts-a.TimedOut)
+	assert.LessOrEqual(t, a.Quantile(0.5), a.Quantile(0.99))
+	assert.LessOrEqual(t, a.PeakConnections, 100)
+
+	c := Run(10*time.Second, append(opts, WithSeed(2))...)
+	assert.NotEqual(t, a.Waits, c.Waits)
+
+	d := Run(10*time.Second, append(opts, WithMaxConnecting(8))...)
+	assert.Equal(t, a.Checkouts, d.Checkouts, "pool settings must not change the traffic")
+}
+
+func TestResult_Quantile(t *testing.T) {
+	res := Result{Waits: []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}}
+
+	assert.Equal(t, time.Duration(5), res.Quantile(0.5))
+	assert.Equal(t, time.Duration(10), res.Quantile(0.99))
+	assert.Equal(t, time.Duration(1), res.Quantile(0))
+	assert.Equal(t, time.Duration(5), res.Mean())
+	assert.Zero(t, Result{}.Quantile(0.5))
+}
@@ -0,0 +1,53 @@
+package poolsim
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Result is the outcome of a simulation.
+type Result struct {
+	Checkouts          int             // Checkouts requested
+	TimedOut           int             // Checkouts that waited longer than the wait queue timeout
+	Waits              []time.Duration // Wait of every served checkout, sorted
+	ConnectionsCreated int             // Handshakes completed
+	IdleClosed         int             // Connections closed for being idle too long
+	PendingReads       int             // Operations that left a pending read
+	PendingReadsClosed int             // Connections closed because a pending read timed out
+	PeakConnections    int             // Most connections open at once
+	PeakWaiting        int             // Most checkouts waiting at once
+	Elapsed            time.Duration   // Simulated time until the last event
+}
+
+// Quantile will return the q-quantile of the checkout waits, e.g. 0.99 for
+// the p99, using the nearest rank.
+func (r Result) Quantile(q float64) time.Duration {
+	if len(r.Waits) == 0 {
+		return 0
+	}
+
+	i := int(math.Ceil(q*float64(len(r.Waits)))) - 1
+
+	return r.Waits[min(max(i, 0), len(r.Waits)-1)]
+}
+
+// Mean will return the mean checkout wait.
+func (r Result) Mean() time.Duration {
+	if len(r.Waits) == 0 {
+		return 0
+	}
+
+	var sum time.Duration
+	for _, w := range r.Waits {
+		sum += w
+	}
+
+	return sum / time.Duration(len(r.Waits))
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("checkouts=%d timed_out=%d mean=%s p50=%s p90=%s p99=%s max=%s created=%d idle_closed=%d pending_reads=%d pending_closed=%d peak_conns=%d peak_waiting=%d",
+		r.Checkouts, r.TimedOut, r.Mean(), r.Quantile(0.5), r.Quantile(0.9), r.Quantile(0.99), r.Quantile(1),
+		r.ConnectionsCreated, r.IdleClosed, r.PendingReads, r.PendingReadsClosed, r.PeakConnections, r.PeakWaiting)
+}
@@ -0,0 +1,43 @@
+package poolstats
+
+import (
+	"time"
+)
+
+// Config is the configuration for an Analyzer.
+type Config struct {
+	buckets []time.Duration  // Upper bounds of the histogram buckets
+	now     func() time.Time // Clock timing hold times and lifetimes
+}
+
+type ConfigOpt func(*Config)
+
+// WithBuckets sets the upper bounds of the histogram buckets, in increasing
+// order. Durations over the last bound are counted in an extra bucket. The
+// default is DefaultBuckets.
+func WithBuckets(bounds ...time.Duration) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.buckets = bounds
+	}
+}
+
+// WithClock sets the clock used to time the intervals the driver doesn't
+// report a duration for. The default is time.Now.
+func WithClock(now func() time.Time) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.now = now
+	}
+}
+
+func newConfig(opts ...ConfigOpt) Config {
+	cfg := Config{
+		buckets: DefaultBuckets,
+		now:     time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return cfg
+}
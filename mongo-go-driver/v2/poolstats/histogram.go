@@ -0,0 +1,166 @@
+package poolstats
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds of the default histogram buckets,
+// doubling from 100µs to about 105s.
+var DefaultBuckets = exponentialBuckets(100*time.Microsecond, 2, 21)
+
+func exponentialBuckets(start time.Duration, factor float64, n int) []time.Duration {
+	bounds := make([]time.Duration, n)
+	for i := range bounds {
+		bounds[i] = start
+		start = time.Duration(float64(start) * factor)
+	}
+
+	return bounds
+}
+
+// Bucket is a histogram bucket, counting the durations up to UpperBound and
+// over the bound of the previous bucket. The last bucket of a histogram has
+// no bound and an UpperBound of 0.
+type Bucket struct {
+	UpperBound time.Duration
+	Count      int
+}
+
+// Histogram is a distribution of durations in fixed buckets.
+type Histogram struct {
+	bounds []time.Duration
+	counts []int // One more than bounds, for overflows
+	count  int
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+func newHistogram(bounds []time.Duration) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]int, len(bounds)+1)}
+}
+
+// Observe will add d to the histogram.
+func (h *Histogram) Observe(d time.Duration) {
+	i := 0
+	for i < len(h.bounds) && d > h.bounds[i] {
+		i++
+	}
+
+	h.counts[i]++
+
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+
+	if d > h.max {
+		h.max = d
+	}
+
+	h.count++
+	h.sum += d
+}
+
+// Count will return the number of durations observed.
+func (h *Histogram) Count() int { return h.count }
+
+// Min will return the shortest duration observed.
+func (h *Histogram) Min() time.Duration { return h.min }
+
+// Max will return the longest duration observed.
+func (h *Histogram) Max() time.Duration { return h.max }
+
+// Mean will return the mean of the durations observed.
+func (h *Histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	return h.sum / time.Duration(h.count)
+}
+
+// Quantile will return an estimate of the q-quantile, e.g. 0.99 for the p99:
+// the upper bound of the bucket holding it, capped at the longest duration
+// observed.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := int(q * float64(h.count))
+	if rank >= h.count {
+		rank = h.count - 1
+	}
+
+	seen := 0
+
+	for i, n := range h.counts {
+		seen += n
+		if seen > rank && i < len(h.bounds) {
+			return min(h.bounds[i], h.max)
+		}
+	}
+
+	return h.max
+}
+
+// Buckets will return the non-empty buckets in increasing order.
+func (h *Histogram) Buckets() []Bucket {
+	var buckets []Bucket
+
+	for i, n := range h.counts {
+		if n == 0 {
+			continue
+		}
+
+		b := Bucket{Count: n}
+		if i < len(h.bounds) {
+			b.UpperBound = h.bounds[i]
+		}
+
+		buckets = append(buckets, b)
+	}
+
+	return buckets
+}
+
+func (h *Histogram) clone() *Histogram {
+	c := *h
+	c.counts = append([]int(nil), h.counts...)
+
+	return &c
+}
+
+// histogramWidth is the number of characters of the largest bar.
+const histogramWidth = 40
+
+// String will render the non-empty buckets as a bar chart.
+func (h *Histogram) String() string {
+	if h.count == 0 {
+		return "(no observations)\n"
+	}
+
+	buckets := h.Buckets()
+
+	largest := 0
+	for _, b := range buckets {
+		largest = max(largest, b.Count)
+	}
+
+	var sb strings.Builder
+
+	for _, b := range buckets {
+		label := "> " + h.bounds[len(h.bounds)-1].String()
+		if b.UpperBound > 0 {
+			label = "<= " + b.UpperBound.String()
+		}
+
+		bar := strings.Repeat("#", max(1, b.Count*histogramWidth/largest))
+
+		fmt.Fprintf(&sb, "%12s | %-*s %d\n", label, histogramWidth, bar, b.Count)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,251 @@
+// Package poolstats analyzes the event.PoolEvent stream of a client to time
+// each stage of a connection's life, per server:
+//
+//   - Establishment: ConnectionCreated to ConnectionReady, as reported by the
+//     driver, including the handshake and authentication.
+//   - Checkout wait: ConnectionCheckOutStarted to ConnectionCheckedOut, as
+//     reported by the driver, including waiting for a connection to be
+//     established or checked in.
+//   - Hold: ConnectionCheckedOut to ConnectionCheckedIn, the time an operation
+//     keeps its connection.
+//   - Lifetime: ConnectionCreated to ConnectionClosed.
+//
+// along with the reasons connections were closed and checkouts failed.
+//
+//	analyzer := poolstats.New()
+//	client, err := mongo.Connect(options.Client().SetPoolMonitor(analyzer.Monitor(nil)))
+//	...
+//	analyzer.WriteReport(os.Stdout)
+package poolstats
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/event"
+)
+
+// ServerStats are the statistics of the pool of one server.
+type ServerStats struct {
+	Address        string
+	Establishment  *Histogram     // Time to establish connections
+	CheckoutWait   *Histogram     // Wait of successful checkouts
+	Hold           *Histogram     // Time connections were checked out
+	Lifetime       *Histogram     // Time from creation to close
+	CloseReasons   map[string]int // Closed connections by reason
+	CheckoutFailed map[string]int // Failed checkouts by reason
+	Cleared        int            // Times the pool was cleared
+	Open           int            // Connections created and not closed
+	CheckedOut     int            // Connections checked out and not checked in
+}
+
+func (s *ServerStats) clone() ServerStats {
+	c := *s
+	c.Establishment = s.Establishment.clone()
+	c.CheckoutWait = s.CheckoutWait.clone()
+	c.Hold = s.Hold.clone()
+	c.Lifetime = s.Lifetime.clone()
+	c.CloseReasons = maps.Clone(s.CloseReasons)
+	c.CheckoutFailed = maps.Clone(s.CheckoutFailed)
+
+	return c
+}
+
+type connKey struct {
+	address string
+	id      int64
+}
+
+// Analyzer aggregates pool events.
+type Analyzer struct {
+	cfg Config
+
+	mu         sync.Mutex
+	servers    map[string]*ServerStats
+	created    map[connKey]time.Time // Creation time of open connections
+	checkedOut map[connKey]time.Time // Checkout time of checked out connections
+}
+
+// New will return an analyzer. Its monitor must be installed on the client,
+// see Monitor.
+func New(opts ...ConfigOpt) *Analyzer {
+	return &Analyzer{
+		cfg:        newConfig(opts...),
+		servers:    map[string]*ServerStats{},
+		created:    map[connKey]time.Time{},
+		checkedOut: map[connKey]time.Time{},
+	}
+}
+
+// Monitor will return a pool monitor that feeds the analyzer and then calls
+// next, which may be nil.
+func (a *Analyzer) Monitor(next *event.PoolMonitor) *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(evt *event.PoolEvent) {
+			a.Event(evt)
+
+			if next != nil && next.Event != nil {
+				next.Event(evt)
+			}
+		},
+	}
+}
+
+// Event will add evt to the statistics.
+func (a *Analyzer) Event(evt *event.PoolEvent) {
+	now := a.cfg.now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stats := a.server(evt.Address)
+	key := connKey{address: evt.Address, id: evt.ConnectionID}
+
+	switch evt.Type {
+	case event.ConnectionCreated:
+		a.created[key] = now
+		stats.Open++
+	case event.ConnectionReady:
+		stats.Establishment.Observe(evt.Duration)
+	case event.ConnectionClosed:
+		stats.CloseReasons[evt.Reason]++
+
+		if created, ok := a.created[key]; ok {
+			stats.Lifetime.Observe(now.Sub(created))
+			stats.Open--
+
+			delete(a.created, key)
+		}
+
+		// A connection closed while checked out, e.g. after a network error,
+		// is never checked in.
+		if _, ok := a.checkedOut[key]; ok {
+			stats.CheckedOut--
+
+			delete(a.checkedOut, key)
+		}
+	case event.ConnectionCheckedOut:
+		stats.CheckoutWait.Observe(evt.Duration)
+		stats.CheckedOut++
+
+		a.checkedOut[key] = now
+	case event.ConnectionCheckOutFailed:
+		stats.CheckoutFailed[evt.Reason]++
+	case event.ConnectionCheckedIn:
+		if checkedOut, ok := a.checkedOut[key]; ok {
+			stats.Hold.Observe(now.Sub(checkedOut))
+			stats.CheckedOut--
+
+			delete(a.checkedOut, key)
+		}
+	case event.ConnectionPoolCleared:
+		stats.Cleared++
+	}
+}
+
+func (a *Analyzer) server(address string) *ServerStats {
+	stats, ok := a.servers[address]
+	if !ok {
+		stats = &ServerStats{
+			Address:        address,
+			Establishment:  newHistogram(a.cfg.buckets),
+			CheckoutWait:   newHistogram(a.cfg.buckets),
+			Hold:           newHistogram(a.cfg.buckets),
+			Lifetime:       newHistogram(a.cfg.buckets),
+			CloseReasons:   map[string]int{},
+			CheckoutFailed: map[string]int{},
+		}
+
+		a.servers[address] = stats
+	}
+
+	return stats
+}
+
+// Stats will return a copy of the statistics of every server seen, sorted by
+// address.
+func (a *Analyzer) Stats() []ServerStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stats := make([]ServerStats, 0, len(a.servers))
+	for _, s := range a.servers {
+		stats = append(stats, s.clone())
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Address < stats[j].Address })
+
+	return stats
+}
+
+// WriteReport will write, for every server, a summary of each histogram, the
+// counts of close reasons and checkout failures, and the histograms.
+func (a *Analyzer) WriteReport(w io.Writer) error {
+	for _, s := range a.Stats() {
+		if err := writeServer(w, s); err != nil {
+			return fmt.Errorf("failed to write report of %s: %w", s.Address, err)
+		}
+	}
+
+	return nil
+}
+
+func writeServer(w io.Writer, s ServerStats) error {
+	fmt.Fprintf(w, "== %s (open=%d checked_out=%d cleared=%d)\n\n", s.Address, s.Open, s.CheckedOut, s.Cleared)
+
+	histograms := []struct {
+		name string
+		h    *Histogram
+	}{
+		{name: "establishment", h: s.Establishment},
+		{name: "checkout wait", h: s.CheckoutWait},
+		{name: "hold", h: s.Hold},
+		{name: "lifetime", h: s.Lifetime},
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tCOUNT\tMEAN\tP50\tP90\tP99\tMAX")
+
+	for _, hist := range histograms {
+		h := hist.h
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			hist.name, h.Count(), h.Mean(), h.Quantile(0.5), h.Quantile(0.9), h.Quantile(0.99), h.Max())
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	writeCounts(w, "close reasons", s.CloseReasons)
+	writeCounts(w, "checkout failures", s.CheckoutFailed)
+
+	for _, hist := range histograms {
+		if hist.h.Count() > 0 {
+			fmt.Fprintf(w, "\n%s:\n%s", hist.name, hist.h)
+		}
+	}
+
+	_, err := fmt.Fprintln(w)
+
+	return err
+}
+
+func writeCounts(w io.Writer, name string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\n%s:", name)
+
+	for _, reason := range slices.Sorted(maps.Keys(counts)) {
+		fmt.Fprintf(w, " %s=%d", reason, counts[reason])
+	}
+
+	fmt.Fprintln(w)
+}
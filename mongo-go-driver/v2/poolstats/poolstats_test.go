@@ -0,0 +1,159 @@
+package poolstats
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/event"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestAnalyzer(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	analyzer := New(WithClock(clock.Now))
+
+	var forwarded int
+
+	monitor := analyzer.Monitor(&event.PoolMonitor{
+		Event: func(*event.PoolEvent) { forwarded++ },
+	})
+
+	const (
+		a = "a:27017"
+		b = "b:27017"
+	)
+
+	events := []struct {
+		advance time.Duration
+		evt     event.PoolEvent
+	}{
+		{evt: event.PoolEvent{Type: event.ConnectionCheckOutStarted, Address: a}},
+		{evt: event.PoolEvent{Type: event.ConnectionCreated, Address: a, ConnectionID: 1}},
+		{advance: 20 * time.Millisecond, evt: event.PoolEvent{Type: event.ConnectionReady, Address: a, ConnectionID: 1, Duration: 20 * time.Millisecond}},
+		{evt: event.PoolEvent{Type: event.ConnectionCheckedOut, Address: a, ConnectionID: 1, Duration: 21 * time.Millisecond}},
+		{advance: 5 * time.Millisecond, evt: event.PoolEvent{Type: event.ConnectionCheckedIn, Address: a, ConnectionID: 1}},
+		{evt: event.PoolEvent{Type: event.ConnectionCheckedOut, Address: a, ConnectionID: 1}},
+		{advance: 3 * time.Millisecond, evt: event.PoolEvent{Type: event.ConnectionCheckedIn, Address: a, ConnectionID: 1}},
+		{evt: event.PoolEvent{Type: event.ConnectionCheckOutFailed, Address: a, Reason: event.ReasonTimedOut, Duration: time.Second}},
+		{advance: time.Second, evt: event.PoolEvent{Type: event.ConnectionClosed, Address: a, ConnectionID: 1, Reason: event.ReasonIdle}},
+
+		// A connection closed while checked out.
+		{evt: event.PoolEvent{Type: event.ConnectionCreated, Address: b, ConnectionID: 1}},
+		{evt: event.PoolEvent{Type: event.ConnectionCheckedOut, Address: b, ConnectionID: 1}},
+		{advance: 2 * time.Second, evt: event.PoolEvent{Type: event.ConnectionClosed, Address: b, ConnectionID: 1, Reason: event.ReasonError}},
+		{evt: event.PoolEvent{Type: event.ConnectionPoolCleared, Address: b}},
+
+		// A connection still open.
+		{evt: event.PoolEvent{Type: event.ConnectionCreated, Address: b, ConnectionID: 2}},
+		{evt: event.PoolEvent{Type: event.ConnectionCheckedOut, Address: b, ConnectionID: 2}},
+	}
+
+	for _, e := range events {
+		clock.Advance(e.advance)
+		monitor.Event(&e.evt)
+	}
+
+	assert.Equal(t, len(events), forwarded)
+
+	stats := analyzer.Stats()
+	require.Len(t, stats, 2)
+
+	sa, sb := stats[0], stats[1]
+
+	assert.Equal(t, a, sa.Address)
+	assert.Equal(t, 1, sa.Establishment.Count())
+	assert.Equal(t, 20*time.Millisecond, sa.Establishment.Max())
+	assert.Equal(t, 2, sa.CheckoutWait.Count())
+	assert.Equal(t, 21*time.Millisecond, sa.CheckoutWait.Max())
+	assert.Equal(t, 2, sa.Hold.Count())
+	assert.Equal(t, 4*time.Millisecond, sa.Hold.Mean())
+	assert.Equal(t, 1, sa.Lifetime.Count())
+	assert.Equal(t, 1028*time.Millisecond, sa.Lifetime.Max())
+	assert.Equal(t, map[string]int{event.ReasonIdle: 1}, sa.CloseReasons)
+	assert.Equal(t, map[string]int{event.ReasonTimedOut: 1}, sa.CheckoutFailed)
+	assert.Zero(t, sa.Open)
+	assert.Zero(t, sa.CheckedOut)
+
+	assert.Equal(t, b, sb.Address)
+	assert.Zero(t, sb.Hold.Count(), "a connection closed while checked out has no hold time")
+	assert.Equal(t, 2*time.Second, sb.Lifetime.Max())
+	assert.Equal(t, map[string]int{event.ReasonError: 1}, sb.CloseReasons)
+	assert.Equal(t, 1, sb.Cleared)
+	assert.Equal(t, 1, sb.Open)
+	assert.Equal(t, 1, sb.CheckedOut)
+
+	// Stats are copies.
+	sa.CloseReasons["mutated"] = 1
+	sa.Hold.Observe(time.Hour)
+
+	again := analyzer.Stats()[0]
+	assert.NotContains(t, again.CloseReasons, "mutated")
+	assert.Equal(t, 2, again.Hold.Count())
+
+	var buf bytes.Buffer
+	require.NoError(t, analyzer.WriteReport(&buf))
+
+	out := buf.String()
+	assert.Contains(t, out, "== a:27017 (open=0 checked_out=0 cleared=0)")
+	assert.Contains(t, out, "== b:27017 (open=1 checked_out=1 cleared=1)")
+	assert.Contains(t, out, "close reasons: idle=1")
+	assert.Contains(t, out, "checkout failures: timeout=1")
+	assert.Contains(t, out, "checkout wait:\n")
+}
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]time.Duration{time.Millisecond, 10 * time.Millisecond, 100 * time.Millisecond})
+
+	assert.Zero(t, h.Quantile(0.5))
+	assert.Equal(t, "(no observations)\n", h.String())
+
+	for _, d := range []time.Duration{
+		500 * time.Microsecond,
+		time.Millisecond,
+		2 * time.Millisecond,
+		3 * time.Millisecond,
+		50 * time.Millisecond,
+		time.Second,
+	} {
+		h.Observe(d)
+	}
+
+	assert.Equal(t, 6, h.Count())
+	assert.Equal(t, 500*time.Microsecond, h.Min())
+	assert.Equal(t, time.Second, h.Max())
+	assert.Equal(t, []Bucket{
+		{UpperBound: time.Millisecond, Count: 2},
+		{UpperBound: 10 * time.Millisecond, Count: 2},
+		{UpperBound: 100 * time.Millisecond, Count: 1},
+		{Count: 1},
+	}, h.Buckets())
+
+	assert.Equal(t, time.Millisecond, h.Quantile(0))
+	assert.Equal(t, 10*time.Millisecond, h.Quantile(0.5))
+	assert.Equal(t, 100*time.Millisecond, h.Quantile(0.8))
+	assert.Equal(t, time.Second, h.Quantile(1))
+
+	assert.Equal(t,
+		"      <= 1ms | ######################################## 2\n"+
+			"     <= 10ms | ######################################## 2\n"+
+			"    <= 100ms | ####################                     1\n"+
+			"     > 100ms | ####################                     1\n",
+		h.String())
+}
+
+func TestDefaultBuckets(t *testing.T) {
+	assert.Len(t, DefaultBuckets, 21)
+	assert.Equal(t, 100*time.Microsecond, DefaultBuckets[0])
+	assert.Equal(t, 200*time.Microsecond, DefaultBuckets[1])
+	assert.Greater(t, DefaultBuckets[20], 100*time.Second)
+}
@@ -0,0 +1,90 @@
+// Command schemagen prints Go struct definitions for the documents of a
+// collection or an Extended JSON file.
+//
+//	schemagen -uri mongodb://localhost:27017 -db test -coll restaurants -name Restaurant
+//	schemagen -file users.json -name User -package model
+//
+// Files are read in either of the formats written by mongoexport: one
+// document per line or a single array.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/schemagen"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func main() {
+	var (
+		uri    = flag.String("uri", "mongodb://localhost:27017", "connection string")
+		db     = flag.String("db", "", "database to sample")
+		coll   = flag.String("coll", "", "collection to sample")
+		sample = flag.Int("sample", 1000, "number of documents to sample from the collection")
+		file   = flag.String("file", "", "Extended JSON file to read instead of a collection")
+		name   = flag.String("name", "Document", "name of the generated struct")
+		pkg    = flag.String("package", "main", "package of the generated file")
+		oneOf  = flag.Bool("oneof", false, "use oneof unions for fields with two or three scalar types")
+	)
+
+	flag.Parse()
+
+	docs, err := readDocuments(*file, *uri, *db, *coll, *sample)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(docs) == 0 {
+		log.Fatal("no documents to infer a schema from")
+	}
+
+	schema, err := schemagen.Infer(docs)
+	if err != nil {
+		log.Fatalf("failed to infer schema: %v", err)
+	}
+
+	opts := []schemagen.ConfigOpt{schemagen.WithPackage(*pkg)}
+	if *oneOf {
+		opts = append(opts, schemagen.WithOneOf())
+	}
+
+	src, err := schemagen.Generate(*name, schema, opts...)
+	if err != nil {
+		log.Fatalf("failed to generate code: %v", err)
+	}
+
+	if _, err := os.Stdout.Write(src); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readDocuments(file, uri, db, coll string, sample int) ([]bson.Raw, error) {
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+
+		defer f.Close()
+
+		return schemagen.ReadExtJSON(f)
+	}
+
+	if db == "" || coll == "" {
+		log.Fatal("either -file or both -db and -coll are required")
+	}
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = client.Disconnect(context.Background()) }()
+
+	return schemagen.Sample(context.Background(), client.Database(db).Collection(coll), sample)
+}
@@ -0,0 +1,337 @@
+package schemagen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const oneofImport = "github.com/prestonvasquez/mongo-go-driver/v2/oneof"
+
+// Config is the configuration for generating Go code.
+type Config struct {
+	pkg   string // Package clause of the generated file
+	oneOf bool   // Use oneof unions for fields with two or three scalar types
+}
+
+type ConfigOpt func(*Config)
+
+// WithPackage sets the package of the generated file. The default is "main".
+func WithPackage(pkg string) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.pkg = pkg
+	}
+}
+
+// WithOneOf generates oneof.OneOf2 and oneof.OneOf3 unions instead of any for
+// fields that hold two or three scalar types, e.g. a string or a bool.
+func WithOneOf() ConfigOpt {
+	return func(cfg *Config) {
+		cfg.oneOf = true
+	}
+}
+
+func newConfig(opts ...ConfigOpt) Config {
+	cfg := Config{pkg: "main"}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return cfg
+}
+
+// Generate will return gofmt-ed Go source declaring a struct named name for
+// the schema, plus one struct for each embedded document.
+func Generate(name string, schema *Schema, opts ...ConfigOpt) ([]byte, error) {
+	g := &generator{
+		cfg:     newConfig(opts...),
+		imports: map[string]bool{},
+		names:   map[string]bool{},
+	}
+
+	g.enqueue(name, schema)
+
+	var body bytes.Buffer
+
+	for len(g.queue) > 0 {
+		next := g.queue[0]
+		g.queue = g.queue[1:]
+
+		g.writeStruct(&body, next.name, next.schema)
+	}
+
+	var src bytes.Buffer
+
+	fmt.Fprintf(&src, "// Code generated by schemagen from %d sample documents. DO NOT EDIT.\n\n", schema.Count)
+	fmt.Fprintf(&src, "package %s\n\n", g.cfg.pkg)
+
+	if len(g.imports) > 0 {
+		var paths []string
+		for path := range g.imports {
+			paths = append(paths, path)
+		}
+
+		sort.Strings(paths)
+
+		src.WriteString("import (\n")
+		for _, path := range paths {
+			fmt.Fprintf(&src, "\t%q\n", path)
+		}
+		src.WriteString(")\n\n")
+	}
+
+	src.Write(body.Bytes())
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w", err)
+	}
+
+	return formatted, nil
+}
+
+type pendingStruct struct {
+	name   string
+	schema *Schema
+}
+
+type generator struct {
+	cfg     Config
+	imports map[string]bool // Import paths used
+	names   map[string]bool // Type names used
+	queue   []pendingStruct // Structs still to write
+}
+
+// enqueue will reserve a unique type name for the schema and return it.
+func (g *generator) enqueue(name string, schema *Schema) string {
+	name = unique(name, g.names)
+	g.queue = append(g.queue, pendingStruct{name: name, schema: schema})
+
+	return name
+}
+
+func (g *generator) writeStruct(w *bytes.Buffer, name string, schema *Schema) {
+	fmt.Fprintf(w, "type %s struct {\n", name)
+
+	fieldNames := map[string]bool{}
+
+	for _, key := range schema.Order {
+		field := schema.Fields[key]
+		fieldName := unique(exportedName(key), fieldNames)
+
+		typ := g.goType(field, name+fieldName)
+
+		optional := field.Optional(schema) || field.Nullable()
+		if optional && pointable(typ) {
+			typ = "*" + typ
+		}
+
+		tag := key
+		if optional {
+			tag += ",omitempty"
+		}
+
+		fmt.Fprintf(w, "\t%s %s `bson:%q json:%q`\n", fieldName, typ, tag, tag)
+	}
+
+	w.WriteString("}\n\n")
+}
+
+// goType will return the Go type for the values of a field. Embedded
+// documents are queued as a struct named structName.
+func (g *generator) goType(field *Field, structName string) string {
+	types := make([]bson.Type, 0, len(field.Types))
+	for typ := range field.Types {
+		types = append(types, typ)
+	}
+
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	switch {
+	case len(types) == 0:
+		return "any"
+	case len(types) == 1:
+		return g.singleType(types[0], field, structName)
+	case numeric(types):
+		if slices.Contains(types, bson.TypeDouble) {
+			return "float64"
+		}
+
+		return "int64"
+	case g.cfg.oneOf && len(types) <= 3 && scalar(types):
+		args := make([]string, len(types))
+		for i, typ := range types {
+			args[i] = g.singleType(typ, field, structName)
+		}
+
+		// Types that map to the same Go type, e.g. string and symbol, can't
+		// be told apart by a union.
+		distinct := slices.Clone(args)
+		slices.Sort(distinct)
+
+		if len(slices.Compact(distinct)) != len(args) {
+			return "any"
+		}
+
+		g.imports[oneofImport] = true
+
+		return fmt.Sprintf("oneof.OneOf%d[%s]", len(types), strings.Join(args, ", "))
+	}
+
+	return "any"
+}
+
+func (g *generator) singleType(typ bson.Type, field *Field, structName string) string {
+	switch typ {
+	case bson.TypeEmbeddedDocument:
+		return g.enqueue(structName, field.Document)
+	case bson.TypeArray:
+		elem := g.goType(field.Elem, structName)
+		if field.Elem.Nullable() && pointable(elem) {
+			elem = "*" + elem
+		}
+
+		return "[]" + elem
+	case bson.TypeString, bson.TypeSymbol, bson.TypeJavaScript:
+		return "string"
+	case bson.TypeBoolean:
+		return "bool"
+	case bson.TypeInt32:
+		return "int32"
+	case bson.TypeInt64:
+		return "int64"
+	case bson.TypeDouble:
+		return "float64"
+	case bson.TypeDateTime:
+		g.imports["time"] = true
+
+		return "time.Time"
+	case bson.TypeBinary:
+		// The bson package only decodes the generic subtypes into a []byte.
+		if bytesSubtypes(field.Subtypes) {
+			return "[]byte"
+		}
+
+		g.imports["go.mongodb.org/mongo-driver/v2/bson"] = true
+
+		return "bson.Binary"
+	}
+
+	if name, ok := bsonTypes[typ]; ok {
+		g.imports["go.mongodb.org/mongo-driver/v2/bson"] = true
+
+		return name
+	}
+
+	return "any"
+}
+
+// bsonTypes are the bson package types for the remaining BSON types.
+var bsonTypes = map[bson.Type]string{
+	bson.TypeObjectID:      "bson.ObjectID",
+	bson.TypeDecimal128:    "bson.Decimal128",
+	bson.TypeTimestamp:     "bson.Timestamp",
+	bson.TypeRegex:         "bson.Regex",
+	bson.TypeDBPointer:     "bson.DBPointer",
+	bson.TypeCodeWithScope: "bson.CodeWithScope",
+	bson.TypeMinKey:        "bson.MinKey",
+	bson.TypeMaxKey:        "bson.MaxKey",
+}
+
+// bytesSubtypes reports whether binary values of the subtypes can be decoded
+// into a []byte: the generic subtype 0x00 and the old binary subtype 0x02.
+func bytesSubtypes(subtypes map[byte]int) bool {
+	for subtype := range subtypes {
+		if subtype != bson.TypeBinaryGeneric && subtype != bson.TypeBinaryBinaryOld {
+			return false
+		}
+	}
+
+	return true
+}
+
+func numeric(types []bson.Type) bool {
+	for _, typ := range types {
+		if typ != bson.TypeInt32 && typ != bson.TypeInt64 && typ != bson.TypeDouble {
+			return false
+		}
+	}
+
+	return true
+}
+
+func scalar(types []bson.Type) bool {
+	return !slices.Contains(types, bson.TypeEmbeddedDocument) && !slices.Contains(types, bson.TypeArray)
+}
+
+// pointable reports whether a missing or null value needs a pointer to be told
+// apart from the zero value.
+func pointable(typ string) bool {
+	return typ != "any" && !strings.HasPrefix(typ, "[]") && !strings.HasPrefix(typ, "oneof.")
+}
+
+// initialisms are written in upper case in Go identifiers. Longer ones come
+// first, so that the "Uuid" of "userUuid" isn't taken for an "Id".
+var initialisms = []string{"UUID", "HTTP", "JSON", "UID", "URL", "URI", "API", "ID", "IP"}
+
+// exportedName will return an exported Go identifier for a field name, e.g.
+// "_id" -> "ID", "created_at" -> "CreatedAt", "userId" -> "UserID".
+func exportedName(key string) string {
+	parts := strings.FieldsFunc(key, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var sb strings.Builder
+
+	for _, part := range parts {
+		if upper := strings.ToUpper(part); slices.Contains(initialisms, upper) {
+			sb.WriteString(upper)
+
+			continue
+		}
+
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		part = string(runes)
+
+		// A trailing initialism in camel case, e.g. the "Id" of "userId".
+		for _, initialism := range initialisms {
+			camel := initialism[:1] + strings.ToLower(initialism[1:])
+			if strings.HasSuffix(part, camel) && len(part) > len(camel) && unicode.IsLower(rune(part[len(part)-len(camel)-1])) {
+				part = strings.TrimSuffix(part, camel) + initialism
+
+				break
+			}
+		}
+
+		sb.WriteString(part)
+	}
+
+	name := sb.String()
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		name = "F" + name
+	}
+
+	return name
+}
+
+// unique will return name, or name with the smallest numeric suffix that
+// isn't in used, and mark it as used.
+func unique(name string, used map[string]bool) string {
+	candidate := name
+	for i := 2; used[candidate]; i++ {
+		candidate = name + strconv.Itoa(i)
+	}
+
+	used[candidate] = true
+
+	return candidate
+}
@@ -0,0 +1,206 @@
+// Package schemagen infers a schema from sample documents and generates Go
+// struct definitions with bson and json tags for it.
+//
+// Fields missing from some documents get omitempty, fields that are sometimes
+// null become pointers, embedded documents become their own struct types and
+// fields holding values of several BSON types become any, or a oneof union
+// when WithOneOf is used.
+package schemagen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Schema is the inferred schema of a set of documents.
+type Schema struct {
+	Count  int               // Number of documents seen
+	Fields map[string]*Field // Fields by name
+	Order  []string          // Field names in the order first seen
+}
+
+// Field is the inferred schema of a single field.
+type Field struct {
+	Count int               // Number of documents the field appears in, including as null
+	Types map[bson.Type]int // Number of non-null values of each type
+	Nulls int               // Number of null or undefined values
+
+	// Subtypes are the number of binary values of each subtype.
+	Subtypes map[byte]int
+
+	Document *Schema // Merged schema of embedded document values
+	Elem     *Field  // Merged schema of array elements
+}
+
+// NewSchema will return an empty schema.
+func NewSchema() *Schema {
+	return &Schema{Fields: map[string]*Field{}}
+}
+
+// Infer will return the schema of docs.
+func Infer(docs []bson.Raw) (*Schema, error) {
+	schema := NewSchema()
+
+	for _, doc := range docs {
+		if err := schema.Add(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	return schema, nil
+}
+
+// Add will merge the fields of doc into the schema.
+func (s *Schema) Add(doc bson.Raw) error {
+	elems, err := doc.Elements()
+	if err != nil {
+		return fmt.Errorf("invalid document: %w", err)
+	}
+
+	s.Count++
+
+	for _, elem := range elems {
+		key := elem.Key()
+
+		field, ok := s.Fields[key]
+		if !ok {
+			field = newField()
+			s.Fields[key] = field
+			s.Order = append(s.Order, key)
+		}
+
+		field.Count++
+
+		if err := field.add(elem.Value()); err != nil {
+			return fmt.Errorf("field %q: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+func newField() *Field {
+	return &Field{Types: map[bson.Type]int{}, Subtypes: map[byte]int{}}
+}
+
+func (f *Field) add(val bson.RawValue) error {
+	switch val.Type {
+	case bson.TypeNull, bson.TypeUndefined:
+		f.Nulls++
+
+		return nil
+	case bson.TypeEmbeddedDocument:
+		if f.Document == nil {
+			f.Document = NewSchema()
+		}
+
+		if err := f.Document.Add(val.Document()); err != nil {
+			return err
+		}
+	case bson.TypeBinary:
+		subtype, _ := val.Binary()
+		f.Subtypes[subtype]++
+	case bson.TypeArray:
+		if f.Elem == nil {
+			f.Elem = newField()
+		}
+
+		values, err := val.Array().Values()
+		if err != nil {
+			return fmt.Errorf("invalid array: %w", err)
+		}
+
+		for _, v := range values {
+			f.Elem.Count++
+
+			if err := f.Elem.add(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	f.Types[val.Type]++
+
+	return nil
+}
+
+// Optional reports whether the field is missing from some of the documents
+// of its schema.
+func (f *Field) Optional(parent *Schema) bool {
+	return f.Count < parent.Count
+}
+
+// Nullable reports whether the field was null at least once.
+func (f *Field) Nullable() bool {
+	return f.Nulls > 0
+}
+
+// Sample will return up to n documents sampled at random from the collection
+// with $sample.
+func Sample(ctx context.Context, coll *mongo.Collection, n int) ([]bson.Raw, error) {
+	pipeline := mongo.Pipeline{{{Key: "$sample", Value: bson.D{{Key: "size", Value: n}}}}}
+
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample collection: %w", err)
+	}
+
+	defer cursor.Close(ctx)
+
+	var docs []bson.Raw
+	for cursor.Next(ctx) {
+		docs = append(docs, append(bson.Raw(nil), cursor.Current...))
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read sample: %w", err)
+	}
+
+	return docs, nil
+}
+
+// ReadExtJSON will read Extended JSON documents from r, either one per line
+// or as a single array, the two formats written by mongoexport.
+func ReadExtJSON(r io.Reader) ([]bson.Raw, error) {
+	dec := json.NewDecoder(r)
+
+	var docs []bson.Raw
+
+	for {
+		var msg json.RawMessage
+
+		err := dec.Decode(&msg)
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JSON: %w", err)
+		}
+
+		messages := []json.RawMessage{msg}
+
+		if strings.HasPrefix(strings.TrimSpace(string(msg)), "[") {
+			messages = nil
+			if err := json.Unmarshal(msg, &messages); err != nil {
+				return nil, fmt.Errorf("failed to read JSON array: %w", err)
+			}
+		}
+
+		for _, m := range messages {
+			var doc bson.Raw
+			if err := bson.UnmarshalExtJSON(m, false, &doc); err != nil {
+				return nil, fmt.Errorf("failed to parse Extended JSON document %d: %w", len(docs), err)
+			}
+
+			docs = append(docs, doc)
+		}
+	}
+}
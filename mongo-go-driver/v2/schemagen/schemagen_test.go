@@ -0,0 +1,234 @@
+package schemagen
+
+import (
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func docs(t *testing.T, ds ...bson.D) []bson.Raw {
+	t.Helper()
+
+	raws := make([]bson.Raw, len(ds))
+	for i, d := range ds {
+		b, err := bson.Marshal(d)
+		require.NoError(t, err)
+
+		raws[i] = b
+	}
+
+	return raws
+}
+
+func TestGenerate(t *testing.T) {
+	id := bson.NewObjectID()
+
+	schema, err := Infer(docs(t,
+		bson.D{
+			{Key: "_id", Value: id},
+			{Key: "name", Value: "Katz's"},
+			{Key: "rating", Value: int32(4)},
+			{Key: "address", Value: bson.D{{Key: "street", Value: "Houston"}, {Key: "zip_code", Value: "10002"}}},
+			{Key: "grades", Value: bson.A{bson.D{{Key: "score", Value: int32(9)}}}},
+			{Key: "openedAt", Value: time.Unix(0, 0)},
+			{Key: "ownerId", Value: nil},
+			{Key: "writeBlocking", Value: true},
+		},
+		bson.D{
+			{Key: "_id", Value: id},
+			{Key: "name", Value: "Russ & Daughters"},
+			{Key: "rating", Value: 4.5},
+			{Key: "address", Value: bson.D{{Key: "street", Value: "Houston"}}},
+			{Key: "grades", Value: bson.A{}},
+			{Key: "ownerId", Value: "u1"},
+			{Key: "writeBlocking", Value: "majority"},
+			{Key: "tags", Value: bson.A{"deli"}},
+		},
+	))
+	require.NoError(t, err)
+
+	src, err := Generate("Restaurant", schema, WithPackage("model"))
+	require.NoError(t, err)
+
+	assert.Equal(t, `// Code generated by schemagen from 2 sample documents. DO NOT EDIT.
+
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"time"
+)
+
+type Restaurant struct {
+	ID            bson.ObjectID      `+"`bson:\"_id\" json:\"_id\"`"+`
+	Name          string             `+"`bson:\"name\" json:\"name\"`"+`
+	Rating        float64            `+"`bson:\"rating\" json:\"rating\"`"+`
+	Address       RestaurantAddress  `+"`bson:\"address\" json:\"address\"`"+`
+	Grades        []RestaurantGrades `+"`bson:\"grades\" json:\"grades\"`"+`
+	OpenedAt      *time.Time         `+"`bson:\"openedAt,omitempty\" json:\"openedAt,omitempty\"`"+`
+	OwnerID       *string            `+"`bson:\"ownerId,omitempty\" json:\"ownerId,omitempty\"`"+`
+	WriteBlocking any                `+"`bson:\"writeBlocking\" json:\"writeBlocking\"`"+`
+	Tags          []string           `+"`bson:\"tags,omitempty\" json:\"tags,omitempty\"`"+`
+}
+
+type RestaurantAddress struct {
+	Street  string  `+"`bson:\"street\" json:\"street\"`"+`
+	ZipCode *string `+"`bson:\"zip_code,omitempty\" json:\"zip_code,omitempty\"`"+`
+}
+
+type RestaurantGrades struct {
+	Score int32 `+"`bson:\"score\" json:\"score\"`"+`
+}
+`, string(src))
+}
+
+// goTypes are the reflect types of the type expressions the round-trip test
+// can build.
+var goTypes = map[string]reflect.Type{
+	"string":        reflect.TypeOf(""),
+	"int32":         reflect.TypeOf(int32(0)),
+	"[]byte":        reflect.TypeOf([]byte(nil)),
+	"bson.Binary":   reflect.TypeOf(bson.Binary{}),
+	"bson.ObjectID": reflect.TypeOf(bson.ObjectID{}),
+}
+
+// structType will return the struct type declared as name in the generated
+// source, built with reflect.StructOf, so that documents can be decoded into
+// it without compiling the source.
+func structType(t *testing.T, src []byte, name string) reflect.Type {
+	t.Helper()
+
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	require.NoError(t, err)
+
+	obj := file.Scope.Lookup(name)
+	require.NotNil(t, obj, "type %s must be declared", name)
+
+	decl := obj.Decl.(*ast.TypeSpec).Type.(*ast.StructType)
+
+	var fields []reflect.StructField
+
+	for _, f := range decl.Fields.List {
+		var expr strings.Builder
+		require.NoError(t, format.Node(&expr, token.NewFileSet(), f.Type))
+
+		typ, ok := goTypes[expr.String()]
+		require.True(t, ok, "unsupported type %s", expr.String())
+
+		fields = append(fields, reflect.StructField{
+			Name: f.Names[0].Name,
+			Type: typ,
+			Tag:  reflect.StructTag(strings.Trim(f.Tag.Value, "`")),
+		})
+	}
+
+	return reflect.StructOf(fields)
+}
+
+func TestGenerate_BinaryRoundTrip(t *testing.T) {
+	uuid := bson.Binary{Subtype: bson.TypeBinaryUUID, Data: make([]byte, 16)}
+
+	samples := docs(t,
+		bson.D{
+			{Key: "_id", Value: bson.NewObjectID()},
+			{Key: "uid", Value: uuid},
+			{Key: "data", Value: bson.Binary{Subtype: bson.TypeBinaryGeneric, Data: []byte("abc")}},
+			{Key: "digest", Value: bson.Binary{Subtype: bson.TypeBinaryMD5, Data: make([]byte, 16)}},
+		},
+		bson.D{
+			{Key: "_id", Value: bson.NewObjectID()},
+			{Key: "uid", Value: uuid},
+			{Key: "data", Value: bson.Binary{Subtype: bson.TypeBinaryGeneric, Data: []byte("de")}},
+			{Key: "digest", Value: bson.Binary{Subtype: bson.TypeBinaryGeneric, Data: []byte("f")}},
+		},
+	)
+
+	schema, err := Infer(samples)
+	require.NoError(t, err)
+
+	src, err := Generate("Session", schema)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(src), "UID    bson.Binary")
+	assert.Contains(t, string(src), "Data   []byte")
+	assert.Contains(t, string(src), "Digest bson.Binary", "mixed subtypes need bson.Binary")
+
+	typ := structType(t, src, "Session")
+
+	for _, sample := range samples {
+		doc := reflect.New(typ)
+		require.NoError(t, bson.Unmarshal(sample, doc.Interface()))
+
+		got, err := bson.Marshal(doc.Interface())
+		require.NoError(t, err)
+		assert.Equal(t, sample, bson.Raw(got), "the sample must round-trip through the generated type")
+	}
+}
+
+func TestGenerate_OneOf(t *testing.T) {
+	schema, err := Infer(docs(t,
+		bson.D{{Key: "v", Value: true}},
+		bson.D{{Key: "v", Value: "x"}},
+	))
+	require.NoError(t, err)
+
+	src, err := Generate("Doc", schema, WithOneOf())
+	require.NoError(t, err)
+
+	assert.Contains(t, string(src), `"github.com/prestonvasquez/mongo-go-driver/v2/oneof"`)
+	assert.Contains(t, string(src), "V oneof.OneOf2[string, bool]")
+}
+
+func TestExportedName(t *testing.T) {
+	tests := map[string]string{
+		"_id":        "ID",
+		"created_at": "CreatedAt",
+		"userId":     "UserID",
+		"uid":        "UID",
+		"userUuid":   "UserUUID",
+		"homepage":   "Homepage",
+		"api-url":    "APIURL",
+		"2fa":        "F2fa",
+		"$":          "F",
+		"café":       "Café",
+	}
+
+	for key, want := range tests {
+		assert.Equal(t, want, exportedName(key), key)
+	}
+}
+
+func TestGenerate_NameCollisions(t *testing.T) {
+	schema, err := Infer(docs(t, bson.D{{Key: "a_b", Value: 1}, {Key: "aB", Value: 2}}))
+	require.NoError(t, err)
+
+	src, err := Generate("Doc", schema)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(src), "AB ")
+	assert.Contains(t, string(src), "AB2 ")
+}
+
+func TestReadExtJSON(t *testing.T) {
+	lines := `{"a": {"$numberLong": "1"}}
+{"a": 2}`
+
+	got, err := ReadExtJSON(strings.NewReader(lines))
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, bson.TypeInt64, got[0].Lookup("a").Type)
+
+	got, err = ReadExtJSON(strings.NewReader(`[{"a": 1}, {"b": {"$date": "2020-01-01T00:00:00Z"}}]`))
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, bson.TypeDateTime, got[1].Lookup("b").Type)
+}
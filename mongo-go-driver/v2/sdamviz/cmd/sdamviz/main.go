@@ -0,0 +1,193 @@
+// Command sdamviz records the SDAM events of a client during a failover
+// experiment and renders them as a state diagram.
+//
+//	sdamviz record -duration 2m -out failover.json
+//	sdamviz show failover.json
+//
+// record connects to -uri, or MONGODB_URI, pings the deployment every
+// -interval so that errors seen by operations can be lined up with the
+// diagram, and stops after -duration or on interrupt. It writes the JSON
+// export to -out and the diagram to stdout.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/sdamviz"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+
+	switch os.Args[1] {
+	case "record":
+		err = record(os.Args[2:])
+	case "show":
+		err = show(os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: sdamviz record [flags] | sdamviz show [flags] snapshot.json")
+	os.Exit(2)
+}
+
+func record(args []string) error {
+	uri := os.Getenv("MONGODB_URI")
+	if uri == "" {
+		uri = "mongodb://localhost:27017"
+	}
+
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+
+	var (
+		uriFlag    = fs.String("uri", uri, "connection string")
+		duration   = fs.Duration("duration", time.Minute, "how long to record, 0 until interrupted")
+		interval   = fs.Duration("interval", time.Second, "interval between pings, 0 for none")
+		heartbeats = fs.Bool("heartbeats", false, "add successful heartbeats to the timeline")
+		out        = fs.String("out", "sdam.json", "JSON file to write, - for stdout")
+	)
+
+	_ = fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *duration > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	rec := sdamviz.New(sdamviz.WithHeartbeats(*heartbeats))
+
+	client, err := mongo.Connect(options.Client().ApplyURI(*uriFlag).SetServerMonitor(rec.Monitor(nil)))
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	if *interval > 0 {
+		ping(ctx, client, *interval)
+	} else {
+		<-ctx.Done()
+	}
+
+	// Disconnecting closes the servers and the topology, which ends the
+	// timeline.
+	disconnectCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Disconnect(disconnectCtx); err != nil {
+		log.Printf("failed to disconnect: %v", err)
+	}
+
+	snap := rec.Snapshot()
+
+	if err := writeFile(*out, snap.WriteJSON); err != nil {
+		return err
+	}
+
+	return snap.WriteDiagram(os.Stdout)
+}
+
+// ping will ping the primary every interval until ctx is done, logging the
+// result whenever it changes.
+func ping(ctx context.Context, client *mongo.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	last := ""
+
+	for {
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		err := client.Ping(pingCtx, nil)
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		result := "ok"
+		if err != nil {
+			result = err.Error()
+		}
+
+		if result != last {
+			log.Printf("+%s ping: %s", time.Since(start).Round(time.Millisecond), result)
+
+			last = result
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func show(args []string) error {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+
+	out := fs.String("out", "-", "file to write the diagram to, - for stdout")
+
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected one snapshot, got %d", fs.NArg())
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+
+	defer f.Close()
+
+	snap, err := sdamviz.ReadJSON(f)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", fs.Arg(0), err)
+	}
+
+	return writeFile(*out, snap.WriteDiagram)
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	if err := write(f); err != nil {
+		_ = f.Close()
+
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return f.Close()
+}
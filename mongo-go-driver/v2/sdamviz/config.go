@@ -0,0 +1,43 @@
+package sdamviz
+
+import (
+	"time"
+)
+
+// Config is the configuration for a Recorder.
+type Config struct {
+	now        func() time.Time // Clock timing the events
+	heartbeats bool             // Add successful heartbeats to the timeline
+}
+
+type ConfigOpt func(*Config)
+
+// WithClock sets the clock used to time the events, which carry no time of
+// their own. The default is time.Now.
+func WithClock(now func() time.Time) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.now = now
+	}
+}
+
+// WithHeartbeats sets whether successful heartbeats are added to the
+// timeline. Their RTTs are recorded per server either way, and failed
+// heartbeats are always added. The default is false, since a heartbeat every
+// 10 seconds per server drowns out the changes.
+func WithHeartbeats(on bool) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.heartbeats = on
+	}
+}
+
+func newConfig(opts ...ConfigOpt) Config {
+	cfg := Config{
+		now: time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return cfg
+}
@@ -0,0 +1,212 @@
+package sdamviz
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Symbols of the lanes of the diagram.
+const (
+	laneUnchanged = "|" // The type didn't change
+	laneChanged   = "*" // The description changed but not the type
+	laneFailed    = "!" // A heartbeat failed
+	laneClosed    = "x" // The server or topology was closed
+)
+
+// WriteDiagram will write the snapshot as a textual state diagram: the
+// sequence of topology types and of primaries, then one row per entry of the
+// timeline with a lane for the topology and for each server showing its type
+// when it changes, and a summary of the heartbeats of each server.
+func (s Snapshot) WriteDiagram(w io.Writer) error {
+	fmt.Fprintf(w, "topology: %s\n", strings.Join(s.topologySequence(), " -> "))
+
+	if primaries := s.primarySequence(); len(primaries) > 1 {
+		fmt.Fprintf(w, "primary:  %s\n", strings.Join(primaries, " -> "))
+	}
+
+	fmt.Fprintf(w, "\nlanes: %s unchanged, %s changed with the same type, %s heartbeat failed, %s closed\n\n",
+		laneUnchanged, laneChanged, laneFailed, laneClosed)
+
+	if err := s.writeLanes(w); err != nil {
+		return fmt.Errorf("failed to write lanes: %w", err)
+	}
+
+	fmt.Fprintln(w)
+
+	if err := s.writeSummary(w); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+
+	return nil
+}
+
+// topologySequence will return the topology types in the order they were
+// entered, with the offset they were entered at.
+func (s Snapshot) topologySequence() []string {
+	seq := []string{unknown}
+
+	for _, e := range s.Timeline {
+		if e.Kind == KindTopologyChanged && e.From != e.To {
+			seq = append(seq, fmt.Sprintf("%s (%s)", e.To, offset(e.Offset)))
+		}
+	}
+
+	return seq
+}
+
+// primarySequence will return the primaries of the topology in the order they
+// were elected, with the offset the topology saw them at.
+func (s Snapshot) primarySequence() []string {
+	seq := []string{"none"}
+	current := ""
+
+	for _, e := range s.Timeline {
+		if e.Kind != KindTopologyChanged || e.Primary == current {
+			continue
+		}
+
+		current = e.Primary
+
+		name := current
+		if name == "" {
+			name = "none"
+		}
+
+		seq = append(seq, fmt.Sprintf("%s (%s)", name, offset(e.Offset)))
+	}
+
+	return seq
+}
+
+func (s Snapshot) writeLanes(w io.Writer) error {
+	column := make(map[string]int, len(s.Servers))
+
+	header := []string{"OFFSET", "TOPOLOGY"}
+	for i, srv := range s.Servers {
+		column[srv.Address] = i + 1
+		header = append(header, srv.Address)
+	}
+
+	header = append(header, "EVENT")
+
+	// Lanes hold what is drawn in each column while nothing happens to it:
+	// nothing before opening and after closing, a line in between.
+	lanes := make([]string, len(s.Servers)+1)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, e := range s.Timeline {
+		cells := append([]string(nil), lanes...)
+
+		col, ok := 0, true
+		if e.Address != "" {
+			col, ok = column[e.Address]
+		}
+
+		switch {
+		case !ok:
+			// A server missing from a snapshot read back from JSON.
+		case e.Kind == KindTopologyOpening, e.Kind == KindServerOpening:
+			cells[col] = unknown
+			lanes[col] = laneUnchanged
+		case e.Kind == KindTopologyChanged, e.Kind == KindServerChanged:
+			cells[col] = laneChanged
+			if e.From != e.To {
+				cells[col] = e.To
+			}
+
+			lanes[col] = laneUnchanged
+		case e.Kind == KindTopologyClosed, e.Kind == KindServerClosed:
+			cells[col] = laneClosed
+			lanes[col] = ""
+		case e.Kind == KindHeartbeatFailed:
+			cells[col] = laneFailed
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", offset(e.Offset), strings.Join(cells, "\t"), describe(e))
+	}
+
+	return tw.Flush()
+}
+
+// describe will return the text of the EVENT column of an entry.
+func describe(e Entry) string {
+	var desc string
+
+	switch e.Kind {
+	case KindTopologyOpening:
+		desc = "topology opening"
+	case KindTopologyChanged:
+		desc = "topology changed"
+		if e.From != e.To {
+			desc = fmt.Sprintf("topology %s -> %s", e.From, e.To)
+		}
+
+		if e.Primary != "" {
+			desc += ", primary " + e.Primary
+		}
+	case KindTopologyClosed:
+		desc = "topology closed"
+	case KindServerOpening:
+		desc = e.Address + " opening"
+	case KindServerChanged:
+		desc = fmt.Sprintf("%s %s changed", e.Address, e.To)
+		if e.From != e.To {
+			desc = fmt.Sprintf("%s %s -> %s", e.Address, e.From, e.To)
+		}
+
+		if e.Primary != "" {
+			desc += ", reports primary " + e.Primary
+		}
+	case KindServerClosed:
+		desc = e.Address + " closed"
+	case KindHeartbeatSucceeded:
+		desc = fmt.Sprintf("%s heartbeat %s", e.Address, e.Duration.Round(time.Microsecond))
+		if e.Awaited {
+			desc = fmt.Sprintf("%s awaited heartbeat %s", e.Address, e.Duration.Round(time.Microsecond))
+		}
+	case KindHeartbeatFailed:
+		desc = fmt.Sprintf("%s heartbeat failed after %s: %s", e.Address, e.Duration.Round(time.Microsecond), e.Error)
+	}
+
+	// Keep multi-line errors on their row.
+	return strings.Join(strings.Fields(desc), " ")
+}
+
+func (s Snapshot) writeSummary(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVER\tTYPE\tTRANSITIONS\tHEARTBEATS\tFAILED\tRTT MIN\tRTT P50\tRTT P90\tRTT MAX\tLAST ERROR")
+
+	for _, srv := range s.Servers {
+		kind := srv.Kind
+		if srv.Closed {
+			kind += " (closed)"
+		}
+
+		rtt := []string{"-", "-", "-", "-"}
+		if p := srv.RTT(); p.Len() > 0 {
+			rtt = []string{p.Min().String(), p.Median().String(), p.Quantile(0.9).String(), p.Max().String()}
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s",
+			srv.Address, kind, len(srv.Transitions), srv.Heartbeats, srv.Failures, strings.Join(rtt, "\t"))
+
+		// An empty last cell would pad the line with spaces.
+		if srv.LastError != "" {
+			fmt.Fprintf(tw, "\t%s", strings.Join(strings.Fields(srv.LastError), " "))
+		}
+
+		fmt.Fprintln(tw)
+	}
+
+	return tw.Flush()
+}
+
+// offset will format an offset from the first event to the millisecond.
+func offset(d time.Duration) string {
+	return "+" + d.Round(time.Millisecond).String()
+}
@@ -0,0 +1,31 @@
+package sdamviz
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// WriteJSON will write the snapshot as indented JSON. Durations are in
+// nanoseconds, in the fields ending in _ns.
+func (s Snapshot) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(s); err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// ReadJSON will read a snapshot written by WriteJSON, e.g. to render the
+// diagram of a recorded experiment.
+func ReadJSON(r io.Reader) (Snapshot, error) {
+	var snap Snapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+
+	return snap, nil
+}
@@ -0,0 +1,373 @@
+// Package sdamviz records the Server Discovery and Monitoring events of a
+// client as a timeline of topology description changes, server type
+// transitions and heartbeats, and renders it as a textual state diagram or
+// exports it as JSON, so that failover experiments can be read at a glance:
+//
+//	rec := sdamviz.New()
+//	client, err := mongo.Connect(options.Client().SetServerMonitor(rec.Monitor(nil)))
+//	...
+//	// Step down the primary, kill a member, etc.
+//	...
+//	_ = client.Disconnect(ctx)
+//	_ = rec.Snapshot().WriteDiagram(os.Stdout)
+//
+// A recorder follows the topology of one client.
+package sdamviz
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/timeoutsel"
+	"go.mongodb.org/mongo-driver/v2/event"
+)
+
+// Kind is the kind of an entry in the timeline.
+type Kind string
+
+const (
+	KindTopologyOpening    Kind = "topologyOpening"
+	KindTopologyChanged    Kind = "topologyDescriptionChanged"
+	KindTopologyClosed     Kind = "topologyClosed"
+	KindServerOpening      Kind = "serverOpening"
+	KindServerChanged      Kind = "serverDescriptionChanged"
+	KindServerClosed       Kind = "serverClosed"
+	KindHeartbeatSucceeded Kind = "serverHeartbeatSucceeded"
+	KindHeartbeatFailed    Kind = "serverHeartbeatFailed"
+)
+
+// unknown is the type of a server or topology before it is discovered.
+const unknown = "Unknown"
+
+// Entry is an event of the timeline.
+type Entry struct {
+	Time    time.Time     `json:"time"`
+	Offset  time.Duration `json:"offset_ns"` // Since the first event
+	Kind    Kind          `json:"kind"`
+	Address string        `json:"address,omitempty"` // Server of server and heartbeat events
+
+	// From and To are the server types of a server description change, or
+	// the topology types of a topology description change.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+
+	// Primary is the primary reported by the server of a server description
+	// change, or the RSPrimary of a topology description change.
+	Primary string `json:"primary,omitempty"`
+
+	// Servers are the server types of a topology description change, by
+	// address.
+	Servers map[string]string `json:"servers,omitempty"`
+
+	Duration time.Duration `json:"duration_ns,omitempty"` // Of a heartbeat
+	Awaited  bool          `json:"awaited,omitempty"`     // Heartbeat was a streaming hello
+	Error    string        `json:"error,omitempty"`       // Failure of a heartbeat
+}
+
+// Transition is a change of server type.
+type Transition struct {
+	Offset time.Duration `json:"offset_ns"`
+	From   string        `json:"from"`
+	To     string        `json:"to"`
+}
+
+// Server is the history of one server.
+type Server struct {
+	Address     string       `json:"address"`
+	Kind        string       `json:"kind"`   // Current server type
+	Closed      bool         `json:"closed"` // Removed from the topology or the client disconnected
+	Transitions []Transition `json:"transitions"`
+	Heartbeats  int          `json:"heartbeats"` // Completed heartbeats, including failed ones
+	Failures    int          `json:"failures"`   // Failed heartbeats
+	LastError   string       `json:"last_error,omitempty"`
+
+	// RTTs are the durations of the successful polling heartbeats. Awaited
+	// heartbeats are left out since the server holds them until its state
+	// changes or maxAwaitTimeMS passes.
+	RTTs []time.Duration `json:"rtts_ns"`
+}
+
+// RTT will return the profile of the server's heartbeat RTTs.
+func (s Server) RTT() timeoutsel.Profile {
+	return timeoutsel.NewProfile(s.RTTs)
+}
+
+func (s *Server) clone() Server {
+	c := *s
+	c.Transitions = append([]Transition(nil), s.Transitions...)
+	c.RTTs = append([]time.Duration(nil), s.RTTs...)
+
+	return c
+}
+
+// Recorder records SDAM events.
+type Recorder struct {
+	cfg Config
+
+	mu       sync.Mutex
+	start    time.Time // Of the first event
+	entries  []Entry
+	servers  map[string]*Server
+	topology string // Current topology type
+}
+
+// New will return a recorder. Its monitor must be installed on the client,
+// see Monitor.
+func New(opts ...ConfigOpt) *Recorder {
+	return &Recorder{
+		cfg:      newConfig(opts...),
+		servers:  map[string]*Server{},
+		topology: unknown,
+	}
+}
+
+// Monitor will return a server monitor that feeds the recorder and then calls
+// next, which may be nil.
+func (r *Recorder) Monitor(next *event.ServerMonitor) *event.ServerMonitor {
+	if next == nil {
+		next = &event.ServerMonitor{}
+	}
+
+	return &event.ServerMonitor{
+		TopologyOpening: func(evt *event.TopologyOpeningEvent) {
+			r.add(Entry{Kind: KindTopologyOpening})
+
+			if next.TopologyOpening != nil {
+				next.TopologyOpening(evt)
+			}
+		},
+		TopologyDescriptionChanged: func(evt *event.TopologyDescriptionChangedEvent) {
+			r.topologyChanged(evt)
+
+			if next.TopologyDescriptionChanged != nil {
+				next.TopologyDescriptionChanged(evt)
+			}
+		},
+		TopologyClosed: func(evt *event.TopologyClosedEvent) {
+			r.add(Entry{Kind: KindTopologyClosed})
+
+			if next.TopologyClosed != nil {
+				next.TopologyClosed(evt)
+			}
+		},
+		ServerOpening: func(evt *event.ServerOpeningEvent) {
+			r.serverOpening(evt)
+
+			if next.ServerOpening != nil {
+				next.ServerOpening(evt)
+			}
+		},
+		ServerDescriptionChanged: func(evt *event.ServerDescriptionChangedEvent) {
+			r.serverChanged(evt)
+
+			if next.ServerDescriptionChanged != nil {
+				next.ServerDescriptionChanged(evt)
+			}
+		},
+		ServerClosed: func(evt *event.ServerClosedEvent) {
+			r.serverClosed(evt)
+
+			if next.ServerClosed != nil {
+				next.ServerClosed(evt)
+			}
+		},
+		ServerHeartbeatStarted: func(evt *event.ServerHeartbeatStartedEvent) {
+			if next.ServerHeartbeatStarted != nil {
+				next.ServerHeartbeatStarted(evt)
+			}
+		},
+		ServerHeartbeatSucceeded: func(evt *event.ServerHeartbeatSucceededEvent) {
+			r.heartbeatSucceeded(evt)
+
+			if next.ServerHeartbeatSucceeded != nil {
+				next.ServerHeartbeatSucceeded(evt)
+			}
+		},
+		ServerHeartbeatFailed: func(evt *event.ServerHeartbeatFailedEvent) {
+			r.heartbeatFailed(evt)
+
+			if next.ServerHeartbeatFailed != nil {
+				next.ServerHeartbeatFailed(evt)
+			}
+		},
+	}
+}
+
+func (r *Recorder) topologyChanged(evt *event.TopologyDescriptionChangedEvent) {
+	entry := Entry{
+		Kind:    KindTopologyChanged,
+		From:    evt.PreviousDescription.Kind,
+		To:      evt.NewDescription.Kind,
+		Servers: make(map[string]string, len(evt.NewDescription.Servers)),
+	}
+
+	for _, desc := range evt.NewDescription.Servers {
+		entry.Servers[desc.Addr.String()] = desc.Kind
+
+		if desc.Kind == "RSPrimary" {
+			entry.Primary = desc.Addr.String()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.topology = entry.To
+	r.addLocked(entry)
+}
+
+func (r *Recorder) serverOpening(evt *event.ServerOpeningEvent) {
+	address := evt.Address.String()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// A server removed from the topology and added back starts over.
+	srv := r.server(address)
+	srv.Kind = unknown
+	srv.Closed = false
+
+	r.addLocked(Entry{Kind: KindServerOpening, Address: address})
+}
+
+func (r *Recorder) serverChanged(evt *event.ServerDescriptionChangedEvent) {
+	entry := Entry{
+		Kind:    KindServerChanged,
+		Address: evt.Address.String(),
+		From:    evt.PreviousDescription.Kind,
+		To:      evt.NewDescription.Kind,
+		Primary: evt.NewDescription.Primary.String(),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.addLocked(entry)
+
+	srv := r.server(entry.Address)
+	srv.Kind = entry.To
+
+	if entry.From != entry.To {
+		srv.Transitions = append(srv.Transitions, Transition{Offset: r.entries[len(r.entries)-1].Offset, From: entry.From, To: entry.To})
+	}
+}
+
+func (r *Recorder) serverClosed(evt *event.ServerClosedEvent) {
+	address := evt.Address.String()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.server(address).Closed = true
+	r.addLocked(Entry{Kind: KindServerClosed, Address: address})
+}
+
+func (r *Recorder) heartbeatSucceeded(evt *event.ServerHeartbeatSucceededEvent) {
+	address := heartbeatAddress(evt.ConnectionID)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	srv := r.server(address)
+	srv.Heartbeats++
+
+	if !evt.Awaited {
+		srv.RTTs = append(srv.RTTs, evt.Duration)
+	}
+
+	if r.cfg.heartbeats {
+		r.addLocked(Entry{Kind: KindHeartbeatSucceeded, Address: address, Duration: evt.Duration, Awaited: evt.Awaited})
+	}
+}
+
+func (r *Recorder) heartbeatFailed(evt *event.ServerHeartbeatFailedEvent) {
+	entry := Entry{
+		Kind:     KindHeartbeatFailed,
+		Address:  heartbeatAddress(evt.ConnectionID),
+		Duration: evt.Duration,
+		Awaited:  evt.Awaited,
+	}
+
+	if evt.Failure != nil {
+		entry.Error = evt.Failure.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	srv := r.server(entry.Address)
+	srv.Heartbeats++
+	srv.Failures++
+	srv.LastError = entry.Error
+
+	r.addLocked(entry)
+}
+
+func (r *Recorder) add(entry Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.addLocked(entry)
+}
+
+func (r *Recorder) addLocked(entry Entry) {
+	entry.Time = r.cfg.now()
+
+	if len(r.entries) == 0 {
+		r.start = entry.Time
+	}
+
+	entry.Offset = entry.Time.Sub(r.start)
+
+	r.entries = append(r.entries, entry)
+}
+
+func (r *Recorder) server(address string) *Server {
+	srv, ok := r.servers[address]
+	if !ok {
+		srv = &Server{Address: address, Kind: unknown}
+		r.servers[address] = srv
+	}
+
+	return srv
+}
+
+// heartbeatAddress will return the address of the connection ID of a
+// heartbeat, which is the address followed by "[-<counter>]".
+func heartbeatAddress(connectionID string) string {
+	if i := strings.LastIndex(connectionID, "[-"); i >= 0 {
+		return connectionID[:i]
+	}
+
+	return connectionID
+}
+
+// Snapshot is a copy of what a recorder has recorded.
+type Snapshot struct {
+	Topology string   `json:"topology"` // Current topology type
+	Servers  []Server `json:"servers"`  // Sorted by address
+	Timeline []Entry  `json:"timeline"`
+}
+
+// Snapshot will return a copy of the timeline and of the history of every
+// server seen.
+func (r *Recorder) Snapshot() Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snap := Snapshot{
+		Topology: r.topology,
+		Servers:  make([]Server, 0, len(r.servers)),
+		Timeline: append([]Entry(nil), r.entries...),
+	}
+
+	for _, srv := range r.servers {
+		snap.Servers = append(snap.Servers, srv.clone())
+	}
+
+	sort.Slice(snap.Servers, func(i, j int) bool { return snap.Servers[i].Address < snap.Servers[j].Address })
+
+	return snap
+}
@@ -0,0 +1,337 @@
+package sdamviz
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/pendingread"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/event"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/address"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+const (
+	a = address.Address("a:27017")
+	b = address.Address("b:27017")
+)
+
+func server(addr address.Address, kind string, primary address.Address) event.ServerDescription {
+	return event.ServerDescription{Addr: addr, Kind: kind, Primary: primary}
+}
+
+func topology(kind string, servers ...event.ServerDescription) event.TopologyDescription {
+	return event.TopologyDescription{Kind: kind, Servers: servers}
+}
+
+// failover will feed a monitor the events of a two member replica set whose
+// primary, a, goes down at 10s and is replaced by b at 12s.
+func failover(clock *fakeClock, monitor *event.ServerMonitor) {
+	monitor.TopologyOpening(&event.TopologyOpeningEvent{})
+	monitor.ServerOpening(&event.ServerOpeningEvent{Address: a})
+	monitor.ServerOpening(&event.ServerOpeningEvent{Address: b})
+
+	clock.Advance(5 * time.Millisecond)
+	monitor.ServerHeartbeatStarted(&event.ServerHeartbeatStartedEvent{ConnectionID: "a:27017[-1]"})
+	monitor.ServerHeartbeatSucceeded(&event.ServerHeartbeatSucceededEvent{ConnectionID: "a:27017[-1]", Duration: 2 * time.Millisecond})
+	monitor.ServerDescriptionChanged(&event.ServerDescriptionChangedEvent{
+		Address:             a,
+		PreviousDescription: server(a, "Unknown", ""),
+		NewDescription:      server(a, "RSPrimary", a),
+	})
+	monitor.TopologyDescriptionChanged(&event.TopologyDescriptionChangedEvent{
+		PreviousDescription: topology("Unknown", server(a, "Unknown", ""), server(b, "Unknown", "")),
+		NewDescription:      topology("ReplicaSetWithPrimary", server(a, "RSPrimary", a), server(b, "Unknown", "")),
+	})
+
+	clock.Advance(5 * time.Millisecond)
+	monitor.ServerHeartbeatSucceeded(&event.ServerHeartbeatSucceededEvent{ConnectionID: "b:27017[-2]", Duration: 4 * time.Millisecond})
+	monitor.ServerDescriptionChanged(&event.ServerDescriptionChangedEvent{
+		Address:             b,
+		PreviousDescription: server(b, "Unknown", ""),
+		NewDescription:      server(b, "RSSecondary", a),
+	})
+	monitor.TopologyDescriptionChanged(&event.TopologyDescriptionChangedEvent{
+		PreviousDescription: topology("ReplicaSetWithPrimary", server(a, "RSPrimary", a), server(b, "Unknown", "")),
+		NewDescription:      topology("ReplicaSetWithPrimary", server(a, "RSPrimary", a), server(b, "RSSecondary", a)),
+	})
+
+	// Streaming heartbeats are held by the server and aren't RTTs.
+	monitor.ServerHeartbeatSucceeded(&event.ServerHeartbeatSucceededEvent{ConnectionID: "a:27017[-3]", Duration: 10 * time.Second, Awaited: true})
+	monitor.ServerHeartbeatSucceeded(&event.ServerHeartbeatSucceededEvent{ConnectionID: "a:27017[-1]", Duration: 6 * time.Millisecond})
+
+	clock.Advance(10*time.Second - 10*time.Millisecond)
+	monitor.ServerHeartbeatFailed(&event.ServerHeartbeatFailedEvent{
+		ConnectionID: "a:27017[-3]",
+		Duration:     3 * time.Millisecond,
+		Failure:      errors.New("connection refused\nby peer"),
+		Awaited:      true,
+	})
+	monitor.ServerDescriptionChanged(&event.ServerDescriptionChangedEvent{
+		Address:             a,
+		PreviousDescription: server(a, "RSPrimary", a),
+		NewDescription:      server(a, "Unknown", ""),
+	})
+	monitor.TopologyDescriptionChanged(&event.TopologyDescriptionChangedEvent{
+		PreviousDescription: topology("ReplicaSetWithPrimary", server(a, "RSPrimary", a), server(b, "RSSecondary", a)),
+		NewDescription:      topology("ReplicaSetNoPrimary", server(a, "Unknown", ""), server(b, "RSSecondary", a)),
+	})
+
+	clock.Advance(2 * time.Second)
+	monitor.ServerDescriptionChanged(&event.ServerDescriptionChangedEvent{
+		Address:             b,
+		PreviousDescription: server(b, "RSSecondary", a),
+		NewDescription:      server(b, "RSPrimary", b),
+	})
+	monitor.TopologyDescriptionChanged(&event.TopologyDescriptionChangedEvent{
+		PreviousDescription: topology("ReplicaSetNoPrimary", server(a, "Unknown", ""), server(b, "RSSecondary", a)),
+		NewDescription:      topology("ReplicaSetWithPrimary", server(a, "Unknown", ""), server(b, "RSPrimary", b)),
+	})
+
+	clock.Advance(time.Second)
+	monitor.ServerClosed(&event.ServerClosedEvent{Address: a})
+	monitor.ServerClosed(&event.ServerClosedEvent{Address: b})
+	monitor.TopologyClosed(&event.TopologyClosedEvent{})
+}
+
+func TestRecorder(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	rec := New(WithClock(clock.Now))
+
+	var forwarded []string
+
+	failover(clock, rec.Monitor(&event.ServerMonitor{
+		ServerHeartbeatStarted: func(*event.ServerHeartbeatStartedEvent) { forwarded = append(forwarded, "heartbeat started") },
+		TopologyClosed:         func(*event.TopologyClosedEvent) { forwarded = append(forwarded, "topology closed") },
+	}))
+
+	assert.Equal(t, []string{"heartbeat started", "topology closed"}, forwarded)
+
+	snap := rec.Snapshot()
+
+	assert.Equal(t, "ReplicaSetWithPrimary", snap.Topology)
+
+	require.Len(t, snap.Servers, 2)
+
+	sa, sb := snap.Servers[0], snap.Servers[1]
+
+	assert.Equal(t, "a:27017", sa.Address)
+	assert.Equal(t, "Unknown", sa.Kind)
+	assert.True(t, sa.Closed)
+	assert.Equal(t, []Transition{
+		{Offset: 5 * time.Millisecond, From: "Unknown", To: "RSPrimary"},
+		{Offset: 10 * time.Second, From: "RSPrimary", To: "Unknown"},
+	}, sa.Transitions)
+	assert.Equal(t, 4, sa.Heartbeats)
+	assert.Equal(t, 1, sa.Failures)
+	assert.Equal(t, []time.Duration{2 * time.Millisecond, 6 * time.Millisecond}, sa.RTTs)
+	assert.Equal(t, 4*time.Millisecond, sa.RTT().Mean())
+	assert.Equal(t, "connection refused\nby peer", sa.LastError)
+
+	assert.Equal(t, "b:27017", sb.Address)
+	assert.Equal(t, "RSPrimary", sb.Kind)
+	assert.Equal(t, []Transition{
+		{Offset: 10 * time.Millisecond, From: "Unknown", To: "RSSecondary"},
+		{Offset: 12 * time.Second, From: "RSSecondary", To: "RSPrimary"},
+	}, sb.Transitions)
+	assert.Equal(t, []time.Duration{4 * time.Millisecond}, sb.RTTs)
+
+	kinds := make([]Kind, len(snap.Timeline))
+	for i, e := range snap.Timeline {
+		kinds[i] = e.Kind
+	}
+
+	// Successful heartbeats are left out by default.
+	assert.Equal(t, []Kind{
+		KindTopologyOpening,
+		KindServerOpening,
+		KindServerOpening,
+		KindServerChanged,
+		KindTopologyChanged,
+		KindServerChanged,
+		KindTopologyChanged,
+		KindHeartbeatFailed,
+		KindServerChanged,
+		KindTopologyChanged,
+		KindServerChanged,
+		KindTopologyChanged,
+		KindServerClosed,
+		KindServerClosed,
+		KindTopologyClosed,
+	}, kinds)
+
+	assert.Equal(t, Entry{
+		Time:     time.Unix(10, 0),
+		Offset:   10 * time.Second,
+		Kind:     KindHeartbeatFailed,
+		Address:  "a:27017",
+		Duration: 3 * time.Millisecond,
+		Awaited:  true,
+		Error:    "connection refused\nby peer",
+	}, snap.Timeline[7])
+
+	assert.Equal(t, map[string]string{"a:27017": "Unknown", "b:27017": "RSPrimary"}, snap.Timeline[11].Servers)
+	assert.Equal(t, "b:27017", snap.Timeline[11].Primary)
+}
+
+func TestRecorder_Heartbeats(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	rec := New(WithClock(clock.Now), WithHeartbeats(true))
+
+	failover(clock, rec.Monitor(nil))
+
+	var heartbeats []Entry
+
+	for _, e := range rec.Snapshot().Timeline {
+		if e.Kind == KindHeartbeatSucceeded {
+			heartbeats = append(heartbeats, e)
+		}
+	}
+
+	require.Len(t, heartbeats, 4)
+	assert.Equal(t, "a:27017", heartbeats[0].Address)
+	assert.Equal(t, 2*time.Millisecond, heartbeats[0].Duration)
+	assert.True(t, heartbeats[2].Awaited)
+}
+
+func TestRecorder_SnapshotIsACopy(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	rec := New(WithClock(clock.Now))
+
+	failover(clock, rec.Monitor(nil))
+
+	snap := rec.Snapshot()
+	snap.Servers[0].RTTs[0] = 0
+	snap.Servers[0].Transitions[0].To = "Mongos"
+
+	again := rec.Snapshot()
+	assert.Equal(t, 2*time.Millisecond, again.Servers[0].RTTs[0])
+	assert.Equal(t, "RSPrimary", again.Servers[0].Transitions[0].To)
+}
+
+func TestHeartbeatAddress(t *testing.T) {
+	assert.Equal(t, "a:27017", heartbeatAddress("a:27017[-12]"))
+	assert.Equal(t, "[::1]:27017", heartbeatAddress("[::1]:27017[-3]"))
+	assert.Equal(t, "a:27017", heartbeatAddress("a:27017"))
+}
+
+func TestSnapshot_WriteDiagram(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	rec := New(WithClock(clock.Now))
+
+	failover(clock, rec.Monitor(nil))
+
+	var buf bytes.Buffer
+	require.NoError(t, rec.Snapshot().WriteDiagram(&buf))
+
+	want := `topology: Unknown -> ReplicaSetWithPrimary (+5ms) -> ReplicaSetNoPrimary (+10s) -> ReplicaSetWithPrimary (+12s)
+primary:  none -> a:27017 (+5ms) -> none (+10s) -> b:27017 (+12s)
+
+lanes: | unchanged, * changed with the same type, ! heartbeat failed, x closed
+
+OFFSET  TOPOLOGY               a:27017    b:27017      EVENT
++0s     Unknown                                        topology opening
++0s     |                      Unknown                 a:27017 opening
++0s     |                      |          Unknown      b:27017 opening
++5ms    |                      RSPrimary  |            a:27017 Unknown -> RSPrimary, reports primary a:27017
++5ms    ReplicaSetWithPrimary  |          |            topology Unknown -> ReplicaSetWithPrimary, primary a:27017
++10ms   |                      |          RSSecondary  b:27017 Unknown -> RSSecondary, reports primary a:27017
++10ms   *                      |          |            topology changed, primary a:27017
++10s    |                      !          |            a:27017 heartbeat failed after 3ms: connection refused by peer
++10s    |                      Unknown    |            a:27017 RSPrimary -> Unknown
++10s    ReplicaSetNoPrimary    |          |            topology ReplicaSetWithPrimary -> ReplicaSetNoPrimary
++12s    |                      |          RSPrimary    b:27017 RSSecondary -> RSPrimary, reports primary b:27017
++12s    ReplicaSetWithPrimary  |          |            topology ReplicaSetNoPrimary -> ReplicaSetWithPrimary, primary b:27017
++13s    |                      x          |            a:27017 closed
++13s    |                                 x            b:27017 closed
++13s    x                                              topology closed
+
+SERVER   TYPE                TRANSITIONS  HEARTBEATS  FAILED  RTT MIN  RTT P50  RTT P90  RTT MAX  LAST ERROR
+a:27017  Unknown (closed)    2            4           1       2ms      2ms      6ms      6ms      connection refused by peer
+b:27017  RSPrimary (closed)  2            1           0       4ms      4ms      4ms      4ms
+`
+
+	assert.Equal(t, want, buf.String())
+}
+
+func TestSnapshot_JSON(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0).UTC()}
+	rec := New(WithClock(clock.Now))
+
+	failover(clock, rec.Monitor(nil))
+
+	snap := rec.Snapshot()
+
+	var buf bytes.Buffer
+	require.NoError(t, snap.WriteJSON(&buf))
+
+	assert.Contains(t, buf.String(), `"kind": "serverHeartbeatFailed"`)
+	assert.Contains(t, buf.String(), `"offset_ns": 10000000000`)
+
+	got, err := ReadJSON(&buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, snap, got)
+
+	_, err = ReadJSON(bytes.NewBufferString("{"))
+	assert.ErrorContains(t, err, "failed to decode snapshot")
+}
+
+func TestRecorder_Standalone(t *testing.T) {
+	srv := pendingread.NewServer(t)
+	rec := New()
+
+	client, err := mongo.Connect(options.Client().
+		ApplyURI(srv.URI()).
+		SetHeartbeatInterval(500 * time.Millisecond).
+		SetServerMonitor(rec.Monitor(nil)))
+	require.NoError(t, err)
+
+	require.NoError(t, client.Ping(context.Background(), nil))
+
+	snap := rec.Snapshot()
+	assert.Equal(t, "Single", snap.Topology)
+
+	require.Len(t, snap.Servers, 1)
+	assert.Equal(t, "Standalone", snap.Servers[0].Kind)
+	assert.NotEmpty(t, snap.Servers[0].RTTs)
+
+	// Stopping the server makes the next heartbeat fail.
+	srv.Close()
+
+	require.Eventually(t, func() bool {
+		return rec.Snapshot().Servers[0].Failures > 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// Disconnecting ends the session of the ping, which would wait for the
+	// server until the server selection timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	require.NoError(t, client.Disconnect(ctx))
+
+	snap = rec.Snapshot()
+
+	s := snap.Servers[0]
+	assert.True(t, s.Closed)
+	assert.NotEmpty(t, s.LastError)
+	require.GreaterOrEqual(t, len(s.Transitions), 2)
+	assert.Equal(t, Transition{Offset: s.Transitions[0].Offset, From: "Unknown", To: "Standalone"}, s.Transitions[0])
+	assert.Equal(t, "Unknown", s.Transitions[1].To)
+
+	assert.Equal(t, KindTopologyOpening, snap.Timeline[0].Kind)
+	assert.Equal(t, KindTopologyClosed, snap.Timeline[len(snap.Timeline)-1].Kind)
+}
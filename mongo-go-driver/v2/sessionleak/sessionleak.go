@@ -0,0 +1,493 @@
+// Package sessionleak finds sessions that are never ended, the usual cause of
+// TooManyLogicalSessions (code 261) errors.
+//
+// A server session stays in use while an explicit session hasn't been ended
+// or while a cursor holds the implicit session of the operation that created
+// it. The Detector records, from command events, the lsid and stack of every
+// command and the stack of every command that creates a cursor. Ended
+// sessions are told from leaked ones by the lsids back in the client's
+// session pool, so the detector must know the client, see Connect and Watch.
+// Sessions and cursors still open are reported with the stack that last used
+// or opened them:
+//
+//	client, detector, err := sessionleak.Connect(options.Client().ApplyURI(uri))
+//	...
+//	defer detector.Check(t)
+//
+//	sess, err := client.StartSession()
+//	...
+//	defer sess.EndSession(ctx)
+package sessionleak
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/event"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver"
+)
+
+// Kind is what holds a leaked session.
+type Kind string
+
+const (
+	KindSession Kind = "session" // An explicit session that wasn't ended
+	KindCursor  Kind = "cursor"  // A cursor that wasn't exhausted or closed
+)
+
+// Leak is a session still in use.
+type Leak struct {
+	Kind     Kind
+	LSID     string        // Hex of the session UUID, empty if unknown
+	Command  string        // Command that created the cursor
+	CursorID int64         // ID of the cursor
+	Age      time.Duration // Time since the cursor was created or the session last used
+	Stack    string        // Stack that created the cursor or last used the session, without driver frames
+}
+
+func (l Leak) String() string {
+	switch {
+	case l.Kind == KindCursor:
+		return fmt.Sprintf("cursor %d from %s on session %s leaked, open for %s, created at:\n%s",
+			l.CursorID, l.Command, l.LSID, l.Age.Round(time.Millisecond), l.Stack)
+	case l.LSID == "":
+		return "session leaked, never used by a command"
+	}
+
+	return fmt.Sprintf("session %s leaked, last used %s ago at:\n%s", l.LSID, l.Age.Round(time.Millisecond), l.Stack)
+}
+
+const codeTooManyLogicalSessions = 261
+
+// expiredAfter is how long a session can stay unused before the session pool
+// discards it, a minute less than the default logicalSessionTimeoutMinutes of
+// 30. The server has expired such a session whether it was ended or not.
+const expiredAfter = 29 * time.Minute
+
+// cursorCommands are the commands that can create a cursor.
+var cursorCommands = map[string]bool{
+	"find":            true,
+	"aggregate":       true,
+	"listCollections": true,
+	"listIndexes":     true,
+}
+
+type opened struct {
+	lsid  string
+	stack string
+	at    time.Time
+}
+
+type cursor struct {
+	opened
+	command string
+}
+
+// Detector tracks sessions and cursors.
+type Detector struct {
+	mu                     sync.Mutex
+	client                 *mongo.Client     // Client whose session pool is probed, nil if unknown
+	sessions               map[string]opened // Last use of each session by lsid
+	inFlight               map[int64]string  // lsid of commands in flight by request ID
+	pending                map[int64]cursor  // Cursor commands in flight by request ID
+	cursors                map[int64]cursor  // Open cursors by ID
+	getMores               map[int64]int64   // Cursor ID of getMores in flight by request ID
+	lsids                  map[string]bool
+	tooManyLogicalSessions int
+}
+
+// New will return a detector. Its monitor must be installed on the client and
+// the client passed to Watch, see Monitor and Connect.
+func New() *Detector {
+	return &Detector{
+		sessions: map[string]opened{},
+		inFlight: map[int64]string{},
+		pending:  map[int64]cursor{},
+		cursors:  map[int64]cursor{},
+		getMores: map[int64]int64{},
+		lsids:    map[string]bool{},
+	}
+}
+
+// Watch will make the detector report the leaked sessions of client, whose
+// command monitor must be the detector's. Without a client only cursors are
+// reported.
+func (d *Detector) Watch(client *mongo.Client) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.client = client
+}
+
+// Connect will connect a client with the detector's monitor installed,
+// chained with the monitor in opts, if any.
+func Connect(opts ...*options.ClientOptions) (*mongo.Client, *Detector, error) {
+	d := New()
+
+	var next *event.CommandMonitor
+	for _, opt := range opts {
+		if opt != nil && opt.Monitor != nil {
+			next = opt.Monitor
+		}
+	}
+
+	client, err := mongo.Connect(append(opts, options.Client().SetMonitor(d.Monitor(next)))...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d.Watch(client)
+
+	return client, d, nil
+}
+
+// Monitor will return a command monitor that feeds the detector and then
+// calls next, which may be nil.
+func (d *Detector) Monitor(next *event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			d.started(evt)
+
+			if next != nil && next.Started != nil {
+				next.Started(ctx, evt)
+			}
+		},
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			d.succeeded(evt)
+
+			if next != nil && next.Succeeded != nil {
+				next.Succeeded(ctx, evt)
+			}
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			d.failed(evt)
+
+			if next != nil && next.Failed != nil {
+				next.Failed(ctx, evt)
+			}
+		},
+	}
+}
+
+// StartSession will start an explicit session on client. Sessions started
+// with client.StartSession are found from the commands that use them; this
+// also records the stack of a session that is never used.
+func (d *Detector) StartSession(client *mongo.Client, opts ...options.Lister[options.SessionOptions]) (*mongo.Session, error) {
+	sess, err := client.StartSession(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lsid := lsidHex(sess.ID())
+	d.lsids[lsid] = true
+	d.sessions[lsid] = opened{lsid: lsid, stack: callerStack(), at: time.Now()}
+
+	return sess, nil
+}
+
+func (d *Detector) started(evt *event.CommandStartedEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lsidDoc, _ := evt.Command.Lookup("lsid").DocumentOK()
+	lsid := lsidHex(lsidDoc)
+
+	// Monitors run on the goroutine of the operation, so this is the stack of
+	// the code that sent the command.
+	used := opened{lsid: lsid, stack: callerStack(), at: time.Now()}
+
+	if lsid != "" {
+		d.lsids[lsid] = true
+		d.sessions[lsid] = used
+		d.inFlight[evt.RequestID] = lsid
+	}
+
+	switch {
+	case cursorCommands[evt.CommandName]:
+		d.pending[evt.RequestID] = cursor{opened: used, command: evt.CommandName}
+	case evt.CommandName == "getMore":
+		if id, ok := evt.Command.Lookup("getMore").AsInt64OK(); ok {
+			d.getMores[evt.RequestID] = id
+		}
+	case evt.CommandName == "killCursors":
+		ids, _ := evt.Command.Lookup("cursors").Array().Values()
+		for _, id := range ids {
+			if n, ok := id.AsInt64OK(); ok {
+				delete(d.cursors, n)
+			}
+		}
+	}
+}
+
+func (d *Detector) succeeded(evt *event.CommandSucceededEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.inFlight, evt.RequestID)
+
+	id, hasCursor := evt.Reply.Lookup("cursor", "id").AsInt64OK()
+
+	if evt.CommandName == "getMore" {
+		// The reply to a getMore that exhausts its cursor has id 0, so the
+		// cursor has to be found through the request.
+		if id == 0 {
+			delete(d.cursors, d.getMores[evt.RequestID])
+		}
+
+		delete(d.getMores, evt.RequestID)
+
+		return
+	}
+
+	c, ok := d.pending[evt.RequestID]
+	if !ok {
+		return
+	}
+
+	delete(d.pending, evt.RequestID)
+
+	if hasCursor && id != 0 {
+		d.cursors[id] = c
+	}
+}
+
+func (d *Detector) failed(evt *event.CommandFailedEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.pending, evt.RequestID)
+
+	// The pool discards a session that saw a network error instead of taking
+	// it back, so it won't be found there.
+	if lsid, ok := d.inFlight[evt.RequestID]; ok && mongo.IsNetworkError(evt.Failure) {
+		delete(d.sessions, lsid)
+	}
+
+	delete(d.inFlight, evt.RequestID)
+
+	if IsTooManyLogicalSessions(evt.Failure) {
+		d.tooManyLogicalSessions++
+	}
+
+	// The driver closes a cursor whose getMore failed.
+	if evt.CommandName == "getMore" {
+		delete(d.cursors, d.getMores[evt.RequestID])
+		delete(d.getMores, evt.RequestID)
+	}
+}
+
+// Leaks will return the sessions and cursors still open, oldest first. It is
+// meant to be called once the operations on the client are done, before or
+// after disconnecting it; an operation in progress may be reported as a leak.
+func (d *Detector) Leaks() []Leak {
+	d.mu.Lock()
+	client := d.client
+	d.mu.Unlock()
+
+	var (
+		pooled     map[string]bool
+		inProgress int
+	)
+
+	if client != nil {
+		pooled = pooledSessions(client)
+		inProgress = client.NumberSessionsInProgress()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+
+	var leaks []Leak
+
+	// Sessions held by a command in flight or an open cursor are in use.
+	inUse := map[string]bool{}
+	for _, lsid := range d.inFlight {
+		inUse[lsid] = true
+	}
+
+	for id, c := range d.cursors {
+		inUse[c.lsid] = true
+
+		leaks = append(leaks, Leak{
+			Kind:     KindCursor,
+			LSID:     c.lsid,
+			Command:  c.command,
+			CursorID: id,
+			Age:      now.Sub(c.at),
+			Stack:    c.stack,
+		})
+	}
+
+	if client != nil {
+		for lsid, o := range d.sessions {
+			if pooled[lsid] || inUse[lsid] || now.Sub(o.at) >= expiredAfter {
+				continue
+			}
+
+			inUse[lsid] = true
+
+			leaks = append(leaks, Leak{Kind: KindSession, LSID: lsid, Age: now.Sub(o.at), Stack: o.stack})
+		}
+
+		// Sessions checked out but never used by a command can only be
+		// counted.
+		delete(inUse, "")
+
+		for i := len(inUse); i < inProgress; i++ {
+			leaks = append(leaks, Leak{Kind: KindSession})
+		}
+	}
+
+	sort.SliceStable(leaks, func(i, j int) bool { return leaks[i].Age > leaks[j].Age })
+
+	return leaks
+}
+
+// pooledSessions will return the lsids of the sessions in the session pool of
+// client. The pool hands out its most recently returned session first and
+// creates one once it is empty, so sessions are checked out until a new one
+// is created, then returned in reverse to keep their order.
+func pooledSessions(client *mongo.Client) map[string]bool {
+	start := time.Now()
+	pooled := map[string]bool{}
+
+	var checkedOut []*mongo.Session
+
+	for {
+		sess, err := client.StartSession()
+		if err != nil {
+			break
+		}
+
+		checkedOut = append(checkedOut, sess)
+
+		// A new session is created in use. Mark it dirty so that the pool
+		// discards it rather than grow on every probe.
+		if server := sess.ClientSession().Server; !server.LastUsed.Before(start) {
+			server.MarkDirty()
+
+			break
+		}
+
+		pooled[lsidHex(sess.ID())] = true
+	}
+
+	for i := len(checkedOut) - 1; i >= 0; i-- {
+		checkedOut[i].EndSession(context.Background())
+	}
+
+	return pooled
+}
+
+// Check will fail t with one error per leak.
+func (d *Detector) Check(t testing.TB) {
+	t.Helper()
+
+	for _, leak := range d.Leaks() {
+		t.Errorf("%s", leak)
+	}
+}
+
+// SessionIDs will return the hex of every lsid seen, the v2 equivalent of the
+// metrics runner's SessionIDSet.
+func (d *Detector) SessionIDs() map[string]bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ids := make(map[string]bool, len(d.lsids))
+	for id := range d.lsids {
+		ids[id] = true
+	}
+
+	return ids
+}
+
+// TooManyLogicalSessions will return the number of commands that failed with
+// TooManyLogicalSessions.
+func (d *Detector) TooManyLogicalSessions() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.tooManyLogicalSessions
+}
+
+// IsTooManyLogicalSessions reports whether err is a TooManyLogicalSessions
+// server error, either returned by an operation or the failure of a command
+// event.
+func IsTooManyLogicalSessions(err error) bool {
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.HasErrorCode(codeTooManyLogicalSessions)
+	}
+
+	var driverErr driver.Error
+
+	return errors.As(err, &driverErr) && driverErr.Code == codeTooManyLogicalSessions
+}
+
+// lsidHex will return the hex of the UUID of an lsid document, {id: UUID}.
+func lsidHex(lsid bson.Raw) string {
+	_, data, ok := lsid.Lookup("id").BinaryOK()
+	if !ok {
+		return ""
+	}
+
+	return hex.EncodeToString(data)
+}
+
+// ignoredFrames are the packages whose frames are dropped from stacks, so
+// that they start at the caller of the driver.
+var ignoredFrames = []string{
+	"go.mongodb.org/mongo-driver/",
+	"github.com/prestonvasquez/mongo-go-driver/v2/sessionleak.",
+	"runtime.",
+}
+
+func callerStack() string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var sb strings.Builder
+
+	for {
+		frame, more := frames.Next()
+
+		if !ignored(frame.Function) {
+			fmt.Fprintf(&sb, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	return sb.String()
+}
+
+func ignored(function string) bool {
+	for _, prefix := range ignoredFrames {
+		if strings.HasPrefix(function, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
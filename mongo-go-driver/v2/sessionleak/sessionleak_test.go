@@ -0,0 +1,287 @@
+package sessionleak_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/mockdeploy"
+	"github.com/prestonvasquez/mongo-go-driver/v2/sessionleak"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/event"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// recordingT captures failures instead of failing the test.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (rt *recordingT) Helper() {}
+
+func (rt *recordingT) Errorf(format string, args ...any) {
+	rt.errors = append(rt.errors, fmt.Sprintf(format, args...))
+}
+
+func newClient(t *testing.T) (*mockdeploy.Deployment, *mongo.Client, *sessionleak.Detector) {
+	t.Helper()
+
+	d := mockdeploy.New(t)
+	d.On("killCursors").Reply(mockdeploy.OK()).Repeat()
+
+	detector := sessionleak.New()
+
+	client, err := d.NewClient(options.Client().SetMonitor(detector.Monitor(nil)))
+	require.NoError(t, err)
+
+	detector.Watch(client)
+
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+
+	return d, client, detector
+}
+
+func leakySession(detector *sessionleak.Detector, client *mongo.Client) (*mongo.Session, error) {
+	return detector.StartSession(client)
+}
+
+func TestDetector_ExplicitSession(t *testing.T) {
+	_, client, detector := newClient(t)
+
+	sess, err := leakySession(detector, client)
+	require.NoError(t, err)
+
+	leaks := detector.Leaks()
+	require.Len(t, leaks, 1)
+
+	assert.Equal(t, sessionleak.KindSession, leaks[0].Kind)
+	assert.Len(t, leaks[0].LSID, 32)
+	assert.Contains(t, leaks[0].Stack, "sessionleak_test.leakySession", "the stack must start at the caller")
+	assert.NotContains(t, leaks[0].Stack, "go.mongodb.org/mongo-driver")
+
+	sess.EndSession(context.Background())
+
+	assert.Empty(t, detector.Leaks())
+}
+
+func insertWith(sess *mongo.Session, coll *mongo.Collection) error {
+	_, err := coll.InsertOne(mongo.NewSessionContext(context.Background(), sess), bson.D{})
+
+	return err
+}
+
+func TestDetector_UnendedSession(t *testing.T) {
+	d, client, detector := newClient(t)
+
+	d.On("insert").Reply(mockdeploy.Inserted(1)).Repeat()
+
+	coll := client.Database("db").Collection("coll")
+
+	sess, err := client.StartSession()
+	require.NoError(t, err)
+
+	require.NoError(t, insertWith(sess, coll))
+
+	leaks := detector.Leaks()
+	require.Len(t, leaks, 1)
+
+	assert.Equal(t, sessionleak.KindSession, leaks[0].Kind)
+	assert.Equal(t, detector.SessionIDs(), map[string]bool{leaks[0].LSID: true})
+	assert.Contains(t, leaks[0].Stack, "sessionleak_test.insertWith", "the stack must be the session's last use")
+
+	sess.EndSession(context.Background())
+
+	assert.Empty(t, detector.Leaks())
+}
+
+func TestDetector_DeferredEndSession(t *testing.T) {
+	d, client, detector := newClient(t)
+
+	d.On("insert").Reply(mockdeploy.Inserted(1)).Repeat()
+
+	coll := client.Database("db").Collection("coll")
+
+	for i := 0; i < 3; i++ {
+		func() {
+			sess, err := client.StartSession()
+			require.NoError(t, err)
+
+			defer sess.EndSession(context.Background())
+
+			require.NoError(t, insertWith(sess, coll))
+		}()
+
+		_, err := coll.InsertOne(context.Background(), bson.D{})
+		require.NoError(t, err)
+	}
+
+	assert.Empty(t, detector.Leaks())
+	assert.Empty(t, detector.Leaks(), "probing the session pool must not change it")
+	assert.Equal(t, 0, client.NumberSessionsInProgress())
+}
+
+func TestDetector_UnusedSession(t *testing.T) {
+	_, client, detector := newClient(t)
+
+	sess, err := client.StartSession()
+	require.NoError(t, err)
+
+	leaks := detector.Leaks()
+	require.Len(t, leaks, 1)
+
+	assert.Equal(t, sessionleak.KindSession, leaks[0].Kind)
+	assert.Empty(t, leaks[0].LSID, "a session never used by a command can only be counted")
+
+	sess.EndSession(context.Background())
+
+	assert.Empty(t, detector.Leaks())
+}
+
+func TestDetector_EndSessionConcurrently(t *testing.T) {
+	d, client, detector := newClient(t)
+
+	d.On("insert").Reply(mockdeploy.Inserted(1)).Repeat()
+
+	coll := client.Database("db").Collection("coll")
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		sess, err := client.StartSession()
+		require.NoError(t, err)
+
+		require.NoError(t, insertWith(sess, coll))
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			sess.EndSession(context.Background())
+		}()
+	}
+
+	// Run with -race: checking for leaks while sessions are ended must not
+	// read state the driver writes without synchronization.
+	for i := 0; i < 8; i++ {
+		_ = detector.Leaks()
+	}
+
+	wg.Wait()
+
+	assert.Empty(t, detector.Leaks())
+}
+
+func openCursor(coll *mongo.Collection) (*mongo.Cursor, error) {
+	return coll.Find(context.Background(), bson.D{})
+}
+
+func TestDetector_Cursor(t *testing.T) {
+	d, client, detector := newClient(t)
+
+	coll := client.Database("db").Collection("coll")
+
+	d.On("find").Reply(mockdeploy.Cursor("db.coll", 7, bson.D{{Key: "_id", Value: 1}}))
+
+	cursor, err := openCursor(coll)
+	require.NoError(t, err)
+
+	leaks := detector.Leaks()
+	require.Len(t, leaks, 1)
+
+	assert.Equal(t, sessionleak.KindCursor, leaks[0].Kind)
+	assert.Equal(t, "find", leaks[0].Command)
+	assert.Equal(t, int64(7), leaks[0].CursorID)
+	assert.Contains(t, leaks[0].Stack, "sessionleak_test.openCursor")
+	assert.True(t, detector.SessionIDs()[leaks[0].LSID], "the cursor's implicit session must be seen")
+
+	require.NoError(t, cursor.Close(context.Background()))
+
+	assert.Empty(t, detector.Leaks())
+}
+
+func TestDetector_CursorExhausted(t *testing.T) {
+	d, client, detector := newClient(t)
+
+	coll := client.Database("db").Collection("coll")
+
+	d.On("find").Reply(mockdeploy.Cursor("db.coll", 7, bson.D{{Key: "_id", Value: 1}}))
+	d.On("getMore").Reply(mockdeploy.NextBatch("db.coll", 0, bson.D{{Key: "_id", Value: 2}}))
+
+	cursor, err := openCursor(coll)
+	require.NoError(t, err)
+
+	var docs []bson.D
+	require.NoError(t, cursor.All(context.Background(), &docs))
+
+	assert.Empty(t, detector.Leaks())
+	assert.Empty(t, d.CommandsNamed("killCursors"))
+}
+
+func TestDetector_SingleBatchCursor(t *testing.T) {
+	d, client, detector := newClient(t)
+
+	d.On("find").Reply(mockdeploy.Cursor("db.coll", 0, bson.D{{Key: "_id", Value: 1}}))
+
+	_, err := openCursor(client.Database("db").Collection("coll"))
+	require.NoError(t, err)
+
+	assert.Empty(t, detector.Leaks(), "a cursor with id 0 holds no session")
+}
+
+func TestDetector_Check(t *testing.T) {
+	_, client, detector := newClient(t)
+
+	_, err := leakySession(detector, client)
+	require.NoError(t, err)
+
+	rt := &recordingT{TB: t}
+	detector.Check(rt)
+
+	require.Len(t, rt.errors, 1)
+	assert.Contains(t, rt.errors[0], "leaked")
+	assert.Contains(t, rt.errors[0], "sessionleak_test.leakySession")
+}
+
+func TestDetector_TooManyLogicalSessions(t *testing.T) {
+	d, client, detector := newClient(t)
+
+	d.On("insert").Reply(mockdeploy.Error(261, "TooManyLogicalSessions", "too many sessions"))
+
+	_, err := client.Database("db").Collection("coll").InsertOne(context.Background(), bson.D{})
+	require.Error(t, err)
+
+	assert.True(t, sessionleak.IsTooManyLogicalSessions(err))
+	assert.Equal(t, 1, detector.TooManyLogicalSessions())
+}
+
+func TestDetector_ChainsMonitor(t *testing.T) {
+	d := mockdeploy.New(t)
+	d.On("insert").Reply(mockdeploy.Inserted(1))
+
+	var started []string
+
+	next := &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			started = append(started, evt.CommandName)
+		},
+	}
+
+	detector := sessionleak.New()
+
+	client, err := d.NewClient(options.Client().SetMonitor(detector.Monitor(next)))
+	require.NoError(t, err)
+
+	defer func() { _ = client.Disconnect(context.Background()) }()
+
+	_, err = client.Database("db").Collection("coll").InsertOne(context.Background(), bson.D{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"insert"}, started)
+	assert.Len(t, detector.SessionIDs(), 1)
+}
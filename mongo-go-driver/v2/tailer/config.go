@@ -0,0 +1,98 @@
+package tailer
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Config is the configuration for a Follower.
+type Config struct {
+	filter       any           // Filter applied to every query, nil for all documents
+	field        string        // Increasing field used to resume, "_id" by default
+	start        bson.RawValue // Resume after this value of field on the first query
+	maxAwaitTime time.Duration // maxTimeMS of awaitData getMores
+	batchSize    int32         // Batch size of the cursor, 0 for the server default
+	minBackoff   time.Duration // First wait before re-querying a dead cursor
+	maxBackoff   time.Duration // Longest wait before re-querying a dead cursor
+	onRestart    func(error)   // Called each time the cursor is re-created
+}
+
+type ConfigOpt func(*Config)
+
+// WithFilter restricts the documents followed. It is combined with the resume
+// condition using $and.
+func WithFilter(filter any) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.filter = filter
+	}
+}
+
+// WithResumeField sets the field used to resume after the last document seen,
+// e.g. a timestamp. Its values must increase in insertion order, which holds
+// for ObjectID _id values generated by a single client and for fields set with
+// $currentDate. The default is "_id".
+func WithResumeField(field string) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.field = field
+	}
+}
+
+// WithStartAfter makes the follower skip documents up to and including the
+// one whose resume field is val, e.g. the last value processed before a
+// restart of the application.
+func WithStartAfter(val bson.RawValue) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.start = val
+	}
+}
+
+// WithMaxAwaitTime sets how long the server waits for new documents before
+// replying to a getMore with an empty batch. It is lowered for a getMore that
+// would otherwise outlive the deadline of the context. The default is 1s.
+func WithMaxAwaitTime(d time.Duration) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.maxAwaitTime = d
+	}
+}
+
+// WithBatchSize sets the batch size of the cursor.
+func WithBatchSize(n int32) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.batchSize = n
+	}
+}
+
+// WithBackoff sets the waits between attempts to re-create a dead cursor. The
+// wait starts at minimum, doubles on each attempt that yields no documents and
+// is capped at maximum. The defaults are 100ms and 5s.
+func WithBackoff(minimum, maximum time.Duration) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.minBackoff = minimum
+		cfg.maxBackoff = maximum
+	}
+}
+
+// WithRestartHook sets a function called before the cursor is re-created,
+// with the error that killed it, or nil when the server closed it, e.g.
+// because the collection was empty.
+func WithRestartHook(fn func(err error)) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.onRestart = fn
+	}
+}
+
+func newConfig(opts ...ConfigOpt) Config {
+	cfg := Config{
+		field:        "_id",
+		maxAwaitTime: time.Second,
+		minBackoff:   100 * time.Millisecond,
+		maxBackoff:   5 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return cfg
+}
@@ -0,0 +1,253 @@
+// Package tailer follows a capped collection with a tailable awaitData cursor
+// and keeps following it when the cursor dies.
+//
+// A tailable cursor is closed by the server when the collection is empty, when
+// the cursor falls behind and its position is overwritten, or when a node
+// steps down, and the driver reports the last two as cursor errors. A Follower
+// re-creates the cursor after a backoff, resuming after the last document it
+// delivered, and only returns on a non-resumable error, an error from the
+// handler or when its context is done.
+//
+// Documents are delivered one at a time and the next getMore is only sent
+// once the handler returns, so a slow consumer slows down the follower rather
+// than buffering documents in memory.
+package tailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Follower tails a capped collection.
+type Follower struct {
+	coll *mongo.Collection
+	cfg  Config
+
+	mu   sync.Mutex
+	last bson.RawValue // Resume field of the last document delivered
+}
+
+// New will return a follower for a capped collection.
+func New(coll *mongo.Collection, opts ...ConfigOpt) *Follower {
+	cfg := newConfig(opts...)
+
+	return &Follower{coll: coll, cfg: cfg, last: cfg.start}
+}
+
+// LastSeen will return the resume field of the last document delivered, or
+// the WithStartAfter value if none has been delivered yet.
+func (f *Follower) LastSeen() bson.RawValue {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.last
+}
+
+// Run will call fn with each document, in insertion order, until ctx is done,
+// fn returns an error or the cursor fails with a non-resumable error, and
+// return that error. Errors from fn are returned as they are.
+func (f *Follower) Run(ctx context.Context, fn func(ctx context.Context, doc bson.Raw) error) error {
+	backoff := f.cfg.minBackoff
+
+	for {
+		delivered, err := f.tail(ctx, fn)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var herr handlerError
+		if errors.As(err, &herr) {
+			return herr.err
+		}
+
+		if err != nil && !resumable(err) {
+			return err
+		}
+
+		if delivered > 0 {
+			backoff = f.cfg.minBackoff
+		}
+
+		if f.cfg.onRestart != nil {
+			f.cfg.onRestart(err)
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		backoff = min(2*backoff, f.cfg.maxBackoff)
+	}
+}
+
+// Stream will run the follower in a new goroutine and send the documents on
+// the returned channel, which is closed when Run returns; wait then returns
+// its error. The channel is unbuffered, so the follower only reads ahead by
+// the batch it already holds. Callers that stop reading must cancel ctx.
+func (f *Follower) Stream(ctx context.Context) (docs <-chan bson.Raw, wait func() error) {
+	ch := make(chan bson.Raw)
+	done := make(chan struct{})
+
+	var runErr error
+
+	go func() {
+		defer close(done)
+		defer close(ch)
+
+		runErr = f.Run(ctx, func(ctx context.Context, doc bson.Raw) error {
+			select {
+			case ch <- doc:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	return ch, func() error {
+		<-done
+
+		return runErr
+	}
+}
+
+// handlerError marks errors returned by the handler, which are never retried.
+type handlerError struct {
+	err error
+}
+
+func (e handlerError) Error() string { return e.err.Error() }
+
+// tail will follow a single cursor until it dies and return the number of
+// documents delivered. A nil error means the server closed the cursor.
+func (f *Follower) tail(ctx context.Context, fn func(context.Context, bson.Raw) error) (int, error) {
+	opts := options.Find().
+		SetCursorType(options.TailableAwait).
+		SetMaxAwaitTime(f.cfg.maxAwaitTime)
+
+	if f.cfg.batchSize > 0 {
+		opts.SetBatchSize(f.cfg.batchSize)
+	}
+
+	cursor, err := f.coll.Find(ctx, f.filter(), opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create tailable cursor: %w", err)
+	}
+
+	defer cursor.Close(context.WithoutCancel(ctx))
+
+	delivered := 0
+
+	for {
+		cursor.SetMaxAwaitTime(f.awaitTime(ctx))
+
+		// TryNext sends at most one getMore, so an empty batch returns control
+		// here instead of blocking in Next until a document arrives.
+		if !cursor.TryNext(ctx) {
+			if err := cursor.Err(); err != nil {
+				return delivered, fmt.Errorf("failed to tail cursor: %w", err)
+			}
+
+			if cursor.ID() == 0 {
+				return delivered, nil
+			}
+
+			continue
+		}
+
+		doc := append(bson.Raw(nil), cursor.Current...)
+
+		val, err := doc.LookupErr(f.cfg.field)
+		if err != nil {
+			return delivered, fmt.Errorf("document has no resume field %q: %w", f.cfg.field, err)
+		}
+
+		if err := fn(ctx, doc); err != nil {
+			return delivered, handlerError{err: err}
+		}
+
+		f.mu.Lock()
+		f.last = val
+		f.mu.Unlock()
+
+		delivered++
+	}
+}
+
+// filter will return the query filter, resuming after the last document
+// delivered.
+func (f *Follower) filter() any {
+	last := f.LastSeen()
+	if last.Type == 0 {
+		if f.cfg.filter == nil {
+			return bson.D{}
+		}
+
+		return f.cfg.filter
+	}
+
+	resume := bson.D{{Key: f.cfg.field, Value: bson.D{{Key: "$gt", Value: last}}}}
+	if f.cfg.filter == nil {
+		return resume
+	}
+
+	return bson.D{{Key: "$and", Value: bson.A{f.cfg.filter, resume}}}
+}
+
+// awaitTime will return the maxAwaitTime for the next getMore. When ctx has
+// a deadline the server must reply before it, otherwise the driver times out
+// the read and closes the connection instead of receiving an empty batch, so
+// the wait is capped at half of the time left.
+func (f *Follower) awaitTime(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return f.cfg.maxAwaitTime
+	}
+
+	// A zero maxAwaitTime omits maxTimeMS and the server waits for 1s.
+	return max(min(f.cfg.maxAwaitTime, time.Until(deadline)/2), time.Millisecond)
+}
+
+// resumableCodes are the server error codes after which re-creating the
+// cursor can succeed.
+var resumableCodes = []int{
+	43,    // CursorNotFound
+	91,    // ShutdownInProgress
+	136,   // CappedPositionLost
+	175,   // QueryPlanKilled
+	189,   // PrimarySteppedDown
+	237,   // CursorKilled
+	10107, // NotWritablePrimary
+	11600, // InterruptedAtShutdown
+	11602, // InterruptedDueToReplStateChange
+	13435, // NotPrimaryNoSecondaryOk
+	13436, // NotPrimaryOrSecondary
+}
+
+func resumable(err error) bool {
+	if mongo.IsNetworkError(err) {
+		return true
+	}
+
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+
+	for _, code := range resumableCodes {
+		if serverErr.HasErrorCode(code) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,218 @@
+package tailer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/mockdeploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var errStop = errors.New("stop")
+
+func newFollower(t *testing.T, opts ...ConfigOpt) (*mockdeploy.Deployment, *Follower) {
+	t.Helper()
+
+	d := mockdeploy.New(t)
+	d.On("killCursors").Reply(mockdeploy.OK()).Repeat()
+
+	client, err := d.NewClient()
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+
+	opts = append([]ConfigOpt{WithBackoff(time.Millisecond, 10*time.Millisecond)}, opts...)
+
+	return d, New(client.Database("db").Collection("capped"), opts...)
+}
+
+func doc(id int32) bson.D {
+	return bson.D{{Key: "_id", Value: id}}
+}
+
+func rawValue(t *testing.T, v any) bson.RawValue {
+	t.Helper()
+
+	typ, data, err := bson.MarshalValue(v)
+	require.NoError(t, err)
+
+	return bson.RawValue{Type: typ, Value: data}
+}
+
+// collect will return a handler that records the _id of each document and
+// stops the follower once it has seen n.
+func collect(n int) (func(context.Context, bson.Raw) error, *[]int32) {
+	var ids []int32
+
+	return func(_ context.Context, doc bson.Raw) error {
+		ids = append(ids, doc.Lookup("_id").Int32())
+		if len(ids) == n {
+			return errStop
+		}
+
+		return nil
+	}, &ids
+}
+
+func TestRun_ResumesAfterDeadCursor(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		restarts []error
+	)
+
+	d, f := newFollower(t, WithRestartHook(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		restarts = append(restarts, err)
+	}))
+
+	d.On("find").Where(mockdeploy.Exists("tailable"), mockdeploy.Exists("awaitData")).
+		Reply(mockdeploy.Cursor("db.capped", 7, doc(1), doc(2)))
+	d.On("getMore").Reply(mockdeploy.Error(136, "CappedPositionLost", "position lost"))
+	d.On("find").Where(mockdeploy.Filter("_id.$gt", 2)).Reply(mockdeploy.Cursor("db.capped", 0))
+	d.On("find").Where(mockdeploy.Filter("_id.$gt", 2)).Reply(mockdeploy.Cursor("db.capped", 0, doc(3)))
+
+	handler, ids := collect(3)
+
+	err := f.Run(context.Background(), handler)
+	require.ErrorIs(t, err, errStop)
+
+	assert.Equal(t, []int32{1, 2, 3}, *ids)
+	assert.Equal(t, int32(2), f.LastSeen().Int32(), "the document the handler failed on isn't seen")
+
+	require.Len(t, restarts, 2)
+
+	var cmdErr mongo.CommandError
+	require.ErrorAs(t, restarts[0], &cmdErr)
+	assert.Equal(t, int32(136), cmdErr.Code)
+	assert.NoError(t, restarts[1], "an empty collection closes the cursor without an error")
+
+	d.Verify()
+}
+
+func TestRun_EmptyBatchesKeepCursor(t *testing.T) {
+	d, f := newFollower(t)
+
+	d.On("find").Reply(mockdeploy.Cursor("db.capped", 7))
+	d.On("getMore").Reply(
+		mockdeploy.NextBatch("db.capped", 7),
+		mockdeploy.NextBatch("db.capped", 7),
+		mockdeploy.NextBatch("db.capped", 7, doc(1)),
+	)
+
+	handler, ids := collect(1)
+
+	require.ErrorIs(t, f.Run(context.Background(), handler), errStop)
+
+	assert.Equal(t, []int32{1}, *ids)
+	assert.Len(t, d.CommandsNamed("find"), 1)
+	assert.Len(t, d.CommandsNamed("getMore"), 3)
+}
+
+func TestRun_NonResumableError(t *testing.T) {
+	d, f := newFollower(t)
+
+	d.On("find").Reply(mockdeploy.Error(2, "BadValue", "error processing query: tailable cursor requested on non capped collection"))
+
+	err := f.Run(context.Background(), func(context.Context, bson.Raw) error { return nil })
+
+	var cmdErr mongo.CommandError
+	require.ErrorAs(t, err, &cmdErr)
+	assert.Equal(t, int32(2), cmdErr.Code)
+	assert.Len(t, d.CommandsNamed("find"), 1)
+}
+
+func TestRun_MissingResumeField(t *testing.T) {
+	d, f := newFollower(t, WithResumeField("ts"))
+
+	d.On("find").Reply(mockdeploy.Cursor("db.capped", 0, doc(1)))
+
+	err := f.Run(context.Background(), func(context.Context, bson.Raw) error { return nil })
+	assert.ErrorContains(t, err, `document has no resume field "ts"`)
+}
+
+func TestRun_FilterAndStartAfter(t *testing.T) {
+	d, f := newFollower(t,
+		WithFilter(bson.D{{Key: "level", Value: "error"}}),
+		WithStartAfter(rawValue(t, int32(5))),
+	)
+
+	d.On("find").Where(
+		mockdeploy.Filter("$and.0.level", "error"),
+		mockdeploy.Filter("$and.1._id.$gt", 5),
+	).Reply(mockdeploy.Cursor("db.capped", 0, doc(6)))
+
+	handler, ids := collect(1)
+
+	require.ErrorIs(t, f.Run(context.Background(), handler), errStop)
+	assert.Equal(t, []int32{6}, *ids)
+}
+
+func TestRun_MaxAwaitTimeBeforeDeadline(t *testing.T) {
+	d, f := newFollower(t, WithMaxAwaitTime(10*time.Second))
+
+	d.On("find").Reply(mockdeploy.Cursor("db.capped", 7))
+	d.On("getMore").Reply(mockdeploy.NextBatch("db.capped", 7)).Repeat()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	err := f.Run(ctx, func(context.Context, bson.Raw) error { return nil })
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	getMores := d.CommandsNamed("getMore")
+	require.NotEmpty(t, getMores)
+
+	maxTimeMS := getMores[0].Document.Lookup("maxTimeMS").Int64()
+	assert.Positive(t, maxTimeMS)
+	assert.LessOrEqual(t, maxTimeMS, int64(100))
+}
+
+func TestAwaitTime(t *testing.T) {
+	f := New(nil, WithMaxAwaitTime(time.Second))
+
+	assert.Equal(t, time.Second, f.awaitTime(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	assert.Equal(t, time.Second, f.awaitTime(ctx))
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	assert.Equal(t, time.Millisecond, f.awaitTime(ctx), "an expired deadline must not omit maxTimeMS")
+}
+
+func TestStream(t *testing.T) {
+	d, f := newFollower(t)
+
+	d.On("find").Reply(mockdeploy.Cursor("db.capped", 7, doc(1), doc(2), doc(3)))
+	d.On("getMore").Reply(mockdeploy.NextBatch("db.capped", 7)).Repeat()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	docs, wait := f.Stream(ctx)
+
+	assert.Equal(t, int32(1), (<-docs).Lookup("_id").Int32())
+	assert.Equal(t, int32(2), (<-docs).Lookup("_id").Int32())
+
+	// The third document is held until it is received, so nothing past the
+	// first batch is fetched.
+	assert.Empty(t, d.CommandsNamed("getMore"))
+
+	cancel()
+
+	for range docs {
+	}
+
+	assert.ErrorIs(t, wait(), context.Canceled)
+}
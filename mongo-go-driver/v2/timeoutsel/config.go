@@ -0,0 +1,72 @@
+package timeoutsel
+
+import (
+	"time"
+)
+
+// Config is the configuration for profiling and recommending timeouts.
+type Config struct {
+	samples     int           // Measured runs of the operation
+	warmup      int           // Runs discarded before measuring
+	concurrency int           // Goroutines running the operation, i.e. the load
+	headroom    float64       // Factor applied to the latency at the target
+	granularity time.Duration // Timeouts are rounded up to a multiple of this
+}
+
+type ConfigOpt func(*Config)
+
+// WithSamples sets the number of measured runs of the operation. The default
+// is 100.
+func WithSamples(n int) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.samples = n
+	}
+}
+
+// WithWarmup sets the number of runs discarded before measuring, e.g. to fill
+// the connection pool. The default is 0.
+func WithWarmup(n int) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.warmup = n
+	}
+}
+
+// WithConcurrency sets the number of goroutines running the operation while
+// profiling, so that the latencies reflect that load. The default is 1.
+func WithConcurrency(n int) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.concurrency = n
+	}
+}
+
+// WithHeadroom sets the factor the latency at the target success rate is
+// multiplied by to get the timeout, e.g. 1.5 for 50% headroom. The default is
+// 1, which makes the timeout the latency at the target.
+func WithHeadroom(f float64) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.headroom = f
+	}
+}
+
+// WithGranularity sets the unit recommended durations are rounded up to. The
+// default is 1ms, the unit of timeoutMS.
+func WithGranularity(d time.Duration) ConfigOpt {
+	return func(cfg *Config) {
+		cfg.granularity = d
+	}
+}
+
+func newConfig(opts ...ConfigOpt) Config {
+	cfg := Config{
+		samples:     100,
+		concurrency: 1,
+		headroom:    1,
+		granularity: time.Millisecond,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return cfg
+}
@@ -0,0 +1,144 @@
+package timeoutsel
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Profile is the latency distribution of an operation.
+type Profile struct {
+	samples []time.Duration // Sorted
+}
+
+// NewProfile will return the profile of the given latencies.
+func NewProfile(samples []time.Duration) Profile {
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return Profile{samples: sorted}
+}
+
+// Measure will run op warmup plus samples times from the configured number of
+// goroutines and return the profile of the measured runs. It stops at the
+// first error returned by op, so op should swallow expected errors such as
+// mongo.ErrNoDocuments.
+func Measure(ctx context.Context, op func(ctx context.Context) error, opts ...ConfigOpt) (Profile, error) {
+	cfg := newConfig(opts...)
+
+	if cfg.samples <= 0 {
+		return Profile{}, fmt.Errorf("invalid number of samples %d", cfg.samples)
+	}
+
+	var (
+		next     atomic.Int64
+		mu       sync.Mutex
+		samples  = make([]time.Duration, 0, cfg.samples)
+		errOnce  sync.Once
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	total := cfg.warmup + cfg.samples
+
+	for g := 0; g < max(cfg.concurrency, 1); g++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= total || ctx.Err() != nil {
+					return
+				}
+
+				start := time.Now()
+
+				if err := op(ctx); err != nil {
+					errOnce.Do(func() { firstErr = err })
+					next.Store(int64(total))
+
+					return
+				}
+
+				if i < cfg.warmup {
+					continue
+				}
+
+				elapsed := time.Since(start)
+
+				mu.Lock()
+				samples = append(samples, elapsed)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return Profile{}, fmt.Errorf("failed to run operation: %w", firstErr)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return Profile{}, err
+	}
+
+	return NewProfile(samples), nil
+}
+
+// Len will return the number of samples.
+func (p Profile) Len() int { return len(p.samples) }
+
+// Min will return the lowest latency.
+func (p Profile) Min() time.Duration { return p.Quantile(0) }
+
+// Max will return the highest latency.
+func (p Profile) Max() time.Duration { return p.Quantile(1) }
+
+// Median will return the median latency.
+func (p Profile) Median() time.Duration { return p.Quantile(0.5) }
+
+// Mean will return the mean latency.
+func (p Profile) Mean() time.Duration {
+	if len(p.samples) == 0 {
+		return 0
+	}
+
+	var sum time.Duration
+	for _, s := range p.samples {
+		sum += s
+	}
+
+	return sum / time.Duration(len(p.samples))
+}
+
+// Quantile will return the q-quantile of the latencies using the nearest
+// rank: the lowest latency at least a fraction q of the samples don't exceed.
+// 0 is the minimum and 1 the maximum.
+func (p Profile) Quantile(q float64) time.Duration {
+	if len(p.samples) == 0 {
+		return 0
+	}
+
+	i := int(math.Ceil(q*float64(len(p.samples)))) - 1
+
+	return p.samples[min(max(i, 0), len(p.samples)-1)]
+}
+
+// SuccessRate will return the fraction of samples that completed within
+// timeout, the expected success rate of the operation with that timeout.
+func (p Profile) SuccessRate(timeout time.Duration) float64 {
+	if len(p.samples) == 0 {
+		return 0
+	}
+
+	n := sort.Search(len(p.samples), func(i int) bool { return p.samples[i] > timeout })
+
+	return float64(n) / float64(len(p.samples))
+}
@@ -0,0 +1,152 @@
+// Package timeoutsel recommends timeouts from the measured latency of an
+// operation, the way the CSOT experiments pick them by hand: profile the
+// operation under the current load, take the latency at the percentile
+// matching the target success rate as timeoutMS, and derive the cursor await
+// time and failpoint block times from it.
+//
+//	profile, err := timeoutsel.Measure(ctx, func(ctx context.Context) error {
+//		err := coll.FindOne(ctx, filter).Err()
+//		if errors.Is(err, mongo.ErrNoDocuments) {
+//			return nil
+//		}
+//
+//		return err
+//	}, timeoutsel.WithConcurrency(10))
+//	...
+//	rec, err := timeoutsel.Recommend(profile, 0.99, timeoutsel.WithHeadroom(1.2))
+//	...
+//	ctx, cancel := context.WithTimeout(ctx, rec.Timeout)
+package timeoutsel
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Ratios of the cursor durations to the timeout, from
+// metrics/arb/cursor_tad_metrics.go.
+const (
+	maxAwaitTimeRatio = 1.0 / 2.0  // maxAwaitTime of a tailable await cursor
+	cursorBlockRatio  = 3.0 / 20.0 // Block time of a failpoint on getMore
+	getMoreBufferDiv  = 70.0       // Fraction of the await window added as a buffer
+)
+
+// Recommendation holds the durations derived from a profile for a target
+// success rate.
+type Recommendation struct {
+	// Target is the requested success rate.
+	Target float64
+
+	// Timeout is the recommended timeoutMS of the operation: the latency at
+	// the target success rate times the headroom.
+	Timeout time.Duration
+
+	// ExpectedSuccessRate is the fraction of the profiled runs that completed
+	// within Timeout, at least Target.
+	ExpectedSuccessRate float64
+
+	// MaxAwaitTime is the maxAwaitTime of a tailable await cursor using
+	// Timeout, half of it so that a getMore with no results returns before
+	// the deadline.
+	MaxAwaitTime time.Duration
+
+	// CursorBlockTime is the block time of a failpoint on getMore that a
+	// cursor using Timeout and MaxAwaitTime tolerates, 15% of Timeout.
+	CursorBlockTime time.Duration
+
+	// GetMoreBound is the longest a getMore is expected to take with
+	// CursorBlockTime: the await window left after the block, plus a buffer
+	// of 1/70 of it.
+	GetMoreBound time.Duration
+
+	// BlockTimeWithin is the longest block time of a failpoint on the
+	// operation that keeps the target success rate, the headroom between
+	// Timeout and the latency at the target. It is 0 without headroom.
+	BlockTimeWithin time.Duration
+
+	// BlockTimeExceed is a block time of a failpoint on the operation that
+	// makes every run time out, since the block alone uses up Timeout.
+	BlockTimeExceed time.Duration
+}
+
+func (r Recommendation) String() string {
+	return fmt.Sprintf("target=%.4g timeoutMS=%d expected_success_rate=%.4g maxAwaitTimeMS=%d cursor_blockTimeMS=%d getMore_bound=%s blockTimeMS_within=%d blockTimeMS_exceed=%d",
+		r.Target, r.Timeout.Milliseconds(), r.ExpectedSuccessRate, r.MaxAwaitTime.Milliseconds(),
+		r.CursorBlockTime.Milliseconds(), r.GetMoreBound, r.BlockTimeWithin.Milliseconds(), r.BlockTimeExceed.Milliseconds())
+}
+
+// Recommend will return the durations for operations profiled by p to succeed
+// at the target rate, in (0,1].
+func Recommend(p Profile, target float64, opts ...ConfigOpt) (Recommendation, error) {
+	cfg := newConfig(opts...)
+
+	if target <= 0 || target > 1 {
+		return Recommendation{}, fmt.Errorf("target success rate %v is not in (0,1]", target)
+	}
+
+	if cfg.headroom < 1 {
+		return Recommendation{}, fmt.Errorf("headroom %v is less than 1", cfg.headroom)
+	}
+
+	if p.Len() == 0 {
+		return Recommendation{}, fmt.Errorf("profile has no samples")
+	}
+
+	latency := p.Quantile(target)
+	timeout := roundUp(time.Duration(float64(latency)*cfg.headroom), cfg.granularity)
+
+	rec := Recommendation{
+		Target:              target,
+		Timeout:             timeout,
+		ExpectedSuccessRate: p.SuccessRate(timeout),
+		BlockTimeWithin:     timeout - roundUp(latency, cfg.granularity),
+		BlockTimeExceed:     timeout,
+	}
+
+	rec.MaxAwaitTime, rec.CursorBlockTime, rec.GetMoreBound = CursorTimes(timeout)
+
+	return rec, nil
+}
+
+// CursorTimes will return the maxAwaitTime of a tailable await cursor whose
+// operations use timeout, the block time of a getMore failpoint the cursor
+// tolerates, and the longest a getMore is then expected to take.
+func CursorTimes(timeout time.Duration) (maxAwaitTime, blockTime, getMoreBound time.Duration) {
+	maxAwaitTime = time.Duration(float64(timeout) * maxAwaitTimeRatio)
+	blockTime = time.Duration(float64(timeout) * cursorBlockRatio)
+
+	window := maxAwaitTime - blockTime
+	getMoreBound = window + time.Duration(float64(window)/getMoreBufferDiv)
+
+	return maxAwaitTime, blockTime, getMoreBound
+}
+
+// FailPoint will return a configureFailPoint command blocking the next times
+// commands with the given names for blockTime, e.g. BlockTimeExceed to force
+// timeouts.
+func FailPoint(blockTime time.Duration, times int, commands ...string) bson.D {
+	return bson.D{
+		{Key: "configureFailPoint", Value: "failCommand"},
+		{Key: "mode", Value: bson.D{{Key: "times", Value: times}}},
+		{Key: "data", Value: bson.D{
+			{Key: "failCommands", Value: commands},
+			{Key: "blockConnection", Value: true},
+			{Key: "blockTimeMS", Value: blockTime.Milliseconds()},
+		}},
+	}
+}
+
+// roundUp will round d up to a multiple of unit.
+func roundUp(d, unit time.Duration) time.Duration {
+	if unit <= 0 {
+		return d
+	}
+
+	if rem := d % unit; rem != 0 {
+		d += unit - rem
+	}
+
+	return d
+}
@@ -0,0 +1,225 @@
+package timeoutsel
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ms will return a profile of latencies given in milliseconds.
+func ms(latencies ...int) Profile {
+	samples := make([]time.Duration, len(latencies))
+	for i, l := range latencies {
+		samples[i] = time.Duration(l) * time.Millisecond
+	}
+
+	return NewProfile(samples)
+}
+
+func TestProfile(t *testing.T) {
+	// 1ms to 100ms, shuffled.
+	latencies := make([]int, 100)
+	for i := range latencies {
+		latencies[i] = (i*37)%100 + 1
+	}
+
+	p := ms(latencies...)
+
+	assert.Equal(t, 100, p.Len())
+	assert.Equal(t, time.Millisecond, p.Min())
+	assert.Equal(t, 100*time.Millisecond, p.Max())
+	assert.Equal(t, 50*time.Millisecond, p.Median())
+	assert.Equal(t, 50500*time.Microsecond, p.Mean())
+	assert.Equal(t, 99*time.Millisecond, p.Quantile(0.99))
+	assert.Equal(t, 91*time.Millisecond, p.Quantile(0.901))
+
+	assert.Equal(t, 0.0, p.SuccessRate(999*time.Microsecond))
+	assert.Equal(t, 0.01, p.SuccessRate(time.Millisecond))
+	assert.Equal(t, 0.99, p.SuccessRate(99*time.Millisecond))
+	assert.Equal(t, 1.0, p.SuccessRate(time.Second))
+}
+
+func TestProfile_Empty(t *testing.T) {
+	var p Profile
+
+	assert.Zero(t, p.Quantile(0.5))
+	assert.Zero(t, p.Mean())
+	assert.Zero(t, p.SuccessRate(time.Second))
+}
+
+func TestNewProfile_CopiesSamples(t *testing.T) {
+	samples := []time.Duration{3, 1, 2}
+
+	p := NewProfile(samples)
+
+	assert.Equal(t, []time.Duration{3, 1, 2}, samples)
+	assert.Equal(t, time.Duration(1), p.Min())
+}
+
+func TestRecommend(t *testing.T) {
+	// Nine fast runs and one slow one.
+	p := ms(10, 10, 10, 10, 10, 10, 10, 10, 12, 400)
+
+	tests := []struct {
+		name   string
+		target float64
+		opts   []ConfigOpt
+		want   Recommendation
+	}{
+		{
+			name:   "p90",
+			target: 0.9,
+			want: Recommendation{
+				Target:              0.9,
+				Timeout:             12 * time.Millisecond,
+				ExpectedSuccessRate: 0.9,
+				MaxAwaitTime:        6 * time.Millisecond,
+				CursorBlockTime:     1800 * time.Microsecond,
+				GetMoreBound:        4260 * time.Millisecond / 1000,
+				BlockTimeWithin:     0,
+				BlockTimeExceed:     12 * time.Millisecond,
+			},
+		},
+		{
+			name:   "p90 with headroom",
+			target: 0.9,
+			opts:   []ConfigOpt{WithHeadroom(1.5)},
+			want: Recommendation{
+				Target:              0.9,
+				Timeout:             18 * time.Millisecond,
+				ExpectedSuccessRate: 0.9,
+				MaxAwaitTime:        9 * time.Millisecond,
+				CursorBlockTime:     2700 * time.Microsecond,
+				GetMoreBound:        6390 * time.Microsecond,
+				BlockTimeWithin:     6 * time.Millisecond,
+				BlockTimeExceed:     18 * time.Millisecond,
+			},
+		},
+		{
+			name:   "every run",
+			target: 1,
+			opts:   []ConfigOpt{WithGranularity(100 * time.Millisecond)},
+			want: Recommendation{
+				Target:              1,
+				Timeout:             400 * time.Millisecond,
+				ExpectedSuccessRate: 1,
+				MaxAwaitTime:        200 * time.Millisecond,
+				CursorBlockTime:     60 * time.Millisecond,
+				GetMoreBound:        142 * time.Millisecond,
+				BlockTimeExceed:     400 * time.Millisecond,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Recommend(p, test.target, test.opts...)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.want, got)
+			assert.GreaterOrEqual(t, got.ExpectedSuccessRate, got.Target)
+		})
+	}
+}
+
+func TestRecommend_RoundsUp(t *testing.T) {
+	p := NewProfile([]time.Duration{10*time.Millisecond + time.Microsecond})
+
+	rec, err := Recommend(p, 1)
+	require.NoError(t, err)
+
+	assert.Equal(t, 11*time.Millisecond, rec.Timeout)
+	assert.Equal(t, 1.0, rec.ExpectedSuccessRate)
+}
+
+func TestRecommend_Invalid(t *testing.T) {
+	p := ms(1, 2, 3)
+
+	_, err := Recommend(p, 0)
+	assert.ErrorContains(t, err, "not in (0,1]")
+
+	_, err = Recommend(p, 1.1)
+	assert.ErrorContains(t, err, "not in (0,1]")
+
+	_, err = Recommend(p, 0.5, WithHeadroom(0.9))
+	assert.ErrorContains(t, err, "headroom")
+
+	_, err = Recommend(Profile{}, 0.5)
+	assert.ErrorContains(t, err, "no samples")
+}
+
+func TestCursorTimes(t *testing.T) {
+	// The values printed by metrics/arb/cursor_tad_metrics.go for 1000.
+	maxAwaitTime, blockTime, getMoreBound := CursorTimes(time.Second)
+
+	assert.Equal(t, 500*time.Millisecond, maxAwaitTime)
+	assert.Equal(t, 150*time.Millisecond, blockTime)
+	assert.Equal(t, int64(355), getMoreBound.Milliseconds())
+	assert.Less(t, getMoreBound, maxAwaitTime)
+}
+
+func TestFailPoint(t *testing.T) {
+	got, err := bson.MarshalExtJSON(FailPoint(250*time.Millisecond, 1, "find"), false, false)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+		"configureFailPoint": "failCommand",
+		"mode": {"times": 1},
+		"data": {
+			"failCommands": ["find"],
+			"blockConnection": true,
+			"blockTimeMS": 250
+		}
+	}`, string(got))
+}
+
+func TestMeasure(t *testing.T) {
+	var calls, running, peak atomic.Int64
+
+	p, err := Measure(context.Background(), func(context.Context) error {
+		calls.Add(1)
+
+		n := running.Add(1)
+		defer running.Add(-1)
+
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond)
+
+		return nil
+	}, WithSamples(40), WithWarmup(8), WithConcurrency(4))
+	require.NoError(t, err)
+
+	assert.Equal(t, 40, p.Len())
+	assert.Equal(t, int64(48), calls.Load())
+	assert.Greater(t, peak.Load(), int64(1), "runs must be concurrent")
+	assert.GreaterOrEqual(t, p.Min(), time.Millisecond)
+}
+
+func TestMeasure_Error(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	var calls atomic.Int64
+
+	_, err := Measure(context.Background(), func(context.Context) error {
+		if calls.Add(1) == 5 {
+			return errBoom
+		}
+
+		return nil
+	}, WithSamples(1000))
+
+	assert.ErrorIs(t, err, errBoom)
+	assert.Equal(t, int64(5), calls.Load(), "measuring stops at the first error")
+}
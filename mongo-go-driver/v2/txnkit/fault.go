@@ -0,0 +1,87 @@
+package txnkit
+
+import (
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Error labels WithTransaction retries on.
+const (
+	TransientTransactionError      = "TransientTransactionError"
+	UnknownTransactionCommitResult = "UnknownTransactionCommitResult"
+)
+
+// Fault is a server error injected into a command.
+type Fault struct {
+	Code     int32
+	CodeName string
+	Labels   []string
+}
+
+// Common faults.
+var (
+	// WriteConflict is what a concurrent transaction writing the same document
+	// causes; the whole transaction can be retried.
+	WriteConflict = Fault{Code: 112, CodeName: "WriteConflict", Labels: []string{TransientTransactionError}}
+
+	// NotWritablePrimary is returned after an election; the whole transaction
+	// can be retried on the new primary.
+	NotWritablePrimary = Fault{Code: 10107, CodeName: "NotWritablePrimary", Labels: []string{TransientTransactionError}}
+
+	// UnknownCommitResult is a commit whose write concern timed out, so it may
+	// or may not have been applied; only the commit is retried.
+	UnknownCommitResult = Fault{Code: 64, CodeName: "WriteConcernFailed", Labels: []string{UnknownTransactionCommitResult}}
+
+	// CommitMaxTimeMSExpired is a commit that ran out of maxTimeMS. It carries
+	// the UnknownTransactionCommitResult label but WithTransaction doesn't
+	// retry it, since retrying with the same time limit would fail again.
+	CommitMaxTimeMSExpired = Fault{Code: 50, CodeName: "MaxTimeMSExpired", Labels: []string{UnknownTransactionCommitResult}}
+
+	// NoSuchTransaction is returned when the server has already aborted the
+	// transaction; it is not retried.
+	NoSuchTransaction = Fault{Code: 251, CodeName: "NoSuchTransaction"}
+)
+
+// Schedule decides the fault, if any, for an attempt counted from 1.
+type Schedule func(attempt int) *Fault
+
+// Fail will return a schedule that fails the first len(faults) attempts with
+// the faults in order and lets later attempts succeed.
+func Fail(faults ...Fault) Schedule {
+	return func(attempt int) *Fault {
+		if attempt > len(faults) {
+			return nil
+		}
+
+		return &faults[attempt-1]
+	}
+}
+
+// FailAlways will return a schedule that fails every attempt with fault.
+func FailAlways(fault Fault) Schedule {
+	return func(int) *Fault {
+		return &fault
+	}
+}
+
+// FailPoint will return the configureFailPoint command that makes a real
+// server return the fault to the next times commands with the given names,
+// for running a scenario against a replica set instead of the mock
+// deployment, e.g.
+//
+//	admin.RunCommand(ctx, txnkit.WriteConflict.FailPoint(1, "insert"))
+func (f Fault) FailPoint(times int, commands ...string) bson.D {
+	data := bson.D{
+		{Key: "failCommands", Value: commands},
+		{Key: "errorCode", Value: f.Code},
+	}
+
+	if len(f.Labels) > 0 {
+		data = append(data, bson.E{Key: "errorLabels", Value: f.Labels})
+	}
+
+	return bson.D{
+		{Key: "configureFailPoint", Value: "failCommand"},
+		{Key: "mode", Value: bson.D{{Key: "times", Value: times}}},
+		{Key: "data", Value: data},
+	}
+}
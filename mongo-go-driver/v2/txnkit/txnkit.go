@@ -0,0 +1,289 @@
+// Package txnkit runs transaction callbacks through mongo.Session's
+// WithTransaction against a mock deployment that injects transaction errors,
+// and reports how the driver retried them.
+//
+//	report := txnkit.Run(t, txnkit.Scenario{
+//		Name:     "write conflict twice",
+//		Callback: txnkit.Fail(txnkit.WriteConflict, txnkit.WriteConflict),
+//	}, func(ctx context.Context, db *mongo.Database) error {
+//		_, err := db.Collection("accounts").InsertOne(ctx, bson.D{})
+//
+//		return err
+//	})
+//
+//	// report.CallbackAttempts == 3, report.Aborts == 2
+package txnkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/prestonvasquez/mongo-go-driver/v2/mockdeploy"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// deadlineGrace is how long past its deadline a scenario may run and
+	// still count as honoring it.
+	deadlineGrace = 100 * time.Millisecond
+
+	// defaultCutoff stops scenarios without a timeout that keep retrying,
+	// since WithTransaction only gives up after 120 seconds.
+	defaultCutoff = 10 * time.Second
+)
+
+// dataCommands are the commands a callback may send. The first one of each
+// callback attempt gets the fault of the Callback schedule.
+var dataCommands = []string{"insert", "update", "delete", "find", "aggregate", "findAndModify"}
+
+// Scenario describes the faults injected into a transaction.
+type Scenario struct {
+	Name string
+
+	// Callback is the fault of the first command sent by each attempt of the
+	// callback. Nil never fails.
+	Callback Schedule
+
+	// Commit is the fault of each commitTransaction. Nil never fails.
+	Commit Schedule
+
+	// Timeout is the deadline of the context passed to WithTransaction, or 0
+	// for none.
+	Timeout time.Duration
+}
+
+// Report is the outcome of a scenario.
+type Report struct {
+	Scenario         string
+	CallbackAttempts int           // Times the callback was called
+	CommitAttempts   int           // commitTransaction commands sent
+	Aborts           int           // abortTransaction commands sent
+	Elapsed          time.Duration // Time spent in WithTransaction
+	Err              error         // Error returned by WithTransaction
+
+	// DeadlineHonored reports whether WithTransaction returned within the
+	// scenario's timeout, give or take 100ms.
+	DeadlineHonored bool
+
+	// CutOff reports whether the kit stopped the driver from retrying by
+	// failing every command without a retryable label, because it ran past
+	// the timeout, or for 10s without one.
+	CutOff bool
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("%s: callback=%d commit=%d aborts=%d elapsed=%s deadline_honored=%t cut_off=%t err=%v",
+		r.Scenario, r.CallbackAttempts, r.CommitAttempts, r.Aborts, r.Elapsed.Round(time.Millisecond),
+		r.DeadlineHonored, r.CutOff, r.Err)
+}
+
+// Run will run fn in WithTransaction against a mock deployment injecting the
+// faults of the scenario and return the report. fn receives the session
+// context and a database on the mock deployment.
+func Run(
+	t testing.TB,
+	scenario Scenario,
+	fn func(ctx context.Context, db *mongo.Database) error,
+	opts ...options.Lister[options.TransactionOptions],
+) Report {
+	t.Helper()
+
+	k := &kit{scenario: scenario, cutoff: defaultCutoff}
+	if scenario.Timeout > 0 {
+		k.cutoff = scenario.Timeout + deadlineGrace
+	}
+
+	d := mockdeploy.New(t)
+
+	for _, name := range dataCommands {
+		d.On(name).ReplyFunc(k.reply).Repeat()
+	}
+
+	d.On("commitTransaction").ReplyFunc(k.commit).Repeat()
+	d.On("abortTransaction").Reply(mockdeploy.OK()).Repeat()
+
+	client, err := d.NewClient()
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	defer func() { _ = client.Disconnect(context.Background()) }()
+
+	db := client.Database("txnkit")
+
+	sess, err := client.StartSession()
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+
+	defer sess.EndSession(context.Background())
+
+	ctx := context.Background()
+
+	if scenario.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, scenario.Timeout)
+		defer cancel()
+	}
+
+	k.start = time.Now()
+
+	_, err = sess.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		k.mu.Lock()
+		k.callbackAttempts++
+		k.faulted = false
+		k.mu.Unlock()
+
+		return nil, fn(ctx, db)
+	}, opts...)
+
+	elapsed := time.Since(k.start)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return Report{
+		Scenario:         scenario.Name,
+		CallbackAttempts: k.callbackAttempts,
+		CommitAttempts:   k.commitAttempts,
+		Aborts:           len(d.CommandsNamed("abortTransaction")),
+		Elapsed:          elapsed,
+		Err:              err,
+		DeadlineHonored:  scenario.Timeout == 0 || elapsed <= scenario.Timeout+deadlineGrace,
+		CutOff:           k.cutOff,
+	}
+}
+
+type kit struct {
+	scenario Scenario
+	cutoff   time.Duration
+	start    time.Time
+
+	mu               sync.Mutex
+	callbackAttempts int
+	commitAttempts   int
+	faulted          bool // The current callback attempt got its fault
+	cutOff           bool
+}
+
+// errCutOff is the reply once a scenario has run for too long. It has no
+// labels, so WithTransaction returns it instead of retrying.
+var errCutOff = mockdeploy.Error(251, "NoSuchTransaction", "txnkit: scenario cut off")
+
+func (k *kit) reply(cmd mockdeploy.Command) bson.D {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.pastCutoff() {
+		return errCutOff
+	}
+
+	if !k.faulted {
+		k.faulted = true
+
+		if fault := k.fault(k.scenario.Callback, k.callbackAttempts); fault != nil {
+			return faultReply(fault)
+		}
+	}
+
+	switch cmd.Name {
+	case "insert":
+		docs, _ := cmd.Document.Lookup("documents").Array().Values()
+
+		return mockdeploy.Inserted(int32(len(docs)))
+	case "update", "delete":
+		return mockdeploy.Write(mockdeploy.WriteResult{N: 1, NModified: 1})
+	case "findAndModify":
+		return mockdeploy.FindAndModify(nil)
+	}
+
+	return mockdeploy.Cursor("txnkit."+cmd.Document.Lookup(cmd.Name).StringValue(), 0)
+}
+
+func (k *kit) commit(mockdeploy.Command) bson.D {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.commitAttempts++
+
+	if k.pastCutoff() {
+		return errCutOff
+	}
+
+	if fault := k.fault(k.scenario.Commit, k.commitAttempts); fault != nil {
+		return faultReply(fault)
+	}
+
+	return mockdeploy.OK()
+}
+
+func (k *kit) pastCutoff() bool {
+	if time.Since(k.start) > k.cutoff {
+		k.cutOff = true
+	}
+
+	return k.cutOff
+}
+
+func (k *kit) fault(schedule Schedule, attempt int) *Fault {
+	if schedule == nil {
+		return nil
+	}
+
+	return schedule(attempt)
+}
+
+func faultReply(f *Fault) bson.D {
+	return mockdeploy.Error(f.Code, f.CodeName, "txnkit: injected "+f.CodeName, f.Labels...)
+}
+
+// WriteReports will write the reports as a table.
+func WriteReports(w io.Writer, reports []Report) {
+	tbl := table.NewWriter()
+	tbl.SetOutputMirror(w)
+
+	tbl.AppendHeader(table.Row{
+		"scenario",
+		"callback",
+		"commit",
+		"aborts",
+		"elapsed",
+		"deadline honored",
+		"cut off",
+		"error",
+	})
+
+	for _, r := range reports {
+		errText := ""
+		if r.Err != nil {
+			errText = r.Err.Error()
+
+			var cmdErr mongo.CommandError
+			if errors.As(r.Err, &cmdErr) {
+				errText = fmt.Sprintf("%s (%d) %v", cmdErr.Name, cmdErr.Code, cmdErr.Labels)
+			}
+		}
+
+		tbl.AppendRow(table.Row{
+			r.Scenario,
+			r.CallbackAttempts,
+			r.CommitAttempts,
+			r.Aborts,
+			r.Elapsed.Round(time.Millisecond),
+			r.DeadlineHonored,
+			r.CutOff,
+			errText,
+		})
+	}
+
+	tbl.Render()
+}
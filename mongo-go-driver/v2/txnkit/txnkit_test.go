@@ -0,0 +1,151 @@
+package txnkit
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func transfer(ctx context.Context, db *mongo.Database) error {
+	accounts := db.Collection("accounts")
+
+	if _, err := accounts.UpdateOne(ctx, bson.D{{Key: "_id", Value: "a"}}, bson.D{{Key: "$inc", Value: bson.D{{Key: "balance", Value: -10}}}}); err != nil {
+		return err
+	}
+
+	_, err := accounts.UpdateOne(ctx, bson.D{{Key: "_id", Value: "b"}}, bson.D{{Key: "$inc", Value: bson.D{{Key: "balance", Value: 10}}}})
+
+	return err
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		scenario Scenario
+		want     Report // Err is compared by code
+		wantCode int32
+	}{
+		{
+			scenario: Scenario{Name: "no faults"},
+			want:     Report{CallbackAttempts: 1, CommitAttempts: 1},
+		},
+		{
+			scenario: Scenario{Name: "write conflicts", Callback: Fail(WriteConflict, WriteConflict)},
+			want:     Report{CallbackAttempts: 3, CommitAttempts: 1, Aborts: 2},
+		},
+		{
+			scenario: Scenario{Name: "election", Callback: Fail(NotWritablePrimary)},
+			want:     Report{CallbackAttempts: 2, CommitAttempts: 1, Aborts: 1},
+		},
+		{
+			scenario: Scenario{Name: "unknown commit result", Commit: Fail(UnknownCommitResult, UnknownCommitResult)},
+			want:     Report{CallbackAttempts: 1, CommitAttempts: 3},
+		},
+		{
+			scenario: Scenario{
+				Name:   "transient commit error",
+				Commit: Fail(Fault{Code: 112, CodeName: "WriteConflict", Labels: []string{TransientTransactionError}}),
+			},
+			want: Report{CallbackAttempts: 2, CommitAttempts: 2},
+		},
+		{
+			scenario: Scenario{Name: "commit maxTimeMS", Commit: Fail(CommitMaxTimeMSExpired)},
+			want:     Report{CallbackAttempts: 1, CommitAttempts: 1},
+			wantCode: 50,
+		},
+		{
+			scenario: Scenario{Name: "no such transaction", Callback: Fail(NoSuchTransaction)},
+			want:     Report{CallbackAttempts: 1, Aborts: 1},
+			wantCode: 251,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario.Name, func(t *testing.T) {
+			report := Run(t, test.scenario, transfer)
+
+			assert.Equal(t, test.scenario.Name, report.Scenario)
+			assert.Equal(t, test.want.CallbackAttempts, report.CallbackAttempts, "callback attempts")
+			assert.Equal(t, test.want.CommitAttempts, report.CommitAttempts, "commit attempts")
+			assert.Equal(t, test.want.Aborts, report.Aborts, "aborts")
+			assert.True(t, report.DeadlineHonored)
+			assert.False(t, report.CutOff)
+
+			if test.wantCode == 0 {
+				assert.NoError(t, report.Err)
+
+				return
+			}
+
+			var cmdErr mongo.CommandError
+			require.ErrorAs(t, report.Err, &cmdErr)
+			assert.Equal(t, test.wantCode, cmdErr.Code)
+		})
+	}
+}
+
+func TestRun_DeadlineDuringCallbackRetries(t *testing.T) {
+	report := Run(t, Scenario{
+		Name:     "write conflicts until the deadline",
+		Callback: FailAlways(WriteConflict),
+		Timeout:  100 * time.Millisecond,
+	}, transfer)
+
+	require.Error(t, report.Err)
+
+	assert.Greater(t, report.CallbackAttempts, 1)
+	assert.Zero(t, report.CommitAttempts)
+	assert.True(t, report.DeadlineHonored, "callback retries stop at the deadline: %s", report)
+}
+
+func TestRun_DeadlineDuringCommitRetries(t *testing.T) {
+	report := Run(t, Scenario{
+		Name:    "unknown commit result until the deadline",
+		Commit:  FailAlways(UnknownCommitResult),
+		Timeout: 100 * time.Millisecond,
+	}, transfer)
+
+	// WithTransaction commits with a context that ignores the deadline, so
+	// only the cut off ends the retries.
+	assert.True(t, report.CutOff, "%s", report)
+	assert.Greater(t, report.CommitAttempts, 1)
+
+	var cmdErr mongo.CommandError
+	require.ErrorAs(t, report.Err, &cmdErr)
+	assert.Equal(t, int32(251), cmdErr.Code)
+}
+
+func TestFailPoint(t *testing.T) {
+	got, err := bson.MarshalExtJSON(WriteConflict.FailPoint(2, "insert", "update"), false, false)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+		"configureFailPoint": "failCommand",
+		"mode": {"times": 2},
+		"data": {
+			"failCommands": ["insert", "update"],
+			"errorCode": 112,
+			"errorLabels": ["TransientTransactionError"]
+		}
+	}`, string(got))
+}
+
+func TestWriteReports(t *testing.T) {
+	var buf bytes.Buffer
+
+	WriteReports(&buf, []Report{
+		Run(t, Scenario{Name: "no faults"}, transfer),
+		Run(t, Scenario{Name: "no such transaction", Callback: Fail(NoSuchTransaction)}, transfer),
+	})
+
+	out := buf.String()
+
+	assert.Contains(t, out, "DEADLINE HONORED")
+	assert.Contains(t, out, "no faults")
+	assert.Contains(t, out, "NoSuchTransaction (251)")
+}
@@ -0,0 +1,186 @@
+// Package typedcoll wraps a mongo.Collection so that reads and writes are in
+// terms of a Go type instead of cursors and Decode calls.
+//
+//	users := typedcoll.New[User](db.Collection("users"))
+//
+//	for user, err := range users.Iterate(ctx, bson.D{{Key: "active", Value: true}}) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+package typedcoll
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// TypedCollection is a collection of documents decoded into T.
+type TypedCollection[T any] struct {
+	coll *mongo.Collection
+}
+
+// New will return a typed view of coll. Documents are decoded into T with the
+// collection's registry.
+func New[T any](coll *mongo.Collection) *TypedCollection[T] {
+	return &TypedCollection[T]{coll: coll}
+}
+
+// Collection will return the underlying collection, for operations this
+// package doesn't wrap.
+func (c *TypedCollection[T]) Collection() *mongo.Collection {
+	return c.coll
+}
+
+// Find will return every document matching filter.
+func (c *TypedCollection[T]) Find(
+	ctx context.Context,
+	filter any,
+	opts ...options.Lister[options.FindOptions],
+) ([]T, error) {
+	cursor, err := c.coll.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find: %w", err)
+	}
+
+	docs := []T{}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	return docs, nil
+}
+
+// FindOne will return the first document matching filter. The error wraps
+// mongo.ErrNoDocuments when nothing matches.
+func (c *TypedCollection[T]) FindOne(
+	ctx context.Context,
+	filter any,
+	opts ...options.Lister[options.FindOneOptions],
+) (T, error) {
+	var doc T
+
+	if err := c.coll.FindOne(ctx, filter, opts...).Decode(&doc); err != nil {
+		return doc, fmt.Errorf("failed to find one: %w", err)
+	}
+
+	return doc, nil
+}
+
+// InsertMany will insert docs and return the _id of each, in order.
+func (c *TypedCollection[T]) InsertMany(
+	ctx context.Context,
+	docs []T,
+	opts ...options.Lister[options.InsertManyOptions],
+) ([]any, error) {
+	res, err := c.coll.InsertMany(ctx, docs, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert documents: %w", err)
+	}
+
+	return res.InsertedIDs, nil
+}
+
+// ReplaceOne will replace the first document matching filter with doc.
+func (c *TypedCollection[T]) ReplaceOne(
+	ctx context.Context,
+	filter any,
+	doc T,
+	opts ...options.Lister[options.ReplaceOptions],
+) (*mongo.UpdateResult, error) {
+	res, err := c.coll.ReplaceOne(ctx, filter, doc, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replace document: %w", err)
+	}
+
+	return res, nil
+}
+
+// Iterate will return an iterator over the documents matching filter. Errors
+// from the query, decoding or getMore are yielded with a zero T, after which
+// iteration stops. The cursor is closed when the loop ends, including on
+// break.
+func (c *TypedCollection[T]) Iterate(
+	ctx context.Context,
+	filter any,
+	opts ...options.Lister[options.FindOptions],
+) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		cursor, err := c.coll.Find(ctx, filter, opts...)
+		if err != nil {
+			yield(zero, fmt.Errorf("failed to find: %w", err))
+
+			return
+		}
+
+		// Close even when ctx is done, e.g. by a Stream caller that stopped
+		// early, so that the server cursor is killed.
+		defer cursor.Close(context.WithoutCancel(ctx))
+
+		for cursor.Next(ctx) {
+			var doc T
+			if err := cursor.Decode(&doc); err != nil {
+				yield(zero, fmt.Errorf("failed to decode document: %w", err))
+
+				return
+			}
+
+			if !yield(doc, nil) {
+				return
+			}
+		}
+
+		if err := cursor.Err(); err != nil {
+			yield(zero, fmt.Errorf("failed to iterate cursor: %w", err))
+		}
+	}
+}
+
+// Stream will send the documents matching filter on the returned channel from
+// a new goroutine. The channel is closed when the cursor is exhausted, on the
+// first error or when ctx is done; wait then returns the error, if any.
+// Callers that stop reading early must cancel ctx so the goroutine can exit.
+func (c *TypedCollection[T]) Stream(
+	ctx context.Context,
+	filter any,
+	opts ...options.Lister[options.FindOptions],
+) (docs <-chan T, wait func() error) {
+	ch := make(chan T)
+	done := make(chan struct{})
+
+	var streamErr error
+
+	go func() {
+		defer close(done)
+		defer close(ch)
+
+		for doc, err := range c.Iterate(ctx, filter, opts...) {
+			if err != nil {
+				streamErr = err
+
+				return
+			}
+
+			select {
+			case ch <- doc:
+			case <-ctx.Done():
+				streamErr = ctx.Err()
+
+				return
+			}
+		}
+	}()
+
+	return ch, func() error {
+		<-done
+
+		return streamErr
+	}
+}
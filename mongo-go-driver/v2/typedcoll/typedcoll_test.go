@@ -0,0 +1,273 @@
+package typedcoll
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prestonvasquez/mongo-go-driver/v2/mockdeploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+type user struct {
+	ID   int32  `bson:"_id"`
+	Name string `bson:"name"`
+}
+
+func newUsers(t *testing.T) (*mockdeploy.Deployment, *TypedCollection[user]) {
+	t.Helper()
+
+	d := mockdeploy.New(t)
+
+	client, err := d.NewClient()
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+
+	return d, New[user](client.Database("db").Collection("users"))
+}
+
+func userDoc(id int32, name string) bson.D {
+	return bson.D{{Key: "_id", Value: id}, {Key: "name", Value: name}}
+}
+
+func TestFind(t *testing.T) {
+	d, users := newUsers(t)
+
+	d.On("find").Reply(mockdeploy.Cursor("db.users", 7, userDoc(1, "ada")))
+	d.On("getMore").Reply(mockdeploy.NextBatch("db.users", 0, userDoc(2, "grace")))
+
+	got, err := users.Find(context.Background(), bson.D{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []user{{ID: 1, Name: "ada"}, {ID: 2, Name: "grace"}}, got)
+
+	d.Verify()
+}
+
+func TestFind_Empty(t *testing.T) {
+	d, users := newUsers(t)
+
+	d.On("find").Reply(mockdeploy.Cursor("db.users", 0))
+
+	got, err := users.Find(context.Background(), bson.D{})
+	require.NoError(t, err)
+
+	assert.NotNil(t, got)
+	assert.Empty(t, got)
+}
+
+func TestFindOne(t *testing.T) {
+	d, users := newUsers(t)
+
+	d.On("find").Where(mockdeploy.Filter("_id", 1)).Reply(mockdeploy.Cursor("db.users", 0, userDoc(1, "ada")))
+	d.On("find").Reply(mockdeploy.Cursor("db.users", 0))
+
+	got, err := users.FindOne(context.Background(), bson.D{{Key: "_id", Value: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, user{ID: 1, Name: "ada"}, got)
+
+	_, err = users.FindOne(context.Background(), bson.D{{Key: "_id", Value: 2}})
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+}
+
+func TestInsertMany(t *testing.T) {
+	d, users := newUsers(t)
+
+	d.On("insert").Reply(mockdeploy.Inserted(2))
+
+	ids, err := users.InsertMany(context.Background(), []user{{ID: 1, Name: "ada"}, {ID: 2, Name: "grace"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []any{int32(1), int32(2)}, ids)
+
+	inserts := d.CommandsNamed("insert")
+	require.Len(t, inserts, 1)
+
+	docs, err := inserts[0].Document.Lookup("documents").Array().Values()
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+
+	assert.Equal(t, "grace", docs[1].Document().Lookup("name").StringValue())
+}
+
+func TestReplaceOne(t *testing.T) {
+	d, users := newUsers(t)
+
+	d.On("update").Reply(mockdeploy.Write(mockdeploy.WriteResult{N: 1, NModified: 1}))
+
+	res, err := users.ReplaceOne(context.Background(), bson.D{{Key: "_id", Value: 1}}, user{ID: 1, Name: "ada"})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1), res.ModifiedCount)
+
+	updates := d.CommandsNamed("update")
+	require.Len(t, updates, 1)
+
+	replacement := updates[0].Document.Lookup("updates", "0", "u").Document()
+	assert.Equal(t, "ada", replacement.Lookup("name").StringValue())
+}
+
+func TestReplaceOne_Error(t *testing.T) {
+	d, users := newUsers(t)
+
+	d.On("update").Reply(mockdeploy.Error(13, "Unauthorized", "not authorized"))
+
+	_, err := users.ReplaceOne(context.Background(), bson.D{}, user{})
+
+	var cmdErr mongo.CommandError
+	require.True(t, errors.As(err, &cmdErr))
+	assert.Equal(t, int32(13), cmdErr.Code)
+}
+
+func TestIterate(t *testing.T) {
+	d, users := newUsers(t)
+
+	d.On("find").Reply(mockdeploy.Cursor("db.users", 7, userDoc(1, "ada"), userDoc(2, "grace")))
+	d.On("getMore").Reply(mockdeploy.NextBatch("db.users", 0, userDoc(3, "barbara")))
+
+	var names []string
+
+	for u, err := range users.Iterate(context.Background(), bson.D{}) {
+		require.NoError(t, err)
+
+		names = append(names, u.Name)
+	}
+
+	assert.Equal(t, []string{"ada", "grace", "barbara"}, names)
+}
+
+func TestIterate_BreakClosesCursor(t *testing.T) {
+	d, users := newUsers(t)
+
+	d.On("find").Reply(mockdeploy.Cursor("db.users", 7, userDoc(1, "ada"), userDoc(2, "grace")))
+	d.On("killCursors").Reply(mockdeploy.OK())
+
+	for range users.Iterate(context.Background(), bson.D{}) {
+		break
+	}
+
+	assert.Len(t, d.CommandsNamed("getMore"), 0)
+	assert.Len(t, d.CommandsNamed("killCursors"), 1)
+}
+
+func TestIterate_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(d *mockdeploy.Deployment)
+		want  string
+	}{
+		{
+			name: "find",
+			setup: func(d *mockdeploy.Deployment) {
+				d.On("find").Reply(mockdeploy.Error(2, "BadValue", "bad filter"))
+			},
+			want: "failed to find",
+		},
+		{
+			name: "decode",
+			setup: func(d *mockdeploy.Deployment) {
+				d.On("find").Reply(mockdeploy.Cursor("db.users", 0, bson.D{{Key: "name", Value: 1}}))
+			},
+			want: "failed to decode document",
+		},
+		{
+			name: "getMore",
+			setup: func(d *mockdeploy.Deployment) {
+				d.On("find").Reply(mockdeploy.Cursor("db.users", 7, userDoc(1, "ada")))
+				d.On("getMore").Reply(mockdeploy.Error(43, "CursorNotFound", "cursor id 7 not found"))
+				d.On("killCursors").Reply(mockdeploy.OK())
+			},
+			want: "failed to iterate cursor",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, users := newUsers(t)
+			test.setup(d)
+
+			var errs []error
+
+			for _, err := range users.Iterate(context.Background(), bson.D{}) {
+				if err != nil {
+					errs = append(errs, err)
+				}
+			}
+
+			require.Len(t, errs, 1)
+			assert.ErrorContains(t, errs[0], test.want)
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	d, users := newUsers(t)
+
+	d.On("find").Reply(mockdeploy.Cursor("db.users", 7, userDoc(1, "ada")))
+	d.On("getMore").Reply(mockdeploy.NextBatch("db.users", 0, userDoc(2, "grace")))
+
+	docs, wait := users.Stream(context.Background(), bson.D{})
+
+	var got []user
+	for doc := range docs {
+		got = append(got, doc)
+	}
+
+	require.NoError(t, wait())
+	assert.Equal(t, []user{{ID: 1, Name: "ada"}, {ID: 2, Name: "grace"}}, got)
+}
+
+func TestStream_Error(t *testing.T) {
+	d, users := newUsers(t)
+
+	d.On("find").Reply(mockdeploy.Cursor("db.users", 7, userDoc(1, "ada")))
+	d.On("getMore").Reply(mockdeploy.Error(43, "CursorNotFound", "cursor id 7 not found"))
+	d.On("killCursors").Reply(mockdeploy.OK())
+
+	docs, wait := users.Stream(context.Background(), bson.D{})
+
+	var got []user
+	for doc := range docs {
+		got = append(got, doc)
+	}
+
+	assert.Len(t, got, 1)
+	assert.ErrorContains(t, wait(), "failed to iterate cursor")
+}
+
+func TestStream_Cancel(t *testing.T) {
+	d, users := newUsers(t)
+
+	d.On("find").Reply(mockdeploy.Cursor("db.users", 0, userDoc(1, "ada"), userDoc(2, "grace")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	docs, wait := users.Stream(ctx, bson.D{})
+
+	<-docs
+	cancel()
+
+	assert.ErrorIs(t, wait(), context.Canceled)
+}
+
+func TestStream_CancelKillsCursor(t *testing.T) {
+	d, users := newUsers(t)
+
+	// The server cursor stays open after the first batch.
+	d.On("find").Reply(mockdeploy.Cursor("db.users", 7, userDoc(1, "ada"), userDoc(2, "grace")))
+	d.On("killCursors").Reply(mockdeploy.OK())
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	docs, wait := users.Stream(ctx, bson.D{})
+
+	<-docs
+	cancel()
+
+	assert.ErrorIs(t, wait(), context.Canceled)
+	assert.Len(t, d.CommandsNamed("killCursors"), 1, "a cancelled stream must still kill its cursor")
+}
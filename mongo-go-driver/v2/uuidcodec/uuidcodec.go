@@ -0,0 +1,237 @@
+// Package uuidcodec encodes and decodes github.com/google/uuid values in the
+// representations used by MongoDB drivers over time.
+//
+// New data should use the standard representation, binary subtype 4. Data
+// written by the legacy Java, C# and Python drivers uses binary subtype 3 with
+// a driver-specific byte order, and some services store UUIDs as strings. A
+// codec decodes all of them, as long as it is told which byte order subtype 3
+// data was written with, so that services migrating from other drivers can
+// read existing data while writing in the representation of their choosing.
+package uuidcodec
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Representation is how a UUID is stored in BSON.
+type Representation int
+
+const (
+	// Standard is binary subtype 4 in network byte order.
+	Standard Representation = iota
+
+	// JavaLegacy is binary subtype 3 with each half of the UUID in reverse
+	// byte order, as written by the legacy Java driver.
+	JavaLegacy
+
+	// CSharpLegacy is binary subtype 3 with the first three groups of the
+	// UUID in little-endian byte order, as written by the legacy C# driver.
+	CSharpLegacy
+
+	// PythonLegacy is binary subtype 3 in network byte order, as written by
+	// the legacy Python driver.
+	PythonLegacy
+
+	// String is the hyphenated string form, e.g.
+	// "00112233-4455-6677-8899-aabbccddeeff".
+	String
+)
+
+func (rep Representation) String() string {
+	switch rep {
+	case Standard:
+		return "standard"
+	case JavaLegacy:
+		return "javaLegacy"
+	case CSharpLegacy:
+		return "csharpLegacy"
+	case PythonLegacy:
+		return "pythonLegacy"
+	case String:
+		return "string"
+	}
+
+	return fmt.Sprintf("Representation(%d)", int(rep))
+}
+
+func (rep Representation) legacy() bool {
+	return rep == JavaLegacy || rep == CSharpLegacy || rep == PythonLegacy
+}
+
+var tUUID = reflect.TypeOf(uuid.UUID{})
+
+// Codec is a bson.ValueEncoder and bson.ValueDecoder for uuid.UUID.
+type Codec struct {
+	encodeAs Representation // Representation written
+	legacy   Representation // Byte order of subtype 3 data, if a legacy representation
+}
+
+var (
+	_ bson.ValueEncoder = &Codec{}
+	_ bson.ValueDecoder = &Codec{}
+)
+
+// New will return a codec that encodes UUIDs in the given representation.
+// When rep is a legacy representation, subtype 3 data is decoded with its
+// byte order; otherwise subtype 3 data is rejected since its byte order is
+// unknown. Use NewWithLegacy to write one representation and read another.
+func New(rep Representation) *Codec {
+	return &Codec{encodeAs: rep, legacy: rep}
+}
+
+// NewWithLegacy will return a codec that encodes UUIDs in the given
+// representation and decodes subtype 3 data with the byte order of legacy,
+// e.g. to write subtype 4 while still reading documents written by the legacy
+// Java driver.
+func NewWithLegacy(rep, legacy Representation) (*Codec, error) {
+	if !legacy.legacy() {
+		return nil, fmt.Errorf("%v is not a legacy representation", legacy)
+	}
+
+	return &Codec{encodeAs: rep, legacy: legacy}, nil
+}
+
+// Register will register the codec for uuid.UUID with the registry. Pointers
+// to UUIDs are handled by the registry's pointer codec.
+func Register(reg *bson.Registry, codec *Codec) {
+	reg.RegisterTypeEncoder(tUUID, codec)
+	reg.RegisterTypeDecoder(tUUID, codec)
+}
+
+// NewRegistry will return the default registry with the codec registered,
+// suitable for options.Client().SetRegistry.
+func NewRegistry(codec *Codec) *bson.Registry {
+	reg := bson.NewRegistry()
+	Register(reg, codec)
+
+	return reg
+}
+
+// EncodeValue implements the bson.ValueEncoder interface.
+func (c *Codec) EncodeValue(_ bson.EncodeContext, vw bson.ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Type() != tUUID {
+		return bson.ValueEncoderError{Name: "uuidcodec.EncodeValue", Types: []reflect.Type{tUUID}, Received: val}
+	}
+
+	id := val.Interface().(uuid.UUID)
+
+	switch c.encodeAs {
+	case Standard:
+		return vw.WriteBinaryWithSubtype(id[:], bson.TypeBinaryUUID)
+	case JavaLegacy, CSharpLegacy, PythonLegacy:
+		return vw.WriteBinaryWithSubtype(toLegacy(id, c.encodeAs), bson.TypeBinaryUUIDOld)
+	case String:
+		return vw.WriteString(id.String())
+	}
+
+	return fmt.Errorf("unsupported UUID representation %v", c.encodeAs)
+}
+
+// DecodeValue implements the bson.ValueDecoder interface. Subtype 4 and
+// strings are always accepted, null and undefined decode to the zero UUID.
+func (c *Codec) DecodeValue(_ bson.DecodeContext, vr bson.ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Type() != tUUID {
+		return bson.ValueDecoderError{Name: "uuidcodec.DecodeValue", Types: []reflect.Type{tUUID}, Received: val}
+	}
+
+	var id uuid.UUID
+
+	switch vrType := vr.Type(); vrType {
+	case bson.TypeBinary:
+		data, subtype, err := vr.ReadBinary()
+		if err != nil {
+			return err
+		}
+
+		id, err = c.fromBinary(data, subtype)
+		if err != nil {
+			return err
+		}
+	case bson.TypeString:
+		str, err := vr.ReadString()
+		if err != nil {
+			return err
+		}
+
+		id, err = uuid.Parse(str)
+		if err != nil {
+			return fmt.Errorf("failed to parse UUID string: %w", err)
+		}
+	case bson.TypeNull:
+		if err := vr.ReadNull(); err != nil {
+			return err
+		}
+	case bson.TypeUndefined:
+		if err := vr.ReadUndefined(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("cannot decode %v into a UUID", vrType)
+	}
+
+	val.Set(reflect.ValueOf(id))
+
+	return nil
+}
+
+func (c *Codec) fromBinary(data []byte, subtype byte) (uuid.UUID, error) {
+	if len(data) != 16 {
+		return uuid.UUID{}, fmt.Errorf("UUID must be 16 bytes, got %d", len(data))
+	}
+
+	switch subtype {
+	case bson.TypeBinaryUUID:
+		return uuid.UUID(data), nil
+	case bson.TypeBinaryUUIDOld:
+		if !c.legacy.legacy() {
+			return uuid.UUID{}, errors.New("cannot decode binary subtype 3 UUID without a legacy representation")
+		}
+
+		return fromLegacy(data, c.legacy), nil
+	}
+
+	return uuid.UUID{}, fmt.Errorf("unsupported binary subtype %v for UUID", subtype)
+}
+
+// toLegacy will return the bytes of id in the byte order of the legacy
+// representation.
+func toLegacy(id uuid.UUID, rep Representation) []byte {
+	b := make([]byte, 16)
+	copy(b, id[:])
+
+	switch rep {
+	case JavaLegacy:
+		reverse(b[0:8])
+		reverse(b[8:16])
+	case CSharpLegacy:
+		reverse(b[0:4])
+		reverse(b[4:6])
+		reverse(b[6:8])
+	}
+
+	return b
+}
+
+// fromLegacy will return the UUID stored in data in the byte order of the
+// legacy representation. Each byte order is its own inverse.
+func fromLegacy(data []byte, rep Representation) uuid.UUID {
+	return uuid.UUID(toLegacy(uuid.UUID(data), rep))
+}
+
+func reverse(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
+
+// ExtJSON will return the Extended JSON $uuid form of id, e.g.
+// {"$uuid":"00112233-4455-6677-8899-aabbccddeeff"}. Extended JSON readers,
+// including bson.UnmarshalExtJSON, read it as binary subtype 4.
+func ExtJSON(id uuid.UUID) string {
+	return `{"$uuid":"` + id.String() + `"}`
+}
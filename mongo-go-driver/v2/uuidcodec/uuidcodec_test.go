@@ -0,0 +1,155 @@
+package uuidcodec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// testUUID and its legacy encodings are the examples from the UUID
+// specification.
+var testUUID = uuid.MustParse("00112233-4455-6677-8899-aabbccddeeff")
+
+type record struct {
+	ID    uuid.UUID  `bson:"id"`
+	Maybe *uuid.UUID `bson:"maybe"`
+}
+
+func marshal(t *testing.T, codec *Codec, val any) bson.Raw {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+
+	enc := bson.NewEncoder(bson.NewDocumentWriter(buf))
+	enc.SetRegistry(NewRegistry(codec))
+
+	require.NoError(t, enc.Encode(val))
+
+	return buf.Bytes()
+}
+
+func unmarshal(t *testing.T, codec *Codec, raw bson.Raw, val any) error {
+	t.Helper()
+
+	dec := bson.NewDecoder(bson.NewDocumentReader(bytes.NewReader(raw)))
+	dec.SetRegistry(NewRegistry(codec))
+
+	return dec.Decode(val)
+}
+
+func TestCodec_Encode(t *testing.T) {
+	tests := []struct {
+		rep     Representation
+		subtype byte
+		base64  string
+	}{
+		{rep: Standard, subtype: 4, base64: "ABEiM0RVZneImaq7zN3u/w=="},
+		{rep: JavaLegacy, subtype: 3, base64: "d2ZVRDMiEQD/7t3Mu6qZiA=="},
+		{rep: CSharpLegacy, subtype: 3, base64: "MyIRAFVEd2aImaq7zN3u/w=="},
+		{rep: PythonLegacy, subtype: 3, base64: "ABEiM0RVZneImaq7zN3u/w=="},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rep.String(), func(t *testing.T) {
+			raw := marshal(t, New(test.rep), record{ID: testUUID})
+
+			subtype, data := raw.Lookup("id").Binary()
+			assert.Equal(t, test.subtype, subtype)
+			assert.Equal(t, test.base64, base64.StdEncoding.EncodeToString(data))
+
+			var got record
+			require.NoError(t, unmarshal(t, New(test.rep), raw, &got))
+			assert.Equal(t, testUUID, got.ID)
+		})
+	}
+}
+
+func TestCodec_String(t *testing.T) {
+	raw := marshal(t, New(String), record{ID: testUUID, Maybe: &testUUID})
+
+	assert.Equal(t, testUUID.String(), raw.Lookup("id").StringValue())
+	assert.Equal(t, testUUID.String(), raw.Lookup("maybe").StringValue())
+
+	var got record
+	require.NoError(t, unmarshal(t, New(Standard), raw, &got), "strings are always accepted")
+
+	assert.Equal(t, testUUID, got.ID)
+	require.NotNil(t, got.Maybe)
+	assert.Equal(t, testUUID, *got.Maybe)
+}
+
+func TestCodec_MigrateFromLegacy(t *testing.T) {
+	legacy := marshal(t, New(JavaLegacy), record{ID: testUUID})
+
+	var got record
+	err := unmarshal(t, New(Standard), legacy, &got)
+	assert.ErrorContains(t, err, "without a legacy representation")
+
+	codec, err := NewWithLegacy(Standard, JavaLegacy)
+	require.NoError(t, err)
+
+	require.NoError(t, unmarshal(t, codec, legacy, &got))
+	assert.Equal(t, testUUID, got.ID)
+
+	subtype, _ := marshal(t, codec, got).Lookup("id").Binary()
+	assert.Equal(t, bson.TypeBinaryUUID, subtype, "written back as subtype 4")
+
+	_, err = NewWithLegacy(Standard, String)
+	assert.Error(t, err)
+}
+
+func TestCodec_Null(t *testing.T) {
+	raw, err := bson.Marshal(bson.D{{Key: "id", Value: nil}})
+	require.NoError(t, err)
+
+	got := record{ID: testUUID}
+	require.NoError(t, unmarshal(t, New(Standard), raw, &got))
+
+	assert.Equal(t, uuid.UUID{}, got.ID)
+}
+
+func TestCodec_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		val  any
+		want string
+	}{
+		{name: "wrong type", val: int32(1), want: "cannot decode 32-bit integer into a UUID"},
+		{name: "wrong subtype", val: bson.Binary{Subtype: 0, Data: testUUID[:]}, want: "unsupported binary subtype"},
+		{name: "wrong length", val: bson.Binary{Subtype: 4, Data: []byte{1}}, want: "must be 16 bytes"},
+		{name: "bad string", val: "not-a-uuid", want: "failed to parse UUID string"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			raw, err := bson.Marshal(bson.D{{Key: "id", Value: test.val}})
+			require.NoError(t, err)
+
+			var got record
+			assert.ErrorContains(t, unmarshal(t, New(Standard), raw, &got), test.want)
+		})
+	}
+}
+
+func TestExtJSON(t *testing.T) {
+	assert.Equal(t, `{"$uuid":"00112233-4455-6677-8899-aabbccddeeff"}`, ExtJSON(testUUID))
+
+	for _, rep := range []Representation{Standard, String} {
+		t.Run(rep.String(), func(t *testing.T) {
+			vr, err := bson.NewExtJSONValueReader(bytes.NewReader([]byte(`{"id":`+ExtJSON(testUUID)+`}`)), true)
+			require.NoError(t, err)
+
+			dec := bson.NewDecoder(vr)
+			dec.SetRegistry(NewRegistry(New(rep)))
+
+			var got record
+			require.NoError(t, dec.Decode(&got))
+			assert.Equal(t, testUUID, got.ID)
+		})
+	}
+}